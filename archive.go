@@ -0,0 +1,192 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack"
+)
+
+// archiveMagic is written at the beginning of an archive created by Backup.
+var archiveMagic = []byte("OLRICARC")
+
+// archiveVersion is the version of the archive format.
+const archiveVersion = 1
+
+// ErrInvalidArchive is returned by Restore if the given archive is corrupted
+// or created by an unknown version.
+var ErrInvalidArchive = errors.New("invalid archive")
+
+type archiveHeader struct {
+	Version     int
+	DMapConfigs map[string]config.DMapCacheConfig
+}
+
+// archiveChunk keeps the key/value pairs of a DMap on a partition.
+type archiveChunk struct {
+	Name    string
+	Entries []storage.VData
+}
+
+// collectPartition returns the DMaps on a primary partition from its owner.
+func (db *Olric) collectPartition(partID uint64) ([]*dmapbox, error) {
+	part := db.partitions[partID]
+	owner := part.owner()
+	if hostCmp(owner, db.this) {
+		return db.exportPartition(part), nil
+	}
+	req := &protocol.Message{
+		Extra: protocol.SyncBackupExtra{
+			PartID: partID,
+		},
+	}
+	resp, err := db.requestTo(owner.String(), protocol.OpSyncBackup, req)
+	if err != nil {
+		return nil, err
+	}
+	var boxes []*dmapbox
+	err = msgpack.Unmarshal(resp.Value, &boxes)
+	return boxes, err
+}
+
+// Backup writes all the DMaps on the cluster into w. The archive includes
+// the DMap names, the key/value pairs with their timestamps and TTLs, and
+// the per-DMap cache configurations of this node. Expired keys are skipped.
+// Use Restore to load the archive into a cluster which uses the same serializer.
+func (db *Olric) Backup(w io.Writer) error {
+	if err := db.checkOperationStatus(); err != nil {
+		return err
+	}
+	if _, err := w.Write(archiveMagic); err != nil {
+		return err
+	}
+
+	enc := msgpack.NewEncoder(w)
+	header := &archiveHeader{
+		Version: archiveVersion,
+	}
+	if db.config.Cache != nil {
+		header.DMapConfigs = db.config.Cache.DMapConfigs
+	}
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		boxes, err := db.collectPartition(partID)
+		if err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("failed to collect PartID: %d", partID))
+		}
+		for _, box := range boxes {
+			str, err := storage.Import(box.Payload)
+			if err != nil {
+				return err
+			}
+			chunk := &archiveChunk{Name: box.Name}
+			str.Range(func(hkey uint64, vdata *storage.VData) bool {
+				if !isKeyExpired(vdata.TTL) {
+					chunk.Entries = append(chunk.Entries, *vdata)
+				}
+				return true
+			})
+			if len(chunk.Entries) == 0 {
+				continue
+			}
+			if err = enc.Encode(chunk); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Restore loads an archive created by Backup. The keys are distributed
+// according to the partition layout of this cluster. The existing keys are
+// overwritten. The cache configurations in the archive are not applied,
+// a warning is logged if they differ.
+func (db *Olric) Restore(r io.Reader) error {
+	if err := db.checkOperationStatus(); err != nil {
+		return err
+	}
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return errors.WithMessage(ErrInvalidArchive, err.Error())
+	}
+	if !bytes.Equal(magic, archiveMagic) {
+		return ErrInvalidArchive
+	}
+
+	dec := msgpack.NewDecoder(r)
+	header := &archiveHeader{}
+	if err := dec.Decode(header); err != nil {
+		return errors.WithMessage(ErrInvalidArchive, err.Error())
+	}
+	if header.Version != archiveVersion {
+		return errors.WithMessage(ErrInvalidArchive,
+			fmt.Sprintf("unknown archive version: %d", header.Version))
+	}
+	for name, cfg := range header.DMapConfigs {
+		var current config.DMapCacheConfig
+		if db.config.Cache != nil {
+			current = db.config.Cache.DMapConfigs[name]
+		}
+		// Functions are not archived.
+		current.MergeFunc = nil
+		if !reflect.DeepEqual(current, cfg) {
+			db.log.V(2).Printf("[WARN] Cache configuration of DMap: %s differs from the archive", name)
+		}
+	}
+
+	for {
+		chunk := &archiveChunk{}
+		err := dec.Decode(chunk)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WithMessage(ErrInvalidArchive, err.Error())
+		}
+		for _, vdata := range chunk.Entries {
+			if isKeyExpired(vdata.TTL) {
+				continue
+			}
+			w := &writeop{
+				opcode:        protocol.OpPut,
+				replicaOpcode: protocol.OpPutReplica,
+				dmap:          chunk.Name,
+				key:           vdata.Key,
+				value:         vdata.Value,
+				timestamp:     vdata.Timestamp,
+				timeout:       getTimeout(vdata.TTL),
+			}
+			if w.timeout != 0 {
+				w.opcode = protocol.OpPutEx
+				w.replicaOpcode = protocol.OpPutExReplica
+			}
+			// put finds the new owner of the key.
+			if err = db.put(w); err != nil {
+				return err
+			}
+		}
+	}
+}
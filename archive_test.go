@@ -0,0 +1,107 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestBackupRestore(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	_, err = c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	names := []string{"mymap-1", "mymap-2"}
+	for _, name := range names {
+		dm, err := db1.NewDMap(name)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			err = dm.Put(bkey(i), bval(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+		}
+		err = dm.PutEx("expired", "value", time.Millisecond)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	<-time.After(10 * time.Millisecond)
+
+	var buf bytes.Buffer
+	err = db1.Backup(&buf)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// Restore the archive into a cluster with a different partition layout.
+	cfg := testSingleReplicaConfig()
+	cfg.PartitionCount = 23
+	db2, err := newDB(cfg)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db2.Shutdown(context.Background())
+		if err != nil {
+			db2.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	err = db2.Restore(&buf)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for _, name := range names {
+		dm, err := db2.NewDMap(name)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			val, err := dm.Get(bkey(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if !bytes.Equal(val.([]byte), bval(i)) {
+				t.Fatalf("Expected the same value. Got: %s", string(val.([]byte)))
+			}
+		}
+		_, err = dm.Get("expired")
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+	}
+
+	err = db2.Restore(bytes.NewBufferString("foobar"))
+	if errors.Cause(err) != ErrInvalidArchive {
+		t.Fatalf("Expected ErrInvalidArchive. Got: %v", err)
+	}
+}
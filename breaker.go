@@ -0,0 +1,151 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/stats"
+)
+
+// ErrCircuitOpen is returned when the requests to a member are short-circuited
+// because it has been failing consistently.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	breakerClosed = "closed"
+	breakerOpen   = "open"
+	// A single request is allowed to probe the member in half-open state.
+	breakerHalfOpen = "half-open"
+)
+
+type circuitBreaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// circuitBreakers keeps a circuit breaker per member. It opens after threshold
+// consecutive failures and half-opens after cooldown to probe the member.
+type circuitBreakers struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	m         map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(threshold int, cooldown time.Duration) *circuitBreakers {
+	return &circuitBreakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		m:         make(map[string]*circuitBreaker),
+	}
+}
+
+// allow returns true if a request can be sent to the member.
+func (c *circuitBreakers) allow(addr string) bool {
+	if c.threshold == 0 {
+		// Disabled
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cb, ok := c.m[addr]
+	if !ok {
+		return true
+	}
+	switch cb.state {
+	case breakerOpen:
+		if time.Since(cb.openedAt) < c.cooldown {
+			return false
+		}
+		cb.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// There is already a probe in flight.
+		return false
+	}
+	return true
+}
+
+// done records the result of a request sent to the member.
+func (c *circuitBreakers) done(addr string, failed bool) {
+	if c.threshold == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cb, ok := c.m[addr]
+	if !failed {
+		if ok {
+			delete(c.m, addr)
+		}
+		return
+	}
+	if !ok {
+		cb = &circuitBreaker{state: breakerClosed}
+		c.m[addr] = cb
+	}
+	cb.failures++
+	if cb.state == breakerHalfOpen || cb.failures >= c.threshold {
+		cb.state = breakerOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+// isOpen returns true if the requests to the member are short-circuited or
+// a probe is in flight. It doesn't change the state of the breaker.
+func (c *circuitBreakers) isOpen(addr string) bool {
+	if c.threshold == 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cb, ok := c.m[addr]
+	return ok && cb.state != breakerClosed
+}
+
+// stats returns the state of the circuit breakers which recorded a failure.
+func (c *circuitBreakers) stats() map[string]stats.CircuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := make(map[string]stats.CircuitBreaker, len(c.m))
+	for addr, cb := range c.m {
+		res[addr] = stats.CircuitBreaker{
+			State:    cb.state,
+			Failures: cb.failures,
+		}
+	}
+	return res
+}
+
+// readRequestTo calls requestTo on the read path. It doesn't send the request
+// if the circuit breaker of the member is open. Any error except ErrKeyNotFound
+// is counted as a failure of the member.
+func (db *Olric) readRequestTo(addr string, opcode protocol.OpCode, req *protocol.Message) (*protocol.Message, error) {
+	if !db.breakers.allow(addr) {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := db.requestWithRetry(addr, opcode, req)
+	db.breakers.done(addr, err != nil && err != ErrKeyNotFound)
+	return resp, err
+}
@@ -0,0 +1,74 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	addr := "127.0.0.1:3320"
+	c := newCircuitBreakers(3, 50*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if !c.allow(addr) {
+			t.Fatalf("Expected the circuit breaker to be closed")
+		}
+		c.done(addr, true)
+	}
+	if c.allow(addr) {
+		t.Fatalf("Expected the circuit breaker to be open")
+	}
+	if c.stats()[addr].State != breakerOpen {
+		t.Fatalf("Expected state: %s. Got: %s", breakerOpen, c.stats()[addr].State)
+	}
+
+	<-time.After(100 * time.Millisecond)
+	// Half-open, allows a single probe.
+	if !c.allow(addr) {
+		t.Fatalf("Expected the circuit breaker to allow a probe")
+	}
+	if c.allow(addr) {
+		t.Fatalf("Expected the circuit breaker to allow only one probe")
+	}
+	// The probe fails, it opens again.
+	c.done(addr, true)
+	if c.allow(addr) {
+		t.Fatalf("Expected the circuit breaker to be open")
+	}
+
+	<-time.After(100 * time.Millisecond)
+	if !c.allow(addr) {
+		t.Fatalf("Expected the circuit breaker to allow a probe")
+	}
+	c.done(addr, false)
+	if !c.allow(addr) {
+		t.Fatalf("Expected the circuit breaker to be closed")
+	}
+	if _, ok := c.stats()[addr]; ok {
+		t.Fatalf("Expected no state for a healthy member")
+	}
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	addr := "127.0.0.1:3320"
+	c := newCircuitBreakers(0, time.Second)
+	for i := 0; i < 10; i++ {
+		c.done(addr, true)
+	}
+	if !c.allow(addr) {
+		t.Fatalf("Expected the circuit breaker to be disabled")
+	}
+}
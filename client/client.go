@@ -16,10 +16,13 @@
 package client // import "github.com/buraksezer/olric/client"
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"time"
 
 	"github.com/buraksezer/olric"
+	"github.com/buraksezer/olric/hasher"
 	"github.com/buraksezer/olric/internal/protocol"
 	"github.com/buraksezer/olric/internal/transport"
 	"github.com/buraksezer/olric/serializer"
@@ -33,6 +36,7 @@ type Client struct {
 	config     *Config
 	client     *transport.Client
 	serializer serializer.Serializer
+	routing    routing
 }
 
 // Config includes configuration parameters for the Client.
@@ -42,6 +46,31 @@ type Config struct {
 	DialTimeout time.Duration
 	KeepAlive   time.Duration
 	MaxConn     int
+
+	// WireCompression compresses the connection streams to the members which
+	// support it. See config.WireCompression in the olric package.
+	WireCompression bool
+
+	// Multiplexing sends the requests over a single connection per member which
+	// supports it. See config.Multiplexing in the olric package.
+	Multiplexing           bool
+	MaxMultiplexedRequests int
+
+	// SmartRouting sends the single-key requests to the partition owners
+	// directly, instead of a random member which redirects them. It saves a
+	// network hop. The client fetches the routing table from the cluster and
+	// refreshes it every RoutingRefreshInterval. Stale tables are harmless,
+	// the members still redirect the requests to the current owners.
+	SmartRouting           bool
+	RoutingRefreshInterval time.Duration
+
+	// Hasher has to be the same with the hasher of the cluster for SmartRouting.
+	// It's hasher.NewDefaultHasher by default.
+	Hasher hasher.Hasher
+
+	// KeyNormalizer has to be the same with the KeyNormalizer of the cluster
+	// for SmartRouting. It's nil by default.
+	KeyNormalizer func(key string) string
 }
 
 // DMap provides methods to access distributed maps on Olric cluster.
@@ -64,11 +93,21 @@ func New(c *Config) (*Client, error) {
 	if c.MaxConn == 0 {
 		c.MaxConn = 1
 	}
+	if c.Hasher == nil {
+		c.Hasher = hasher.NewDefaultHasher()
+	}
+	if c.RoutingRefreshInterval == 0 {
+		c.RoutingRefreshInterval = defaultRoutingRefreshInterval
+	}
 	cc := &transport.ClientConfig{
 		Addrs:       c.Addrs,
 		DialTimeout: c.DialTimeout,
 		KeepAlive:   c.KeepAlive,
 		MaxConn:     c.MaxConn,
+
+		WireCompression:        c.WireCompression,
+		Multiplexing:           c.Multiplexing,
+		MaxMultiplexedRequests: c.MaxMultiplexedRequests,
 	}
 	return &Client{
 		config:     c,
@@ -118,6 +157,39 @@ func (c *Client) NewDMap(name string) *DMap {
 	}
 }
 
+// newOpID returns a random, non-zero operation ID. Atomic operations carry
+// an OpID, so the cluster doesn't apply a replayed operation twice.
+func newOpID() (uint64, error) {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		if id := binary.BigEndian.Uint64(b[:]); id != 0 {
+			return id, nil
+		}
+	}
+}
+
+// maxAtomicRetries is the number of times an atomic operation is sent again
+// after a network error.
+const maxAtomicRetries = 3
+
+// requestOnce sends an atomic operation with an OpID. It sends the same message
+// again after a network error, the partition owner returns the original result
+// if the operation has already been applied.
+func (c *Client) requestOnce(op protocol.OpCode, req *protocol.Message) (*protocol.Message, error) {
+	var err error
+	for i := 0; i <= maxAtomicRetries; i++ {
+		var resp *protocol.Message
+		resp, err = c.request(op, req)
+		if err == nil {
+			return resp, nil
+		}
+	}
+	return nil, err
+}
+
 func checkStatusCode(resp *protocol.Message) error {
 	switch {
 	case resp.Status == protocol.StatusOK:
@@ -142,6 +214,38 @@ func checkStatusCode(resp *protocol.Message) error {
 		return olric.ErrClusterQuorum
 	case resp.Status == protocol.StatusErrUnknownOperation:
 		return olric.ErrUnknownOperation
+	case resp.Status == protocol.StatusErrTooManyRequests:
+		return olric.ErrTooManyRequests
+	case resp.Status == protocol.StatusErrKeyExpired:
+		return olric.ErrKeyExpired
+	case resp.Status == protocol.StatusErrKeyIdle:
+		return olric.ErrKeyIdle
+	case resp.Status == protocol.StatusErrPartitionFull:
+		return olric.ErrPartitionFull
+	case resp.Status == protocol.StatusErrClockSkew:
+		return olric.ErrClockSkew
+	case resp.Status == protocol.StatusErrDMapUnavailable:
+		return olric.ErrDMapUnavailable
+	case resp.Status == protocol.StatusErrReadOnly:
+		return olric.ErrReadOnly
+	case resp.Status == protocol.StatusErrMessageTooLarge:
+		return olric.ErrMessageTooLarge
+	case resp.Status == protocol.StatusErrNotNumeric:
+		return olric.ErrNotNumeric
+	case resp.Status == protocol.StatusErrSerializerMismatch:
+		return olric.ErrSerializerMismatch
+	case resp.Status == protocol.StatusErrNoMajority:
+		return olric.ErrNoMajority
+	case resp.Status == protocol.StatusErrCrossPartitionSwap:
+		return olric.ErrCrossPartitionSwap
+	case resp.Status == protocol.StatusErrClusterNotReady:
+		return olric.ErrClusterNotReady
+	case resp.Status == protocol.StatusErrWritesPaused:
+		return olric.ErrWritesPaused
+	case resp.Status == protocol.StatusErrResultTooLarge:
+		return olric.ErrResultTooLarge
+	case resp.Status == protocol.StatusErrNotBitmap:
+		return olric.ErrNotBitmap
 	default:
 		return fmt.Errorf("unknown status: %v", resp.Status)
 	}
@@ -152,10 +256,31 @@ func (c *Client) processGetResponse(resp *protocol.Message) (interface{}, error)
 	if err := checkStatusCode(resp); err != nil {
 		return value, err
 	}
+	if err := checkCodec(resp, c.serializer); err != nil {
+		return value, err
+	}
 	err := c.serializer.Unmarshal(resp.Value, &value)
 	return value, err
 }
 
+// checkCodec returns olric.ErrSerializerMismatch if the response is served by
+// a member which uses a different serializer. It's not checked for the unknown
+// codecs and the members which don't report their codec.
+func checkCodec(resp *protocol.Message, s serializer.Serializer) error {
+	extra, ok := resp.Extra.(protocol.GetResponseExtra)
+	if !ok {
+		return nil
+	}
+	codec := serializer.Codec(s)
+	if extra.Codec == serializer.UnknownCodec || codec == serializer.UnknownCodec {
+		return nil
+	}
+	if extra.Codec != codec {
+		return olric.ErrSerializerMismatch
+	}
+	return nil
+}
+
 // Get gets the value for the given key. It returns ErrKeyNotFound if the DB does not contains the key.
 // It's thread-safe. It is safe to modify the contents of the returned value.
 // It is safe to modify the contents of the argument after Get returns.
@@ -164,13 +289,53 @@ func (d *DMap) Get(key string) (interface{}, error) {
 		DMap: d.name,
 		Key:  key,
 	}
-	resp, err := d.client.Request(protocol.OpGet, m)
+	resp, err := d.request(protocol.OpGet, m)
 	if err != nil {
 		return nil, err
 	}
 	return d.processGetResponse(resp)
 }
 
+// Exists reports whether the given key exists without transferring its value.
+// It returns false and nil error if the key doesn't exist.
+func (d *DMap) Exists(key string) (bool, error) {
+	m := &protocol.Message{
+		DMap: d.name,
+		Key:  key,
+	}
+	resp, err := d.request(protocol.OpExists, m)
+	if err != nil {
+		return false, err
+	}
+	err = checkStatusCode(resp)
+	if err == olric.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetTTL returns the remaining time to live of the given key without fetching
+// its value. It returns olric.NoTTL if the key never expires.
+func (d *DMap) GetTTL(key string) (time.Duration, error) {
+	m := &protocol.Message{
+		DMap: d.name,
+		Key:  key,
+	}
+	resp, err := d.request(protocol.OpGetTTL, m)
+	if err != nil {
+		return 0, err
+	}
+	if err = checkStatusCode(resp); err != nil {
+		return 0, err
+	}
+	var ttl time.Duration
+	err = msgpack.Unmarshal(resp.Value, &ttl)
+	return ttl, err
+}
+
 // Put sets the value for the given key. It overwrites any previous value for that key and it's thread-safe.
 // It is safe to modify the contents of the arguments after Put returns but not before.
 func (d *DMap) Put(key string, value interface{}) error {
@@ -186,7 +351,7 @@ func (d *DMap) Put(key string, value interface{}) error {
 			Timestamp: time.Now().UnixNano(),
 		},
 	}
-	resp, err := d.client.Request(protocol.OpPut, m)
+	resp, err := d.request(protocol.OpPut, m)
 	if err != nil {
 		return err
 	}
@@ -209,7 +374,7 @@ func (d *DMap) PutEx(key string, value interface{}, timeout time.Duration) error
 			Timestamp: time.Now().UnixNano(),
 		},
 	}
-	resp, err := d.client.Request(protocol.OpPutEx, m)
+	resp, err := d.request(protocol.OpPutEx, m)
 	if err != nil {
 		return err
 	}
@@ -223,13 +388,73 @@ func (d *DMap) Delete(key string) error {
 		DMap: d.name,
 		Key:  key,
 	}
-	resp, err := d.client.Request(protocol.OpDelete, m)
+	resp, err := d.request(protocol.OpDelete, m)
 	if err != nil {
 		return err
 	}
 	return checkStatusCode(resp)
 }
 
+// DeleteWithResult works like Delete, but it also returns true if a live entry
+// of the key was present before deletion. The servers which don't report it
+// always return false.
+func (d *DMap) DeleteWithResult(key string) (bool, error) {
+	m := &protocol.Message{
+		DMap: d.name,
+		Key:  key,
+	}
+	resp, err := d.request(protocol.OpDelete, m)
+	if err != nil {
+		return false, err
+	}
+	if err = checkStatusCode(resp); err != nil {
+		return false, err
+	}
+	return len(resp.Value) == 1 && resp.Value[0] == 1, nil
+}
+
+// GetDelete atomically gets the value for the given key and deletes it. The
+// value is returned to only one of the concurrent callers. It returns
+// olric.ErrKeyNotFound if the key doesn't exist.
+func (d *DMap) GetDelete(key string) (interface{}, error) {
+	m := &protocol.Message{
+		DMap: d.name,
+		Key:  key,
+	}
+	resp, err := d.request(protocol.OpGetDelete, m)
+	if err != nil {
+		return nil, err
+	}
+	return d.processGetResponse(resp)
+}
+
+// CompareAndDelete deletes the given key only if its value is equal to the
+// expected one. It returns false if the value is different or the key doesn't
+// exist. See olric.DMap.CompareAndDelete.
+func (d *DMap) CompareAndDelete(key string, expected interface{}) (bool, error) {
+	data, err := d.serializer.Marshal(expected)
+	if err != nil {
+		return false, err
+	}
+	m := &protocol.Message{
+		DMap:  d.name,
+		Key:   key,
+		Value: data,
+	}
+	resp, err := d.request(protocol.OpCompareAndDelete, m)
+	if err != nil {
+		return false, err
+	}
+	err = checkStatusCode(resp)
+	if err == olric.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // LockContext is returned by Lock and LockWithTimeout methods.
 // It should be stored in a proper way to release the lock.
 type LockContext struct {
@@ -344,15 +569,20 @@ func (c *Client) incrDecr(op protocol.OpCode, name, key string, delta int) (int,
 	if err != nil {
 		return 0, err
 	}
+	opID, err := newOpID()
+	if err != nil {
+		return 0, err
+	}
 	m := &protocol.Message{
 		DMap:  name,
 		Key:   key,
 		Value: value,
 		Extra: protocol.AtomicExtra{
 			Timestamp: time.Now().UnixNano(),
+			OpID:      opID,
 		},
 	}
-	resp, err := c.client.Request(op, m)
+	resp, err := c.requestOnce(op, m)
 	if err != nil {
 		return 0, err
 	}
@@ -369,6 +599,135 @@ func (d *DMap) Decr(key string, delta int) (int, error) {
 	return d.incrDecr(protocol.OpDecr, d.name, key, delta)
 }
 
+// IncrFloat atomically increments key by delta. The key is initialized to zero
+// if it doesn't exist. The return value is the new value after being incremented
+// or an error. It returns olric.ErrNotNumeric if the stored value is not a number.
+func (d *DMap) IncrFloat(key string, delta float64) (float64, error) {
+	value, err := d.serializer.Marshal(delta)
+	if err != nil {
+		return 0, err
+	}
+	opID, err := newOpID()
+	if err != nil {
+		return 0, err
+	}
+	m := &protocol.Message{
+		DMap:  d.name,
+		Key:   key,
+		Value: value,
+		Extra: protocol.AtomicExtra{
+			Timestamp: time.Now().UnixNano(),
+			OpID:      opID,
+		},
+	}
+	resp, err := d.requestOnce(protocol.OpIncrFloat, m)
+	if err != nil {
+		return 0, err
+	}
+	if err = checkStatusCode(resp); err != nil {
+		return 0, err
+	}
+	var res interface{}
+	if err = d.serializer.Unmarshal(resp.Value, &res); err != nil {
+		return 0, err
+	}
+	newval, ok := res.(float64)
+	if !ok {
+		return 0, olric.ErrNotNumeric
+	}
+	return newval, nil
+}
+
+// DecrFloor atomically decrements key by delta unless the result is negative.
+// The key is initialized to zero if it doesn't exist. It returns the new value
+// and true if the decrement is applied, the current value and false otherwise.
+// See olric.DMap.DecrFloor.
+func (d *DMap) DecrFloor(key string, delta int) (int, bool, error) {
+	value, err := d.serializer.Marshal(delta)
+	if err != nil {
+		return 0, false, err
+	}
+	opID, err := newOpID()
+	if err != nil {
+		return 0, false, err
+	}
+	m := &protocol.Message{
+		DMap:  d.name,
+		Key:   key,
+		Value: value,
+		Extra: protocol.AtomicExtra{
+			Timestamp: time.Now().UnixNano(),
+			OpID:      opID,
+		},
+	}
+	resp, err := d.requestOnce(protocol.OpDecrFloor, m)
+	if err != nil {
+		return 0, false, err
+	}
+	if err = checkStatusCode(resp); err != nil {
+		return 0, false, err
+	}
+	res := protocol.DecrFloorResult{}
+	if err = msgpack.Unmarshal(resp.Value, &res); err != nil {
+		return 0, false, err
+	}
+	return res.Value, res.Applied, nil
+}
+
+// SetBit sets or clears the bit at offset of the value, which is treated as
+// a bitset, and returns the previous bit. The value grows as needed. It returns
+// olric.ErrNotBitmap if the stored value is not a byte slice.
+// See olric.DMap.SetBit.
+func (d *DMap) SetBit(key string, offset int, value bool) (bool, error) {
+	if offset < 0 {
+		return false, olric.ErrInvalidBitOffset
+	}
+	m := &protocol.Message{
+		DMap: d.name,
+		Key:  key,
+		Extra: protocol.SetBitExtra{
+			Offset:    int64(offset),
+			Value:     value,
+			Timestamp: time.Now().UnixNano(),
+		},
+	}
+	resp, err := d.request(protocol.OpSetBit, m)
+	if err != nil {
+		return false, err
+	}
+	if err = checkStatusCode(resp); err != nil {
+		return false, err
+	}
+	var prev bool
+	err = msgpack.Unmarshal(resp.Value, &prev)
+	return prev, err
+}
+
+// GetBit returns the bit at offset of the value, which is treated as a bitset.
+// The bits of a missing key are zero. See olric.DMap.GetBit.
+func (d *DMap) GetBit(key string, offset int) (bool, error) {
+	if offset < 0 {
+		return false, olric.ErrInvalidBitOffset
+	}
+	m := &protocol.Message{
+		DMap: d.name,
+		Key:  key,
+		Extra: protocol.GetBitExtra{
+			Offset: int64(offset),
+		},
+	}
+	resp, err := d.request(protocol.OpGetBit, m)
+	if err != nil {
+		return false, err
+	}
+	if err = checkStatusCode(resp); err != nil {
+		return false, err
+	}
+	var bit bool
+	err = msgpack.Unmarshal(resp.Value, &bit)
+	return bit, err
+}
+
 func (c *Client) processGetPutResponse(resp *protocol.Message) (interface{}, error) {
 	if err := checkStatusCode(resp); err != nil {
 		return nil, err
@@ -389,15 +748,48 @@ func (d *DMap) GetPut(key string, value interface{}) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	opID, err := newOpID()
+	if err != nil {
+		return nil, err
+	}
 	m := &protocol.Message{
 		DMap:  d.name,
 		Key:   key,
 		Value: data,
 		Extra: protocol.AtomicExtra{
 			Timestamp: time.Now().UnixNano(),
+			OpID:      opID,
+		},
+	}
+	resp, err := d.requestOnce(protocol.OpGetPut, m)
+	if err != nil {
+		return nil, err
+	}
+	return d.processGetPutResponse(resp)
+}
+
+// GetPutEx atomically sets key to value with the given TTL and returns the old
+// value stored at key. It returns nil if the key doesn't exist.
+func (d *DMap) GetPutEx(key string, value interface{}, timeout time.Duration) (interface{}, error) {
+	data, err := d.serializer.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	opID, err := newOpID()
+	if err != nil {
+		return nil, err
+	}
+	m := &protocol.Message{
+		DMap:  d.name,
+		Key:   key,
+		Value: data,
+		Extra: protocol.GetPutExExtra{
+			TTL:       timeout.Nanoseconds(),
+			Timestamp: time.Now().UnixNano(),
+			OpID:      opID,
 		},
 	}
-	resp, err := d.client.Request(protocol.OpGetPut, m)
+	resp, err := d.requestOnce(protocol.OpGetPutEx, m)
 	if err != nil {
 		return nil, err
 	}
@@ -415,7 +807,7 @@ func (d *DMap) Expire(key string, timeout time.Duration) error {
 			Timestamp: time.Now().UnixNano(),
 		},
 	}
-	resp, err := d.client.Request(protocol.OpExpire, m)
+	resp, err := d.request(protocol.OpExpire, m)
 	if err != nil {
 		return err
 	}
@@ -445,7 +837,7 @@ func (d *DMap) PutIf(key string, value interface{}, flags int16) error {
 			Timestamp: time.Now().UnixNano(),
 		},
 	}
-	resp, err := d.client.Request(protocol.OpPutIf, m)
+	resp, err := d.request(protocol.OpPutIf, m)
 	if err != nil {
 		return err
 	}
@@ -476,7 +868,7 @@ func (d *DMap) PutIfEx(key string, value interface{}, timeout time.Duration, fla
 			Timestamp: time.Now().UnixNano(),
 		},
 	}
-	resp, err := d.client.Request(protocol.OpPutIfEx, m)
+	resp, err := d.request(protocol.OpPutIfEx, m)
 	if err != nil {
 		return err
 	}
@@ -25,6 +25,8 @@ import (
 	"time"
 
 	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/serializer"
 
 	"github.com/buraksezer/olric"
 )
@@ -118,6 +120,89 @@ func TestClient_Get(t *testing.T) {
 	}
 }
 
+func TestClient_Exists(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		serr := db.Shutdown(context.Background())
+		if serr != nil {
+			t.Errorf("Expected nil. Got %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	name := "mymap"
+	dm, err := db.NewDMap(name)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put("my-key", "my-value")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	ok, err := c.NewDMap(name).Exists("my-key")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !ok {
+		t.Fatalf("Expected true. Got: %v", ok)
+	}
+	ok, err = c.NewDMap(name).Exists("missing")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if ok {
+		t.Fatalf("Expected false. Got: %v", ok)
+	}
+}
+
+func TestClient_GetTTL(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		serr := db.Shutdown(context.Background())
+		if serr != nil {
+			t.Errorf("Expected nil. Got %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	name := "mymap"
+	dm, err := db.NewDMap(name)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.PutEx("my-key", "my-value", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	ttl, err := c.NewDMap(name).GetTTL("my-key")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("Expected TTL between 0 and 1h. Got: %v", ttl)
+	}
+	_, err = c.NewDMap(name).GetTTL("missing")
+	if err != olric.ErrKeyNotFound {
+		t.Fatalf("Expected olric.ErrKeyNotFound. Got: %v", err)
+	}
+}
+
 func TestClient_Put(t *testing.T) {
 	db, done, err := newDB()
 	if err != nil {
@@ -231,6 +316,221 @@ func TestClient_Delete(t *testing.T) {
 	}
 }
 
+func TestClient_DeleteWithResult(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		serr := db.Shutdown(context.Background())
+		if serr != nil {
+			t.Errorf("Expected nil. Got %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm := c.NewDMap("mymap")
+	err = dm.Put("my-key", "my-value")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	existed, err := dm.DeleteWithResult("my-key")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !existed {
+		t.Fatalf("Expected the key to exist before deletion")
+	}
+	existed, err = dm.DeleteWithResult("my-key")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if existed {
+		t.Fatalf("Expected the key to be deleted already")
+	}
+}
+
+func TestClient_GetDelete(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		serr := db.Shutdown(context.Background())
+		if serr != nil {
+			t.Errorf("Expected nil. Got %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm := c.NewDMap("mymap")
+	err = dm.Put("my-key", "my-value")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	value, err := dm.GetDelete("my-key")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value.(string) != "my-value" {
+		t.Fatalf("Expected my-value. Got: %v", value)
+	}
+	_, err = dm.GetDelete("my-key")
+	if err != olric.ErrKeyNotFound {
+		t.Fatalf("Expected olric.ErrKeyNotFound. Got: %v", err)
+	}
+}
+
+func TestClient_CompareAndDelete(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		serr := db.Shutdown(context.Background())
+		if serr != nil {
+			t.Errorf("Expected nil. Got %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm := c.NewDMap("mymap")
+	err = dm.Put("my-key", "my-value")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	deleted, err := dm.CompareAndDelete("my-key", "another-value")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if deleted {
+		t.Fatalf("Expected my-key not to be deleted")
+	}
+	deleted, err = dm.CompareAndDelete("my-key", "my-value")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !deleted {
+		t.Fatalf("Expected my-key to be deleted")
+	}
+	_, err = dm.Get("my-key")
+	if err != olric.ErrKeyNotFound {
+		t.Fatalf("Expected olric.ErrKeyNotFound. Got: %v", err)
+	}
+}
+
+func TestClient_DecrFloor(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		serr := db.Shutdown(context.Background())
+		if serr != nil {
+			t.Errorf("Expected nil. Got %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm := c.NewDMap("mymap")
+	err = dm.Put("stock", 2)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	value, applied, err := dm.DecrFloor("stock", 2)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value != 0 || !applied {
+		t.Fatalf("Expected 0, true. Got: %d, %v", value, applied)
+	}
+	value, applied, err = dm.DecrFloor("stock", 1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value != 0 || applied {
+		t.Fatalf("Expected 0, false. Got: %d, %v", value, applied)
+	}
+}
+
+func TestClient_SetBit(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		serr := db.Shutdown(context.Background())
+		if serr != nil {
+			t.Errorf("Expected nil. Got %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm := c.NewDMap("mymap")
+	prev, err := dm.SetBit("cohort", 10, true)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if prev {
+		t.Fatalf("Expected false. Got: true")
+	}
+	prev, err = dm.SetBit("cohort", 10, true)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !prev {
+		t.Fatalf("Expected true. Got: false")
+	}
+	bit, err := dm.GetBit("cohort", 10)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bit {
+		t.Fatalf("Expected true. Got: false")
+	}
+	bit, err = dm.GetBit("cohort", 11)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if bit {
+		t.Fatalf("Expected false. Got: true")
+	}
+
+	err = dm.Put("name", "olric")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = dm.SetBit("name", 1, true)
+	if err != olric.ErrNotBitmap {
+		t.Fatalf("Expected ErrNotBitmap. Got: %v", err)
+	}
+}
+
 func TestClient_LockWithTimeout(t *testing.T) {
 	db, done, err := newDB()
 	if err != nil {
@@ -449,6 +749,144 @@ func TestClient_Incr(t *testing.T) {
 	}
 }
 
+func TestClient_IncrReplay(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		serr := db.Shutdown(ctx)
+		if serr != nil {
+			log.Printf("[WARN] Olric Shutdown returned an error: %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	delta, err := c.serializer.Marshal(1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	opID, err := newOpID()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	m := &protocol.Message{
+		DMap:  "atomic_test",
+		Key:   "incr",
+		Value: delta,
+		Extra: protocol.AtomicExtra{
+			Timestamp: time.Now().UnixNano(),
+			OpID:      opID,
+		},
+	}
+	// A retry sends the same message. It should be applied once.
+	for i := 0; i < 3; i++ {
+		resp, err := c.requestOnce(protocol.OpIncr, m)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		res, err := c.processIncrDecrResponse(resp)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if res != 1 {
+			t.Fatalf("Expected 1. Got: %v", res)
+		}
+	}
+
+	res, err := c.NewDMap("atomic_test").Incr("incr", 1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if res != 2 {
+		t.Fatalf("Expected 2. Got: %v", res)
+	}
+}
+
+func TestClient_IncrFloat(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		serr := db.Shutdown(ctx)
+		if serr != nil {
+			log.Printf("[WARN] Olric Shutdown returned an error: %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm := c.NewDMap("atomic_test")
+	for i := 0; i < 10; i++ {
+		_, err = dm.IncrFloat("incr", 0.25)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	res, err := dm.IncrFloat("incr", 0.25)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if res != 2.75 {
+		t.Fatalf("Expected 2.75. Got: %v", res)
+	}
+
+	err = dm.Put("str", "foobar")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = dm.IncrFloat("str", 1)
+	if err != olric.ErrNotNumeric {
+		t.Fatalf("Expected olric.ErrNotNumeric. Got: %v", err)
+	}
+}
+
+func TestClient_SerializerMismatch(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		serr := db.Shutdown(ctx)
+		if serr != nil {
+			log.Printf("[WARN] Olric Shutdown returned an error: %v", serr)
+		}
+		<-done
+	}()
+
+	cfg := *testConfig
+	cfg.Serializer = serializer.NewJSONSerializer()
+	c, err := New(&cfg)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	dm := c.NewDMap("mymap")
+	err = dm.Put("mykey", "myvalue")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = dm.Get("mykey")
+	if err != olric.ErrSerializerMismatch {
+		t.Fatalf("Expected olric.ErrSerializerMismatch. Got: %v", err)
+	}
+}
+
 func TestClient_Decr(t *testing.T) {
 	db, done, err := newDB()
 	if err != nil {
@@ -564,6 +1002,49 @@ func TestClient_GetPut(t *testing.T) {
 	}
 }
 
+func TestClient_GetPutEx(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		serr := db.Shutdown(ctx)
+		if serr != nil {
+			log.Printf("[WARN] Olric Shutdown returned an error: %v", serr)
+		}
+		<-done
+	}()
+
+	c, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm := c.NewDMap("atomic_test")
+	oldval, err := dm.GetPutEx("getputex", "first", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if oldval != nil {
+		t.Fatalf("Expected nil. Got: %v", oldval)
+	}
+	oldval, err = dm.GetPutEx("getputex", "second", time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if oldval != "first" {
+		t.Fatalf("Expected first. Got: %v", oldval)
+	}
+
+	<-time.After(10 * time.Millisecond)
+	_, err = dm.Get("getputex")
+	if err != olric.ErrKeyNotFound {
+		t.Fatalf("Expected olric.ErrKeyNotFound. Got: %v", err)
+	}
+}
+
 func TestClient_Ping(t *testing.T) {
 	db, done, err := newDB()
 	if err != nil {
@@ -775,3 +1256,74 @@ func TestClient_PutIfEx(t *testing.T) {
 		t.Fatalf("Expected nil. Got: %v", v)
 	}
 }
+
+func TestClient_SmartRouting(t *testing.T) {
+	db, done, err := newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	defer func() {
+		serr := db.Shutdown(context.Background())
+		if serr != nil {
+			t.Errorf("Expected nil. Got %v", serr)
+		}
+		<-done
+	}()
+
+	cfg := *testConfig
+	cfg.SmartRouting = true
+	c, err := New(&cfg)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	dm := c.NewDMap("mymap")
+	for i := 0; i < 10; i++ {
+		key := "my-key-" + strconv.Itoa(i)
+		err = dm.Put(key, i)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		value, err := dm.Get(key)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if value.(int) != i {
+			t.Fatalf("Expected %d. Got: %v", i, value)
+		}
+	}
+
+	table, err := c.loadRouting()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if table.PartitionCount != 7 {
+		t.Fatalf("Expected PartitionCount: 7. Got: %d", table.PartitionCount)
+	}
+	for partID, owner := range table.Owners {
+		if owner != cfg.Addrs[0] {
+			t.Fatalf("Expected %s as the owner of %d. Got: %s", cfg.Addrs[0], partID, owner)
+		}
+	}
+
+	// A failed request to a stale owner invalidates the table.
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	c.routing.mtx.Lock()
+	for partID := range table.Owners {
+		table.Owners[partID] = "127.0.0.1:" + strconv.Itoa(port)
+	}
+	c.routing.mtx.Unlock()
+	_, err = dm.Get("my-key-0")
+	if err == nil {
+		t.Fatalf("Expected an error from the stale owner")
+	}
+	value, err := dm.Get("my-key-0")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value.(int) != 0 {
+		t.Fatalf("Expected 0. Got: %v", value)
+	}
+}
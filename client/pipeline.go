@@ -131,6 +131,10 @@ func (p *Pipeline) incrOrDecr(opcode protocol.OpCode, dmap, key string, delta in
 	if err != nil {
 		return err
 	}
+	opID, err := newOpID()
+	if err != nil {
+		return err
+	}
 	m := &protocol.Message{
 		Header: protocol.Header{
 			Magic: protocol.MagicReq,
@@ -139,7 +143,10 @@ func (p *Pipeline) incrOrDecr(opcode protocol.OpCode, dmap, key string, delta in
 		DMap:  dmap,
 		Key:   key,
 		Value: value,
-		Extra: protocol.AtomicExtra{Timestamp: time.Now().UnixNano()},
+		Extra: protocol.AtomicExtra{
+			Timestamp: time.Now().UnixNano(),
+			OpID:      opID,
+		},
 	}
 	return m.Write(p.buf)
 }
@@ -163,6 +170,10 @@ func (p *Pipeline) GetPut(dmap, key string, value interface{}) error {
 	if err != nil {
 		return err
 	}
+	opID, err := newOpID()
+	if err != nil {
+		return err
+	}
 	m := &protocol.Message{
 		Header: protocol.Header{
 			Magic: protocol.MagicReq,
@@ -171,7 +182,10 @@ func (p *Pipeline) GetPut(dmap, key string, value interface{}) error {
 		DMap:  dmap,
 		Key:   key,
 		Value: data,
-		Extra: protocol.AtomicExtra{Timestamp: time.Now().UnixNano()},
+		Extra: protocol.AtomicExtra{
+			Timestamp: time.Now().UnixNano(),
+			OpID:      opID,
+		},
 	}
 	return m.Write(p.buf)
 }
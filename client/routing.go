@@ -0,0 +1,111 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// defaultRoutingRefreshInterval is the default value of Config.RoutingRefreshInterval.
+const defaultRoutingRefreshInterval = 10 * time.Second
+
+// routing keeps a copy of the routing table of the cluster to send the single-key
+// requests to the partition owners directly. See Config.SmartRouting.
+type routing struct {
+	mtx       sync.RWMutex
+	table     *protocol.RoutingTable
+	fetchedAt time.Time
+}
+
+func (c *Client) refreshRouting() (*protocol.RoutingTable, error) {
+	resp, err := c.client.Request(protocol.OpGetRoutingTable, &protocol.Message{})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatusCode(resp); err != nil {
+		return nil, err
+	}
+	table := &protocol.RoutingTable{}
+	err = msgpack.Unmarshal(resp.Value, table)
+	if err != nil {
+		return nil, err
+	}
+
+	c.routing.mtx.Lock()
+	defer c.routing.mtx.Unlock()
+	c.routing.table = table
+	c.routing.fetchedAt = time.Now()
+	return table, nil
+}
+
+// loadRouting returns the routing table. It's fetched again if it's older than
+// Config.RoutingRefreshInterval.
+func (c *Client) loadRouting() (*protocol.RoutingTable, error) {
+	c.routing.mtx.RLock()
+	table := c.routing.table
+	fresh := table != nil && time.Since(c.routing.fetchedAt) < c.config.RoutingRefreshInterval
+	c.routing.mtx.RUnlock()
+	if fresh {
+		return table, nil
+	}
+	return c.refreshRouting()
+}
+
+// invalidateRouting makes the next request fetch the routing table again.
+func (c *Client) invalidateRouting() {
+	c.routing.mtx.Lock()
+	defer c.routing.mtx.Unlock()
+	c.routing.table = nil
+}
+
+// findOwner returns the address of the partition owner of the key. It returns
+// false if the owner cannot be computed locally.
+func (c *Client) findOwner(name, key string) (string, bool) {
+	table, err := c.loadRouting()
+	if err != nil || table.PartitionCount == 0 {
+		return "", false
+	}
+	if c.config.KeyNormalizer != nil {
+		key = c.config.KeyNormalizer(key)
+	}
+	tmp := name + key
+	hkey := c.config.Hasher.Sum64(*(*[]byte)(unsafe.Pointer(&tmp)))
+	owner := table.Owners[hkey%table.PartitionCount]
+	return owner, owner != ""
+}
+
+// request sends a single-key request. With Config.SmartRouting, it's sent to the
+// partition owner of the key in the local routing table. If the table is stale,
+// the receiving member redirects the request to the current owner.
+func (c *Client) request(op protocol.OpCode, req *protocol.Message) (*protocol.Message, error) {
+	if !c.config.SmartRouting {
+		return c.client.Request(op, req)
+	}
+	addr, ok := c.findOwner(req.DMap, req.Key)
+	if !ok {
+		return c.client.Request(op, req)
+	}
+	resp, err := c.client.RequestTo(addr, op, req)
+	if err != nil {
+		// The owner may have left the cluster.
+		c.invalidateRouting()
+	}
+	return resp, err
+}
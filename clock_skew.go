@@ -0,0 +1,98 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/olric/stats"
+)
+
+// ErrClockSkew is returned when the timestamp of a write is more than
+// MaxClockSkew ahead of the clock of the partition owner.
+var ErrClockSkew = errors.New("timestamp exceeds MaxClockSkew")
+
+// clockSkewStats counts the timestamps beyond MaxClockSkew.
+type clockSkewStats struct {
+	rejected uint64
+	clamped  uint64
+	warnings uint64
+	max      int64
+}
+
+func (c *clockSkewStats) observe(skew time.Duration) {
+	for {
+		current := atomic.LoadInt64(&c.max)
+		if int64(skew) <= current || atomic.CompareAndSwapInt64(&c.max, current, int64(skew)) {
+			return
+		}
+	}
+}
+
+func (c *clockSkewStats) stats() stats.ClockSkew {
+	return stats.ClockSkew{
+		Rejected: atomic.LoadUint64(&c.rejected),
+		Clamped:  atomic.LoadUint64(&c.clamped),
+		Warnings: atomic.LoadUint64(&c.warnings),
+		Max:      time.Duration(atomic.LoadInt64(&c.max)),
+	}
+}
+
+// skewOf returns how far the given timestamp is ahead of the local clock and
+// true if it exceeds MaxClockSkew.
+func (db *Olric) skewOf(timestamp int64) (time.Duration, bool) {
+	if db.config.MaxClockSkew == 0 {
+		return 0, false
+	}
+	skew := time.Duration(timestamp - time.Now().UnixNano())
+	return skew, skew > db.config.MaxClockSkew
+}
+
+// checkClockSkew rejects a write whose timestamp is too far ahead of the local
+// clock. A single member with a skewed clock would always win the last write
+// wins resolution otherwise. It clamps the timestamp if ClampClockSkew is set.
+func (db *Olric) checkClockSkew(w *writeop) error {
+	skew, exceeded := db.skewOf(w.timestamp)
+	if !exceeded {
+		return nil
+	}
+	db.clockSkew.observe(skew)
+	if db.config.ClampClockSkew {
+		atomic.AddUint64(&db.clockSkew.clamped, 1)
+		db.log.V(2).Printf("[WARN] Timestamp of key: %s on DMap: %s is %v ahead, clamped",
+			w.key, w.dmap, skew)
+		w.timestamp = time.Now().UnixNano()
+		return nil
+	}
+	atomic.AddUint64(&db.clockSkew.rejected, 1)
+	db.log.V(2).Printf("[WARN] Timestamp of key: %s on DMap: %s is %v ahead, rejected",
+		w.key, w.dmap, skew)
+	return ErrClockSkew
+}
+
+// observeClockSkew reports a version whose timestamp is too far ahead of the
+// local clock. It doesn't change the version ordering.
+func (db *Olric) observeClockSkew(ver *version) {
+	skew, exceeded := db.skewOf(ver.Data.Timestamp)
+	if !exceeded {
+		return
+	}
+	db.clockSkew.observe(skew)
+	atomic.AddUint64(&db.clockSkew.warnings, 1)
+	db.log.V(2).Printf("[WARN] Version of key: %s on %s is %v ahead of the local clock",
+		ver.Data.Key, ver.host, skew)
+}
@@ -0,0 +1,80 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+func TestDMap_MaxClockSkew(t *testing.T) {
+	for _, clamp := range []bool{false, true} {
+		c := testSingleReplicaConfig()
+		c.MaxClockSkew = time.Second
+		c.ClampClockSkew = clamp
+		db, err := newDB(c)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+
+		value, err := db.serializer.Marshal("value")
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		future := time.Now().Add(time.Hour).UnixNano()
+		w := &writeop{
+			opcode:        protocol.OpPut,
+			replicaOpcode: protocol.OpPutReplica,
+			dmap:          "mymap",
+			key:           "mykey",
+			value:         value,
+			timestamp:     future,
+		}
+		err = db.put(w)
+		if !clamp {
+			if err != ErrClockSkew {
+				t.Fatalf("Expected ErrClockSkew. Got: %v", err)
+			}
+			if db.clockSkew.stats().Rejected != 1 {
+				t.Fatalf("Expected one rejected write. Got: %v", db.clockSkew.stats())
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			res, err := db.getWithOptions("mymap", "mykey", nil)
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if res.Timestamp >= future {
+				t.Fatalf("Expected a clamped timestamp. Got: %d", res.Timestamp)
+			}
+			if db.clockSkew.stats().Clamped != 1 {
+				t.Fatalf("Expected one clamped write. Got: %v", db.clockSkew.stats())
+			}
+		}
+		if db.clockSkew.stats().Max < time.Minute {
+			t.Fatalf("Expected the observed skew to be recorded. Got: %v", db.clockSkew.stats().Max)
+		}
+
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+}
@@ -34,15 +34,77 @@ type olricd struct {
 	ReplicationMode   int     `yaml:"replicationMode"`
 	PartitionCount    uint64  `yaml:"partitionCount"`
 	LoadFactor        float64 `yaml:"loadFactor"`
+	Distribution string `yaml:"distribution"`
 	Serializer        string  `yaml:"serializer"`
+	MigrationSerializer string `yaml:"migrationSerializer"`
 	KeepAlivePeriod   string  `yaml:"keepAlivePeriod"`
 	RequestTimeout    string  `yaml:"requestTimeout"`
 	ReplicaCount      int     `yaml:"replicaCount"`
 	WriteQuorum       int     `yaml:"writeQuorum"`
 	ReadQuorum        int     `yaml:"readQuorum"`
+	Region            string  `yaml:"region"`
+	ReadRegionQuorum  int     `yaml:"readRegionQuorum"`
+	ReadWeight        int     `yaml:"readWeight"`
 	ReadRepair        bool    `yaml:"readRepair"`
+	ReadRepairMinLag string `yaml:"readRepairMinLag"`
+	EnableMemberReads bool `yaml:"enableMemberReads"`
+	PreferUnexpiredVersions bool `yaml:"preferUnexpiredVersions"`
+	MaxReadVersions int `yaml:"maxReadVersions"`
+	AvoidReplicaReads bool `yaml:"avoidReplicaReads"`
+	AllowLocalOnlyOnPartition bool `yaml:"allowLocalOnlyOnPartition"`
+	RedirectedReadCacheTTL string `yaml:"redirectedReadCacheTTL"`
+	CopyPreservesTimestamp bool `yaml:"copyPreservesTimestamp"`
 	TableSize         int     `yaml:"tableSize"`
 	MemberCountQuorum int32   `yaml:"memberCountQuorum"`
+	MinimumMemberQuorum int32 `yaml:"minimumMemberQuorum"`
+	MaxConnsPerMember int     `yaml:"maxConnsPerMember"`
+	MinConnsPerMember int     `yaml:"minConnsPerMember"`
+	IdleConnTimeout   string  `yaml:"idleConnTimeout"`
+	PlacementHints    map[string][]string `yaml:"placementHints"`
+	OpIDCacheSize     int     `yaml:"opIDCacheSize"`
+	GetAllLimit       int     `yaml:"getAllLimit"`
+	ReaperInterval string `yaml:"reaperInterval"`
+	ReaperBatchSize int `yaml:"reaperBatchSize"`
+	OpIDCacheTTL      string  `yaml:"opIDCacheTTL"`
+	OrderedIndexes    []string `yaml:"orderedIndexes"`
+	RebalanceRateLimit int `yaml:"rebalanceRateLimit"`
+	RebalanceDelay string `yaml:"rebalanceDelay"`
+	RebalanceImbalanceThreshold float64 `yaml:"rebalanceImbalanceThreshold"`
+	EnableScrubber bool `yaml:"enableScrubber"`
+	ScrubRate int `yaml:"scrubRate"`
+	CircuitBreakerThreshold int `yaml:"circuitBreakerThreshold"`
+	CircuitBreakerCooldown string `yaml:"circuitBreakerCooldown"`
+	RPCRetryBackoff rpcRetryBackoff `yaml:"rpcRetryBackoff"`
+	MaxKeysPerPartition int `yaml:"maxKeysPerPartition"`
+	GlobalMaxMemory int `yaml:"globalMaxMemory"`
+	GlobalMemoryLowWatermark float64 `yaml:"globalMemoryLowWatermark"`
+	MaxClockSkew string `yaml:"maxClockSkew"`
+	DestroyWaitTimeout string `yaml:"destroyWaitTimeout"`
+	ReadProfileSampleRate int `yaml:"readProfileSampleRate"`
+	TrackValueSizes bool `yaml:"trackValueSizes"`
+	MaxMessageSize int `yaml:"maxMessageSize"`
+	WireCompression bool `yaml:"wireCompression"`
+	Multiplexing bool `yaml:"multiplexing"`
+	MaxMultiplexedRequests int `yaml:"maxMultiplexedRequests"`
+	FanoutConcurrency int `yaml:"fanoutConcurrency"`
+	PartitionSizeHighWatermark int `yaml:"partitionSizeHighWatermark"`
+	PartitionSizeLowWatermark int `yaml:"partitionSizeLowWatermark"`
+	HotPartitionRatio float64 `yaml:"hotPartitionRatio"`
+	MetricsAddr string `yaml:"metricsAddr"`
+	ClampClockSkew bool `yaml:"clampClockSkew"`
+	BackupMode int `yaml:"backupMode"`
+	ReplicationTopology int `yaml:"replicationTopology"`
+	LazyBackupFlushInterval string `yaml:"lazyBackupFlushInterval"`
+	LazyBackupBufferSize int `yaml:"lazyBackupBufferSize"`
+	WALDir string `yaml:"walDir"`
+	WALSyncMode int `yaml:"walSyncMode"`
+}
+
+// rpcRetryBackoff contains configuration variables of the retries of the read requests.
+type rpcRetryBackoff struct {
+	MaxRetries int    `yaml:"maxRetries"`
+	MinDelay   string `yaml:"minDelay"`
+	MaxDelay   string `yaml:"maxDelay"`
 }
 
 // logging contains configuration variables of logging section of config file.
@@ -90,6 +152,11 @@ type cache struct {
 	MaxInuse           int    `yaml:"maxInuse"`
 	LRUSamples         int    `yaml:"lruSamples"`
 	EvictionPolicy     string `yaml:"evictionPolicy"`
+	MaxConcurrentOps   int    `yaml:"maxConcurrentOps"`
+	ReadOnly           bool   `yaml:"readOnly"`
+	DemoteTo           string `yaml:"demoteTo"`
+	HistorySize        int    `yaml:"historySize"`
+	HistoryMaxKeys     int    `yaml:"historyMaxKeys"`
 }
 
 // Config is the main configuration struct
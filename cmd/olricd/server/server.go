@@ -66,10 +66,15 @@ func prepareCacheConfig(c *Config) (*config.CacheConfig, error) {
 		res.DMapConfigs = make(map[string]config.DMapCacheConfig)
 		for name, dc := range c.DMaps {
 			cc := config.DMapCacheConfig{
-				MaxInuse:       dc.MaxInuse,
-				MaxKeys:        dc.MaxKeys,
-				EvictionPolicy: config.EvictionPolicy(dc.EvictionPolicy),
-				LRUSamples:     dc.LRUSamples,
+				MaxInuse:         dc.MaxInuse,
+				MaxKeys:          dc.MaxKeys,
+				EvictionPolicy:   config.EvictionPolicy(dc.EvictionPolicy),
+				LRUSamples:       dc.LRUSamples,
+				MaxConcurrentOps: dc.MaxConcurrentOps,
+				ReadOnly:         dc.ReadOnly,
+				DemoteTo:         dc.DemoteTo,
+				HistorySize:      dc.HistorySize,
+				HistoryMaxKeys:   dc.HistoryMaxKeys,
 			}
 			if dc.MaxIdleDuration != "" {
 				maxIdleDuration, err := time.ParseDuration(dc.MaxIdleDuration)
@@ -107,15 +112,16 @@ func New(c *Config) (*Olricd, error) {
 	}
 
 	// Default serializer is Gob serializer, just set nil or use gob keyword to use it.
-	var sr serializer.Serializer
-	if c.Olricd.Serializer == "json" {
-		sr = serializer.NewJSONSerializer()
-	} else if c.Olricd.Serializer == "msgpack" {
-		sr = serializer.NewMsgpackSerializer()
-	} else if c.Olricd.Serializer == "gob" {
-		sr = serializer.NewGobSerializer()
-	} else {
-		return nil, fmt.Errorf("invalid serializer: %s", c.Olricd.Serializer)
+	sr, err := newSerializer(c.Olricd.Serializer)
+	if err != nil {
+		return nil, err
+	}
+	var msr serializer.Serializer
+	if c.Olricd.MigrationSerializer != "" {
+		msr, err = newSerializer(c.Olricd.MigrationSerializer)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	mc, err := newMemberlistConf(c)
@@ -123,7 +129,7 @@ func New(c *Config) (*Olricd, error) {
 		return nil, err
 	}
 
-	var joinRetryInterval, keepAlivePeriod, requestTimeout time.Duration
+	var joinRetryInterval, keepAlivePeriod, requestTimeout, idleConnTimeout, opIDCacheTTL, circuitBreakerCooldown, rebalanceDelay, lazyBackupFlushInterval, maxClockSkew, destroyWaitTimeout, redirectedReadCacheTTL, readRepairMinLag, reaperInterval time.Duration
 	if c.Olricd.KeepAlivePeriod != "" {
 		keepAlivePeriod, err = time.ParseDuration(c.Olricd.KeepAlivePeriod)
 		if err != nil {
@@ -138,6 +144,93 @@ func New(c *Config) (*Olricd, error) {
 				fmt.Sprintf("failed to parse olricd.requestTimeout: '%s'", c.Olricd.RequestTimeout))
 		}
 	}
+	if c.Olricd.IdleConnTimeout != "" {
+		idleConnTimeout, err = time.ParseDuration(c.Olricd.IdleConnTimeout)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.idleConnTimeout: '%s'", c.Olricd.IdleConnTimeout))
+		}
+	}
+	if c.Olricd.OpIDCacheTTL != "" {
+		opIDCacheTTL, err = time.ParseDuration(c.Olricd.OpIDCacheTTL)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.opIDCacheTTL: '%s'", c.Olricd.OpIDCacheTTL))
+		}
+	}
+	if c.Olricd.CircuitBreakerCooldown != "" {
+		circuitBreakerCooldown, err = time.ParseDuration(c.Olricd.CircuitBreakerCooldown)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.circuitBreakerCooldown: '%s'", c.Olricd.CircuitBreakerCooldown))
+		}
+	}
+	if c.Olricd.LazyBackupFlushInterval != "" {
+		lazyBackupFlushInterval, err = time.ParseDuration(c.Olricd.LazyBackupFlushInterval)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.lazyBackupFlushInterval: '%s'", c.Olricd.LazyBackupFlushInterval))
+		}
+	}
+	if c.Olricd.MaxClockSkew != "" {
+		maxClockSkew, err = time.ParseDuration(c.Olricd.MaxClockSkew)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.maxClockSkew: '%s'", c.Olricd.MaxClockSkew))
+		}
+	}
+	if c.Olricd.RedirectedReadCacheTTL != "" {
+		redirectedReadCacheTTL, err = time.ParseDuration(c.Olricd.RedirectedReadCacheTTL)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.redirectedReadCacheTTL: '%s'", c.Olricd.RedirectedReadCacheTTL))
+		}
+	}
+	if c.Olricd.ReadRepairMinLag != "" {
+		readRepairMinLag, err = time.ParseDuration(c.Olricd.ReadRepairMinLag)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.readRepairMinLag: '%s'", c.Olricd.ReadRepairMinLag))
+		}
+	}
+	if c.Olricd.ReaperInterval != "" {
+		reaperInterval, err = time.ParseDuration(c.Olricd.ReaperInterval)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.reaperInterval: '%s'", c.Olricd.ReaperInterval))
+		}
+	}
+	if c.Olricd.DestroyWaitTimeout != "" {
+		destroyWaitTimeout, err = time.ParseDuration(c.Olricd.DestroyWaitTimeout)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.destroyWaitTimeout: '%s'", c.Olricd.DestroyWaitTimeout))
+		}
+	}
+	if c.Olricd.RebalanceDelay != "" {
+		rebalanceDelay, err = time.ParseDuration(c.Olricd.RebalanceDelay)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.rebalanceDelay: '%s'", c.Olricd.RebalanceDelay))
+		}
+	}
+	rpcRetryBackoff := config.RetryBackoff{
+		MaxRetries: c.Olricd.RPCRetryBackoff.MaxRetries,
+	}
+	if c.Olricd.RPCRetryBackoff.MinDelay != "" {
+		rpcRetryBackoff.MinDelay, err = time.ParseDuration(c.Olricd.RPCRetryBackoff.MinDelay)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.rpcRetryBackoff.minDelay: '%s'", c.Olricd.RPCRetryBackoff.MinDelay))
+		}
+	}
+	if c.Olricd.RPCRetryBackoff.MaxDelay != "" {
+		rpcRetryBackoff.MaxDelay, err = time.ParseDuration(c.Olricd.RPCRetryBackoff.MaxDelay)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				fmt.Sprintf("failed to parse olricd.rpcRetryBackoff.maxDelay: '%s'", c.Olricd.RPCRetryBackoff.MaxDelay))
+		}
+	}
 	if c.Memberlist.JoinRetryInterval != "" {
 		joinRetryInterval, err = time.ParseDuration(c.Memberlist.JoinRetryInterval)
 		if err != nil {
@@ -153,29 +246,84 @@ func New(c *Config) (*Olricd, error) {
 
 	s.log = log.New(logOutput, "", log.LstdFlags)
 	s.config = &config.Config{
-		Name:              c.Olricd.Name,
-		MemberlistConfig:  mc,
-		LogLevel:          c.Logging.Level,
-		JoinRetryInterval: joinRetryInterval,
-		MaxJoinAttempts:   c.Memberlist.MaxJoinAttempts,
-		Peers:             c.Memberlist.Peers,
-		PartitionCount:    c.Olricd.PartitionCount,
-		ReplicaCount:      c.Olricd.ReplicaCount,
-		WriteQuorum:       c.Olricd.WriteQuorum,
-		ReadQuorum:        c.Olricd.ReadQuorum,
-		ReplicationMode:   c.Olricd.ReplicationMode,
-		ReadRepair:        c.Olricd.ReadRepair,
-		LoadFactor:        c.Olricd.LoadFactor,
-		MemberCountQuorum: c.Olricd.MemberCountQuorum,
-		Logger:            s.log,
-		LogOutput:         logOutput,
-		LogVerbosity:      c.Logging.Verbosity,
-		Hasher:            hasher.NewDefaultHasher(),
-		Serializer:        sr,
-		KeepAlivePeriod:   keepAlivePeriod,
-		RequestTimeout:    requestTimeout,
-		Cache:             cacheConfig,
-		TableSize:         c.Olricd.TableSize,
+		Name:                        c.Olricd.Name,
+		MemberlistConfig:            mc,
+		LogLevel:                    c.Logging.Level,
+		JoinRetryInterval:           joinRetryInterval,
+		MaxJoinAttempts:             c.Memberlist.MaxJoinAttempts,
+		Peers:                       c.Memberlist.Peers,
+		PartitionCount:              c.Olricd.PartitionCount,
+		ReplicaCount:                c.Olricd.ReplicaCount,
+		WriteQuorum:                 c.Olricd.WriteQuorum,
+		ReadQuorum:                  c.Olricd.ReadQuorum,
+		Region:                      c.Olricd.Region,
+		ReadRegionQuorum:            c.Olricd.ReadRegionQuorum,
+		ReadWeight:                  c.Olricd.ReadWeight,
+		ReplicationMode:             c.Olricd.ReplicationMode,
+		ReadRepair:                  c.Olricd.ReadRepair,
+		ReadRepairMinLag:            readRepairMinLag,
+		CopyPreservesTimestamp:      c.Olricd.CopyPreservesTimestamp,
+		LoadFactor:                  c.Olricd.LoadFactor,
+		Distribution:                config.Distribution(c.Olricd.Distribution),
+		MemberCountQuorum:           c.Olricd.MemberCountQuorum,
+		MinimumMemberQuorum:         c.Olricd.MinimumMemberQuorum,
+		Logger:                      s.log,
+		LogOutput:                   logOutput,
+		LogVerbosity:                c.Logging.Verbosity,
+		Hasher:                      hasher.NewDefaultHasher(),
+		Serializer:                  sr,
+		MigrationSerializer:         msr,
+		KeepAlivePeriod:             keepAlivePeriod,
+		RequestTimeout:              requestTimeout,
+		Cache:                       cacheConfig,
+		TableSize:                   c.Olricd.TableSize,
+		MaxConnsPerMember:           c.Olricd.MaxConnsPerMember,
+		MinConnsPerMember:           c.Olricd.MinConnsPerMember,
+		IdleConnTimeout:             idleConnTimeout,
+		PlacementHints:              c.Olricd.PlacementHints,
+		OpIDCacheSize:               c.Olricd.OpIDCacheSize,
+		GetAllLimit:                 c.Olricd.GetAllLimit,
+		ReaperInterval:              reaperInterval,
+		ReaperBatchSize:             c.Olricd.ReaperBatchSize,
+		OpIDCacheTTL:                opIDCacheTTL,
+		OrderedIndexes:              c.Olricd.OrderedIndexes,
+		RebalanceRateLimit:          c.Olricd.RebalanceRateLimit,
+		RebalanceDelay:              rebalanceDelay,
+		RebalanceImbalanceThreshold: c.Olricd.RebalanceImbalanceThreshold,
+		EnableScrubber:              c.Olricd.EnableScrubber,
+		EnableMemberReads:           c.Olricd.EnableMemberReads,
+		PreferUnexpiredVersions:     c.Olricd.PreferUnexpiredVersions,
+		MaxReadVersions:             c.Olricd.MaxReadVersions,
+		AvoidReplicaReads:           c.Olricd.AvoidReplicaReads,
+		AllowLocalOnlyOnPartition:   c.Olricd.AllowLocalOnlyOnPartition,
+		RedirectedReadCacheTTL:      redirectedReadCacheTTL,
+		ScrubRate:                   c.Olricd.ScrubRate,
+		CircuitBreakerThreshold:     c.Olricd.CircuitBreakerThreshold,
+		CircuitBreakerCooldown:      circuitBreakerCooldown,
+		RPCRetryBackoff:             rpcRetryBackoff,
+		BackupMode:                  c.Olricd.BackupMode,
+		ReplicationTopology:         c.Olricd.ReplicationTopology,
+		LazyBackupFlushInterval:     lazyBackupFlushInterval,
+		LazyBackupBufferSize:        c.Olricd.LazyBackupBufferSize,
+		WALDir:                      c.Olricd.WALDir,
+		WALSyncMode:                 c.Olricd.WALSyncMode,
+		GlobalMaxMemory:             c.Olricd.GlobalMaxMemory,
+		GlobalMemoryLowWatermark:    c.Olricd.GlobalMemoryLowWatermark,
+		MaxKeysPerPartition:         c.Olricd.MaxKeysPerPartition,
+		MaxClockSkew:                maxClockSkew,
+		MetricsAddr:                 c.Olricd.MetricsAddr,
+		ReadProfileSampleRate:       c.Olricd.ReadProfileSampleRate,
+		TrackValueSizes:             c.Olricd.TrackValueSizes,
+		MaxMessageSize:              c.Olricd.MaxMessageSize,
+		WireCompression:             c.Olricd.WireCompression,
+		Multiplexing:                c.Olricd.Multiplexing,
+		MaxMultiplexedRequests:      c.Olricd.MaxMultiplexedRequests,
+		FanoutConcurrency:           c.Olricd.FanoutConcurrency,
+		PartitionSizeHighWatermark:  c.Olricd.PartitionSizeHighWatermark,
+		PartitionSizeLowWatermark:   c.Olricd.PartitionSizeLowWatermark,
+		HotPartitionRatio:           c.Olricd.HotPartitionRatio,
+		DestroyWaitTimeout:          destroyWaitTimeout,
+		ClampClockSkew:              c.Olricd.ClampClockSkew,
 	}
 	return s, nil
 }
@@ -230,3 +378,16 @@ func (s *Olricd) Start() error {
 	})
 	return s.errgr.Wait()
 }
+
+func newSerializer(name string) (serializer.Serializer, error) {
+	switch name {
+	case "json":
+		return serializer.NewJSONSerializer(), nil
+	case "msgpack":
+		return serializer.NewMsgpackSerializer(), nil
+	case "gob":
+		return serializer.NewGobSerializer(), nil
+	default:
+		return nil, fmt.Errorf("invalid serializer: %s", name)
+	}
+}
@@ -18,8 +18,10 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -41,6 +43,39 @@ const (
 	AsyncReplicationMode = 1
 )
 
+const (
+	// EagerBackupMode sends a replica write to the backup owners for every write.
+	// The default mode is EagerBackupMode.
+	EagerBackupMode = 0
+
+	// LazyBackupMode buffers the replica writes per backup owner and sends them
+	// in batches. The backups may lag behind the partition owners.
+	LazyBackupMode = 1
+)
+
+const (
+	// StarReplicationTopology sends the replica writes from the partition owner
+	// to every backup owner. The default topology is StarReplicationTopology.
+	StarReplicationTopology = 0
+
+	// ChainReplicationTopology relays the replica writes from the partition
+	// owner to the first backup owner, then to the next one and so on.
+	ChainReplicationTopology = 1
+)
+
+const (
+	// WALSyncNone leaves flushing the write-ahead log to the operating system.
+	// The writes survive a process crash but may be lost if the machine crashes.
+	// The default mode is WALSyncNone.
+	WALSyncNone = 0
+
+	// WALSyncAlways calls fsync after every write. The writes survive a machine
+	// crash but the write throughput of a partition is bounded by the fsync
+	// latency of the disk, typically a few hundred writes per second on HDDs
+	// and a few thousand on SSDs.
+	WALSyncAlways = 1
+)
+
 const (
 	// DefaultPartitionCount denotes default partition count in the cluster.
 	DefaultPartitionCount = 271
@@ -94,15 +129,111 @@ const (
 	// DefaultTableSize is 1MB if you don't set your own value.
 	DefaultTableSize = 1 << 20
 
+	// DefaultMaxConnsPerMember denotes the default maximum number of connections
+	// kept in the connection pool of a member.
+	DefaultMaxConnsPerMember = 1024
+
+	// DefaultHistoryMaxKeys denotes the default number of keys whose write
+	// history is kept per DMap on a member. See DMapCacheConfig.HistorySize.
+	DefaultHistoryMaxKeys = 1024
+
+	// DefaultReaperInterval denotes the default time to wait between the runs
+	// of an expiry reaper worker. See ReaperInterval.
+	DefaultReaperInterval = 100 * time.Millisecond
+
+	// DefaultReaperBatchSize denotes the default number of entries scanned by
+	// the expiry reaper per batch. See ReaperBatchSize.
+	DefaultReaperBatchSize = 20
+
+	// DefaultGetAllLimit denotes the default maximum number of entries returned
+	// by DMap.GetAll.
+	DefaultGetAllLimit = 10000
+
+	// DefaultOpIDCacheSize denotes the default number of responses kept to
+	// recognize replayed operations.
+	DefaultOpIDCacheSize = 1024
+
+	// DefaultOpIDCacheTTL denotes the default period to keep a response of
+	// an operation with an OpID.
+	DefaultOpIDCacheTTL = time.Minute
+
+	// DefaultCircuitBreakerCooldown denotes the default period to short-circuit
+	// the requests to a failing member.
+	DefaultCircuitBreakerCooldown = 10 * time.Second
+
+	// DefaultScrubRate denotes the default number of keys scanned by
+	// the scrubber per second.
+	DefaultScrubRate = 100
+
+	// DefaultRPCRetryMinDelay denotes the default upper bound of the delay
+	// before the first retry of a request to a member.
+	DefaultRPCRetryMinDelay = 10 * time.Millisecond
+
+	// DefaultRPCRetryMaxDelay denotes the default maximum delay between the
+	// retries of a request to a member.
+	DefaultRPCRetryMaxDelay = time.Second
+
+	// DefaultLazyBackupFlushInterval denotes the default period to flush the
+	// buffered replica writes in LazyBackupMode.
+	DefaultLazyBackupFlushInterval = 100 * time.Millisecond
+
+	// DefaultLazyBackupBufferSize denotes the default number of the buffered
+	// replica writes per backup owner in LazyBackupMode.
+	DefaultLazyBackupBufferSize = 1024
+
+	// DefaultGlobalMemoryLowWatermark denotes the default fraction of GlobalMaxMemory
+	// to stop the global eviction.
+	DefaultGlobalMemoryLowWatermark = 0.8
+
+	// DefaultDestroyWaitTimeout denotes the default maximum duration to wait for
+	// a DMap to be destroyed before applying a write.
+	DefaultDestroyWaitTimeout = 10 * time.Second
+
+	// DefaultReadWeight denotes the default read weight of a member.
+	DefaultReadWeight = 1
+
+	// DefaultPartitionSizeHighWatermark denotes the default mean size of the
+	// primary partitions, in bytes, above which Olric.SuggestPartitionCount
+	// suggests more partitions.
+	DefaultPartitionSizeHighWatermark = 1 << 28
+
+	// DefaultHotPartitionRatio denotes the default ratio of the size of a
+	// partition to the mean size to report it as hot.
+	DefaultHotPartitionRatio = 2.0
+
 	DefaultLRUSamples int = 5
 
 	// Assign this as EvictionPolicy in order to enable LRU eviction algorithm.
 	LRUEviction EvictionPolicy = "LRU"
+
+	// Assign this as Distribution in order to use consistent hashing with
+	// bounded loads. It's the default.
+	ConsistentDistribution Distribution = "consistent"
+
+	// Assign this as Distribution in order to use rendezvous (highest random
+	// weight) hashing.
+	RendezvousDistribution Distribution = "rendezvous"
 )
 
 // EvictionPolicy denotes eviction policy. Currently: LRU or NONE.
 type EvictionPolicy string
 
+// Distribution denotes the strategy which assigns the partitions to the members.
+type Distribution string
+
+// VData denotes a version of a key/value pair passed to MergeFunc. Value is
+// the serialized value, use the Serializer to decode it.
+type VData struct {
+	Key       string
+	Value     []byte
+	Timestamp int64
+}
+
+// MergeFunc resolves a write whose timestamp is older than or equal to the
+// timestamp of the stored version. The returned version is stored and replicated
+// instead of the incoming one. The TTL of the incoming write is kept.
+type MergeFunc func(existing, incoming VData) VData
+
 // note on DMapCacheConfig and CacheConfig:
 // golang doesn't provide the typical notion of inheritance.
 // because of that I preferred to define the types explicitly.
@@ -135,6 +266,72 @@ type DMapCacheConfig struct {
 	// EvictionPolicy determines the eviction policy in use. It's NONE by default.
 	// Set as LRU to enable LRU eviction policy.
 	EvictionPolicy EvictionPolicy
+
+	// MaxConcurrentOps denotes maximum number of in-flight operations on the DMap
+	// served by a particular node. The requests beyond the limit are rejected with
+	// ErrTooManyRequests. It bounds the memory used by the buffered values.
+	// Zero means unlimited.
+	MaxConcurrentOps int
+
+	// MergeFunc is called on the partition owner when a write is older than or
+	// equal to the stored version, e.g. an out of order write. It's useful to
+	// implement application-defined conflict resolution. If it's nil, the write
+	// is applied as is.
+	MergeFunc MergeFunc `msgpack:"-"`
+
+	// ReadOnly rejects the write operations on the DMap with ErrReadOnly on the
+	// partition owners. It can be changed at runtime with DMap.MakeReadOnly
+	// and DMap.MakeWritable.
+	ReadOnly bool
+
+	// ReplicaCount overrides Config.ReplicaCount for the DMap. It cannot be
+	// greater than Config.ReplicaCount, every partition has Config.ReplicaCount-1
+	// backup owners and the DMap is copied to the first ReplicaCount-1 of them.
+	// ReadQuorum and WriteQuorum are capped by it. All the members have to use
+	// the same value, a member with a different one cannot join the cluster.
+	// Zero means Config.ReplicaCount.
+	ReplicaCount int
+
+	// DemoteTo moves the evicted keys of the DMap to the given DMap instead of
+	// deleting them, e.g. from a hot tier to a warm one. It applies to the keys
+	// evicted by TTL, MaxIdleDuration and LRU. The moved key has no TTL, the
+	// TTLDuration of the target DMap applies.
+	//
+	// The key is written to the target DMap and then deleted from this one,
+	// under the lock of the DMap on the partition owner. The writes to the key
+	// wait for the move. If the write to the target DMap fails, the key is kept
+	// and the eviction is retried later. If the delete fails, the key exists in
+	// both DMaps until the next attempt. A DMap cannot be demoted to itself,
+	// directly or through the other DMaps. Empty string disables it.
+	DemoteTo string
+
+	// HistorySize enables the write history of the keys for debugging. The
+	// partition owner keeps the last HistorySize writes and deletes of a key
+	// with their timestamps and the hashes of the values. See DMap.History.
+	// It adds memory and write overhead. Zero disables it.
+	HistorySize int
+
+	// HistoryMaxKeys denotes the maximum number of keys whose history is kept
+	// on a member. The least recently written keys are forgotten first.
+	// The default value is 1024.
+	HistoryMaxKeys int
+}
+
+// RetryBackoff denotes the retry policy of the read requests to the other members.
+// The delay before a retry is chosen randomly between zero and MinDelay * 2^n,
+// capped by MaxDelay, where n is the number of consecutive failures of the member.
+type RetryBackoff struct {
+	// MaxRetries denotes the maximum number of retries of a request. Zero
+	// disables the retries.
+	MaxRetries int
+
+	// MinDelay denotes the upper bound of the delay before the first retry.
+	// The default value is 10 milliseconds.
+	MinDelay time.Duration
+
+	// MaxDelay denotes the maximum delay between the retries. The default
+	// value is one second.
+	MaxDelay time.Duration
 }
 
 // CacheConfig denotes a global cache configuration for DMaps. You can still overwrite it by setting a
@@ -199,6 +396,186 @@ type Config struct {
 
 	RequestTimeout time.Duration
 
+	// MaxConnsPerMember denotes the maximum number of connections kept open in
+	// the connection pool of a member. When the pool is exhausted, a request dials
+	// a new connection and it's closed after use if the pool is still full.
+	// The default value is 1024.
+	MaxConnsPerMember int
+
+	// MinConnsPerMember denotes the number of connections created when the
+	// connection pool of a member is initialized. It's zero by default.
+	MinConnsPerMember int
+
+	// IdleConnTimeout denotes the maximum amount of time a connection may stay
+	// idle in the pool before being closed. Zero means no limit.
+	IdleConnTimeout time.Duration
+
+	// GetAllLimit denotes the maximum number of entries returned by DMap.GetAll.
+	// It returns ErrResultTooLarge if the DMap has more live entries, so
+	// a DMap which is not small enough is never fetched by accident.
+	// The default value is 10000.
+	GetAllLimit int
+
+	// OpIDCacheSize denotes the maximum number of responses kept by a partition
+	// owner to recognize the replayed atomic operations with the same OpID.
+	// The default value is 1024.
+	OpIDCacheSize int
+
+	// OpIDCacheTTL denotes how long the response of an operation with an OpID
+	// is kept. The default value is one minute.
+	OpIDCacheTTL time.Duration
+
+	// RebalanceRateLimit denotes the maximum number of bytes per second
+	// transferred by the rebalancer and the backup warm-up on join. Zero means
+	// no limit.
+	RebalanceRateLimit int
+
+	// RebalanceDelay denotes how long the cluster coordinator waits for the
+	// membership to stabilize before updating the routing table. Every join or
+	// leave event restarts the delay. Zero means that the routing table is
+	// updated immediately.
+	RebalanceDelay time.Duration
+
+	// RebalanceImbalanceThreshold denotes the fraction of the primary partitions,
+	// between 0 and 1, which have to change hands to move the partitions on
+	// a membership change. Otherwise the current routing table is kept. The
+	// partitions of the departed members are always moved. Zero means that
+	// the partitions are moved on every membership change.
+	RebalanceImbalanceThreshold float64
+
+	// EnableScrubber starts a background job which walks the primary partitions
+	// and repairs the stale replicas without waiting for a read request.
+	// It's disabled by default.
+	EnableScrubber bool
+
+	// ScrubRate denotes the maximum number of keys scanned by the scrubber
+	// per second. The default value is 100.
+	ScrubRate int
+
+	// CircuitBreakerThreshold denotes the number of consecutive failures on
+	// the read path to open the circuit breaker of a member. The requests to
+	// the member are short-circuited for CircuitBreakerCooldown, then a single
+	// request probes it. Zero disables the circuit breaker.
+	CircuitBreakerThreshold int
+
+	// CircuitBreakerCooldown denotes how long a circuit breaker stays open.
+	// The default value is 10 seconds.
+	CircuitBreakerCooldown time.Duration
+
+	// RPCRetryBackoff denotes the retry policy of the read requests to the other
+	// members, including the redirected Get requests. Only the network errors
+	// are retried. The retries are disabled by default.
+	RPCRetryBackoff RetryBackoff
+
+	// MaxKeysPerPartition denotes the maximum number of keys a DMap can keep on
+	// a primary partition. If a DMap with LRU eviction policy is full, the least
+	// recently used key is evicted to make room for the new one. Otherwise, the
+	// new keys are rejected with ErrPartitionFull. Zero means no limit.
+	MaxKeysPerPartition int
+
+	// GlobalMaxMemory denotes the maximum number of bytes in use by the keys and
+	// the values on this member, including the backups. If it's exceeded, the
+	// expired keys are deleted and the keys of the DMaps with LRU eviction policy
+	// are evicted, in proportion to the memory used by each DMap, until the usage
+	// drops below GlobalMemoryLowWatermark. The DMaps without an eviction policy
+	// are never evicted. Zero disables it.
+	GlobalMaxMemory int
+
+	// GlobalMemoryLowWatermark denotes the fraction of GlobalMaxMemory, between
+	// 0 and 1, to stop the global eviction. The default value is 0.8.
+	GlobalMemoryLowWatermark float64
+
+	// MetricsAddr denotes the address to serve the metrics in Prometheus text
+	// format at /metrics, e.g. "0.0.0.0:9090". The operations served through the
+	// protocol are measured, including the requests redirected by the other
+	// members. Empty string disables it.
+	MetricsAddr string
+
+	// ReadProfileSampleRate enables the read profiler for 1 in ReadProfileSampleRate
+	// reads on the partition owners. The time spent looking up the owners and the
+	// replicas, sorting the versions and read-repair is reported in Stats.
+	// Zero disables it.
+	ReadProfileSampleRate int
+
+	// TrackValueSizes keeps a histogram of the sizes of the values written
+	// through this member per DMap. The histograms are reported in Stats and
+	// cleared by Olric.ResetValueSizes. It's disabled by default.
+	TrackValueSizes bool
+
+	// MaxMessageSize denotes the maximum body length of a request in bytes,
+	// including the key, the DMap name and the value. The limit is checked
+	// against the length declared in the message header and the oversized
+	// requests are rejected with ErrMessageTooLarge before reading the body.
+	// The partitions moved between the members are exempted. Zero means no limit.
+	MaxMessageSize int
+
+	// WireCompression compresses the connection streams to the other members with
+	// DEFLATE, including the headers and the batch payloads. It's negotiated in the
+	// connection handshake, the connections to the members which don't support it
+	// are not compressed. The incoming connections are compressed if the dialing
+	// side asks for it, regardless of this option. It's orthogonal to the value
+	// compression and useful for the bandwidth-constrained links between regions.
+	//
+	// It trades CPU for bandwidth. Every message is flushed separately, so a
+	// small write takes about three times longer than an uncompressed one on a
+	// loopback interface, see BenchmarkWireCompression. Every compressed
+	// connection also keeps its own compression state, around 500KB. Don't
+	// enable it on a fast local network.
+	WireCompression bool
+
+	// Multiplexing sends the requests to the other members over a single
+	// connection per member instead of the connection pool. The requests are
+	// prefixed with an ID and the responses are matched by it, so a slow request
+	// doesn't block the others. It reduces the number of file descriptors under
+	// high fan-out. It's negotiated in the connection handshake, the pool is used
+	// for the members which don't support it. It's disabled by default.
+	Multiplexing bool
+
+	// MaxMultiplexedRequests denotes the maximum number of concurrent requests
+	// on a multiplexed connection. The requests beyond it wait for a slot.
+	// The default value is 256.
+	MaxMultiplexedRequests int
+
+	// FanoutConcurrency denotes the maximum number of members which are contacted
+	// in parallel by the cluster-wide operations, like Keys, RangeBetween,
+	// DeleteExpired, Destroy and the routing table updates. The members are
+	// processed in waves of this size. ImportSnapshot writes the partitions in
+	// waves of the same size. A smaller value lowers the load of a single
+	// operation on a large cluster and makes it slower. The default value is the
+	// number of CPUs.
+	FanoutConcurrency int
+
+	// PartitionSizeHighWatermark denotes the mean size of the primary partitions,
+	// in bytes, above which Olric.SuggestPartitionCount suggests a higher
+	// PartitionCount. The default value is 256MB.
+	PartitionSizeHighWatermark int
+
+	// PartitionSizeLowWatermark denotes the mean size of the primary partitions,
+	// in bytes, below which Olric.SuggestPartitionCount suggests a lower
+	// PartitionCount to reduce the overhead. It's disabled by default.
+	PartitionSizeLowWatermark int
+
+	// HotPartitionRatio denotes the ratio of the size of a partition to the mean
+	// size to report it as hot in Olric.SuggestPartitionCount. The default value
+	// is 2.
+	HotPartitionRatio float64
+
+	// DestroyWaitTimeout denotes the maximum duration to keep a DMap in destroying
+	// state. The reads on a DMap being destroyed return ErrDMapUnavailable and the
+	// writes wait until the DMap is destroyed or DestroyWaitTimeout passes.
+	// The default value is 10 seconds.
+	DestroyWaitTimeout time.Duration
+
+	// MaxClockSkew denotes the maximum duration the timestamp of a write may be
+	// ahead of the clock of the partition owner. The writes beyond it are
+	// rejected with ErrClockSkew, or clamped if ClampClockSkew is set. The
+	// versions which are too far ahead are reported in Stats. Zero disables it.
+	MaxClockSkew time.Duration
+
+	// ClampClockSkew replaces the timestamp of a write which exceeds MaxClockSkew
+	// with the local time instead of rejecting it.
+	ClampClockSkew bool
+
 	// The list of host:port which are used by memberlist for discovery. Don't confuse it with Name.
 	Peers []string
 
@@ -211,28 +588,189 @@ type Config struct {
 	// Minimum number of successful reads to return a response for a read request.
 	ReadQuorum int
 
+	// Region denotes the region of this member. It's shared with the other
+	// members via the node metadata. It's empty by default.
+	Region string
+
+	// ReadRegionQuorum denotes the minimum number of distinct regions which
+	// should respond with a version of the key for a read request, in addition
+	// to ReadQuorum. The members without a region don't count. Zero disables it.
+	ReadRegionQuorum int
+
+	// ReadWeight denotes the relative capacity of this member to serve the reads.
+	// It's shared with the other members via the node metadata. The replicas are
+	// consulted in descending order of their weights on the read path, so it only
+	// takes effect with MaxReadVersions: the reads which stop early are served by
+	// the heavier replicas. Otherwise every replica is consulted anyway. It doesn't
+	// affect the read quorum. The default value is 1.
+	ReadWeight int
+
 	// Minimum number of successful writes to return a response for a write request.
 	WriteQuorum int
 
 	// Minimum number of members to form a cluster and run any query on the cluster.
 	MemberCountQuorum int32
 
+	// MinimumMemberQuorum is the number of members which have to be present
+	// before this member starts serving the reads and writes. Until then, it
+	// returns ErrClusterNotReady, so a fresh cluster doesn't store unreplicated
+	// data which conflicts during the rebalance. Unlike MemberCountQuorum, it's
+	// only checked until it's met once. See Olric.Ready. Zero disables it.
+	MinimumMemberQuorum int32
+
 	// Switch to control read-repair algorithm which helps to reduce entropy.
 	ReadRepair bool
 
+	// ReadRepairMinLag skips the read-repair of the replicas whose timestamps
+	// are behind the winner by no more than ReadRepairMinLag. Such replicas
+	// are likely to receive the write by the replication, repairing them
+	// races with it and amplifies the writes. The missing replicas are always
+	// repaired, and DMap.Repair ignores it. Zero repairs every stale replica.
+	ReadRepairMinLag time.Duration
+
+	// PreferUnexpiredVersions makes the reads skip the expired versions of a key
+	// if a non-expired one exists on the other owners or replicas. The newest
+	// non-expired version wins. By default, the newest version wins, and the key
+	// is reported as expired if it has expired. Enabling it may serve an older
+	// value after the latest one has expired.
+	PreferUnexpiredVersions bool
+
+	// MaxReadVersions caps the number of the versions collected for a read on
+	// the partition owner. It stops querying the previous owners and the
+	// replicas once it has found MaxReadVersions versions of the key. It's
+	// never less than the read quorum of the request, set it to the read quorum
+	// plus a margin. ReadOptions.ReadAll and ReadOptions.MajorityAgreement
+	// ignore it. Zero disables it.
+	MaxReadVersions int
+
+	// AvoidReplicaReads skips the replica lookups of a read if the partition
+	// owner and the previous owners already have ReadQuorum versions of the key.
+	// It saves the replica RPCs when the key is on the partition owner. The
+	// replicas are still consulted if the owners don't have the key, e.g. after
+	// a member failure. It's ignored by the reads with read-repair, ReadAll and
+	// MajorityAgreement, and if ReadRegionQuorum or PreferUnexpiredVersions is
+	// set. It's disabled by default.
+	AvoidReplicaReads bool
+
+	// AllowLocalOnlyOnPartition serves the reads from the local storage of this
+	// member when it cannot reach any other member of the cluster, e.g. during
+	// a network partition. A member is cut off if it has had peers, and all of
+	// them have left its member list or their circuit breakers are open. See
+	// CircuitBreakerThreshold. If a read fails on such a member, DMap.Get and
+	// DMap.GetWithOptions return the latest version on the primary and the
+	// backup partitions of this member along with ErrDegradedRead.
+	//
+	// It trades consistency for availability: the value may be outdated or
+	// already deleted. The keys served in this way are repaired once the member
+	// is back in the cluster. See DMap.Repair. It's disabled by default.
+	AllowLocalOnlyOnPartition bool
+
+	// RedirectedReadCacheTTL enables the coalescing of the reads redirected to
+	// the partition owners by this member. The concurrent Get requests for the
+	// same key are sent to the partition owner once, and the response is served
+	// to the next requests for RedirectedReadCacheTTL. A read may return
+	// a value which is RedirectedReadCacheTTL old, including the writes done
+	// through this member. It has to be less than a second. Zero disables it.
+	RedirectedReadCacheTTL time.Duration
+
+	// EnableMemberReads allows Olric.GetFromMember which reads the version of
+	// a key on a given member without quorum or read-repair. It's meant for
+	// testing and debugging the divergence of the replicas. It's disabled by
+	// default.
+	EnableMemberReads bool
+
+	// ValueEqual reports whether two serialized values are logically equal.
+	// The versions of a key with the same timestamp are ordered by comparing
+	// the raw bytes of the values. Set it if logically equal values, e.g.
+	// maps, may serialize to different bytes. The versions with different
+	// timestamps and logically equal values are not repaired and don't count
+	// as diverged, see ReadRepair. It's nil by default.
+	ValueEqual func(a, b []byte) bool
+
+	// CopyPreservesTimestamp makes DMap.Copy keep the timestamp of the source
+	// key instead of refreshing it. Keep in mind that an older timestamp may
+	// lose against the existing value of the destination key in read-repair.
+	CopyPreservesTimestamp bool
+
 	// Default value is SyncReplicationMode.
 	ReplicationMode int
 
+	// BackupMode controls how the replica writes of Put and its variants are sent
+	// to the backup owners. In LazyBackupMode, the writes return after updating
+	// the partition owner and the replica writes are flushed every
+	// LazyBackupFlushInterval or when LazyBackupBufferSize writes are buffered.
+	// WriteQuorum and ReplicationMode are ineffective for these writes, a backup
+	// may miss the last writes if the partition owner crashes. Default value is
+	// EagerBackupMode.
+	BackupMode int
+
+	// ReplicationTopology controls how the replica writes of Put and its
+	// variants travel to the backup owners in EagerBackupMode. In
+	// StarReplicationTopology, the partition owner sends a copy to every backup
+	// owner, so its outbound traffic grows with ReplicaCount. In
+	// ChainReplicationTopology, it sends a single copy to the first backup owner
+	// which stores it and relays it to the next one. It bounds the outbound
+	// traffic of the partition owner to a single copy, at the cost of latency:
+	// a synchronous write waits for every hop in turn instead of the slowest
+	// backup owner. An unreachable backup owner is skipped. The other replica
+	// writes, e.g. Delete and Expire, are always sent in StarReplicationTopology.
+	// Default value is StarReplicationTopology.
+	ReplicationTopology int
+
+	// LazyBackupFlushInterval denotes the period to flush the buffered replica
+	// writes in LazyBackupMode. The default value is 100 milliseconds.
+	LazyBackupFlushInterval time.Duration
+
+	// LazyBackupBufferSize denotes the number of the buffered replica writes per
+	// backup owner which triggers a flush in LazyBackupMode. The default value is 1024.
+	LazyBackupBufferSize int
+
+	// WALDir enables the write-ahead log. Every write on a partition of this
+	// member is appended to a log file per partition in WALDir. The logs are
+	// replayed to reconstruct the partitions on startup and compacted afterwards.
+	// Empty string disables it.
+	WALDir string
+
+	// WALSyncMode controls when the write-ahead log is flushed to the disk.
+	// The default value is WALSyncNone.
+	WALSyncMode int
+
 	// LoadFactor is used by consistent hashing function. It determines the maximum load
 	// for a server in the cluster. Keep it small.
 	LoadFactor float64
 
+	// Distribution denotes the strategy which assigns the partitions to the
+	// members. It's ConsistentDistribution by default. LoadFactor is only used
+	// by ConsistentDistribution. The routing table is built by the cluster
+	// coordinator, all the members must use the same Distribution. Otherwise
+	// the partitions are moved when the coordinator changes.
+	Distribution Distribution
+
 	// Default hasher is github.com/cespare/xxhash
 	Hasher hasher.Hasher
 
+	// KeyNormalizer maps a key to its normalized form before hashing, e.g.
+	// strings.ToLower for case-insensitive keys. The keys with the same
+	// normalized form refer to the same entry. The stored key keeps the form
+	// of the last write.
+	//
+	// All the members of a cluster MUST use the same KeyNormalizer. Otherwise
+	// the members locate the keys on different partitions, and the keys become
+	// unreachable. Changing it on a running cluster has the same effect. The
+	// clients with SmartRouting should use the same one.
+	//
+	// It's nil by default, the keys are hashed as they are.
+	KeyNormalizer func(key string) string
+
 	// Default Serializer implementation uses gob for encoding/decoding.
 	Serializer serializer.Serializer
 
+	// MigrationSerializer decodes the values which cannot be decoded by the
+	// Serializer. Set it to the previous serializer while migrating to a new
+	// one, the values written with both of them can be read until all of them
+	// are rewritten. It's nil by default.
+	MigrationSerializer serializer.Serializer
+
 	// LogOutput is the writer where logs should be sent. If this is not
 	// set, logging will go to stderr by default. You cannot specify both LogOutput
 	// and Logger at the same time.
@@ -246,6 +784,38 @@ type Config struct {
 
 	Cache *CacheConfig
 
+	// ReaperInterval denotes the time an expiry reaper worker waits between
+	// its runs. Every run scans a random partition for the expired and idle
+	// entries. A shorter interval reclaims the memory sooner at the cost of
+	// CPU. The number of workers is CacheConfig.NumEvictionWorkers. The default
+	// value is 100ms.
+	ReaperInterval time.Duration
+
+	// ReaperBatchSize denotes the number of entries scanned by the expiry reaper
+	// while it holds the lock of a DMap. The reaper releases the lock between
+	// the batches, and it scans the next batch only if more than a quarter of
+	// the entries in the batch were expired. A run scans five batches at most.
+	// The default value is 20.
+	ReaperBatchSize int
+
+	// PlacementHints maps DMap names to the members(Name of the node, host:port)
+	// which are preferred as partition owners. The hints are member-level: the
+	// partitions are shared by all DMaps, so the DMap names only label the
+	// hints and a hinted member is preferred for the keys of every DMap. The
+	// cluster coordinator makes a hinted member the primary owner of every
+	// partition it's already selected for as a backup owner, so the hint
+	// doesn't move more data to the member than its fair share. It requires
+	// ReplicaCount to be greater than 1, there is no backup owner to promote
+	// otherwise. It's a soft constraint: the partitions are placed as usual if
+	// none of the hinted members is available.
+	PlacementHints map[string][]string
+
+	// OrderedIndexes is the list of DMaps which maintain an ordered index of
+	// their keys to run range queries with DMap.RangeBetween. The index is kept
+	// in the primary partitions and costs roughly 64 bytes plus the length
+	// of the key for every key on a member.
+	OrderedIndexes []string
+
 	// Minimum size(in-bytes) for append-only file
 	TableSize int
 
@@ -322,6 +892,34 @@ func (c *Config) Validate() error {
 			fmt.Errorf("cannot specify ReplicaCount smaller than MinimumReplicaCount"))
 	}
 
+	if c.Distribution != ConsistentDistribution && c.Distribution != RendezvousDistribution {
+		result = multierror.Append(result,
+			fmt.Errorf("unknown Distribution: %s", c.Distribution))
+	}
+
+	if c.MaxMultiplexedRequests < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify MaxMultiplexedRequests less than zero"))
+	}
+
+	if c.FanoutConcurrency < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify FanoutConcurrency less than zero"))
+	}
+
+	if c.PartitionSizeHighWatermark < 0 || c.PartitionSizeLowWatermark < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify partition size watermarks less than zero"))
+	}
+	if c.PartitionSizeLowWatermark >= c.PartitionSizeHighWatermark && c.PartitionSizeLowWatermark != 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("PartitionSizeLowWatermark has to be less than PartitionSizeHighWatermark"))
+	}
+	if c.HotPartitionRatio < 0 || (c.HotPartitionRatio > 0 && c.HotPartitionRatio <= 1) {
+		result = multierror.Append(result,
+			fmt.Errorf("HotPartitionRatio has to be greater than 1"))
+	}
+
 	if c.ReadQuorum <= 0 {
 		result = multierror.Append(result,
 			fmt.Errorf("cannot specify ReadQuorum less than or equal to zero"))
@@ -331,6 +929,158 @@ func (c *Config) Validate() error {
 			fmt.Errorf("cannot specify ReadQuorum greater than ReplicaCount"))
 	}
 
+	if c.RebalanceRateLimit < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify RebalanceRateLimit less than zero"))
+	}
+
+	if c.RebalanceDelay < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify RebalanceDelay less than zero"))
+	}
+	if c.RebalanceImbalanceThreshold < 0 || c.RebalanceImbalanceThreshold > 1 {
+		result = multierror.Append(result,
+			fmt.Errorf("RebalanceImbalanceThreshold has to be between 0 and 1"))
+	}
+
+	if c.ScrubRate < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify ScrubRate less than zero"))
+	}
+
+	if c.RPCRetryBackoff.MaxRetries < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify RPCRetryBackoff.MaxRetries less than zero"))
+	}
+	if c.RPCRetryBackoff.MinDelay < 0 || c.RPCRetryBackoff.MaxDelay < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify RPCRetryBackoff delays less than zero"))
+	}
+
+	if c.GlobalMaxMemory < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify GlobalMaxMemory less than zero"))
+	}
+	if c.GlobalMemoryLowWatermark < 0 || c.GlobalMemoryLowWatermark >= 1 {
+		result = multierror.Append(result,
+			fmt.Errorf("GlobalMemoryLowWatermark has to be between 0 and 1"))
+	}
+
+	if c.ReadProfileSampleRate < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify ReadProfileSampleRate less than zero"))
+	}
+
+	if c.MaxMessageSize < 0 || int64(c.MaxMessageSize) > math.MaxUint32 {
+		result = multierror.Append(result,
+			fmt.Errorf("MaxMessageSize has to be between 0 and %d", uint32(math.MaxUint32)))
+	}
+
+	if c.DestroyWaitTimeout < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify DestroyWaitTimeout less than zero"))
+	}
+
+	if c.MaxClockSkew < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify MaxClockSkew less than zero"))
+	}
+
+	if c.MaxKeysPerPartition < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify MaxKeysPerPartition less than zero"))
+	}
+
+	if c.CircuitBreakerThreshold < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify CircuitBreakerThreshold less than zero"))
+	}
+
+	if c.ReadRegionQuorum < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify ReadRegionQuorum less than zero"))
+	}
+	if c.ReadRegionQuorum > c.ReplicaCount {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify ReadRegionQuorum greater than ReplicaCount"))
+	}
+	if c.MaxReadVersions < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify MaxReadVersions less than zero"))
+	}
+	if c.ReadRepairMinLag < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify ReadRepairMinLag less than zero"))
+	}
+	if c.RedirectedReadCacheTTL < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify RedirectedReadCacheTTL less than zero"))
+	}
+	if c.RedirectedReadCacheTTL >= time.Second {
+		result = multierror.Append(result,
+			fmt.Errorf("RedirectedReadCacheTTL has to be less than a second"))
+	}
+	if c.BackupMode != EagerBackupMode && c.BackupMode != LazyBackupMode {
+		result = multierror.Append(result,
+			fmt.Errorf("invalid BackupMode: %d", c.BackupMode))
+	}
+	if c.ReplicationTopology != StarReplicationTopology &&
+		c.ReplicationTopology != ChainReplicationTopology {
+		result = multierror.Append(result,
+			fmt.Errorf("invalid ReplicationTopology: %d", c.ReplicationTopology))
+	}
+	if c.LazyBackupFlushInterval < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify LazyBackupFlushInterval less than zero"))
+	}
+	if c.LazyBackupBufferSize < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify LazyBackupBufferSize less than zero"))
+	}
+	if c.WALSyncMode != WALSyncNone && c.WALSyncMode != WALSyncAlways {
+		result = multierror.Append(result,
+			fmt.Errorf("invalid WALSyncMode: %d", c.WALSyncMode))
+	}
+
+	if len(c.PlacementHints) != 0 && c.ReplicaCount <= MinimumReplicaCount {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify PlacementHints if ReplicaCount is not greater than %d", MinimumReplicaCount))
+	}
+
+	if c.ReadWeight < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify ReadWeight less than zero"))
+	}
+
+	if c.Cache != nil {
+		for name, dc := range c.Cache.DMapConfigs {
+			if dc.MaxConcurrentOps < 0 {
+				result = multierror.Append(result,
+					fmt.Errorf("cannot specify MaxConcurrentOps less than zero for DMap: %s", name))
+			}
+			if dc.ReplicaCount < 0 {
+				result = multierror.Append(result,
+					fmt.Errorf("cannot specify ReplicaCount less than zero for DMap: %s", name))
+			}
+			if dc.ReplicaCount > c.ReplicaCount {
+				result = multierror.Append(result,
+					fmt.Errorf("cannot specify ReplicaCount greater than the global ReplicaCount for DMap: %s", name))
+			}
+			if dc.HistorySize < 0 {
+				result = multierror.Append(result,
+					fmt.Errorf("cannot specify HistorySize less than zero for DMap: %s", name))
+			}
+			if dc.HistoryMaxKeys < 0 {
+				result = multierror.Append(result,
+					fmt.Errorf("cannot specify HistoryMaxKeys less than zero for DMap: %s", name))
+			}
+			if hasDemotionCycle(c.Cache.DMapConfigs, name) {
+				result = multierror.Append(result,
+					fmt.Errorf("DemoteTo of DMap: %s leads to itself", name))
+			}
+		}
+	}
+
 	if c.WriteQuorum <= 0 {
 		result = multierror.Append(result,
 			fmt.Errorf("cannot specify WriteQuorum less than or equal to zero"))
@@ -344,11 +1094,36 @@ func (c *Config) Validate() error {
 		result = multierror.Append(result, err)
 	}
 
+	if c.MinConnsPerMember < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify MinConnsPerMember less than zero"))
+	}
+	if c.MaxConnsPerMember < c.MinConnsPerMember {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify MinConnsPerMember greater than MaxConnsPerMember"))
+	}
+
 	if c.MemberCountQuorum < MinimumMemberCountQuorum {
 		result = multierror.Append(result,
 			fmt.Errorf("cannot specify MemberCountQuorum "+
 				"smaller than MinimumMemberCountQuorum"))
 	}
+	if c.ReaperInterval < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify ReaperInterval less than zero"))
+	}
+	if c.ReaperBatchSize < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify ReaperBatchSize less than zero"))
+	}
+	if c.GetAllLimit < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify GetAllLimit less than zero"))
+	}
+	if c.MinimumMemberQuorum < 0 {
+		result = multierror.Append(result,
+			fmt.Errorf("cannot specify MinimumMemberQuorum less than zero"))
+	}
 
 	return result
 }
@@ -386,6 +1161,9 @@ func (c *Config) Sanitize() error {
 	if c.LoadFactor == 0 {
 		c.LoadFactor = DefaultLoadFactor
 	}
+	if c.Distribution == "" {
+		c.Distribution = ConsistentDistribution
+	}
 	if c.PartitionCount == 0 {
 		c.PartitionCount = DefaultPartitionCount
 	}
@@ -407,6 +1185,60 @@ func (c *Config) Sanitize() error {
 	if c.TableSize == 0 {
 		c.TableSize = DefaultTableSize
 	}
+	if c.MaxConnsPerMember == 0 {
+		c.MaxConnsPerMember = DefaultMaxConnsPerMember
+	}
+	if c.GetAllLimit == 0 {
+		c.GetAllLimit = DefaultGetAllLimit
+	}
+	if c.ReaperInterval == 0 {
+		c.ReaperInterval = DefaultReaperInterval
+	}
+	if c.ReaperBatchSize == 0 {
+		c.ReaperBatchSize = DefaultReaperBatchSize
+	}
+	if c.OpIDCacheSize == 0 {
+		c.OpIDCacheSize = DefaultOpIDCacheSize
+	}
+	if c.OpIDCacheTTL == 0 {
+		c.OpIDCacheTTL = DefaultOpIDCacheTTL
+	}
+	if c.ScrubRate == 0 {
+		c.ScrubRate = DefaultScrubRate
+	}
+	if c.CircuitBreakerCooldown == 0 {
+		c.CircuitBreakerCooldown = DefaultCircuitBreakerCooldown
+	}
+	if c.RPCRetryBackoff.MinDelay == 0 {
+		c.RPCRetryBackoff.MinDelay = DefaultRPCRetryMinDelay
+	}
+	if c.RPCRetryBackoff.MaxDelay == 0 {
+		c.RPCRetryBackoff.MaxDelay = DefaultRPCRetryMaxDelay
+	}
+	if c.LazyBackupFlushInterval == 0 {
+		c.LazyBackupFlushInterval = DefaultLazyBackupFlushInterval
+	}
+	if c.LazyBackupBufferSize == 0 {
+		c.LazyBackupBufferSize = DefaultLazyBackupBufferSize
+	}
+	if c.GlobalMemoryLowWatermark == 0 {
+		c.GlobalMemoryLowWatermark = DefaultGlobalMemoryLowWatermark
+	}
+	if c.ReadWeight == 0 {
+		c.ReadWeight = DefaultReadWeight
+	}
+	if c.DestroyWaitTimeout == 0 {
+		c.DestroyWaitTimeout = DefaultDestroyWaitTimeout
+	}
+	if c.FanoutConcurrency == 0 {
+		c.FanoutConcurrency = runtime.NumCPU()
+	}
+	if c.PartitionSizeHighWatermark == 0 {
+		c.PartitionSizeHighWatermark = DefaultPartitionSizeHighWatermark
+	}
+	if c.HotPartitionRatio == 0 {
+		c.HotPartitionRatio = DefaultHotPartitionRatio
+	}
 
 	// Check peers. If Peers slice contains node's itself, return an error.
 	port := strconv.Itoa(c.MemberlistConfig.BindPort)
@@ -418,3 +1250,22 @@ func (c *Config) Sanitize() error {
 	}
 	return nil
 }
+
+// hasDemotionCycle returns true if following DemoteTo from the given DMap leads
+// to itself.
+func hasDemotionCycle(configs map[string]DMapCacheConfig, name string) bool {
+	visited := make(map[string]struct{})
+	next := configs[name].DemoteTo
+	for next != "" {
+		if next == name {
+			return true
+		}
+		if _, ok := visited[next]; ok {
+			// A cycle which doesn't include this DMap. It's reported for the others.
+			return false
+		}
+		visited[next] = struct{}{}
+		next = configs[next].DemoteTo
+	}
+	return false
+}
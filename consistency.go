@@ -0,0 +1,71 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+)
+
+// ConsistencyLevel denotes the number of the owners and the replicas which
+// should respond to a request. It's translated into a quorum against
+// ReplicaCount.
+type ConsistencyLevel uint8
+
+const (
+	// ConsistencyDefault uses ReadQuorum or WriteQuorum in the configuration.
+	ConsistencyDefault ConsistencyLevel = iota
+
+	// ConsistencyOne requires a response from a single owner or replica.
+	ConsistencyOne
+
+	// ConsistencyQuorum requires responses from the majority of the owner
+	// and the replicas.
+	ConsistencyQuorum
+
+	// ConsistencyAll requires responses from the owner and all the replicas.
+	ConsistencyAll
+
+	// ConsistencyLocalOne only requires the copy on the partition owner. A read
+	// request doesn't contact the other members and a write request fails if
+	// the owner cannot store the value.
+	ConsistencyLocalOne
+)
+
+// ErrInvalidConsistencyLevel is returned if the consistency level is unknown
+// or cannot be satisfied with the configured replica count.
+var ErrInvalidConsistencyLevel = errors.New("invalid consistency level")
+
+// quorum translates the consistency level into a quorum for the DMap. configured
+// is used for ConsistencyDefault, capped by the replica count of the DMap.
+func (db *Olric) quorum(name string, level ConsistencyLevel, configured int) (int, error) {
+	rc := db.replicaCount(name)
+	var q int
+	switch level {
+	case ConsistencyDefault:
+		q = db.capQuorum(name, configured)
+	case ConsistencyOne, ConsistencyLocalOne:
+		q = 1
+	case ConsistencyQuorum:
+		q = rc/2 + 1
+	case ConsistencyAll:
+		q = rc
+	default:
+		return 0, ErrInvalidConsistencyLevel
+	}
+	if q > rc {
+		return 0, ErrInvalidConsistencyLevel
+	}
+	return q, nil
+}
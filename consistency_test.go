@@ -0,0 +1,100 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/buraksezer/olric/config"
+)
+
+func TestConsistencyLevel_Quorum(t *testing.T) {
+	db := &Olric{
+		config: &config.Config{ReplicaCount: 3},
+	}
+	expected := map[ConsistencyLevel]int{
+		ConsistencyDefault:  2,
+		ConsistencyOne:      1,
+		ConsistencyLocalOne: 1,
+		ConsistencyQuorum:   2,
+		ConsistencyAll:      3,
+	}
+	for level, q := range expected {
+		res, err := db.quorum("mymap", level, 2)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if res != q {
+			t.Fatalf("Expected quorum for level %d: %d. Got: %d", level, q, res)
+		}
+	}
+	_, err := db.quorum("mymap", ConsistencyLevel(100), 2)
+	if err != ErrInvalidConsistencyLevel {
+		t.Fatalf("Expected ErrInvalidConsistencyLevel. Got: %v", err)
+	}
+}
+
+func TestConsistencyLevel_PutGet(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm1.PutWithOptions(bkey(i), bval(i), &WriteOptions{Consistency: ConsistencyAll})
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	levels := []ConsistencyLevel{ConsistencyOne, ConsistencyQuorum, ConsistencyAll, ConsistencyLocalOne}
+	for _, level := range levels {
+		for i := 0; i < 10; i++ {
+			res, err := dm2.GetWithOptions(bkey(i), &ReadOptions{Consistency: level})
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if !bytes.Equal(res.Value.([]byte), bval(i)) {
+				t.Fatalf("Expected the same value. Got: %s", string(res.Value.([]byte)))
+			}
+		}
+	}
+
+	_, err = dm2.GetWithOptions(bkey(0), &ReadOptions{Consistency: ConsistencyLevel(100)})
+	if err != ErrInvalidConsistencyLevel {
+		t.Fatalf("Expected ErrInvalidConsistencyLevel. Got: %v", err)
+	}
+	err = dm2.PutWithOptions(bkey(0), bval(0), &WriteOptions{Consistency: ConsistencyLevel(100)})
+	if err != ErrInvalidConsistencyLevel {
+		t.Fatalf("Expected ErrInvalidConsistencyLevel. Got: %v", err)
+	}
+}
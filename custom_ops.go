@@ -0,0 +1,210 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/pkg/errors"
+)
+
+// FirstCustomOp is the first OpCode which can be used by a custom operation.
+// The OpCodes between FirstCustomOp and 255 are reserved for the users.
+const FirstCustomOp = uint8(protocol.OpCustomBase)
+
+// ErrInvalidOpCode is returned by RegisterOperation if the OpCode is out of the
+// reserved range or it's already in use.
+var ErrInvalidOpCode = errors.New("invalid opcode")
+
+// OperationHandler implements a custom operation. It runs on the partition owner
+// of the key while the DMap is locked. arg is sent by the caller as is and the
+// returned value is delivered to the caller.
+type OperationHandler func(ctx *OperationContext, arg []byte) ([]byte, error)
+
+// OperationContext gives a custom operation access to the key on the partition
+// owner. It's only valid until the handler returns.
+type OperationContext struct {
+	// DMap is the name of the DMap.
+	DMap string
+
+	// Key is the key which the operation is called for.
+	Key string
+
+	// PartID is the partition which owns the key.
+	PartID uint64
+
+	db   *Olric
+	dm   *dmap
+	hkey uint64
+}
+
+// Get returns the value of the key in the local storage. It returns
+// ErrKeyNotFound if the key doesn't exist or it has expired.
+func (c *OperationContext) Get() (interface{}, error) {
+	vdata, err := c.dm.storage.Get(c.hkey)
+	if err == storage.ErrKeyNotFound {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isKeyExpired(vdata.TTL) {
+		return nil, ErrKeyNotFound
+	}
+	return c.db.unmarshalValue(vdata.Value)
+}
+
+// Put sets the value of the key and replicates it to the backups. A zero
+// timeout means that the key never expires.
+func (c *OperationContext) Put(value interface{}, timeout time.Duration) error {
+	val, err := c.db.serializer.Marshal(value)
+	if err != nil {
+		return err
+	}
+	w := &writeop{
+		opcode:        protocol.OpPut,
+		replicaOpcode: protocol.OpPutReplica,
+		dmap:          c.DMap,
+		key:           c.Key,
+		value:         val,
+		timestamp:     time.Now().UnixNano(),
+		timeout:       timeout,
+	}
+	if timeout != 0 {
+		w.opcode = protocol.OpPutEx
+		w.replicaOpcode = protocol.OpPutExReplica
+	}
+	return c.db.putOnCluster(c.hkey, c.dm, w)
+}
+
+// Delete deletes the key from the owners and the backups.
+func (c *OperationContext) Delete() error {
+	return c.db.delKeyVal(c.dm, c.hkey, c.DMap, c.Key)
+}
+
+// customOp is an operation registered by the user.
+type customOp struct {
+	handler   OperationHandler
+	operation func(*protocol.Message) *protocol.Message
+}
+
+// customOps keeps the operations registered by the user.
+type customOps struct {
+	mtx sync.RWMutex
+	m   map[protocol.OpCode]*customOp
+}
+
+func (c *customOps) load(op protocol.OpCode) (*customOp, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	cop, ok := c.m[op]
+	return cop, ok
+}
+
+// RegisterOperation registers a custom operation with an OpCode between
+// FirstCustomOp and 255. The operation should be registered on all the members
+// of the cluster with the same OpCode, the partition owner of the key returns
+// ErrUnknownOperation otherwise. Call it with DMap.Execute. It's thread-safe.
+func (db *Olric) RegisterOperation(op uint8, fn OperationHandler) error {
+	if fn == nil {
+		return errors.New("operation handler cannot be nil")
+	}
+	opcode := protocol.OpCode(op)
+	if opcode < protocol.OpCustomBase {
+		return errors.WithMessage(ErrInvalidOpCode,
+			fmt.Sprintf("%d is reserved for the built-in operations", op))
+	}
+	if _, ok := db.operations[opcode]; ok {
+		return errors.WithMessage(ErrInvalidOpCode,
+			fmt.Sprintf("%d collides with a built-in operation", op))
+	}
+
+	db.customOps.mtx.Lock()
+	defer db.customOps.mtx.Unlock()
+	if _, ok := db.customOps.m[opcode]; ok {
+		return errors.WithMessage(ErrInvalidOpCode, fmt.Sprintf("%d is already registered", op))
+	}
+	if db.customOps.m == nil {
+		db.customOps.m = make(map[protocol.OpCode]*customOp)
+	}
+	db.customOps.m[opcode] = &customOp{
+		handler: fn,
+		operation: db.limitOps(func(req *protocol.Message) *protocol.Message {
+			value, err := db.execute(opcode, req.DMap, req.Key, req.Value)
+			if err != nil {
+				return db.prepareResponse(req, err)
+			}
+			resp := req.Success()
+			resp.Value = value
+			return resp
+		}),
+	}
+	return nil
+}
+
+func (db *Olric) execute(opcode protocol.OpCode, name, key string, arg []byte) ([]byte, error) {
+	member, hkey := db.findPartitionOwner(name, key)
+	if !hostCmp(member, db.this) {
+		// Redirect to the partition owner
+		req := &protocol.Message{
+			DMap:  name,
+			Key:   key,
+			Value: arg,
+		}
+		resp, err := db.requestTo(member.String(), opcode, req)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Value, nil
+	}
+
+	cop, ok := db.customOps.load(opcode)
+	if !ok {
+		return nil, ErrUnknownOperation
+	}
+	if err := db.checkWritable(name); err != nil {
+		return nil, err
+	}
+	dm, err := db.getDMap(name, hkey)
+	if err != nil {
+		return nil, err
+	}
+	dm.Lock()
+	defer dm.Unlock()
+	ctx := &OperationContext{
+		DMap:   name,
+		Key:    key,
+		PartID: db.getPartitionID(hkey),
+		db:     db,
+		dm:     dm,
+		hkey:   hkey,
+	}
+	return cop.handler(ctx, arg)
+}
+
+// Execute calls the custom operation which is registered with the OpCode on the
+// partition owner of the key, and returns its result. See RegisterOperation.
+// It's thread-safe.
+func (dm *DMap) Execute(op uint8, key string, arg []byte) ([]byte, error) {
+	opcode := protocol.OpCode(op)
+	if opcode < protocol.OpCustomBase {
+		return nil, ErrInvalidOpCode
+	}
+	return dm.db.execute(opcode, dm.target(), key, arg)
+}
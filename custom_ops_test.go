@@ -0,0 +1,119 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/pkg/errors"
+)
+
+// appendOperation appends arg to the current value and returns the new one.
+func appendOperation(ctx *OperationContext, arg []byte) ([]byte, error) {
+	var current []byte
+	value, err := ctx.Get()
+	if err == nil {
+		current = value.([]byte)
+	} else if err != ErrKeyNotFound {
+		return nil, err
+	}
+	current = append(current, arg...)
+	if err = ctx.Put(current, 0); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+func TestCustomOps_RegisterOperation(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	err = db.RegisterOperation(uint8(protocol.OpPut), appendOperation)
+	if errors.Cause(err) != ErrInvalidOpCode {
+		t.Fatalf("Expected ErrInvalidOpCode. Got: %v", err)
+	}
+	err = db.RegisterOperation(FirstCustomOp, appendOperation)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = db.RegisterOperation(FirstCustomOp, appendOperation)
+	if errors.Cause(err) != ErrInvalidOpCode {
+		t.Fatalf("Expected ErrInvalidOpCode. Got: %v", err)
+	}
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = dm.Execute(FirstCustomOp+1, "mykey", nil)
+	if err != ErrUnknownOperation {
+		t.Fatalf("Expected ErrUnknownOperation. Got: %v", err)
+	}
+}
+
+func TestCustomOps_Execute(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	for _, db := range []*Olric{db1, db2} {
+		if err = db.RegisterOperation(FirstCustomOp, appendOperation); err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		for _, part := range [][]byte{[]byte("foo"), []byte("bar")} {
+			_, err = dm2.Execute(FirstCustomOp, bkey(i), part)
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+		}
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		value, err := dm1.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), []byte("foobar")) {
+			t.Fatalf("Expected foobar. Got: %s", string(value.([]byte)))
+		}
+	}
+}
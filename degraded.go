@@ -0,0 +1,173 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDegradedRead is returned along with a value served from the local storage
+// of a member which cannot reach the cluster. See config.AllowLocalOnlyOnPartition.
+var ErrDegradedRead = errors.New("degraded read: served from the local storage")
+
+const (
+	// degradedKeysLimit is the maximum number of the keys served by the degraded
+	// reads to repair later.
+	degradedKeysLimit = 4096
+
+	// degradedReconcileInterval is the period to check the connectivity to
+	// repair the keys served by the degraded reads.
+	degradedReconcileInterval = time.Second
+)
+
+type degradedKey struct {
+	name string
+	key  string
+}
+
+// degradedReads keeps the keys served by the degraded reads until they are
+// repaired.
+type degradedReads struct {
+	mtx  sync.Mutex
+	keys map[degradedKey]struct{}
+}
+
+func newDegradedReads() *degradedReads {
+	return &degradedReads{
+		keys: make(map[degradedKey]struct{}),
+	}
+}
+
+func (d *degradedReads) add(name, key string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if len(d.keys) >= degradedKeysLimit {
+		return
+	}
+	d.keys[degradedKey{name: name, key: key}] = struct{}{}
+}
+
+func (d *degradedReads) pending() []degradedKey {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	res := make([]degradedKey, 0, len(d.keys))
+	for k := range d.keys {
+		res = append(res, k)
+	}
+	return res
+}
+
+func (d *degradedReads) remove(k degradedKey) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	delete(d.keys, k)
+}
+
+// isolated returns true if the member has had peers and cannot reach any of
+// them now.
+func (db *Olric) isolated() bool {
+	if atomic.LoadInt32(&db.hadPeers) == 0 {
+		return false
+	}
+	for _, member := range db.discovery.GetMembers() {
+		if hostCmp(member, db.this) {
+			continue
+		}
+		if !db.breakers.isOpen(member.String()) {
+			return false
+		}
+	}
+	return true
+}
+
+// degradedGet serves the read from the local storage if the read has failed
+// with cause and the member is cut off from the cluster. It returns cause
+// otherwise.
+func (db *Olric) degradedGet(name, key string, cause error) (*getResult, error) {
+	if !db.config.AllowLocalOnlyOnPartition {
+		return nil, cause
+	}
+	if cause == ErrKeyNotFound || cause == ErrKeyExpired || cause == ErrKeyIdle {
+		// The cluster has answered.
+		return nil, cause
+	}
+	if !db.isolated() {
+		return nil, cause
+	}
+
+	hkey := db.getHKey(name, key)
+	partID := db.getPartitionID(hkey)
+	var winner *getResult
+	for _, part := range []*partition{db.partitions[partID], db.backups[partID]} {
+		tmp, ok := part.m.Load(name)
+		if !ok {
+			continue
+		}
+		dm := tmp.(*dmap)
+		dm.RLock()
+		vdata, err := dm.storage.Get(hkey)
+		if err == nil && !isKeyExpired(vdata.TTL) &&
+			(winner == nil || winner.Timestamp < vdata.Timestamp) {
+			// The value is not valid after releasing the lock.
+			winner = &getResult{
+				Value:     copyBytes(vdata.Value),
+				Timestamp: vdata.Timestamp,
+			}
+		}
+		dm.RUnlock()
+	}
+	if winner == nil {
+		return nil, ErrKeyNotFound
+	}
+	db.degradedReads.add(name, key)
+	if db.log.V(6).Ok() {
+		db.log.V(6).Printf("[DEBUG] Key: %s on DMap: %s is served from the local storage: %v", key, name, cause)
+	}
+	return winner, nil
+}
+
+// reconcileDegradedReads repairs the keys served by the degraded reads once the
+// member is back in the cluster.
+func (db *Olric) reconcileDegradedReads() {
+	if db.isolated() || atomic.LoadInt32(&db.numMembers) <= 1 {
+		return
+	}
+	for _, k := range db.degradedReads.pending() {
+		if _, err := db.repair(k.name, k.key); err != nil && err != ErrKeyNotFound {
+			db.log.V(3).Printf("[ERROR] Failed to repair key: %s on DMap: %s: %v", k.key, k.name, err)
+			// Try again later.
+			continue
+		}
+		db.degradedReads.remove(k)
+	}
+}
+
+func (db *Olric) degradedReadsReconciler() {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(degradedReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.ctx.Done():
+			return
+		case <-ticker.C:
+			db.reconcileDegradedReads()
+		}
+	}
+}
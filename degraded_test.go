@@ -0,0 +1,132 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDMap_AllowLocalOnlyOnPartition(t *testing.T) {
+	c1 := testConfig(nil)
+	c1.WriteQuorum = 2
+	c1.ReadQuorum = 2
+	c1.AllowLocalOnlyOnPartition = true
+	db1, err := newDB(c1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err := db1.Shutdown(context.Background())
+		if err != nil {
+			db1.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	c2 := testConfig(nil)
+	c2.WriteQuorum = 2
+	c2.ReadQuorum = 2
+	db2, err := newDB(c2, db1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	syncClusterMembers(db1, db2)
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	if db1.isolated() {
+		t.Fatalf("Expected the member not to be isolated")
+	}
+
+	// Lose the only peer.
+	err = db2.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&db1.numMembers) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the peer to leave")
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+	if !db1.isolated() {
+		t.Fatalf("Expected the member to be isolated")
+	}
+
+	for i := 0; i < 10; i++ {
+		value, err := dm.Get(bkey(i))
+		if err != ErrDegradedRead {
+			t.Fatalf("Expected ErrDegradedRead. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), bval(i)) {
+			t.Fatalf("Value is different for key: %s", bkey(i))
+		}
+	}
+	res, err := dm.GetWithOptions(bkey(0), nil)
+	if err != ErrDegradedRead {
+		t.Fatalf("Expected ErrDegradedRead. Got: %v", err)
+	}
+	if !res.Degraded {
+		t.Fatalf("Expected a degraded result")
+	}
+	_, err = dm.Get("missing")
+	if err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+	}
+	if n := len(db1.degradedReads.pending()); n != 10 {
+		t.Fatalf("Expected 10 keys to repair. Got: %d", n)
+	}
+
+	// The keys are repaired once a peer joins.
+	c3 := testConfig(nil)
+	c3.WriteQuorum = 2
+	c3.ReadQuorum = 2
+	db3, err := newDB(c3, db1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err := db3.Shutdown(context.Background())
+		if err != nil {
+			db3.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	syncClusterMembers(db1, db3)
+	db1.reconcileDegradedReads()
+	if n := len(db1.degradedReads.pending()); n != 0 {
+		t.Fatalf("Expected no keys to repair. Got: %d", n)
+	}
+	for i := 0; i < 10; i++ {
+		value, err := dm.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), bval(i)) {
+			t.Fatalf("Value is different for key: %s", bkey(i))
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"github.com/buraksezer/consistent"
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/hasher"
+	"github.com/buraksezer/olric/internal/discovery"
+)
+
+// distributor assigns the partitions to the members. The cluster coordinator
+// builds the routing table with it, the other members find the partition
+// owners in the routing table. See config.Distribution.
+type distributor interface {
+	Add(member discovery.Member)
+	Remove(name string)
+	GetMembers() []discovery.Member
+
+	// Owners returns count members for the partition. The first one is the
+	// primary owner, the rest are the backup owners. It returns
+	// consistent.ErrInsufficientMemberCount if there are not enough members.
+	Owners(partID uint64, count int) ([]discovery.Member, error)
+}
+
+func newDistributor(c *config.Config) distributor {
+	if c.Distribution == config.RendezvousDistribution {
+		return &hintedDistributor{
+			distributor: newRendezvous(c.Hasher),
+			config:      c,
+		}
+	}
+	cfg := consistent.Config{
+		Hasher:            c.Hasher,
+		PartitionCount:    int(c.PartitionCount),
+		ReplicationFactor: 20, // TODO: This also may be a configuration param.
+		Load:              c.LoadFactor,
+	}
+	return &hintedDistributor{
+		distributor: &consistentDistributor{
+			c: consistent.New(nil, cfg),
+		},
+		config: c,
+	}
+}
+
+// consistentDistributor uses consistent hashing with bounded loads.
+type consistentDistributor struct {
+	c *consistent.Consistent
+}
+
+func (d *consistentDistributor) Add(member discovery.Member) {
+	d.c.Add(member)
+}
+
+func (d *consistentDistributor) Remove(name string) {
+	d.c.Remove(name)
+}
+
+func (d *consistentDistributor) GetMembers() []discovery.Member {
+	var members []discovery.Member
+	for _, member := range d.c.GetMembers() {
+		members = append(members, member.(discovery.Member))
+	}
+	return members
+}
+
+func (d *consistentDistributor) Owners(partID uint64, count int) ([]discovery.Member, error) {
+	res, err := d.c.GetClosestNForPartition(int(partID), count)
+	if err != nil {
+		return nil, err
+	}
+	var owners []discovery.Member
+	for _, owner := range res {
+		owners = append(owners, owner.(discovery.Member))
+	}
+	return owners, nil
+}
+
+// rendezvous uses rendezvous (highest random weight) hashing. Only the
+// partitions of a leaving member and the partitions which a new member wins
+// are moved, but the load is not bounded like consistent hashing does.
+type rendezvous struct {
+	mtx     sync.RWMutex
+	hasher  hasher.Hasher
+	members map[string]discovery.Member
+}
+
+func newRendezvous(h hasher.Hasher) *rendezvous {
+	return &rendezvous{
+		hasher:  h,
+		members: make(map[string]discovery.Member),
+	}
+}
+
+func (r *rendezvous) Add(member discovery.Member) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.members[member.String()] = member
+}
+
+func (r *rendezvous) Remove(name string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.members, name)
+}
+
+func (r *rendezvous) GetMembers() []discovery.Member {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	members := make([]discovery.Member, 0, len(r.members))
+	for _, member := range r.members {
+		members = append(members, member)
+	}
+	return members
+}
+
+func (r *rendezvous) weight(name string, partID uint64) uint64 {
+	buf := make([]byte, len(name)+8)
+	copy(buf, name)
+	binary.BigEndian.PutUint64(buf[len(name):], partID)
+	return r.hasher.Sum64(buf)
+}
+
+func (r *rendezvous) Owners(partID uint64, count int) ([]discovery.Member, error) {
+	members := r.GetMembers()
+	if count > len(members) {
+		return nil, consistent.ErrInsufficientMemberCount
+	}
+	weights := make(map[string]uint64, len(members))
+	for _, member := range members {
+		weights[member.String()] = r.weight(member.String(), partID)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		wi, wj := weights[members[i].String()], weights[members[j].String()]
+		if wi == wj {
+			return members[i].String() < members[j].String()
+		}
+		return wi > wj
+	})
+	return members[:count], nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/buraksezer/consistent"
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/hasher"
+	"github.com/buraksezer/olric/internal/discovery"
+)
+
+func TestDistributor_Rendezvous(t *testing.T) {
+	r := newRendezvous(hasher.NewDefaultHasher())
+	for i := 0; i < 3; i++ {
+		r.Add(discovery.Member{Name: fmt.Sprintf("127.0.0.1:%d", 3320+i)})
+	}
+	_, err := r.Owners(0, 4)
+	if err != consistent.ErrInsufficientMemberCount {
+		t.Fatalf("Expected ErrInsufficientMemberCount. Got: %v", err)
+	}
+
+	const partitionCount = 271
+	before := make(map[uint64]string)
+	for partID := uint64(0); partID < partitionCount; partID++ {
+		owners, err := r.Owners(partID, 2)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if owners[0].Name == owners[1].Name {
+			t.Fatalf("Expected distinct owners for PartID: %d", partID)
+		}
+		before[partID] = owners[0].Name
+	}
+
+	// Only the partitions which are won by the new member are moved.
+	r.Add(discovery.Member{Name: "127.0.0.1:3323"})
+	var moved int
+	for partID := uint64(0); partID < partitionCount; partID++ {
+		owners, err := r.Owners(partID, 1)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if owners[0].Name == before[partID] {
+			continue
+		}
+		if owners[0].Name != "127.0.0.1:3323" {
+			t.Fatalf("Expected PartID: %d to stay on %s. Got: %s", partID, before[partID], owners[0].Name)
+		}
+		moved++
+	}
+	if moved == 0 || moved == partitionCount {
+		t.Fatalf("Expected some of the partitions to be moved. Got: %d", moved)
+	}
+}
+
+func TestDistributor_RendezvousCluster(t *testing.T) {
+	newConfig := func() *config.Config {
+		c := testConfig(nil)
+		c.Distribution = config.RendezvousDistribution
+		return c
+	}
+	db1, err := newDB(newConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db1.Shutdown(context.Background())
+		if err != nil {
+			db1.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	db2, err := newDB(newConfig(), db1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db2.Shutdown(context.Background())
+		if err != nil {
+			db2.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	syncClusterMembers(db1, db2)
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		value, err := dm2.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), bval(i)) {
+			t.Fatalf("Expected value: %s. Got: %v", bval(i), value)
+		}
+	}
+
+	for _, db := range []*Olric{db1, db2} {
+		var owned int
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			owners, err := db.distributor.Owners(partID, 1)
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if hostCmp(db.partitions[partID].owner(), owners[0]) {
+				owned++
+			}
+		}
+		if owned != int(db.config.PartitionCount) {
+			t.Fatalf("Expected the routing table to follow the distributor on %s", db.this)
+		}
+	}
+}
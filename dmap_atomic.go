@@ -15,6 +15,7 @@
 package olric
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"time"
@@ -22,8 +23,11 @@ import (
 	"github.com/buraksezer/olric/internal/protocol"
 )
 
+// ErrNotNumeric is returned by IncrFloat if the stored value is not a number.
+var ErrNotNumeric = errors.New("value is not numeric")
+
 func (db *Olric) atomicIncrDecr(opr string, w *writeop, delta int) (int, error) {
-	atomicKey := w.dmap + w.key
+	atomicKey := w.dmap + db.normalizeKey(w.key)
 	db.locker.Lock(atomicKey)
 	defer func() {
 		err := db.locker.Unlock(atomicKey)
@@ -43,7 +47,7 @@ func (db *Olric) atomicIncrDecr(opr string, w *writeop, delta int) (int, error)
 	var newval, curval int
 	if len(rawval) != 0 {
 		var value interface{}
-		if err = db.serializer.Unmarshal(rawval, &value); err != nil {
+		if err = db.unmarshal(rawval, &value); err != nil {
 			return 0, err
 		}
 
@@ -80,7 +84,7 @@ func (dm *DMap) Incr(key string, delta int) (int, error) {
 	w := &writeop{
 		opcode:        protocol.OpPut,
 		replicaOpcode: protocol.OpPutReplica,
-		dmap:          dm.name,
+		dmap:          dm.target(),
 		key:           key,
 		timestamp:     time.Now().UnixNano(),
 	}
@@ -92,15 +96,108 @@ func (dm *DMap) Decr(key string, delta int) (int, error) {
 	w := &writeop{
 		opcode:        protocol.OpPut,
 		replicaOpcode: protocol.OpPutReplica,
-		dmap:          dm.name,
+		dmap:          dm.target(),
 		key:           key,
 		timestamp:     time.Now().UnixNano(),
 	}
 	return dm.db.atomicIncrDecr("decr", w, delta)
 }
 
+// toFloat64 converts a decoded number to float64. The serializers don't agree
+// on the type of a number, JSON decodes all numbers as float64 and msgpack
+// decodes the small integers as int8, for example.
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func (db *Olric) atomicIncrFloat(w *writeop, delta float64) (float64, error) {
+	atomicKey := w.dmap + db.normalizeKey(w.key)
+	db.locker.Lock(atomicKey)
+	defer func() {
+		err := db.locker.Unlock(atomicKey)
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to release the fine grained lock for key: %s on DMap: %s: %v", w.key, w.dmap, err)
+		}
+	}()
+
+	rawval, err := db.get(w.dmap, w.key)
+	if err == ErrKeyNotFound {
+		err = nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var curval float64
+	if len(rawval) != 0 {
+		var value interface{}
+		if err = db.unmarshal(rawval, &value); err != nil {
+			return 0, err
+		}
+		var ok bool
+		curval, ok = toFloat64(value)
+		if !ok {
+			return 0, ErrNotNumeric
+		}
+	}
+
+	// The new value is always stored as float64. An integral value is not
+	// converted to int, the accumulated sum keeps its precision.
+	newval := curval + delta
+	nval, err := db.serializer.Marshal(newval)
+	if err != nil {
+		return 0, err
+	}
+	w.value = nval
+	err = db.put(w)
+	if err != nil {
+		return 0, err
+	}
+	return newval, nil
+}
+
+// IncrFloat atomically increments key by delta. The key is initialized to zero
+// if it doesn't exist. The return value is the new value after being incremented
+// or an error. It returns ErrNotNumeric if the stored value is not a number.
+func (dm *DMap) IncrFloat(key string, delta float64) (float64, error) {
+	w := &writeop{
+		opcode:        protocol.OpPut,
+		replicaOpcode: protocol.OpPutReplica,
+		dmap:          dm.target(),
+		key:           key,
+		timestamp:     time.Now().UnixNano(),
+	}
+	return dm.db.atomicIncrFloat(w, delta)
+}
+
 func (db *Olric) getPut(w *writeop) ([]byte, error) {
-	atomicKey := w.dmap + w.key
+	atomicKey := w.dmap + db.normalizeKey(w.key)
 	db.locker.Lock(atomicKey)
 	defer func() {
 		err := db.locker.Unlock(atomicKey)
@@ -132,7 +229,7 @@ func (dm *DMap) GetPut(key string, value interface{}) (interface{}, error) {
 	w := &writeop{
 		opcode:        protocol.OpPut,
 		replicaOpcode: protocol.OpPutReplica,
-		dmap:          dm.name,
+		dmap:          dm.target(),
 		key:           key,
 		value:         val,
 		timestamp:     time.Now().UnixNano(),
@@ -144,14 +241,131 @@ func (dm *DMap) GetPut(key string, value interface{}) (interface{}, error) {
 
 	var oldval interface{}
 	if rawval != nil {
-		if err = dm.db.serializer.Unmarshal(rawval, &oldval); err != nil {
+		if err = dm.db.unmarshal(rawval, &oldval); err != nil {
 			return nil, err
 		}
 	}
 	return oldval, nil
 }
 
+// getPutEx runs getPut with a TTL on the partition owner.
+func (db *Olric) getPutEx(w *writeop, opID uint64) ([]byte, error) {
+	member, _ := db.findPartitionOwner(w.dmap, w.key)
+	if hostCmp(member, db.this) {
+		return db.getPut(w)
+	}
+	// Redirect to the partition owner
+	req := &protocol.Message{
+		DMap:  w.dmap,
+		Key:   w.key,
+		Value: w.value,
+		Extra: protocol.GetPutExExtra{
+			TTL:       w.timeout.Nanoseconds(),
+			Timestamp: w.timestamp,
+			OpID:      opID,
+		},
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpGetPutEx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Value, nil
+}
+
+// GetPutEx atomically sets key to value with the given TTL and returns the old
+// value stored at key. It returns nil if the key doesn't exist.
+func (dm *DMap) GetPutEx(key string, value interface{}, timeout time.Duration) (interface{}, error) {
+	if value == nil {
+		value = struct{}{}
+	}
+	val, err := dm.db.serializer.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	w := &writeop{
+		opcode:        protocol.OpPutEx,
+		replicaOpcode: protocol.OpPutExReplica,
+		dmap:          dm.target(),
+		key:           key,
+		value:         val,
+		timestamp:     time.Now().UnixNano(),
+		timeout:       timeout,
+	}
+	rawval, err := dm.db.getPutEx(w, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rawval) == 0 {
+		return nil, nil
+	}
+	return dm.db.unmarshalValue(rawval)
+}
+
+// applyOnce calls f only once for an operation with an OpID. Such operations
+// are redirected to the partition owner which keeps the results for a while and
+// returns the original result for a replayed operation.
+func (db *Olric) applyOnce(req *protocol.Message, f func(*protocol.Message) *protocol.Message) *protocol.Message {
+	var opID uint64
+	switch extra := req.Extra.(type) {
+	case protocol.AtomicExtra:
+		opID = extra.OpID
+	case protocol.GetPutExExtra:
+		opID = extra.OpID
+	}
+	if opID == 0 {
+		return f(req)
+	}
+
+	member, _ := db.findPartitionOwner(req.DMap, req.Key)
+	if !hostCmp(member, db.this) {
+		// Redirect to the partition owner
+		resp, err := db.requestTo(member.String(), req.Op, req)
+		if err != nil {
+			return db.prepareResponse(req, err)
+		}
+		return resp
+	}
+
+	k := opKey{dmap: req.DMap, key: req.Key, id: opID}
+	lkey := fmt.Sprintf("%s%s%d", req.DMap, req.Key, opID)
+	db.locker.Lock(lkey)
+	defer func() {
+		err := db.locker.Unlock(lkey)
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to release the lock for OpID: %d on DMap: %s: %v", opID, req.DMap, err)
+		}
+	}()
+
+	if res, ok := db.opcache.get(k); ok {
+		resp := req.Success()
+		resp.Value = res.value
+		return resp
+	}
+	resp := f(req)
+	if resp.Status == protocol.StatusOK {
+		// Don't cache the failed operations. The client should be able to retry.
+		db.opcache.set(k, resp.Value)
+	}
+	return resp
+}
+
 func (db *Olric) exIncrDecrOperation(req *protocol.Message) *protocol.Message {
+	return db.applyOnce(req, db.incrDecrOperation)
+}
+
+func (db *Olric) exIncrFloatOperation(req *protocol.Message) *protocol.Message {
+	return db.applyOnce(req, db.incrFloatOperation)
+}
+
+func (db *Olric) exGetPutOperation(req *protocol.Message) *protocol.Message {
+	return db.applyOnce(req, db.getPutOperation)
+}
+
+func (db *Olric) exGetPutExOperation(req *protocol.Message) *protocol.Message {
+	return db.applyOnce(req, db.getPutExOperation)
+}
+
+func (db *Olric) incrDecrOperation(req *protocol.Message) *protocol.Message {
 	var delta interface{}
 	err := db.serializer.Unmarshal(req.Value, &delta)
 	if err != nil {
@@ -182,7 +396,38 @@ func (db *Olric) exIncrDecrOperation(req *protocol.Message) *protocol.Message {
 	return resp
 }
 
-func (db *Olric) exGetPutOperation(req *protocol.Message) *protocol.Message {
+func (db *Olric) incrFloatOperation(req *protocol.Message) *protocol.Message {
+	var value interface{}
+	err := db.serializer.Unmarshal(req.Value, &value)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	delta, ok := toFloat64(value)
+	if !ok {
+		return db.prepareResponse(req, ErrNotNumeric)
+	}
+	w := &writeop{
+		opcode:        protocol.OpPut,
+		replicaOpcode: protocol.OpPutReplica,
+		dmap:          req.DMap,
+		key:           req.Key,
+		timestamp:     time.Now().UnixNano(),
+	}
+	newval, err := db.atomicIncrFloat(w, delta)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+
+	data, err := db.serializer.Marshal(newval)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = data
+	return resp
+}
+
+func (db *Olric) getPutOperation(req *protocol.Message) *protocol.Message {
 	w := &writeop{
 		opcode:        protocol.OpPut,
 		replicaOpcode: protocol.OpPutReplica,
@@ -201,3 +446,25 @@ func (db *Olric) exGetPutOperation(req *protocol.Message) *protocol.Message {
 	}
 	return resp
 }
+
+func (db *Olric) getPutExOperation(req *protocol.Message) *protocol.Message {
+	extra := req.Extra.(protocol.GetPutExExtra)
+	w := &writeop{
+		opcode:        protocol.OpPutEx,
+		replicaOpcode: protocol.OpPutExReplica,
+		dmap:          req.DMap,
+		key:           req.Key,
+		value:         req.Value,
+		timestamp:     extra.Timestamp,
+		timeout:       time.Duration(extra.TTL),
+	}
+	oldval, err := db.getPutEx(w, extra.OpID)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	if oldval != nil {
+		resp.Value = oldval
+	}
+	return resp
+}
@@ -15,10 +15,14 @@
 package olric
 
 import (
+	"bytes"
 	"context"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
 )
 
 func TestDMap_AtomicIncr(t *testing.T) {
@@ -69,6 +73,124 @@ func TestDMap_AtomicIncr(t *testing.T) {
 	}
 }
 
+func TestDMap_AtomicIncrFloat(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	var start chan struct{}
+	key := "incr"
+
+	incr := func(dm *DMap) {
+		<-start
+		defer wg.Done()
+
+		_, err := dm.IncrFloat(key, 0.5)
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to call IncrFloat: %v", err)
+			return
+		}
+	}
+
+	dm, err := db.NewDMap("atomic_test")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	start = make(chan struct{})
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go incr(dm)
+	}
+	close(start)
+	wg.Wait()
+
+	res, err := dm.Get(key)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if res.(float64) != 50 {
+		t.Fatalf("Expected 50. Got: %v", res)
+	}
+
+	// The integral sum is still stored as float64.
+	fres, err := dm.IncrFloat(key, 0.1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if fres != 50.1 {
+		t.Fatalf("Expected 50.1. Got: %v", fres)
+	}
+
+	err = dm.Put("str", "foobar")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = dm.IncrFloat("str", 1)
+	if err != ErrNotNumeric {
+		t.Fatalf("Expected ErrNotNumeric. Got: %v", err)
+	}
+}
+
+func TestDMap_AtomicIncrFloatOperation(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("atomic_test")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	// Integers are accepted as the initial value.
+	err = dm.Put("incr", 10)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	delta, err := db.serializer.Marshal(1.25)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	req := &protocol.Message{
+		DMap:  "atomic_test",
+		Key:   "incr",
+		Value: delta,
+		Extra: protocol.AtomicExtra{
+			Timestamp: time.Now().UnixNano(),
+			OpID:      1,
+		},
+	}
+	for i := 0; i < 2; i++ {
+		// The replayed operation is applied only once.
+		resp, err := db.requestTo(db.this.String(), protocol.OpIncrFloat, req)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		var res interface{}
+		err = db.serializer.Unmarshal(resp.Value, &res)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if res.(float64) != 11.25 {
+			t.Fatalf("Expected 11.25. Got: %v", res)
+		}
+	}
+}
+
 func TestDMap_AtomicDecr(t *testing.T) {
 	db, err := newDB(testSingleReplicaConfig())
 	if err != nil {
@@ -171,3 +293,183 @@ func TestDMap_AtomicGetPut(t *testing.T) {
 		t.Fatalf("Expected %d. Got: %d", final, atomic.LoadInt64(&total))
 	}
 }
+
+func TestDMap_AtomicGetPutEx(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("atomic_test")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	dm2, err := db2.NewDMap("atomic_test")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		oldval, err := dm2.GetPutEx(bkey(i), i, time.Hour)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if oldval != nil {
+			t.Fatalf("Expected nil. Got: %v", oldval)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		oldval, err := dm1.GetPutEx(bkey(i), i+1, 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if oldval != i {
+			t.Fatalf("Expected %d. Got: %v", i, oldval)
+		}
+	}
+
+	<-time.After(100 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		_, err := dm2.Get(bkey(i))
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+	}
+}
+
+func TestDMap_AtomicIncrWithOpID(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	incr := func(db *Olric, opID uint64) int {
+		delta, err := db.serializer.Marshal(1)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		req := &protocol.Message{
+			DMap:  "atomic_test",
+			Key:   "incr",
+			Value: delta,
+			Extra: protocol.AtomicExtra{
+				Timestamp: time.Now().UnixNano(),
+				OpID:      opID,
+			},
+		}
+		resp, err := db.requestTo(db.this.String(), protocol.OpIncr, req)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		var res interface{}
+		err = db.serializer.Unmarshal(resp.Value, &res)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		return res.(int)
+	}
+
+	// Replay the same operation on both members. It should be applied once.
+	for _, db := range []*Olric{db1, db2, db1, db2} {
+		if res := incr(db, 1); res != 1 {
+			t.Fatalf("Expected 1. Got: %v", res)
+		}
+	}
+	if res := incr(db2, 2); res != 2 {
+		t.Fatalf("Expected 2. Got: %v", res)
+	}
+
+	dm, err := db1.NewDMap("atomic_test")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	res, err := dm.Get("incr")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if res.(int) != 2 {
+		t.Fatalf("Expected 2. Got: %v", res)
+	}
+}
+
+func TestDMap_AtomicIncrLegacyExtra(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// The older peers send AtomicExtra without OpID.
+	type legacyAtomicExtra struct {
+		Timestamp int64
+	}
+	delta, err := db.serializer.Marshal(1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		req := &protocol.Message{
+			DMap:  "atomic_test",
+			Key:   "incr",
+			Value: delta,
+			Extra: legacyAtomicExtra{
+				Timestamp: time.Now().UnixNano(),
+			},
+		}
+		resp, err := db.requestTo(db.this.String(), protocol.OpIncr, req)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		var res interface{}
+		err = db.serializer.Unmarshal(resp.Value, &res)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if res.(int) != i {
+			t.Fatalf("Expected %d. Got: %v", i, res)
+		}
+	}
+}
+
+func TestDMap_OpCache(t *testing.T) {
+	oc := newOpCache(2, time.Hour)
+	for i := uint64(1); i <= 3; i++ {
+		oc.set(opKey{dmap: "mymap", key: "mykey", id: i}, []byte{byte(i)})
+	}
+	if _, ok := oc.get(opKey{dmap: "mymap", key: "mykey", id: 1}); ok {
+		t.Fatalf("Expected the oldest result is evicted")
+	}
+	res, ok := oc.get(opKey{dmap: "mymap", key: "mykey", id: 3})
+	if !ok {
+		t.Fatalf("Expected the result is found")
+	}
+	if !bytes.Equal(res.value, []byte{3}) {
+		t.Fatalf("Expected the same value. Got: %v", res.value)
+	}
+
+	oc = newOpCache(2, time.Millisecond)
+	oc.set(opKey{dmap: "mymap", key: "mykey", id: 1}, []byte{1})
+	<-time.After(2 * time.Millisecond)
+	if _, ok := oc.get(opKey{dmap: "mymap", key: "mykey", id: 1}); ok {
+		t.Fatalf("Expected the result is expired")
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ErrNotBitmap is returned by SetBit and GetBit if the stored value is not
+// a byte slice.
+var ErrNotBitmap = errors.New("value is not a bitmap")
+
+// ErrInvalidBitOffset is returned by SetBit and GetBit if the offset is negative
+// or greater than maxBitOffset.
+var ErrInvalidBitOffset = errors.New("invalid bit offset")
+
+// maxBitOffset is the greatest bit offset. It limits a bitmap to 512MB.
+const maxBitOffset = 1<<32 - 1
+
+// validBitOffset returns true if offset is in the range of a bitmap.
+func validBitOffset(offset int64) bool {
+	return offset >= 0 && offset <= maxBitOffset
+}
+
+// toBitmap converts a decoded value to a bitmap. A missing value is an empty
+// bitmap.
+func toBitmap(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	}
+	return nil, ErrNotBitmap
+}
+
+// bitMask returns the index of the byte and the mask of the bit at offset.
+// The bits are numbered from the most significant bit of the first byte.
+func bitMask(offset int) (int, byte) {
+	return offset / 8, 0x80 >> uint(offset%8)
+}
+
+// getBitOf returns the bit at offset. The bits beyond the end of the bitmap
+// are zero.
+func getBitOf(bitmap []byte, offset int) bool {
+	i, mask := bitMask(offset)
+	if i >= len(bitmap) {
+		return false
+	}
+	return bitmap[i]&mask != 0
+}
+
+// setBit sets the bit at offset on the partition owner under the lock of
+// the DMap and returns the previous bit. The bitmap is replicated before it
+// returns.
+func (db *Olric) setBit(w *writeop, offset int, value bool) (bool, error) {
+	member, hkey, err := db.lookupPartitionOwner(w.dmap, w.key)
+	if err != nil {
+		return false, err
+	}
+	if !hostCmp(member, db.this) {
+		// Redirect to the partition owner
+		req := &protocol.Message{
+			DMap: w.dmap,
+			Key:  w.key,
+			Extra: protocol.SetBitExtra{
+				Offset:    int64(offset),
+				Value:     value,
+				Timestamp: w.timestamp,
+			},
+		}
+		resp, err := db.requestTo(member.String(), protocol.OpSetBit, req)
+		if err != nil {
+			return false, err
+		}
+		var prev bool
+		err = msgpack.Unmarshal(resp.Value, &prev)
+		return prev, err
+	}
+
+	if err := db.checkWritable(w.dmap); err != nil {
+		return false, err
+	}
+	dm, err := db.getDMap(w.dmap, hkey)
+	if err != nil {
+		return false, err
+	}
+	dm.Lock()
+	defer dm.Unlock()
+	winner, err := db.liveVersionOnOwners(dm, hkey, w.dmap, w.key)
+	if err != nil {
+		return false, err
+	}
+
+	var bitmap []byte
+	if winner != nil {
+		var current interface{}
+		if err = db.unmarshal(winner.Data.Value, &current); err != nil {
+			return false, err
+		}
+		if bitmap, err = toBitmap(current); err != nil {
+			return false, err
+		}
+	}
+	prev := getBitOf(bitmap, offset)
+	i, mask := bitMask(offset)
+	if prev == value && winner != nil {
+		// Nothing to write.
+		return prev, nil
+	}
+	if i >= len(bitmap) {
+		grown := make([]byte, i+1)
+		copy(grown, bitmap)
+		bitmap = grown
+	}
+	if value {
+		bitmap[i] |= mask
+	} else {
+		bitmap[i] &^= mask
+	}
+
+	w.value, err = db.serializer.Marshal(bitmap)
+	if err != nil {
+		return false, err
+	}
+	if err = db.putOnCluster(hkey, dm, w); err != nil {
+		return false, err
+	}
+	return prev, nil
+}
+
+// getBit reads the key with the read quorum and returns the bit at offset.
+// A missing key reads as zero.
+func (db *Olric) getBit(name, key string, offset int) (bool, error) {
+	rawval, err := db.get(name, key)
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	value, err := db.unmarshalValue(rawval)
+	if err != nil {
+		return false, err
+	}
+	bitmap, err := toBitmap(value)
+	if err != nil {
+		return false, err
+	}
+	return getBitOf(bitmap, offset), nil
+}
+
+// SetBit sets or clears the bit at offset of the value, which is treated as
+// a bitset, and returns the previous bit. The bits are numbered from the most
+// significant bit of the first byte. The value grows as needed and a missing
+// key is initialized to an empty bitset. It returns ErrNotBitmap if the stored
+// value is not a byte slice and ErrInvalidBitOffset if the offset is greater
+// than 2^32-1.
+//
+// The partition owner reads and writes the key under the lock of its partition,
+// so concurrent writes on the key don't interleave with it. The new value is
+// replicated to the backup owners before it returns. It's thread-safe.
+func (dm *DMap) SetBit(key string, offset int, value bool) (bool, error) {
+	if !validBitOffset(int64(offset)) {
+		return false, ErrInvalidBitOffset
+	}
+	w := &writeop{
+		opcode:        protocol.OpPut,
+		replicaOpcode: protocol.OpPutReplica,
+		dmap:          dm.target(),
+		key:           key,
+		timestamp:     time.Now().UnixNano(),
+	}
+	return dm.db.setBit(w, offset, value)
+}
+
+// GetBit returns the bit at offset of the value, which is treated as a bitset.
+// The bits beyond the end of the value and the bits of a missing key are zero.
+// It returns ErrNotBitmap if the stored value is not a byte slice. Only the bit
+// is sent to the clients instead of the whole value. It's thread-safe.
+func (dm *DMap) GetBit(key string, offset int) (bool, error) {
+	if !validBitOffset(int64(offset)) {
+		return false, ErrInvalidBitOffset
+	}
+	return dm.db.getBit(dm.target(), key, offset)
+}
+
+func (db *Olric) setBitOperation(req *protocol.Message) *protocol.Message {
+	extra := req.Extra.(protocol.SetBitExtra)
+	if !validBitOffset(extra.Offset) {
+		return db.prepareResponse(req, ErrInvalidBitOffset)
+	}
+	w := &writeop{
+		opcode:        protocol.OpPut,
+		replicaOpcode: protocol.OpPutReplica,
+		dmap:          req.DMap,
+		key:           req.Key,
+		timestamp:     extra.Timestamp,
+	}
+	prev, err := db.setBit(w, int(extra.Offset), extra.Value)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(prev)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
+
+func (db *Olric) getBitOperation(req *protocol.Message) *protocol.Message {
+	extra := req.Extra.(protocol.GetBitExtra)
+	if !validBitOffset(extra.Offset) {
+		return db.prepareResponse(req, ErrInvalidBitOffset)
+	}
+	bit, err := db.getBit(req.DMap, req.Key, int(extra.Offset))
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(bit)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
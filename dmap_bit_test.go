@@ -0,0 +1,213 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+func TestDMap_SetBit(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// A missing key reads as zero.
+	bit, err := dm1.GetBit("cohort", 100)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if bit {
+		t.Fatalf("Expected false. Got: true")
+	}
+
+	for _, offset := range []int{0, 9, 15} {
+		prev, err := dm2.SetBit("cohort", offset, true)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if prev {
+			t.Fatalf("Expected the previous bit of %d is false", offset)
+		}
+	}
+	prev, err := dm1.SetBit("cohort", 9, false)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !prev {
+		t.Fatalf("Expected the previous bit of 9 is true")
+	}
+
+	value, err := dm1.Get("cohort")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(value.([]byte), []byte{0x80, 0x01}) {
+		t.Fatalf("Expected [0x80 0x01]. Got: %#v", value)
+	}
+	for offset, expected := range map[int]bool{0: true, 1: false, 9: false, 15: true, 1000: false} {
+		bit, err := dm2.GetBit("cohort", offset)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if bit != expected {
+			t.Fatalf("Expected bit %d: %v. Got: %v", offset, expected, bit)
+		}
+	}
+
+	// The bitmap is replicated to the backup owner.
+	hkey := db1.getHKey("mymap", "cohort")
+	backup := db1
+	if hostCmp(db1.getBackupPartitionOwners(hkey)[0], db2.this) {
+		backup = db2
+	}
+	bdm, err := backup.getBackupDMap("mymap", hkey)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	bdm.RLock()
+	vdata, err := bdm.storage.Get(hkey)
+	if err != nil {
+		bdm.RUnlock()
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	var replica interface{}
+	err = backup.unmarshal(vdata.Value, &replica)
+	bdm.RUnlock()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(replica.([]byte), []byte{0x80, 0x01}) {
+		t.Fatalf("Expected [0x80 0x01] on the backup. Got: %#v", replica)
+	}
+
+	err = dm1.Put("name", "olric")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = dm2.SetBit("name", 1, true)
+	if err != ErrNotBitmap {
+		t.Fatalf("Expected ErrNotBitmap. Got: %v", err)
+	}
+	_, err = dm2.GetBit("name", 1)
+	if err != ErrNotBitmap {
+		t.Fatalf("Expected ErrNotBitmap. Got: %v", err)
+	}
+	_, err = dm2.SetBit("cohort", -1, true)
+	if err != ErrInvalidBitOffset {
+		t.Fatalf("Expected ErrInvalidBitOffset. Got: %v", err)
+	}
+}
+
+func TestDMap_SetBitOffsetLimit(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// The offset is validated before a bitmap of that size is allocated.
+	requests := []*protocol.Message{
+		{
+			Header: protocol.Header{Op: protocol.OpSetBit},
+			DMap:   "mymap",
+			Key:    "cohort",
+			Extra:  protocol.SetBitExtra{Offset: maxBitOffset + 1, Value: true},
+		},
+		{
+			Header: protocol.Header{Op: protocol.OpGetBit},
+			DMap:   "mymap",
+			Key:    "cohort",
+			Extra:  protocol.GetBitExtra{Offset: maxBitOffset + 1},
+		},
+	}
+	for _, req := range requests {
+		resp := db.operations[req.Op](req)
+		if resp.Status != protocol.StatusBadRequest {
+			t.Fatalf("Expected StatusBadRequest for %s. Got: %d", req.Op, resp.Status)
+		}
+	}
+}
+
+func TestDMap_SetBitConcurrent(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// Every bit survives the concurrent writes on the same bitmap.
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		db := db1
+		if i%2 == 0 {
+			db = db2
+		}
+		wg.Add(1)
+		go func(db *Olric, offset int) {
+			defer wg.Done()
+			dm, err := db.NewDMap("mymap")
+			if err != nil {
+				t.Errorf("Expected nil. Got: %v", err)
+				return
+			}
+			_, err = dm.SetBit("cohort", offset, true)
+			if err != nil {
+				t.Errorf("Expected nil. Got: %v", err)
+			}
+		}(db, i)
+	}
+	wg.Wait()
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	value, err := dm.Get("cohort")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(value.([]byte), bytes.Repeat([]byte{0xff}, 8)) {
+		t.Fatalf("Expected every bit is set. Got: %#v", value)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+// valueEqual reports whether the serialized values are equal. It uses
+// config.ValueEqual if it's set.
+func (db *Olric) valueEqual(a, b []byte) bool {
+	if db.config.ValueEqual != nil {
+		return db.config.ValueEqual(a, b)
+	}
+	return bytes.Equal(a, b)
+}
+
+// compareAndDelete deletes the key on the partition owner under the lock of the
+// DMap if its value is equal to the expected one. The deletion is replicated
+// before it returns.
+func (db *Olric) compareAndDelete(name, key string, expected []byte) (bool, error) {
+	member, hkey, err := db.lookupPartitionOwner(name, key)
+	if err != nil {
+		return false, err
+	}
+	if !hostCmp(member, db.this) {
+		req := &protocol.Message{
+			DMap:  name,
+			Key:   key,
+			Value: expected,
+		}
+		_, err := db.requestTo(member.String(), protocol.OpCompareAndDelete, req)
+		if err == ErrKeyNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if err := db.checkWritable(name); err != nil {
+		return false, err
+	}
+	dm, err := db.getDMap(name, hkey)
+	if err != nil {
+		return false, err
+	}
+	dm.Lock()
+	defer dm.Unlock()
+	winner, err := db.liveVersionOnOwners(dm, hkey, name, key)
+	if err != nil {
+		return false, err
+	}
+	if winner == nil || !db.valueEqual(winner.Data.Value, expected) {
+		return false, nil
+	}
+	if err = db.delKeyVal(dm, hkey, name, key); err != nil {
+		return false, err
+	}
+	db.publishChange(name, ChangeDelete, key, nil, time.Now().UnixNano())
+	return true, nil
+}
+
+// CompareAndDelete deletes the given key only if its value is equal to the
+// expected one. The partition owner compares the serialized values and deletes
+// the key under the same lock, and deletes it on the backup owners before
+// returning. So a value which has changed since it was read is never deleted.
+// It returns false if the value is different or the key doesn't exist. It's
+// the delete analog of a compare-and-swap. It's thread-safe.
+func (dm *DMap) CompareAndDelete(key string, expected interface{}) (bool, error) {
+	value, err := dm.db.serializer.Marshal(expected)
+	if err != nil {
+		return false, err
+	}
+	return dm.db.compareAndDelete(dm.target(), key, value)
+}
+
+func (db *Olric) compareAndDeleteOperation(req *protocol.Message) *protocol.Message {
+	deleted, err := db.compareAndDelete(req.DMap, req.Key, req.Value)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	if !deleted {
+		// Like Exists, the callers map it to false.
+		return db.prepareResponse(req, ErrKeyNotFound)
+	}
+	return req.Success()
+}
@@ -0,0 +1,101 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+)
+
+func TestDMap_CompareAndDelete(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		// The value has changed since it was read.
+		deleted, err := dm2.CompareAndDelete(bkey(i), bval(i+1))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if deleted {
+			t.Fatalf("Expected %s not to be deleted", bkey(i))
+		}
+		_, err = dm1.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+
+		deleted, err = dm2.CompareAndDelete(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !deleted {
+			t.Fatalf("Expected %s to be deleted", bkey(i))
+		}
+		_, err = dm1.Get(bkey(i))
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+
+		// The key is absent.
+		deleted, err = dm2.CompareAndDelete(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if deleted {
+			t.Fatalf("Expected %s not to be deleted", bkey(i))
+		}
+	}
+
+	// Check the backups too.
+	for _, db := range []*Olric{db1, db2} {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			tmp, ok := db.backups[partID].m.Load("mymap")
+			if !ok {
+				continue
+			}
+			dm := tmp.(*dmap)
+			dm.RLock()
+			length := dm.storage.Len()
+			dm.RUnlock()
+			if length != 0 {
+				t.Fatalf("Expected no keys on the backups. Got: %d", length)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+// prepareCopyWriteop creates a writeop to store the value of src under dst.
+func (db *Olric) prepareCopyWriteop(name, dst string, vdata *storage.VData) *writeop {
+	w := &writeop{
+		dmap:      name,
+		key:       dst,
+		value:     vdata.Value,
+		timestamp: time.Now().UnixNano(),
+		timeout:   getTimeout(vdata.TTL),
+	}
+	if db.config.CopyPreservesTimestamp {
+		w.timestamp = vdata.Timestamp
+	}
+	if w.timeout == 0 {
+		w.opcode = protocol.OpPut
+		w.replicaOpcode = protocol.OpPutReplica
+	} else {
+		w.opcode = protocol.OpPutEx
+		w.replicaOpcode = protocol.OpPutExReplica
+	}
+	return w
+}
+
+// getForCopy returns the value of the key from the local storage. The caller
+// must hold the DMap's lock.
+func (db *Olric) getForCopy(dm *dmap, hkey uint64) (*storage.VData, error) {
+	vdata, err := dm.storage.Get(hkey)
+	if err == storage.ErrKeyNotFound {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isKeyExpired(vdata.TTL) || dm.isKeyIdle(hkey) {
+		return nil, ErrKeyNotFound
+	}
+	// The value points to the underlying table. Copy it before writing
+	// to the storage.
+	value := make([]byte, len(vdata.Value))
+	copy(value, vdata.Value)
+	vdata.Value = value
+	return vdata, nil
+}
+
+func (db *Olric) copyKey(name, src, dst string) error {
+	member, hkey := db.findPartitionOwner(name, src)
+	if !hostCmp(member, db.this) {
+		// Redirect to the owner of src.
+		req := &protocol.Message{
+			DMap:  name,
+			Key:   src,
+			Value: []byte(dst),
+		}
+		_, err := db.requestTo(member.String(), protocol.OpCopy, req)
+		return err
+	}
+
+	if err := db.checkWritable(name); err != nil {
+		return err
+	}
+
+	dm, err := db.getDMap(name, hkey)
+	if err != nil {
+		return err
+	}
+
+	dstHKey := db.getHKey(name, dst)
+	if db.getPartitionID(hkey) == db.getPartitionID(dstHKey) {
+		// Both keys live in the same partition. Copy the value under
+		// a single lock.
+		dm.Lock()
+		defer dm.Unlock()
+		vdata, err := db.getForCopy(dm, hkey)
+		if err != nil {
+			return err
+		}
+		return db.putOnCluster(dstHKey, dm, db.prepareCopyWriteop(name, dst, vdata))
+	}
+
+	dm.RLock()
+	vdata, err := db.getForCopy(dm, hkey)
+	dm.RUnlock()
+	if err != nil {
+		return err
+	}
+	// put ships the value to the owner of dst, if it's another member.
+	return db.put(db.prepareCopyWriteop(name, dst, vdata))
+}
+
+// Copy copies the value of src to dst without transferring it to the caller.
+// The TTL of src is preserved. It returns ErrKeyNotFound if src doesn't exist.
+// It's thread-safe.
+func (dm *DMap) Copy(src, dst string) error {
+	return dm.db.copyKey(dm.target(), src, dst)
+}
+
+func (db *Olric) copyOperation(req *protocol.Message) *protocol.Message {
+	err := db.copyKey(req.DMap, req.Key, string(req.Value))
+	return db.prepareResponse(req, err)
+}
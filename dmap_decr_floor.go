@@ -0,0 +1,184 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// toInt converts a decoded integer to int. The serializers don't agree on the
+// type of an integer, msgpack decodes the small integers as int8, for example.
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int8:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint:
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case uint16:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// decrFloor decrements the key on the partition owner under the lock of the
+// DMap unless the result is negative. The new value is replicated before it
+// returns.
+func (db *Olric) decrFloor(w *writeop, delta int) (int, bool, error) {
+	member, hkey, err := db.lookupPartitionOwner(w.dmap, w.key)
+	if err != nil {
+		return 0, false, err
+	}
+	if !hostCmp(member, db.this) {
+		// Redirect to the partition owner
+		value, err := db.serializer.Marshal(delta)
+		if err != nil {
+			return 0, false, err
+		}
+		req := &protocol.Message{
+			DMap:  w.dmap,
+			Key:   w.key,
+			Value: value,
+			Extra: protocol.AtomicExtra{
+				Timestamp: w.timestamp,
+			},
+		}
+		resp, err := db.requestTo(member.String(), protocol.OpDecrFloor, req)
+		if err != nil {
+			return 0, false, err
+		}
+		res := protocol.DecrFloorResult{}
+		err = msgpack.Unmarshal(resp.Value, &res)
+		if err != nil {
+			return 0, false, err
+		}
+		return res.Value, res.Applied, nil
+	}
+
+	if err := db.checkWritable(w.dmap); err != nil {
+		return 0, false, err
+	}
+	dm, err := db.getDMap(w.dmap, hkey)
+	if err != nil {
+		return 0, false, err
+	}
+	dm.Lock()
+	defer dm.Unlock()
+	winner, err := db.liveVersionOnOwners(dm, hkey, w.dmap, w.key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// The key is initialized to zero if it doesn't exist.
+	var curval int
+	if winner != nil {
+		var value interface{}
+		if err = db.unmarshal(winner.Data.Value, &value); err != nil {
+			return 0, false, err
+		}
+		var ok bool
+		curval, ok = toInt(value)
+		if !ok {
+			return 0, false, ErrNotNumeric
+		}
+	}
+	newval := curval - delta
+	if newval < 0 {
+		return curval, false, nil
+	}
+
+	w.value, err = db.serializer.Marshal(newval)
+	if err != nil {
+		return 0, false, err
+	}
+	if err = db.putOnCluster(hkey, dm, w); err != nil {
+		return 0, false, err
+	}
+	return newval, true, nil
+}
+
+// DecrFloor atomically decrements key by delta unless the result is negative.
+// It's useful for the bounded-resource counters, e.g. inventory or semaphores.
+// The key is initialized to zero if it doesn't exist, so a decrement on
+// a missing key is rejected. It returns the new value and true if the decrement
+// is applied, the current value and false otherwise. It returns ErrNotNumeric
+// if the stored value is not an integer.
+//
+// The partition owner reads and writes the key under the lock of its partition,
+// so concurrent writes on the key don't interleave with it. The new value is
+// replicated to the backup owners before it returns. It's thread-safe.
+func (dm *DMap) DecrFloor(key string, delta int) (int, bool, error) {
+	w := &writeop{
+		opcode:        protocol.OpPut,
+		replicaOpcode: protocol.OpPutReplica,
+		dmap:          dm.target(),
+		key:           key,
+		timestamp:     time.Now().UnixNano(),
+	}
+	return dm.db.decrFloor(w, delta)
+}
+
+func (db *Olric) exDecrFloorOperation(req *protocol.Message) *protocol.Message {
+	return db.applyOnce(req, db.decrFloorOperation)
+}
+
+func (db *Olric) decrFloorOperation(req *protocol.Message) *protocol.Message {
+	var delta interface{}
+	err := db.serializer.Unmarshal(req.Value, &delta)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	d, ok := toInt(delta)
+	if !ok {
+		return db.prepareResponse(req, ErrNotNumeric)
+	}
+	w := &writeop{
+		opcode:        protocol.OpPut,
+		replicaOpcode: protocol.OpPutReplica,
+		dmap:          req.DMap,
+		key:           req.Key,
+		timestamp:     time.Now().UnixNano(),
+	}
+	newval, applied, err := db.decrFloor(w, d)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(protocol.DecrFloorResult{
+		Value:   newval,
+		Applied: applied,
+	})
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -0,0 +1,142 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDMap_DecrFloor(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	check := func(delta, expected int, expectedApplied bool) {
+		t.Helper()
+		value, applied, err := dm2.DecrFloor("stock", delta)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if value != expected || applied != expectedApplied {
+			t.Fatalf("Expected %d, %v. Got: %d, %v", expected, expectedApplied, value, applied)
+		}
+	}
+
+	// A missing key is zero.
+	check(1, 0, false)
+	err = dm1.Put("stock", 5)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	check(3, 2, true)
+	check(3, 2, false)
+	check(2, 0, true)
+	value, err := dm1.Get("stock")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value.(int) != 0 {
+		t.Fatalf("Expected 0. Got: %v", value)
+	}
+
+	err = dm1.Put("name", "olric")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, _, err = dm2.DecrFloor("name", 1)
+	if err != ErrNotNumeric {
+		t.Fatalf("Expected ErrNotNumeric. Got: %v", err)
+	}
+}
+
+func TestDMap_DecrFloorConcurrent(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm1.Put("stock", 10)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// The stock never goes negative.
+	var applied int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		db := db1
+		if i%2 == 0 {
+			db = db2
+		}
+		wg.Add(1)
+		go func(db *Olric) {
+			defer wg.Done()
+			dm, err := db.NewDMap("mymap")
+			if err != nil {
+				t.Errorf("Expected nil. Got: %v", err)
+				return
+			}
+			_, ok, err := dm.DecrFloor("stock", 1)
+			if err != nil {
+				t.Errorf("Expected nil. Got: %v", err)
+				return
+			}
+			if ok {
+				atomic.AddInt32(&applied, 1)
+			}
+		}(db)
+	}
+	wg.Wait()
+	if applied != 10 {
+		t.Fatalf("Expected 10 decrements. Got: %d", applied)
+	}
+	value, err := dm1.Get("stock")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value.(int) != 0 {
+		t.Fatalf("Expected 0. Got: %v", value)
+	}
+}
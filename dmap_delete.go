@@ -15,11 +15,21 @@
 package olric
 
 import (
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/discovery"
 	"github.com/buraksezer/olric/internal/protocol"
 	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
 	"golang.org/x/sync/errgroup"
 )
 
+// deleteExpiredBatchSize is the maximum number of keys deleted by DeleteExpired
+// before releasing the DMap's lock.
+const deleteExpiredBatchSize = 100
+
 func (db *Olric) deleteStaleDMaps() {
 	janitor := func(part *partition) {
 		part.m.Range(func(name, dm interface{}) bool {
@@ -49,7 +59,7 @@ func (db *Olric) deleteStaleDMaps() {
 func (db *Olric) delKeyVal(dm *dmap, hkey uint64, name, key string) error {
 	owners := db.getPartitionOwners(hkey)
 	if len(owners) == 0 {
-		panic("partition owners list cannot be empty")
+		return ErrClusterNotReady
 	}
 
 	// Traverse in reverse order. Except from the latest host, this one.
@@ -64,12 +74,15 @@ func (db *Olric) delKeyVal(dm *dmap, hkey uint64, name, key string) error {
 			return err
 		}
 	}
-	if db.config.ReplicaCount != 0 {
+	if db.replicaCount(name) > config.MinimumReplicaCount {
 		err := db.deleteKeyValBackup(hkey, name, key)
 		if err != nil {
 			return err
 		}
 	}
+	if err := dm.wal.delete(name, key); err != nil {
+		return err
+	}
 	err := dm.storage.Delete(hkey)
 	if err == storage.ErrFragmented {
 		db.wg.Add(1)
@@ -80,40 +93,108 @@ func (db *Olric) delKeyVal(dm *dmap, hkey uint64, name, key string) error {
 	// Delete it from access log if everything is ok.
 	// If we delete the hkey when err is not nil, LRU/MaxIdleDuration may not work properly.
 	if err == nil {
+		if dm.index != nil {
+			dm.index.Delete(db.normalizeKey(key))
+		}
 		dm.deleteAccessLog(hkey)
+		db.recordDelete(name, key)
 	}
 	return err
 }
 
-func (db *Olric) deleteKey(name, key string) error {
+// liveVersionOnOwners returns the latest version of the key found on the
+// partition owner or the previous owners. It returns nil if there is no live
+// version, neither expired nor idle. The caller must hold the DMap's lock.
+func (db *Olric) liveVersionOnOwners(dm *dmap, hkey uint64, name, key string) (*version, error) {
+	versions, err := db.lookupOnOwners(dm, hkey, name, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	sorted := db.sanitizeAndSortVersions(versions)
+	if len(sorted) == 0 {
+		return nil, nil
+	}
+	winner := db.pickWinner(sorted)
+	if isKeyExpired(winner.Data.TTL) || dm.isKeyIdle(hkey) {
+		return nil, nil
+	}
+	return winner, nil
+}
+
+// existsOnOwners returns true if a live version of the key is found on the
+// partition owner or the previous owners. The caller must hold the DMap's lock.
+func (db *Olric) existsOnOwners(dm *dmap, hkey uint64, name, key string) (bool, error) {
+	winner, err := db.liveVersionOnOwners(dm, hkey, name, key)
+	if err != nil {
+		return false, err
+	}
+	return winner != nil, nil
+}
+
+// deleteKey deletes the key and returns true if it was alive before deletion.
+func (db *Olric) deleteKey(name, key string) (bool, error) {
 	member, hkey := db.findPartitionOwner(name, key)
 	if !hostCmp(member, db.this) {
 		msg := &protocol.Message{
 			DMap: name,
 			Key:  key,
 		}
-		_, err := db.requestTo(member.String(), protocol.OpDelete, msg)
-		return err
+		resp, err := db.requestTo(member.String(), protocol.OpDelete, msg)
+		if err != nil {
+			return false, err
+		}
+		// The members which don't report it return an empty value.
+		return len(resp.Value) == 1 && resp.Value[0] == 1, nil
+	}
+
+	if err := db.checkWritable(name); err != nil {
+		return false, err
 	}
 
 	dm, err := db.getDMap(name, hkey)
 	if err != nil {
-		return err
+		return false, err
 	}
 	dm.Lock()
 	defer dm.Unlock()
-	return db.delKeyVal(dm, hkey, name, key)
+	existed, err := db.existsOnOwners(dm, hkey, name, key)
+	if err != nil {
+		return false, err
+	}
+	if err = db.delKeyVal(dm, hkey, name, key); err != nil {
+		return false, err
+	}
+	db.publishChange(name, ChangeDelete, key, nil, time.Now().UnixNano())
+	return existed, nil
 }
 
 // Delete deletes the value for the given key. Delete will not return error if key doesn't exist. It's thread-safe.
 // It is safe to modify the contents of the argument after Delete returns.
 func (dm *DMap) Delete(key string) error {
-	return dm.db.deleteKey(dm.name, key)
+	_, err := dm.db.deleteKey(dm.target(), key)
+	return err
+}
+
+// DeleteWithResult works like Delete, but it also returns true if a live entry
+// of the key, neither expired nor idle, was present before deletion. The
+// partition owner checks it under the same lock with the deletion. It's
+// thread-safe.
+func (dm *DMap) DeleteWithResult(key string) (bool, error) {
+	return dm.db.deleteKey(dm.target(), key)
 }
 
 func (db *Olric) exDeleteOperation(req *protocol.Message) *protocol.Message {
-	err := db.deleteKey(req.DMap, req.Key)
-	return db.prepareResponse(req, err)
+	existed, err := db.deleteKey(req.DMap, req.Key)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	if existed {
+		resp.Value = []byte{1}
+	} else {
+		resp.Value = []byte{0}
+	}
+	return resp
 }
 
 func (db *Olric) deletePrevOperation(req *protocol.Message) *protocol.Message {
@@ -125,12 +206,18 @@ func (db *Olric) deletePrevOperation(req *protocol.Message) *protocol.Message {
 	dm.Lock()
 	defer dm.Unlock()
 
+	if err = dm.wal.delete(req.DMap, req.Key); err != nil {
+		return db.prepareResponse(req, err)
+	}
 	err = dm.storage.Delete(hkey)
 	if err == storage.ErrFragmented {
 		db.wg.Add(1)
 		go db.compactTables(dm)
 		err = nil
 	}
+	if err == nil && dm.index != nil {
+		dm.index.Delete(db.normalizeKey(req.Key))
+	}
 	return db.prepareResponse(req, err)
 }
 
@@ -143,6 +230,9 @@ func (db *Olric) deleteBackupOperation(req *protocol.Message) *protocol.Message
 	dm.Lock()
 	defer dm.Unlock()
 
+	if err = dm.wal.delete(req.DMap, req.Key); err != nil {
+		return db.prepareResponse(req, err)
+	}
 	err = dm.storage.Delete(hkey)
 	if err == storage.ErrFragmented {
 		db.wg.Add(1)
@@ -153,12 +243,13 @@ func (db *Olric) deleteBackupOperation(req *protocol.Message) *protocol.Message
 }
 
 func (db *Olric) deleteKeyValBackup(hkey uint64, name, key string) error {
-	backupOwners := db.getBackupPartitionOwners(hkey)
+	backupOwners := db.getDMapBackupOwners(name, hkey)
 	var g errgroup.Group
 	for _, backup := range backupOwners {
 		mem := backup
 		g.Go(func() error {
 			// TODO: Add retry with backoff
+			db.flushBeforeDelete(mem)
 			req := &protocol.Message{
 				DMap: name,
 				Key:  key,
@@ -172,3 +263,109 @@ func (db *Olric) deleteKeyValBackup(hkey uint64, name, key string) error {
 	}
 	return g.Wait()
 }
+
+// deleteExpiredOnPartition deletes the expired keys of a DMap in batches. It
+// releases the lock between the batches to let the other requests in.
+func (db *Olric) deleteExpiredOnPartition(name string, dm *dmap) int {
+	type item struct {
+		hkey uint64
+		key  string
+	}
+
+	var total int
+	for {
+		select {
+		case <-db.ctx.Done():
+			// The server has gone.
+			return total
+		default:
+		}
+
+		var count int
+		dm.Lock()
+		var batch []item
+		dm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+			if isKeyExpired(vdata.TTL) {
+				batch = append(batch, item{hkey: hkey, key: vdata.Key})
+			}
+			return len(batch) < deleteExpiredBatchSize
+		})
+		for _, i := range batch {
+			err := db.delKeyVal(dm, i.hkey, name, i.key)
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to delete expired hkey: %d on DMap: %s: %v",
+					i.hkey, name, err)
+				continue
+			}
+			count++
+		}
+		dm.Unlock()
+
+		total += count
+		if len(batch) < deleteExpiredBatchSize || count == 0 {
+			// No more expired keys or all of them failed. Quit.
+			return total
+		}
+	}
+}
+
+// localDeleteExpired deletes the expired keys of a DMap on the partitions
+// owned by this member.
+func (db *Olric) localDeleteExpired(name string) int {
+	var total int
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		if !hostCmp(part.owner(), db.this) {
+			continue
+		}
+		tmp, ok := part.m.Load(name)
+		if !ok {
+			continue
+		}
+		total += db.deleteExpiredOnPartition(name, tmp.(*dmap))
+	}
+	return total
+}
+
+func (db *Olric) deleteExpired(name string) (int, error) {
+	var total int64
+	err := db.fanout(db.discovery.GetMembers(), func(mem discovery.Member) error {
+		if hostCmp(mem, db.this) {
+			atomic.AddInt64(&total, int64(db.localDeleteExpired(name)))
+			return nil
+		}
+		req := &protocol.Message{
+			DMap: name,
+		}
+		resp, err := db.requestTo(mem.String(), protocol.OpDeleteExpired, req)
+		if err != nil {
+			return err
+		}
+		var count int
+		err = msgpack.Unmarshal(resp.Value, &count)
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&total, int64(count))
+		return nil
+	})
+	return int(total), err
+}
+
+// DeleteExpired scans the partitions on all members and deletes the expired
+// keys, including the backups, immediately instead of waiting for the background
+// eviction. It returns the number of deleted keys. This is useful to reclaim
+// memory on demand. It's thread-safe.
+func (dm *DMap) DeleteExpired() (int, error) {
+	return dm.db.deleteExpired(dm.target())
+}
+
+func (db *Olric) deleteExpiredOperation(req *protocol.Message) *protocol.Message {
+	value, err := msgpack.Marshal(db.localDeleteExpired(req.DMap))
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
 )
 
 func TestDMap_Delete(t *testing.T) {
@@ -60,6 +61,62 @@ func TestDMap_Delete(t *testing.T) {
 	}
 }
 
+func TestDMap_DeleteWithResult(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	_, err = c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm.PutEx(bkey(10), bval(10), time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	<-time.After(10 * time.Millisecond)
+
+	// Some of the keys are owned by the other member.
+	for i := 0; i < 10; i++ {
+		existed, err := dm.DeleteWithResult(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v for %s", err, bkey(i))
+		}
+		if !existed {
+			t.Fatalf("Expected %s to exist before deletion", bkey(i))
+		}
+		existed, err = dm.DeleteWithResult(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v for %s", err, bkey(i))
+		}
+		if existed {
+			t.Fatalf("Expected %s to be deleted already", bkey(i))
+		}
+	}
+	existed, err := dm.DeleteWithResult(bkey(10))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if existed {
+		t.Fatalf("Expected an expired key not to be reported")
+	}
+}
+
 func TestDMap_DeleteLookup(t *testing.T) {
 	c := newTestCluster(nil)
 	defer c.teardown()
@@ -208,3 +265,69 @@ func TestDMap_DeleteOnPreviousOwner(t *testing.T) {
 		t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
 	}
 }
+
+func TestDMap_DeleteExpired(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 300; i++ {
+		if i%2 == 0 {
+			err = dm.PutEx(bkey(i), bval(i), time.Millisecond)
+		} else {
+			err = dm.Put(bkey(i), bval(i))
+		}
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	<-time.After(10 * time.Millisecond)
+
+	count, err := dm.DeleteExpired()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if count != 150 {
+		t.Fatalf("Expected count is 150. Got: %d", count)
+	}
+
+	var total int
+	for _, db := range []*Olric{db1, db2} {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			for _, part := range []*partition{db.partitions[partID], db.backups[partID]} {
+				tmp, ok := part.m.Load("mymap")
+				if !ok {
+					continue
+				}
+				d := tmp.(*dmap)
+				d.RLock()
+				if !part.backup {
+					total += d.storage.Len()
+				}
+				d.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+					if isKeyExpired(vdata.TTL) {
+						t.Errorf("Expired key is still there: %s", vdata.Key)
+					}
+					return true
+				})
+				d.RUnlock()
+			}
+		}
+	}
+	if total != 150 {
+		t.Fatalf("Expected key count is 150. Got: %d", total)
+	}
+}
@@ -15,48 +15,138 @@
 package olric
 
 import (
-	"runtime"
+	"errors"
+	"sync"
+	"time"
 
+	"github.com/buraksezer/olric/internal/discovery"
 	"github.com/buraksezer/olric/internal/protocol"
-	"golang.org/x/sync/errgroup"
-	"golang.org/x/sync/semaphore"
 )
 
-func (db *Olric) destroyDMap(name string) error {
-	num := int64(runtime.NumCPU())
-	sem := semaphore.NewWeighted(num)
+// ErrDMapUnavailable is returned when a DMap is being destroyed.
+var ErrDMapUnavailable = errors.New("dmap is unavailable")
+
+// destroyingDMap is closed when the DMap is destroyed on this member.
+type destroyingDMap struct {
+	done  chan struct{}
+	timer *time.Timer
+}
+
+// destroyingDMaps keeps the DMaps being destroyed on the cluster.
+type destroyingDMaps struct {
+	mtx sync.Mutex
+	m   map[string]*destroyingDMap
+}
+
+func newDestroyingDMaps() *destroyingDMaps {
+	return &destroyingDMaps{
+		m: make(map[string]*destroyingDMap),
+	}
+}
+
+// mark puts the DMap in destroying state. The state is cleared automatically
+// after timeout, if the coordinator of Destroy fails to complete it.
+func (d *destroyingDMaps) mark(name string, timeout time.Duration) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if _, ok := d.m[name]; ok {
+		return
+	}
+	s := &destroyingDMap{
+		done: make(chan struct{}),
+	}
+	s.timer = time.AfterFunc(timeout, func() {
+		d.remove(name, s)
+	})
+	d.m[name] = s
+}
+
+// unmark clears the destroying state of the DMap and releases the waiting writes.
+func (d *destroyingDMaps) unmark(name string) {
+	d.remove(name, nil)
+}
+
+func (d *destroyingDMaps) remove(name string, expected *destroyingDMap) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	s, ok := d.m[name]
+	if !ok || (expected != nil && s != expected) {
+		return
+	}
+	s.timer.Stop()
+	close(s.done)
+	delete(d.m, name)
+}
+
+func (d *destroyingDMaps) load(name string) (<-chan struct{}, bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	s, ok := d.m[name]
+	if !ok {
+		return nil, false
+	}
+	return s.done, true
+}
+
+// checkDMapAvailable returns ErrDMapUnavailable if the DMap is being destroyed.
+// It's called by the read operations.
+func (db *Olric) checkDMapAvailable(name string) error {
+	if _, ok := db.destroying.load(name); ok {
+		return ErrDMapUnavailable
+	}
+	return nil
+}
 
-	var g errgroup.Group
-	for _, item := range db.discovery.GetMembers() {
+// waitForDMap blocks the write operations until the DMap is destroyed. It must
+// be called before loading the DMap, the writes would be lost otherwise.
+func (db *Olric) waitForDMap(name string) error {
+	done, ok := db.destroying.load(name)
+	if !ok {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-db.ctx.Done():
+		return ErrDMapUnavailable
+	}
+}
+
+// callDestroyOnMembers sends the given destroy command to all the members.
+func (db *Olric) callDestroyOnMembers(name string, opcode protocol.OpCode) error {
+	return db.fanout(db.discovery.GetMembers(), func(item discovery.Member) error {
 		addr := item.String()
-		g.Go(func() error {
-			if err := sem.Acquire(db.ctx, 1); err != nil {
-				db.log.V(3).
-					Printf("[ERROR] Failed to acquire semaphore to call Destroy command on %s for %s: %v",
-						addr, name, err)
-				return err
-			}
-			defer sem.Release(1)
-
-			msg := &protocol.Message{
-				DMap: name,
-			}
-			db.log.V(5).Printf("[DEBUG] Calling Destroy command on %s for %s", addr, name)
-			_, err := db.requestTo(addr, protocol.OpDestroyDMap, msg)
-			if err != nil {
-				db.log.V(2).Printf("[ERROR] Failed to destroy dmap:%s on %s", name, addr)
-			}
-			return err
-		})
+		msg := &protocol.Message{
+			DMap: name,
+		}
+		db.log.V(5).Printf("[DEBUG] Calling Destroy command on %s for %s", addr, name)
+		_, err := db.requestTo(addr, opcode, msg)
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to destroy dmap:%s on %s", name, addr)
+		}
+		return err
+	})
+}
+
+func (db *Olric) destroyDMap(name string) error {
+	// Put the DMap in destroying state on all the members first. A member which
+	// fails to mark it only serves the half-cleared DMap, it's not fatal.
+	if err := db.callDestroyOnMembers(name, protocol.OpMarkDestroying); err != nil {
+		db.log.V(2).Printf("[ERROR] Failed to mark dmap:%s as destroying: %v", name, err)
 	}
-	return g.Wait()
+	return db.callDestroyOnMembers(name, protocol.OpDestroyDMap)
 }
 
-// Destroy flushes the given DMap on the cluster. You should know that there
-// is no global lock on DMaps. So if you call Put/PutEx and Destroy methods
-// concurrently on the cluster, Put/PutEx calls may set new values to the DMap.
+// Destroy flushes the given DMap on the cluster. The DMap is put in destroying
+// state on all the members before flushing. The reads return ErrDMapUnavailable
+// and the writes wait until the DMap is destroyed, up to DestroyWaitTimeout.
+// There is still no global lock on DMaps, a write which has already loaded
+// the DMap before the destroying state may be lost.
 func (dm *DMap) Destroy() error {
-	return dm.db.destroyDMap(dm.name)
+	return dm.db.destroyDMap(dm.target())
 }
 
 func (db *Olric) exDestroyOperation(req *protocol.Message) *protocol.Message {
@@ -64,17 +154,35 @@ func (db *Olric) exDestroyOperation(req *protocol.Message) *protocol.Message {
 	return db.prepareResponse(req, err)
 }
 
+// dropDMap deletes a DMap from the partition.
+func (db *Olric) dropDMap(part *partition, name string) {
+	if tmp, ok := part.m.Load(name); ok {
+		dm := tmp.(*dmap)
+		if err := dm.wal.drop(name); err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to log destroyed DMap: %s on PartID: %d: %v", name, part.id, err)
+		}
+	}
+	part.m.Delete(name)
+}
+
 func (db *Olric) destroyDMapOperation(req *protocol.Message) *protocol.Message {
 	// This is very similar with rm -rf. Destroys given dmap on the cluster
 	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
 		// Delete primary copies
 		part := db.partitions[partID]
-		part.m.Delete(req.DMap)
+		db.dropDMap(part, req.DMap)
 		// Delete from Backups
 		if db.config.ReplicaCount != 0 {
 			bpart := db.backups[partID]
-			bpart.m.Delete(req.DMap)
+			db.dropDMap(bpart, req.DMap)
 		}
 	}
+	// Release the waiting writes.
+	db.destroying.unmark(req.DMap)
+	return req.Success()
+}
+
+func (db *Olric) markDestroyingOperation(req *protocol.Message) *protocol.Message {
+	db.destroying.mark(req.DMap, db.config.DestroyWaitTimeout)
 	return req.Success()
 }
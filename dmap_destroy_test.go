@@ -15,7 +15,9 @@
 package olric
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 func TestDMap_Destroy(t *testing.T) {
@@ -55,3 +57,72 @@ func TestDMap_Destroy(t *testing.T) {
 		}
 	}
 }
+
+func TestDMap_DestroyingState(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.DestroyWaitTimeout = time.Second
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put("mykey", "myvalue")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db.destroying.mark("mymap", c.DestroyWaitTimeout)
+	_, err = dm.Get("mykey")
+	if err != ErrDMapUnavailable {
+		t.Fatalf("Expected ErrDMapUnavailable. Got: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- dm.Put("mykey", "newvalue")
+	}()
+	select {
+	case err = <-errCh:
+		t.Fatalf("Expected Put to wait. Got: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Completes the destroy and releases the writes.
+	err = dm.Destroy()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	select {
+	case err = <-errCh:
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Put is still waiting")
+	}
+	value, err := dm.Get("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value != "newvalue" {
+		t.Fatalf("Expected newvalue. Got: %v", value)
+	}
+
+	// The state is cleared after DestroyWaitTimeout, if Destroy never completes.
+	db.destroying.mark("mymap", 10*time.Millisecond)
+	<-time.After(50 * time.Millisecond)
+	_, err = dm.Get("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+}
@@ -19,12 +19,49 @@ import (
 	"math/rand"
 	"runtime"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/buraksezer/olric/internal/storage"
+	"github.com/buraksezer/olric/stats"
 	"golang.org/x/sync/semaphore"
 )
 
+// reaperStats counts the activity of the expiry reaper.
+type reaperStats struct {
+	runs     uint64
+	scanned  uint64
+	reaped   uint64
+	expired  uint64
+	totalLag int64
+	maxLag   int64
+}
+
+// observe records the time between the expiry of a reaped key and its deletion.
+func (r *reaperStats) observe(lag time.Duration) {
+	atomic.AddUint64(&r.expired, 1)
+	atomic.AddInt64(&r.totalLag, int64(lag))
+	for {
+		current := atomic.LoadInt64(&r.maxLag)
+		if int64(lag) <= current || atomic.CompareAndSwapInt64(&r.maxLag, current, int64(lag)) {
+			return
+		}
+	}
+}
+
+func (r *reaperStats) stats() stats.Reaper {
+	s := stats.Reaper{
+		Runs:    atomic.LoadUint64(&r.runs),
+		Scanned: atomic.LoadUint64(&r.scanned),
+		Reaped:  atomic.LoadUint64(&r.reaped),
+		MaxLag:  time.Duration(atomic.LoadInt64(&r.maxLag)),
+	}
+	if expired := atomic.LoadUint64(&r.expired); expired != 0 {
+		s.Lag = time.Duration(atomic.LoadInt64(&r.totalLag) / int64(expired))
+	}
+	return s
+}
+
 func (db *Olric) evictKeysAtBackground() {
 	defer db.wg.Done()
 
@@ -50,7 +87,7 @@ func (db *Olric) evictKeysAtBackground() {
 			// Good for developing tests.
 			db.evictKeys()
 			select {
-			case <-time.After(100 * time.Millisecond):
+			case <-time.After(db.config.ReaperInterval):
 			case <-db.ctx.Done():
 				return
 			}
@@ -79,40 +116,47 @@ func (db *Olric) scanDMapForEviction(partID uint64, name string, dm *dmap) {
 
 	// We need limits to prevent CPU starvation. delKeyVal does some network operation
 	// to delete keys from the backup nodes and the previous owners.
-	var maxKeyCount = 20
-	var maxTotalCount = 100
+	var maxKeyCount = db.config.ReaperBatchSize
+	var maxTotalCount = 5 * maxKeyCount
 	var totalCount = 0
 
-	dm.Lock()
-	defer dm.Unlock()
-
+	atomic.AddUint64(&db.reaper.runs, 1)
 	janitor := func() bool {
 		if totalCount > maxTotalCount {
-			// Release the lock. Eviction will be triggered again.
+			// Eviction will be triggered again.
 			return false
 		}
 
+		// The lock is released between the batches, so the writes on the DMap
+		// don't wait for the whole run.
+		dm.Lock()
+		defer dm.Unlock()
+
 		count, keyCount := 0, 0
 		dm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
 			keyCount++
-			if keyCount >= maxKeyCount {
-				// this means 'break'.
-				return false
-			}
-			if isKeyExpired(vdata.TTL) || dm.isKeyIdle(hkey) {
-				err := db.delKeyVal(dm, hkey, name, vdata.Key)
+			expired := isKeyExpired(vdata.TTL)
+			if expired || dm.isKeyIdle(hkey) {
+				ttl := vdata.TTL
+				err := db.evictKey(dm, hkey, name, vdata.Key)
 				if err != nil {
 					// It will be tried again.
 					db.log.V(2).Printf("[ERROR] Failed to delete expired hkey: %d on DMap: %s: %v",
 						hkey, name, err)
-					return true // this means 'continue'
+				} else {
+					count++
+					if expired {
+						db.reaper.observe(time.Duration(time.Now().UnixNano() - ttl*1000000))
+					}
 				}
-				count++
 			}
-			return true
+			// Stop at the end of the batch.
+			return keyCount < maxKeyCount
 		})
+		atomic.AddUint64(&db.reaper.scanned, uint64(keyCount))
+		atomic.AddUint64(&db.reaper.reaped, uint64(count))
 		totalCount += count
-		return count >= maxKeyCount/4
+		return count > 0 && count >= maxKeyCount/4
 	}
 	defer func() {
 		if totalCount > 0 {
@@ -145,6 +189,18 @@ func (dm *dmap) updateAccessLog(hkey uint64) {
 	dm.cache.accessLog[hkey] = time.Now().UnixNano()
 }
 
+// lastAccess returns the last access time of the key in nanoseconds. It returns
+// false if the access log is not maintained or there is no record for the key.
+func (dm *dmap) lastAccess(hkey uint64) (int64, bool) {
+	if dm.cache == nil || dm.cache.accessLog == nil {
+		return 0, false
+	}
+	dm.cache.RLock()
+	defer dm.cache.RUnlock()
+	accessedAt, ok := dm.cache.accessLog[hkey]
+	return accessedAt, ok
+}
+
 func (dm *dmap) deleteAccessLog(hkey uint64) {
 	if dm.cache == nil || dm.cache.accessLog == nil {
 		return
@@ -214,5 +270,42 @@ func (db *Olric) evictKeyWithLRU(dm *dmap, name string) error {
 	if db.log.V(6).Ok() {
 		db.log.V(6).Printf("[DEBUG] Evicted item on DMap: %s, Key: %s with LRU", name, key)
 	}
-	return db.delKeyVal(dm, item.HKey, name, key)
+	return db.evictKey(dm, item.HKey, name, key)
+}
+
+// evictKey deletes the key from the DMap. If the DMap has a DemoteTo, the key is
+// moved there first. The caller must hold the DMap's lock.
+func (db *Olric) evictKey(dm *dmap, hkey uint64, name, key string) error {
+	if dm.cache != nil && dm.cache.demoteTo != "" {
+		if err := db.demoteKey(dm, hkey, key); err != nil {
+			// Keep the key. The eviction will be tried again.
+			return err
+		}
+	}
+	return db.delKeyVal(dm, hkey, name, key)
+}
+
+// demoteKey writes the key to the DemoteTo DMap without a TTL. It reuses the
+// transfer of DMap.Copy. The caller must hold the DMap's lock.
+func (db *Olric) demoteKey(dm *dmap, hkey uint64, key string) error {
+	vdata, err := dm.storage.Get(hkey)
+	if err == storage.ErrKeyNotFound {
+		return ErrKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// The value points to the underlying table. Copy it before writing
+	// to the storage.
+	value := make([]byte, len(vdata.Value))
+	copy(value, vdata.Value)
+	vdata.Value = value
+	// The TTL has already expired, or it's irrelevant for the target DMap.
+	vdata.TTL = 0
+	if db.log.V(6).Ok() {
+		db.log.V(6).Printf("[DEBUG] Demoting key: %s to DMap: %s", key, dm.cache.demoteTo)
+	}
+	// put ships the value to the owner of the key on the target DMap, if it's
+	// another member.
+	return db.put(db.prepareCopyWriteop(dm.cache.demoteTo, key, vdata))
 }
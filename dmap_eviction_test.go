@@ -15,7 +15,9 @@
 package olric
 
 import (
+	"bytes"
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -67,6 +69,67 @@ func TestDMap_TTLEviction(t *testing.T) {
 	}
 }
 
+func TestDMap_ReaperBatchSize(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.PartitionCount = 1
+	c.ReaperBatchSize = 4
+	// Keep the background reaper out of the way.
+	c.ReaperInterval = time.Hour
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.PutEx(bkey(i), bval(i), time.Millisecond)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	<-time.After(10 * time.Millisecond)
+
+	before, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	tmp, ok := db.partitions[0].m.Load("mymap")
+	if !ok {
+		t.Fatalf("Expected mymap on the partition")
+	}
+	db.scanDMapForEviction(0, "mymap", tmp.(*dmap))
+
+	after, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	// A run stops after five batches are reaped.
+	if reaped := after.Reaper.Reaped - before.Reaper.Reaped; reaped != 24 {
+		t.Fatalf("Expected 24 reaped keys. Got: %d", reaped)
+	}
+	if scanned := after.Reaper.Scanned - before.Reaper.Scanned; scanned != 24 {
+		t.Fatalf("Expected 24 scanned keys. Got: %d", scanned)
+	}
+	if runs := after.Reaper.Runs - before.Reaper.Runs; runs != 1 {
+		t.Fatalf("Expected 1 run. Got: %d", runs)
+	}
+	if after.Reaper.Lag <= 0 || after.Reaper.MaxLag < after.Reaper.Lag {
+		t.Fatalf("Unexpected lag: %v, max lag: %v", after.Reaper.Lag, after.Reaper.MaxLag)
+	}
+	if length := tmp.(*dmap).storage.Len(); length != 76 {
+		t.Fatalf("Expected 76 keys. Got: %d", length)
+	}
+}
+
 func TestDMap_TTLDuration(t *testing.T) {
 	db, err := newDB(testSingleReplicaConfig())
 	if err != nil {
@@ -200,6 +263,107 @@ func TestDMap_EvictionPolicyLRUMaxKeys(t *testing.T) {
 	}
 }
 
+func TestDMap_MaxKeysPerPartition(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.MaxKeysPerPartition = 10
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	var rejected int
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err == ErrPartitionFull {
+			rejected++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	// We have 7 partitions and a partition may have only 10 keys.
+	if rejected != 30 {
+		t.Fatalf("Expected rejected key count is 30. Got: %d", rejected)
+	}
+
+	// Updating an existing key is allowed.
+	for i := 0; i < 100; i++ {
+		_, err = dm.Get(bkey(i))
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if err = dm.Put(bkey(i), bval(i)); err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	var total uint64
+	for _, part := range s.Partitions {
+		total += part.Rejected
+	}
+	if total != 30 {
+		t.Fatalf("Expected rejected write count is 30. Got: %d", total)
+	}
+}
+
+func TestDMap_MaxKeysPerPartitionWithLRU(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.MaxKeysPerPartition = 10
+	c.Cache = &config.CacheConfig{EvictionPolicy: config.LRUEviction}
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	keyCount := 0
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		part.m.Range(func(k, v interface{}) bool {
+			dm := v.(*dmap)
+			keyCount += dm.storage.Len()
+			return true
+		})
+	}
+	if keyCount != 70 {
+		t.Fatalf("Expected key count is 70. Got: %d", keyCount)
+	}
+}
+
 func TestDMap_EvictionPolicyLRUMaxInuse(t *testing.T) {
 	db, err := newDB(testSingleReplicaConfig())
 	if err != nil {
@@ -241,3 +405,87 @@ func TestDMap_EvictionPolicyLRUMaxInuse(t *testing.T) {
 		t.Fatalf("Key count has to be smaller than 100: %d", keyCount)
 	}
 }
+
+func TestDMap_DemoteTo(t *testing.T) {
+	newConfig := func() *config.Config {
+		c := testConfig(nil)
+		c.Cache = &config.CacheConfig{
+			DMapConfigs: map[string]config.DMapCacheConfig{
+				"hot": {DemoteTo: "warm"},
+			},
+		}
+		return c
+	}
+	db1, err := newDB(newConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := newDB(newConfig(), db1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		for _, db := range []*Olric{db1, db2} {
+			err = db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(db1, db2)
+
+	hot, err := db1.NewDMap("hot")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = hot.PutEx(bkey(i), bval(i), time.Millisecond)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	<-time.After(10 * time.Millisecond)
+	for _, db := range []*Olric{db1, db2} {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			tmp, ok := db.partitions[partID].m.Load("hot")
+			if !ok {
+				continue
+			}
+			for i := 0; i < 10; i++ {
+				db.scanDMapForEviction(partID, "hot", tmp.(*dmap))
+			}
+		}
+	}
+
+	warm, err := db2.NewDMap("warm")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		_, err = hot.Get(bkey(i))
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+		value, err := warm.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v for %s", err, bkey(i))
+		}
+		if !bytes.Equal(value.([]byte), bval(i)) {
+			t.Fatalf("Value is different for key: %s", bkey(i))
+		}
+		ttl, err := warm.GetTTL(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if ttl != NoTTL {
+			t.Fatalf("Expected NoTTL on the demoted key. Got: %v", ttl)
+		}
+	}
+
+	c := newConfig()
+	c.Cache.DMapConfigs["warm"] = config.DMapCacheConfig{DemoteTo: "hot"}
+	_, err = New(c)
+	if err == nil || !strings.Contains(err.Error(), "leads to itself") {
+		t.Fatalf("Expected an error for a demotion cycle. Got: %v", err)
+	}
+}
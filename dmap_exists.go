@@ -0,0 +1,112 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+// lookupLatestVersion finds the most up-to-date version of a key on the owners
+// and the replicas with the same quorum rules as callGetOnCluster. It neither
+// touches the access log nor triggers a read repair. It returns ErrKeyNotFound
+// if the key doesn't exist, or it's expired or idle.
+func (db *Olric) lookupLatestVersion(hkey uint64, name, key string) (*storage.VData, error) {
+	if err := db.checkDMapAvailable(name); err != nil {
+		return nil, err
+	}
+	dm, err := db.getDMap(name, hkey)
+	if err != nil {
+		return nil, err
+	}
+	dm.RLock()
+	defer dm.RUnlock()
+
+	versions, err := db.lookupOnOwners(dm, hkey, name, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if db.config.ReadQuorum >= config.MinimumReplicaCount || db.config.ReadRegionQuorum > 1 {
+		v := db.lookupOnReplicas(dm, hkey, name, key, nil)
+		versions = append(versions, v...)
+	}
+	sorted := db.sanitizeAndSortVersions(versions)
+	readQuorum := db.capQuorum(name, db.config.ReadQuorum)
+	if len(versions) >= readQuorum && len(sorted) == 0 {
+		// We checked everywhere, it's not here.
+		return nil, ErrKeyNotFound
+	}
+	if len(versions) < readQuorum || len(sorted) < readQuorum || !db.checkRegionQuorum(sorted) {
+		return nil, ErrReadQuorum
+	}
+	winner := db.pickWinner(sorted)
+	if isKeyExpired(winner.Data.TTL) || dm.isKeyIdle(hkey) {
+		return nil, ErrKeyNotFound
+	}
+	return winner.Data, nil
+}
+
+func (db *Olric) callExistsOnCluster(hkey uint64, name, key string) (bool, error) {
+	_, err := db.lookupLatestVersion(hkey, name, key)
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (db *Olric) exists(name, key string) (bool, error) {
+	member, hkey := db.findPartitionOwner(name, key)
+	// We are on the partition owner
+	if hostCmp(member, db.this) {
+		return db.callExistsOnCluster(hkey, name, key)
+	}
+	// Redirect to the partition owner
+	req := &protocol.Message{
+		DMap: name,
+		Key:  key,
+	}
+	_, err := db.requestWithRetry(member.String(), protocol.OpExists, req)
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Exists reports whether the given key exists. It honors ReadQuorum like Get:
+// the key is present if a quorum of the owners and the replicas hold a version
+// and the most up-to-date one is neither expired nor idle. The value is not
+// transferred to the caller, so it's cheaper than Get for large values.
+// It returns false and nil error if the key doesn't exist. It's thread-safe.
+func (dm *DMap) Exists(key string) (bool, error) {
+	return dm.db.exists(dm.target(), key)
+}
+
+func (db *Olric) existsOperation(req *protocol.Message) *protocol.Message {
+	ok, err := db.exists(req.DMap, req.Key)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	if !ok {
+		return db.prepareResponse(req, ErrKeyNotFound)
+	}
+	return req.Success()
+}
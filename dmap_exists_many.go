@@ -0,0 +1,128 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack"
+)
+
+// localExistsMany reports the presence of the given keys on this member, the
+// partition owner. Each key is looked up like Exists, respecting the read quorum.
+func (db *Olric) localExistsMany(name string, keys []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		ok, err := db.callExistsOnCluster(db.getHKey(name, key), name, key)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = ok
+	}
+	return result, nil
+}
+
+func (db *Olric) existsMany(name string, keys []string) (map[string]bool, error) {
+	groups := make(map[discovery.Member][]string)
+	for _, key := range keys {
+		member, _, err := db.lookupPartitionOwner(name, key)
+		if err != nil {
+			return nil, err
+		}
+		groups[member] = append(groups[member], key)
+	}
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	var result error
+	found := make(map[string]bool, len(keys))
+	for member, keys := range groups {
+		wg.Add(1)
+		go func(member discovery.Member, keys []string) {
+			defer wg.Done()
+			res, err := db.existsManyOnOwner(member, name, keys)
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err != nil {
+				result = multierror.Append(result,
+					errors.WithMessage(err, fmt.Sprintf("failed to check keys on %s", member)))
+				return
+			}
+			for key, ok := range res {
+				found[key] = ok
+			}
+		}(member, keys)
+	}
+	wg.Wait()
+	if result != nil {
+		return nil, result
+	}
+	return found, nil
+}
+
+func (db *Olric) existsManyOnOwner(member discovery.Member, name string, keys []string) (map[string]bool, error) {
+	if hostCmp(member, db.this) {
+		return db.localExistsMany(name, keys)
+	}
+	value, err := msgpack.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	req := &protocol.Message{
+		DMap:  name,
+		Value: value,
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpExistsMany, req)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]bool)
+	err = msgpack.Unmarshal(resp.Value, &res)
+	return res, err
+}
+
+// ExistsMany reports whether the given keys exist without transferring their
+// values. The keys are grouped by their partition owners and each owner
+// receives a single request. Each key is checked like Exists, the read quorum
+// is respected. The returned map has an entry for every requested key. If some
+// of the owners fail, it returns an error which includes a message for each of
+// them. It's thread-safe.
+func (dm *DMap) ExistsMany(keys []string) (map[string]bool, error) {
+	return dm.db.existsMany(dm.target(), keys)
+}
+
+func (db *Olric) existsManyOperation(req *protocol.Message) *protocol.Message {
+	var keys []string
+	err := msgpack.Unmarshal(req.Value, &keys)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	res, err := db.localExistsMany(req.DMap, keys)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(res)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
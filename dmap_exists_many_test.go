@@ -0,0 +1,76 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDMap_ExistsMany(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	var keys []string
+	for i := 0; i < 20; i++ {
+		keys = append(keys, bkey(i))
+		if i%2 != 0 {
+			continue
+		}
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm1.PutEx("expired", bval(0), time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	keys = append(keys, "expired")
+	<-time.After(10 * time.Millisecond)
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	res, err := dm2.ExistsMany(keys)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(res) != len(keys) {
+		t.Fatalf("Expected %d keys. Got: %d", len(keys), len(res))
+	}
+	for i := 0; i < 20; i++ {
+		if res[bkey(i)] != (i%2 == 0) {
+			t.Fatalf("Expected %v for %s. Got: %v", i%2 == 0, bkey(i), res[bkey(i)])
+		}
+	}
+	if res["expired"] {
+		t.Fatalf("Expected false for an expired key")
+	}
+}
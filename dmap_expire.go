@@ -30,6 +30,9 @@ func (db *Olric) localExpire(hkey uint64, dm *dmap, w *writeop) error {
 		Timestamp: w.timestamp,
 		TTL:       ttl,
 	}
+	if err := dm.wal.expire(w.dmap, w.key, w.timestamp, ttl); err != nil {
+		return err
+	}
 	err := dm.storage.UpdateTTL(hkey, val)
 	if err != nil {
 		if err == storage.ErrKeyNotFound {
@@ -44,7 +47,7 @@ func (db *Olric) localExpire(hkey uint64, dm *dmap, w *writeop) error {
 func (db *Olric) asyncExpireOnCluster(hkey uint64, dm *dmap, w *writeop) error {
 	req := w.toReq(protocol.OpExpireReplica)
 	// Fire and forget mode.
-	owners := db.getBackupPartitionOwners(hkey)
+	owners := db.getDMapBackupOwners(w.dmap, hkey)
 	for _, owner := range owners {
 		db.wg.Add(1)
 		go func(host discovery.Member) {
@@ -65,7 +68,7 @@ func (db *Olric) syncExpireOnCluster(hkey uint64, dm *dmap, w *writeop) error {
 
 	// Quorum based replication.
 	var successful int
-	owners := db.getBackupPartitionOwners(hkey)
+	owners := db.getDMapBackupOwners(w.dmap, hkey)
 	for _, owner := range owners {
 		_, err := db.requestTo(owner.String(), protocol.OpExpireReplica, req)
 		if err != nil {
@@ -86,13 +89,16 @@ func (db *Olric) syncExpireOnCluster(hkey uint64, dm *dmap, w *writeop) error {
 	} else {
 		successful++
 	}
-	if successful >= db.config.WriteQuorum {
+	if successful >= db.capQuorum(w.dmap, db.config.WriteQuorum) {
 		return nil
 	}
 	return ErrWriteQuorum
 }
 
 func (db *Olric) callExpireOnCluster(hkey uint64, w *writeop) error {
+	if err := db.checkWritable(w.dmap); err != nil {
+		return err
+	}
 	// Get the DMap and acquire its lock
 	dm, err := db.getDMap(w.dmap, hkey)
 	if err != nil {
@@ -101,19 +107,22 @@ func (db *Olric) callExpireOnCluster(hkey uint64, w *writeop) error {
 	dm.Lock()
 	defer dm.Unlock()
 
-	if db.config.ReplicaCount == config.MinimumReplicaCount {
+	if db.replicaCount(w.dmap) == config.MinimumReplicaCount {
 		// MinimumReplicaCount is 1. So it's enough to put the key locally. There is no
 		// other replica host.
-		return db.localExpire(hkey, dm, w)
-	}
-
-	if db.config.ReplicationMode == config.AsyncReplicationMode {
-		return db.asyncExpireOnCluster(hkey, dm, w)
+		err = db.localExpire(hkey, dm, w)
+	} else if db.config.ReplicationMode == config.AsyncReplicationMode {
+		err = db.asyncExpireOnCluster(hkey, dm, w)
 	} else if db.config.ReplicationMode == config.SyncReplicationMode {
-		return db.syncExpireOnCluster(hkey, dm, w)
+		err = db.syncExpireOnCluster(hkey, dm, w)
+	} else {
+		return fmt.Errorf("invalid replication mode: %v", db.config.ReplicationMode)
 	}
-
-	return fmt.Errorf("invalid replication mode: %v", db.config.ReplicationMode)
+	if err != nil {
+		return err
+	}
+	db.publishChange(w.dmap, ChangeExpire, w.key, nil, w.timestamp)
+	return nil
 }
 
 func (db *Olric) expire(w *writeop) error {
@@ -159,7 +168,7 @@ func (db *Olric) exExpireOperation(req *protocol.Message) *protocol.Message {
 // DB does not contains the key. It's thread-safe.
 func (dm *DMap) Expire(key string, timeout time.Duration) error {
 	w := &writeop{
-		dmap:      dm.name,
+		dmap:      dm.target(),
 		key:       key,
 		timestamp: time.Now().UnixNano(),
 		timeout:   timeout,
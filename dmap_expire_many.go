@@ -0,0 +1,244 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack"
+)
+
+// updateTTL sets the TTL of a key without bumping its timestamp. A TTL-only
+// update must not win the last write wins resolution against a newer value.
+// It returns false if the key doesn't exist or has already expired. The caller
+// must hold the DMap's lock.
+func (db *Olric) updateTTL(dm *dmap, name string, hkey uint64, ttl int64) (bool, error) {
+	vdata, err := dm.storage.Get(hkey)
+	if err == storage.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if isKeyExpired(vdata.TTL) {
+		return false, nil
+	}
+	if err = dm.wal.expire(name, vdata.Key, vdata.Timestamp, ttl); err != nil {
+		return false, err
+	}
+	err = dm.storage.UpdateTTL(hkey, &storage.VData{
+		Timestamp: vdata.Timestamp,
+		TTL:       ttl,
+	})
+	if err != nil {
+		return false, err
+	}
+	dm.updateAccessLog(hkey)
+	return true, nil
+}
+
+// replicateExpireMany sends the updated keys to the backup owners, one request
+// per backup owner.
+func (db *Olric) replicateExpireMany(name string, backups map[discovery.Member][]string, timeout time.Duration) error {
+	send := func(owner discovery.Member, keys []string) error {
+		value, err := msgpack.Marshal(keys)
+		if err != nil {
+			return err
+		}
+		req := &protocol.Message{
+			DMap:  name,
+			Value: value,
+			Extra: protocol.ExpireManyExtra{
+				TTL: timeout.Nanoseconds(),
+			},
+		}
+		_, err = db.requestTo(owner.String(), protocol.OpExpireManyReplica, req)
+		return err
+	}
+
+	if db.config.ReplicationMode == config.AsyncReplicationMode {
+		// Fire and forget mode.
+		for owner, keys := range backups {
+			db.wg.Add(1)
+			go func(owner discovery.Member, keys []string) {
+				defer db.wg.Done()
+				if err := send(owner, keys); err != nil {
+					db.log.V(3).Printf("[ERROR] Failed to set expire in async mode on %s for DMap: %s: %v",
+						owner, name, err)
+				}
+			}(owner, keys)
+		}
+		return nil
+	}
+
+	var result error
+	for owner, keys := range backups {
+		if err := send(owner, keys); err != nil {
+			result = multierror.Append(result,
+				errors.WithMessage(err, fmt.Sprintf("failed to set expire on backup owner %s", owner)))
+		}
+	}
+	return result
+}
+
+// localExpireMany sets the TTL of the given keys on this member, the partition
+// owner, and replicates them. It returns the number of the existing keys.
+func (db *Olric) localExpireMany(name string, keys []string, timeout time.Duration) (int, error) {
+	if err := db.checkWritable(name); err != nil {
+		return 0, err
+	}
+
+	ttl := getTTL(timeout)
+	backups := make(map[discovery.Member][]string)
+	var count int
+	for _, key := range keys {
+		hkey := db.getHKey(name, key)
+		dm, err := db.getDMap(name, hkey)
+		if err != nil {
+			return count, err
+		}
+		dm.Lock()
+		ok, err := db.updateTTL(dm, name, hkey, ttl)
+		dm.Unlock()
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			continue
+		}
+		count++
+		if db.replicaCount(name) > config.MinimumReplicaCount {
+			for _, owner := range db.getDMapBackupOwners(name, hkey) {
+				backups[owner] = append(backups[owner], key)
+			}
+		}
+	}
+	return count, db.replicateExpireMany(name, backups, timeout)
+}
+
+func (db *Olric) expireMany(name string, keys []string, timeout time.Duration) (int, error) {
+	groups := make(map[discovery.Member][]string)
+	for _, key := range keys {
+		member, _ := db.findPartitionOwner(name, key)
+		groups[member] = append(groups[member], key)
+	}
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	var total int
+	var result error
+	for member, keys := range groups {
+		wg.Add(1)
+		go func(member discovery.Member, keys []string) {
+			defer wg.Done()
+			count, err := db.expireManyOnOwner(member, name, keys, timeout)
+			mtx.Lock()
+			defer mtx.Unlock()
+			total += count
+			if err != nil {
+				result = multierror.Append(result,
+					errors.WithMessage(err, fmt.Sprintf("failed to set expire on %s", member)))
+			}
+		}(member, keys)
+	}
+	wg.Wait()
+	return total, result
+}
+
+func (db *Olric) expireManyOnOwner(member discovery.Member, name string,
+	keys []string, timeout time.Duration) (int, error) {
+	if hostCmp(member, db.this) {
+		return db.localExpireMany(name, keys, timeout)
+	}
+	value, err := msgpack.Marshal(keys)
+	if err != nil {
+		return 0, err
+	}
+	req := &protocol.Message{
+		DMap:  name,
+		Value: value,
+		Extra: protocol.ExpireManyExtra{
+			TTL: timeout.Nanoseconds(),
+		},
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpExpireMany, req)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = msgpack.Unmarshal(resp.Value, &count)
+	return count, err
+}
+
+// ExpireMany updates the expiry for the given keys. The keys are grouped by
+// their partition owners and each owner receives a single request. Unlike
+// Expire, it doesn't update the timestamps of the keys. It returns the number
+// of the keys which exist and have their TTL set. If some of the owners fail,
+// the error includes a message for each of them and the count only covers the
+// successful ones. It's thread-safe.
+func (dm *DMap) ExpireMany(keys []string, timeout time.Duration) (int, error) {
+	return dm.db.expireMany(dm.target(), keys, timeout)
+}
+
+func (db *Olric) expireManyOperation(req *protocol.Message) *protocol.Message {
+	var keys []string
+	err := msgpack.Unmarshal(req.Value, &keys)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	timeout := time.Duration(req.Extra.(protocol.ExpireManyExtra).TTL)
+	count, err := db.localExpireMany(req.DMap, keys, timeout)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(count)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
+
+func (db *Olric) expireManyReplicaOperation(req *protocol.Message) *protocol.Message {
+	var keys []string
+	err := msgpack.Unmarshal(req.Value, &keys)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	ttl := getTTL(time.Duration(req.Extra.(protocol.ExpireManyExtra).TTL))
+	for _, key := range keys {
+		hkey := db.getHKey(req.DMap, key)
+		dm, err := db.getBackupDMap(req.DMap, hkey)
+		if err != nil {
+			return db.prepareResponse(req, err)
+		}
+		dm.Lock()
+		_, err = db.updateTTL(dm, req.DMap, hkey, ttl)
+		dm.Unlock()
+		if err != nil {
+			return db.prepareResponse(req, err)
+		}
+	}
+	return req.Success()
+}
@@ -0,0 +1,102 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDMap_ExpireMany(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	var keys []string
+	timestamps := make(map[string]int64)
+	for i := 0; i < 10; i++ {
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		res, err := db1.getWithOptions("mymap", bkey(i), &ReadOptions{})
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		timestamps[bkey(i)] = res.Timestamp
+		keys = append(keys, bkey(i))
+	}
+	keys = append(keys, "missing-key")
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	count, err := dm2.ExpireMany(keys, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if count != 10 {
+		t.Fatalf("Expected count is 10. Got: %d", count)
+	}
+
+	for i := 0; i < 10; i++ {
+		res, err := db2.getWithOptions("mymap", bkey(i), &ReadOptions{})
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if res.Timestamp != timestamps[bkey(i)] {
+			t.Fatalf("Expected timestamp of %s not to change", bkey(i))
+		}
+	}
+
+	<-time.After(100 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		// Check the backups too.
+		for _, db := range []*Olric{db1, db2} {
+			hkey := db.getHKey("mymap", bkey(i))
+			if !hostCmp(db.getBackupPartitionOwners(hkey)[0], db.this) {
+				continue
+			}
+			dm, err := db.getBackupDMap("mymap", hkey)
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			ttl, err := dm.storage.GetTTL(hkey)
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if !isKeyExpired(ttl) {
+				t.Fatalf("Expected the backup of %s to be expired", bkey(i))
+			}
+		}
+		_, err = dm2.Get(bkey(i))
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+	}
+}
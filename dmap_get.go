@@ -17,18 +17,37 @@ package olric
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/buraksezer/olric/config"
 	"github.com/buraksezer/olric/internal/discovery"
 	"github.com/buraksezer/olric/internal/protocol"
 	"github.com/buraksezer/olric/internal/storage"
+	"github.com/buraksezer/olric/serializer"
 	"github.com/vmihailenco/msgpack"
 )
 
 var ErrReadQuorum = errors.New("read quorum cannot be reached")
 
+// ErrKeyExpired is returned instead of ErrKeyNotFound if the TTL of the key
+// has expired and ReadOptions.ExpiryReason is set.
+var ErrKeyExpired = errors.New("key expired")
+
+// ErrKeyIdle is returned instead of ErrKeyNotFound if the key has stayed idle
+// longer than MaxIdleDuration and ReadOptions.ExpiryReason is set.
+var ErrKeyIdle = errors.New("key idle")
+
+// ErrStaleRead is returned along with the best available version of a value
+// if ReadOptions.AllowStale is set and the read quorum cannot be reached.
+var ErrStaleRead = errors.New("stale read: read quorum cannot be reached")
+
+// ErrNoMajority is returned if ReadOptions.MajorityAgreement is set and less
+// than a strict majority of the versions share the timestamp of the winner.
+var ErrNoMajority = errors.New("no majority agreement among the versions")
+
 type version struct {
 	host *discovery.Member
 	Data *storage.VData
@@ -36,7 +55,7 @@ type version struct {
 
 func (db *Olric) unmarshalValue(rawval []byte) (interface{}, error) {
 	var value interface{}
-	err := db.serializer.Unmarshal(rawval, &value)
+	err := db.unmarshal(rawval, &value)
 	if err != nil {
 		return nil, err
 	}
@@ -47,30 +66,26 @@ func (db *Olric) unmarshalValue(rawval []byte) (interface{}, error) {
 }
 
 // lookupOnOwners collects versions of a key/value pair on the partition owner
-// by including previous partition owners.
-func (db *Olric) lookupOnOwners(dm *dmap, hkey uint64, name, key string) []*version {
-	var versions []*version
+// by including previous partition owners. It returns ErrClusterNotReady if the
+// partition has no owner yet. It stops querying the previous owners once the
+// limit is reached, the limit may be nil.
+func (db *Olric) lookupOnOwners(dm *dmap, hkey uint64, name, key string, limit *readLimit) ([]*version, error) {
+	owners := db.getPartitionOwners(hkey)
+	if len(owners) == 0 {
+		return nil, ErrClusterNotReady
+	}
 
 	// Check on localhost, the partition owner.
-	value, err := dm.storage.Get(hkey)
-	ver := &version{host: &db.this}
-	if err == nil {
-		ver.Data = value
-	} else {
-		if db.log.V(3).Ok() {
-			db.log.V(3).Printf("[ERROR] Failed to get key from local storage: %v", err)
-		}
-	}
-	versions = append(versions, ver)
+	versions := []*version{db.lookupOnLocal(dm, hkey)}
+	limit.observe(versions[0])
 
 	// Run a query on the previous owners.
-	owners := db.getPartitionOwners(hkey)
-	if len(owners) == 0 {
-		panic("partition owners list cannot be empty")
-	}
 
 	// Traverse in reverse order. Except from the latest host, this one.
 	for i := len(owners) - 2; i >= 0; i-- {
+		if limit.reached() {
+			break
+		}
 		owner := owners[i]
 		req := &protocol.Message{
 			DMap: name,
@@ -78,7 +93,7 @@ func (db *Olric) lookupOnOwners(dm *dmap, hkey uint64, name, key string) []*vers
 		}
 
 		ver := &version{host: &owner}
-		resp, err := db.requestTo(owner.String(), protocol.OpGetPrev, req)
+		resp, err := db.readRequestTo(owner.String(), protocol.OpGetPrev, req)
 		if err != nil {
 			if db.log.V(3).Ok() {
 				db.log.V(3).Printf("[ERROR] Failed to call get on a previous "+
@@ -95,16 +110,36 @@ func (db *Olric) lookupOnOwners(dm *dmap, hkey uint64, name, key string) []*vers
 				// Ignore failed owners. The data on those hosts will be wiped out
 				// by the rebalancer.
 				versions = append(versions, ver)
+				limit.observe(ver)
 			}
 		}
 	}
-	return versions
+	return versions, nil
+}
+
+// lookupOnLocal returns the version of a key/value pair on this node.
+func (db *Olric) lookupOnLocal(dm *dmap, hkey uint64) *version {
+	value, err := dm.storage.Get(hkey)
+	ver := &version{host: &db.this}
+	if err == nil {
+		ver.Data = value
+	} else {
+		if db.log.V(3).Ok() {
+			db.log.V(3).Printf("[ERROR] Failed to get key from local storage: %v", err)
+		}
+	}
+	return ver
 }
 
 func (db *Olric) sortVersions(versions []*version) []*version {
 	sort.Slice(versions,
 		func(i, j int) bool {
 			if versions[i].Data.Timestamp == versions[j].Data.Timestamp {
+				if db.config.ValueEqual != nil &&
+					db.config.ValueEqual(versions[i].Data.Value, versions[j].Data.Value) {
+					// Logically equal values. Keep the order.
+					return false
+				}
 				// The first one is greater or equal than the second one.
 				return bytes.Compare(versions[i].Data.Value, versions[j].Data.Value) >= 0
 			}
@@ -120,6 +155,7 @@ func (db *Olric) sanitizeAndSortVersions(versions []*version) []*version {
 	// We use versions slice for read-repair. Clear nil values first.
 	for _, ver := range versions {
 		if ver.Data != nil {
+			db.observeClockSkew(ver)
 			sanitized = append(sanitized, ver)
 		}
 	}
@@ -129,167 +165,586 @@ func (db *Olric) sanitizeAndSortVersions(versions []*version) []*version {
 	return db.sortVersions(sanitized)
 }
 
-func (db *Olric) lookupOnReplicas(dm *dmap, hkey uint64, name, key string) []*version {
+// pickWinner returns the most up-to-date version from the sorted versions. If
+// PreferUnexpiredVersions is set, the expired versions are skipped as long as
+// there is a non-expired one.
+func (db *Olric) pickWinner(sorted []*version) *version {
+	if db.config.PreferUnexpiredVersions {
+		for _, ver := range sorted {
+			if !isKeyExpired(ver.Data.TTL) {
+				return ver
+			}
+		}
+	}
+	return sorted[0]
+}
+
+// readWeight returns the read weight of a member. The members which don't
+// share a weight have the default one.
+func readWeight(member discovery.Member) int {
+	if member.Weight <= 0 {
+		return config.DefaultReadWeight
+	}
+	return member.Weight
+}
+
+// sortByReadWeight returns a copy of the members in descending order of their
+// read weights. The members with the same weight keep their order.
+func sortByReadWeight(members []discovery.Member) []discovery.Member {
+	sorted := make([]discovery.Member, len(members))
+	copy(sorted, members)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return readWeight(sorted[i]) > readWeight(sorted[j])
+	})
+	return sorted
+}
+
+// lookupOnReplicas collects versions of a key/value pair on the backup owners.
+// It stops querying the replicas once the limit is reached, the limit may be nil.
+func (db *Olric) lookupOnReplicas(dm *dmap, hkey uint64, name, key string, limit *readLimit) []*version {
 	var versions []*version
-	// Check backups.
-	backups := db.getBackupPartitionOwners(hkey)
+	// Check backups. Prefer the members with a higher read weight.
+	backups := sortByReadWeight(db.getDMapBackupOwners(name, hkey))
 	for _, replica := range backups {
+		if limit.reached() {
+			break
+		}
+		replica := replica
 		req := &protocol.Message{
 			DMap: name,
 			Key:  key,
 		}
 
 		ver := &version{host: &replica}
-		resp, err := db.requestTo(replica.String(), protocol.OpGetBackup, req)
-		if err != nil {
+		resp, err := db.readRequestTo(replica.String(), protocol.OpGetBackup, req)
+		if err == ErrCircuitOpen {
+			// Treat the replica as unavailable.
+			continue
+		}
+		switch {
+		case err == ErrKeyNotFound:
+			// The replica doesn't have the key or the DMap yet. It's an absent
+			// version, it counts towards the read quorum.
+		case err != nil:
+			// The replica didn't answer. It doesn't count towards the read quorum.
 			if db.log.V(3).Ok() {
 				db.log.V(3).Printf("[ERROR] Failed to call get on a replica owner: %s: %v", replica, err)
 			}
-		} else {
+			continue
+		default:
 			value := storage.VData{}
 			err = msgpack.Unmarshal(resp.Value, &value)
 			if err != nil {
 				db.log.V(2).Printf("[ERROR] Failed to unmarshal data from a replica owner: %s: %v", replica, err)
-			} else {
-				ver.Data = &value
+				continue
 			}
+			ver.Data = &value
 		}
 		versions = append(versions, ver)
+		limit.observe(ver)
 	}
 	return versions
 }
 
-func (db *Olric) readRepair(name string, dm *dmap, winner *version, versions []*version) {
+// canSkipReplicas returns true if the versions found on the owners satisfy the
+// read quorum. See config.AvoidReplicaReads.
+func (db *Olric) canSkipReplicas(versions []*version, readQuorum int, opts *ReadOptions) bool {
+	if !db.config.AvoidReplicaReads || db.config.ReadRepair || opts.ReadRepair {
+		return false
+	}
+	if opts.ReadAll || opts.MajorityAgreement {
+		return false
+	}
+	if db.config.ReadRegionQuorum > 0 || db.config.PreferUnexpiredVersions {
+		return false
+	}
+	var found int
 	for _, ver := range versions {
-		if ver.Data != nil && winner.Data.Timestamp == ver.Data.Timestamp {
-			continue
+		if ver.Data != nil {
+			found++
 		}
+	}
+	return found >= readQuorum
+}
 
-		// If readRepair is enabled, this function is called by every GET request.
-		req := &protocol.Message{
-			DMap:  name,
-			Key:   winner.Data.Key,
-			Value: winner.Data.Value,
+// readRepair propagates the winner to the stale versions. The versions which
+// lag behind the winner by no more than minLag are skipped, they're expected
+// to receive the write by the replication. The missing versions are always
+// synchronized. It returns the number of the synchronized versions.
+func (db *Olric) readRepair(name string, dm *dmap, winner *version, versions []*version, minLag time.Duration) int {
+	// The stored TTL is an absolute expiry time. Convert it back to a timeout
+	// to propagate the winner's expiry as it is. A zero timeout clears
+	// the TTL of a stale replica.
+	w := &writeop{
+		dmap:      name,
+		key:       winner.Data.Key,
+		value:     winner.Data.Value,
+		timestamp: winner.Data.Timestamp,
+		timeout:   getTimeout(winner.Data.TTL),
+		deadline:  winner.Data.Deadline,
+	}
+	op := protocol.OpPutReplica
+	if w.timeout != 0 {
+		op = protocol.OpPutExReplica
+	}
+	if w.deadline != 0 {
+		op = protocol.OpPutWithOptionsReplica
+	}
+
+	var repaired int
+	for _, ver := range versions {
+		if db.sameVersion(winner, ver) {
+			continue
 		}
-		var op protocol.OpCode
-		if winner.Data.TTL == 0 {
-			op = protocol.OpPutReplica
-			req.Extra = protocol.PutExtra{Timestamp: winner.Data.Timestamp}
-		} else {
-			op = protocol.OpPutExReplica
-			req.Extra = protocol.PutExExtra{
-				Timestamp: winner.Data.Timestamp,
-				TTL:       winner.Data.TTL,
+		if minLag > 0 && ver.Data != nil {
+			// Only the replicas which are slightly behind the winner are skipped.
+			lag := winner.Data.Timestamp - ver.Data.Timestamp
+			if lag > 0 && lag <= minLag.Nanoseconds() {
+				continue
 			}
 		}
 
 		// Sync
 		if hostCmp(*ver.host, db.this) {
 			hkey := db.getHKey(name, winner.Data.Key)
-			w := &writeop{
-				dmap:      name,
-				key:       winner.Data.Key,
-				value:     winner.Data.Value,
-				timestamp: winner.Data.Timestamp,
-				timeout:   time.Duration(winner.Data.TTL),
-			}
 			dm.Lock()
 			err := db.localPut(hkey, dm, w)
 			if err != nil {
 				db.log.V(2).Printf("[ERROR] Failed to synchronize with replica: %v", err)
+			} else {
+				repaired++
 			}
 			dm.Unlock()
 		} else {
-			_, err := db.requestTo(ver.host.String(), op, req)
+			// If readRepair is enabled, this function is called by every GET request.
+			_, err := db.requestTo(ver.host.String(), op, w.toReq(op))
 			if err != nil {
 				db.log.V(2).Printf("[ERROR] Failed to synchronize replica %s: %v", ver.host, err)
+			} else {
+				repaired++
 			}
 		}
 	}
+	atomic.AddUint64(&db.metrics.readRepairs, uint64(repaired))
+	return repaired
+}
+
+// ReadOptions defines options for a read request. See DMap.GetWithOptions.
+type ReadOptions struct {
+	// ReadAll forces the partition owner to consult every backup owner
+	// regardless of ReadQuorum and report whether the versions diverge.
+	// This is useful for consistency monitoring.
+	ReadAll bool
+
+	// ReadRepair triggers read-repair for the request. If ReadAll is set,
+	// read-repair only runs if it's requested here, otherwise config.ReadRepair
+	// is also taken into account.
+	ReadRepair bool
+
+	// Consistency overrides ReadQuorum for the request.
+	Consistency ConsistencyLevel
+
+	// AllowStale returns the most up-to-date version among the available ones
+	// along with ErrStaleRead, instead of failing with ErrReadQuorum, if the read
+	// quorum cannot be reached. Read-repair is skipped for stale reads.
+	AllowStale bool
+
+	// ExpiryReason returns ErrKeyExpired or ErrKeyIdle instead of ErrKeyNotFound
+	// if the key is still there but has expired by its TTL or MaxIdleDuration.
+	// A key which has already been evicted is still reported as ErrKeyNotFound.
+	ExpiryReason bool
+
+	// MajorityAgreement consults every backup owner and returns ErrNoMajority
+	// unless a strict majority of the found versions share the timestamp of the
+	// winner. The versions in minority are repaired, they don't fail the read.
+	MajorityAgreement bool
+}
+
+// ReadResult is the result of a read request with options.
+type ReadResult struct {
+	Value interface{}
+
+	// Diverged is true if one of the owners or the replicas has a different
+	// version of the value or doesn't have it at all. It's only reported
+	// when ReadOptions.ReadAll is set.
+	Diverged bool
+
+	// Agreed is the number of versions which share the timestamp of the
+	// returned value. It's only reported when ReadOptions.MajorityAgreement
+	// is set.
+	Agreed int
+
+	// Degraded is true if the value is served from the local storage of this
+	// member. See config.AllowLocalOnlyOnPartition.
+	Degraded bool
+}
+
+// getResult is the internal representation of ReadResult. It's also sent
+// over the wire as a response to OpGetWithOptions.
+type getResult struct {
+	Value     []byte
+	Diverged  bool
+	Stale     bool
+	Timestamp int64
+	Agreed    int
+
+	// The access time of the key before this read. See DMap.LastAccess.
+	LastAccess int64
 }
 
-func (db *Olric) callGetOnCluster(hkey uint64, name, key string) ([]byte, error) {
+// sameVersion returns true if ver is the same as the winner. A version with
+// a different timestamp is the same if config.ValueEqual reports its value as
+// equal to the winner's and it expires at the same time.
+func (db *Olric) sameVersion(winner, ver *version) bool {
+	if ver.Data == nil {
+		return false
+	}
+	if ver.Data.Timestamp == winner.Data.Timestamp {
+		return true
+	}
+	return db.config.ValueEqual != nil &&
+		ver.Data.TTL == winner.Data.TTL &&
+		db.config.ValueEqual(winner.Data.Value, ver.Data.Value)
+}
+
+// isDiverged returns true if any of the versions differs from the winner.
+func (db *Olric) isDiverged(winner *version, versions []*version) bool {
+	for _, ver := range versions {
+		if !db.sameVersion(winner, ver) {
+			return true
+		}
+	}
+	return false
+}
+
+// countAgreed returns the number of versions which are the same as the winner.
+func (db *Olric) countAgreed(winner *version, sorted []*version) int {
+	var agreed int
+	for _, ver := range sorted {
+		if db.sameVersion(winner, ver) {
+			agreed++
+		}
+	}
+	return agreed
+}
+
+// checkRegionQuorum returns true if the versions are collected from at least
+// ReadRegionQuorum distinct regions.
+func (db *Olric) checkRegionQuorum(versions []*version) bool {
+	if db.config.ReadRegionQuorum == 0 {
+		return true
+	}
+	regions := make(map[string]struct{})
+	for _, ver := range versions {
+		if ver.host.Region == "" {
+			continue
+		}
+		regions[ver.host.Region] = struct{}{}
+	}
+	return len(regions) >= db.config.ReadRegionQuorum
+}
+
+func (db *Olric) callGetOnCluster(hkey uint64, name, key string, opts *ReadOptions) (*getResult, error) {
+	if opts == nil {
+		opts = &ReadOptions{}
+	}
+	if err := db.checkDMapAvailable(name); err != nil {
+		return nil, err
+	}
+	readQuorum, err := db.quorum(name, opts.Consistency, db.config.ReadQuorum)
+	if err != nil {
+		return nil, err
+	}
 	dm, err := db.getDMap(name, hkey)
 	if err != nil {
 		return nil, err
 	}
+	prof := db.readProfile.sample(db.config.ReadProfileSampleRate)
+	defer db.readProfile.record(&prof)
+
 	dm.RLock()
 	// RUnlock should not be called with defer statement here because
 	// readRepair function may call localPut function which needs a write
 	// lock. Please don't forget calling RUnlock before returning here.
 
-	versions := db.lookupOnOwners(dm, hkey, name, key)
-	if db.config.ReadQuorum >= config.MinimumReplicaCount {
-		v := db.lookupOnReplicas(dm, hkey, name, key)
-		versions = append(versions, v...)
-	}
-	if len(versions) < db.config.ReadQuorum {
-		dm.RUnlock()
-		return nil, ErrReadQuorum
+	var versions []*version
+	limit := db.newReadLimit(readQuorum, opts)
+	prof.lap()
+	if opts.Consistency == ConsistencyLocalOne {
+		versions = append(versions, db.lookupOnLocal(dm, hkey))
+		prof.owners = prof.lap()
+	} else {
+		versions, err = db.lookupOnOwners(dm, hkey, name, key, limit)
+		if err != nil {
+			dm.RUnlock()
+			return nil, err
+		}
+		prof.owners = prof.lap()
+		if (readQuorum >= config.MinimumReplicaCount ||
+			db.config.ReadRegionQuorum > 1 || opts.ReadAll || opts.MajorityAgreement) &&
+			!db.canSkipReplicas(versions, readQuorum, opts) {
+			v := db.lookupOnReplicas(dm, hkey, name, key, limit)
+			versions = append(versions, v...)
+			prof.replicas = prof.lap()
+		}
 	}
+	db.readVersions.observe(len(versions), limit != nil && limit.truncated)
 	sorted := db.sanitizeAndSortVersions(versions)
-	if len(sorted) == 0 {
+	prof.sort = prof.lap()
+	if len(versions) >= readQuorum && len(sorted) == 0 {
 		// We checked everywhere, it's not here.
 		dm.RUnlock()
 		return nil, ErrKeyNotFound
 	}
-	if len(sorted) < db.config.ReadQuorum {
-		dm.RUnlock()
-		return nil, ErrReadQuorum
+	var stale bool
+	if len(versions) < readQuorum || len(sorted) < readQuorum || !db.checkRegionQuorum(sorted) {
+		if !opts.AllowStale || len(sorted) == 0 {
+			dm.RUnlock()
+			return nil, ErrReadQuorum
+		}
+		// Serve the best available version. The caller decides to use it or not.
+		stale = true
 	}
 
 	// The most up-to-date version of the values.
-	winner := sorted[0]
-	if isKeyExpired(winner.Data.TTL) || dm.isKeyIdle(hkey) {
+	winner := db.pickWinner(sorted)
+	if isKeyExpired(winner.Data.TTL) {
 		dm.RUnlock()
-		return nil, ErrKeyNotFound
+		return nil, expiryError(ErrKeyExpired, opts)
+	}
+	if dm.isKeyIdle(hkey) {
+		dm.RUnlock()
+		return nil, expiryError(ErrKeyIdle, opts)
 	}
 	// LRU and MaxIdleDuration eviction policies are only valid on
 	// the partition owner. Normally, we shouldn't need to retrieve the keys
 	// from the backup or the previous owners. When the fsck merge
 	// a fragmented partition or recover keys from a backup, Olric
 	// continue maintaining a reliable access log.
+	lastAccess, _ := dm.lastAccess(hkey)
 	dm.updateAccessLog(hkey)
 
 	dm.RUnlock()
-	if db.config.ReadRepair {
+
+	res := &getResult{
+		Value:      winner.Data.Value,
+		Timestamp:  winner.Data.Timestamp,
+		LastAccess: lastAccess,
+	}
+	if stale {
+		// Don't propagate a version which may be outdated.
+		res.Stale = true
+		return res, nil
+	}
+	readRepair := db.config.ReadRepair || opts.ReadRepair
+	if opts.ReadAll {
+		res.Diverged = db.isDiverged(winner, versions)
+		// Don't hide the divergence unless it's requested explicitly.
+		readRepair = opts.ReadRepair
+	}
+	if opts.MajorityAgreement {
+		res.Agreed = db.countAgreed(winner, sorted)
+		if res.Agreed*2 <= len(sorted) {
+			return nil, ErrNoMajority
+		}
+		// Bring the minority in line with the majority.
+		if db.isDiverged(winner, versions) {
+			readRepair = true
+		}
+	}
+	if readRepair {
 		// Parallel read operations may propagate different versions of
 		// the same key/value pair. The rule is simple: last write wins.
-		db.readRepair(name, dm, winner, versions)
+		prof.lap()
+		db.readRepair(name, dm, winner, versions, db.config.ReadRepairMinLag)
+		prof.repair = prof.lap()
+	}
+	return res, nil
+}
+
+// expiryError returns the reason of a miss, if it's requested. See ReadOptions.ExpiryReason.
+func expiryError(reason error, opts *ReadOptions) error {
+	if opts.ExpiryReason {
+		return reason
 	}
-	return winner.Data.Value, nil
+	return ErrKeyNotFound
 }
 
 func (db *Olric) get(name, key string) ([]byte, error) {
-	member, hkey := db.findPartitionOwner(name, key)
+	member, hkey, err := db.lookupPartitionOwner(name, key)
+	if err != nil {
+		return nil, err
+	}
 	// We are on the partition owner
 	if hostCmp(member, db.this) {
-		return db.callGetOnCluster(hkey, name, key)
+		res, err := db.callGetOnCluster(hkey, name, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		return res.Value, nil
 	}
 	// Redirect to the partition owner
+	if db.config.RedirectedReadCacheTTL > 0 {
+		return db.readCoalescer.get(name, key, func() ([]byte, error) {
+			return db.getFromOwner(member, name, key)
+		})
+	}
+	return db.getFromOwner(member, name, key)
+}
+
+// getFromOwner sends a read request to the partition owner.
+func (db *Olric) getFromOwner(member discovery.Member, name, key string) ([]byte, error) {
 	req := &protocol.Message{
 		DMap: name,
 		Key:  key,
 	}
-	resp, err := db.requestTo(member.String(), protocol.OpGet, req)
+	resp, err := db.requestWithRetry(member.String(), protocol.OpGet, req)
 	if err != nil {
 		return nil, err
 	}
+	if err = checkCodec(resp, db.serializer); err != nil {
+		return nil, err
+	}
 	return resp.Value, nil
 }
 
+// checkCodec returns ErrSerializerMismatch if the response is served by a member
+// which uses a different serializer. It's not checked for the unknown codecs and
+// the members which don't report their codec.
+func checkCodec(resp *protocol.Message, s serializer.Serializer) error {
+	extra, ok := resp.Extra.(protocol.GetResponseExtra)
+	if !ok {
+		return nil
+	}
+	codec := serializer.Codec(s)
+	if extra.Codec == serializer.UnknownCodec || codec == serializer.UnknownCodec {
+		return nil
+	}
+	if extra.Codec != codec {
+		return ErrSerializerMismatch
+	}
+	return nil
+}
+
+func (db *Olric) getWithOptions(name, key string, opts *ReadOptions) (*getResult, error) {
+	member, hkey, err := db.lookupPartitionOwner(name, key)
+	if err != nil {
+		return nil, err
+	}
+	// We are on the partition owner
+	if hostCmp(member, db.this) {
+		return db.callGetOnCluster(hkey, name, key, opts)
+	}
+	ok, err := db.client.Supports(member.String(), protocol.CapGetWithOptions)
+	if err != nil {
+		return nil, err
+	}
+	if ok && opts.Consistency != ConsistencyDefault {
+		ok, err = db.client.Supports(member.String(), protocol.CapConsistencyLevel)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s doesn't support consistency levels", member)
+		}
+	}
+	if !ok {
+		// The partition owner doesn't know the read options. Fall back to a plain read.
+		value, err := db.get(name, key)
+		if err != nil {
+			return nil, err
+		}
+		return &getResult{Value: value}, nil
+	}
+
+	// Redirect to the partition owner
+	req := &protocol.Message{
+		DMap: name,
+		Key:  key,
+		Extra: protocol.GetWithOptionsExtra{
+			ReadAll:           opts.ReadAll,
+			ReadRepair:        opts.ReadRepair,
+			Consistency:       uint8(opts.Consistency),
+			AllowStale:        opts.AllowStale,
+			ExpiryReason:      opts.ExpiryReason,
+			MajorityAgreement: opts.MajorityAgreement,
+		},
+	}
+	resp, err := db.requestWithRetry(member.String(), protocol.OpGetWithOptions, req)
+	if err != nil {
+		return nil, err
+	}
+	res := &getResult{}
+	err = msgpack.Unmarshal(resp.Value, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 // Get gets the value for the given key. It returns ErrKeyNotFound if the DB
 // does not contains the key. It's thread-safe. It is safe to modify the contents
 // of the returned value. It is safe to modify the contents of the argument
 // after Get returns.
+//
+// If config.AllowLocalOnlyOnPartition is set, it may return a value from the
+// local storage along with ErrDegradedRead.
 func (dm *DMap) Get(key string) (interface{}, error) {
-	rawval, err := dm.db.get(dm.name, key)
+	rawval, err := dm.db.get(dm.target(), key)
 	if err != nil {
-		return nil, err
+		res, err := dm.db.degradedGet(dm.target(), key, err)
+		if err != nil {
+			return nil, err
+		}
+		value, err := dm.db.unmarshalValue(res.Value)
+		if err != nil {
+			return nil, err
+		}
+		return value, ErrDegradedRead
 	}
 	return dm.db.unmarshalValue(rawval)
 }
 
+// GetWithOptions gets the value for the given key with the given read options.
+// See ReadOptions. It returns ErrKeyNotFound if the DB does not contains the key.
+// If ReadOptions.AllowStale is set, it may return a result along with ErrStaleRead.
+// If config.AllowLocalOnlyOnPartition is set, it may return a result from the
+// local storage along with ErrDegradedRead. It's thread-safe.
+func (dm *DMap) GetWithOptions(key string, opts *ReadOptions) (*ReadResult, error) {
+	if opts == nil {
+		opts = &ReadOptions{}
+	}
+	if _, err := dm.db.quorum(dm.target(), opts.Consistency, dm.db.config.ReadQuorum); err != nil {
+		return nil, err
+	}
+	var degraded bool
+	res, err := dm.db.getWithOptions(dm.target(), key, opts)
+	if err != nil {
+		res, err = dm.db.degradedGet(dm.target(), key, err)
+		if err != nil {
+			return nil, err
+		}
+		degraded = true
+	}
+	value, err := dm.db.unmarshalValue(res.Value)
+	if err != nil {
+		return nil, err
+	}
+	result := &ReadResult{
+		Value:    value,
+		Diverged: res.Diverged,
+		Agreed:   res.Agreed,
+		Degraded: degraded,
+	}
+	if degraded {
+		return result, ErrDegradedRead
+	}
+	if res.Stale {
+		return result, ErrStaleRead
+	}
+	return result, nil
+}
+
 func (db *Olric) exGetOperation(req *protocol.Message) *protocol.Message {
 	value, err := db.get(req.DMap, req.Key)
 	if err != nil {
@@ -297,15 +752,46 @@ func (db *Olric) exGetOperation(req *protocol.Message) *protocol.Message {
 	}
 	resp := req.Success()
 	resp.Value = value
+	resp.Extra = protocol.GetResponseExtra{
+		Codec: serializer.Codec(db.serializer),
+	}
 	return resp
 }
 
-func (db *Olric) getBackupOperation(req *protocol.Message) *protocol.Message {
-	hkey := db.getHKey(req.DMap, req.Key)
-	dm, err := db.getBackupDMap(req.DMap, hkey)
+func (db *Olric) getWithOptionsOperation(req *protocol.Message) *protocol.Message {
+	extra := req.Extra.(protocol.GetWithOptionsExtra)
+	opts := &ReadOptions{
+		ReadAll:           extra.ReadAll,
+		ReadRepair:        extra.ReadRepair,
+		Consistency:       ConsistencyLevel(extra.Consistency),
+		AllowStale:        extra.AllowStale,
+		ExpiryReason:      extra.ExpiryReason,
+		MajorityAgreement: extra.MajorityAgreement,
+	}
+	res, err := db.getWithOptions(req.DMap, req.Key, opts)
 	if err != nil {
 		return db.prepareResponse(req, err)
 	}
+	value, err := msgpack.Marshal(res)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
+
+func (db *Olric) getBackupOperation(req *protocol.Message) *protocol.Message {
+	hkey := db.getHKey(req.DMap, req.Key)
+	part := db.getBackupPartition(hkey)
+	tmp, ok := part.m.Load(req.DMap)
+	if !ok {
+		// The DMap is not created on this backup yet, it may be on the way
+		// during rebalancing. It's an absent version, not an error. Don't create
+		// it here, a read should not have side effects.
+		return req.Error(protocol.StatusErrKeyNotFound, "")
+	}
+	dm := tmp.(*dmap)
 	dm.RLock()
 	defer dm.RUnlock()
 	vdata, err := dm.storage.Get(hkey)
@@ -316,7 +802,7 @@ func (db *Olric) getBackupOperation(req *protocol.Message) *protocol.Message {
 		return req.Error(protocol.StatusErrKeyNotFound, "key expired")
 	}
 
-	value, err := msgpack.Marshal(*vdata)
+	value, err := marshalVData(vdata)
 	if err != nil {
 		return db.prepareResponse(req, err)
 	}
@@ -343,7 +829,7 @@ func (db *Olric) getPrevOperation(req *protocol.Message) *protocol.Message {
 		return req.Error(protocol.StatusErrKeyNotFound, "key expired")
 	}
 
-	value, err := msgpack.Marshal(*vdata)
+	value, err := marshalVData(vdata)
 	if err != nil {
 		return db.prepareResponse(req, err)
 	}
@@ -0,0 +1,171 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ErrResultTooLarge is returned by GetAll if the DMap has more entries than
+// config.GetAllLimit.
+var ErrResultTooLarge = errors.New("result too large")
+
+// localGetAll returns the live entries of a DMap on the primary partitions of
+// this member. It returns ErrResultTooLarge as soon as there are more than
+// limit entries.
+func (db *Olric) localGetAll(name string, limit int) ([]storage.VData, error) {
+	var result []storage.VData
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		tmp, ok := part.m.Load(name)
+		if !ok {
+			continue
+		}
+		dm := tmp.(*dmap)
+		dm.RLock()
+		dm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+			if !isKeyExpired(vdata.TTL) {
+				result = append(result, *vdata)
+			}
+			return len(result) <= limit
+		})
+		dm.RUnlock()
+		if len(result) > limit {
+			return nil, ErrResultTooLarge
+		}
+	}
+	return result, nil
+}
+
+func (db *Olric) getAll(name string) (map[string]storage.VData, error) {
+	if err := db.checkDMapAvailable(name); err != nil {
+		return nil, err
+	}
+	limit := db.config.GetAllLimit
+	var mtx sync.Mutex
+	// There may be more than one version of a key on the previous owners
+	// of a partition. The last write wins.
+	latest := make(map[string]storage.VData)
+	merge := func(items []storage.VData) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, item := range items {
+			cur, ok := latest[item.Key]
+			if !ok || cur.Timestamp < item.Timestamp {
+				latest[item.Key] = item
+			}
+		}
+		if len(latest) > limit {
+			return ErrResultTooLarge
+		}
+		return nil
+	}
+
+	err := db.fanout(db.discovery.GetMembers(), func(mem discovery.Member) error {
+		if hostCmp(mem, db.this) {
+			items, err := db.localGetAll(name, limit)
+			if err != nil {
+				return err
+			}
+			return merge(items)
+		}
+		return db.requestGetAll(mem, name, limit, merge)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+func (db *Olric) requestGetAll(member discovery.Member, name string, limit int,
+	merge func([]storage.VData) error) error {
+	ok, err := db.client.Supports(member.String(), protocol.CapGetAll)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s doesn't support GetAll", member)
+	}
+
+	// The owners apply the limit of the caller.
+	data, err := msgpack.Marshal(limit)
+	if err != nil {
+		return err
+	}
+	req := &protocol.Message{
+		DMap:  name,
+		Value: data,
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpGetAll, req)
+	if err != nil {
+		return err
+	}
+	var items []storage.VData
+	err = msgpack.Unmarshal(resp.Value, &items)
+	if err != nil {
+		return err
+	}
+	return merge(items)
+}
+
+// GetAll returns every live entry of the DMap. The expired keys are skipped.
+// It's meant for the small DMaps, e.g. the lookup tables loaded at startup.
+// It returns ErrResultTooLarge if the DMap has more than config.GetAllLimit
+// entries.
+//
+// GetAll collects the entries from all members, like Keys. A partition is
+// scanned under the lock of its DMap, there is no consistency guarantee across
+// the partitions. Don't use it on the hot path.
+func (dm *DMap) GetAll() (map[string]interface{}, error) {
+	latest, err := dm.db.getAll(dm.target())
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{}, len(latest))
+	for key, item := range latest {
+		value, err := dm.db.unmarshalValue(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func (db *Olric) getAllOperation(req *protocol.Message) *protocol.Message {
+	var limit int
+	err := msgpack.Unmarshal(req.Value, &limit)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	items, err := db.localGetAll(req.DMap, limit)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(items)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
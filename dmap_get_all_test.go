@@ -0,0 +1,84 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDMap_GetAll(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm1.PutEx("expired", "value", time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	<-time.After(10 * time.Millisecond)
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	entries, err := dm2.GetAll()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(entries) != 100 {
+		t.Fatalf("Expected 100 entries. Got: %d", len(entries))
+	}
+	for i := 0; i < 100; i++ {
+		value, ok := entries[bkey(i)]
+		if !ok {
+			t.Fatalf("Expected %s in the result", bkey(i))
+		}
+		if !bytes.Equal(value.([]byte), bval(i)) {
+			t.Fatalf("Value is different for key: %s", bkey(i))
+		}
+	}
+
+	// The limit of the caller is applied by all owners.
+	db2.config.GetAllLimit = 50
+	_, err = dm2.GetAll()
+	if err != ErrResultTooLarge {
+		t.Fatalf("Expected ErrResultTooLarge. Got: %v", err)
+	}
+	db2.config.GetAllLimit = 100
+	_, err = dm2.GetAll()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/serializer"
+)
+
+// getDelete reads and deletes the key on the partition owner under the lock of
+// the DMap. The deletion is replicated before the value is returned.
+func (db *Olric) getDelete(name, key string) ([]byte, error) {
+	member, hkey, err := db.lookupPartitionOwner(name, key)
+	if err != nil {
+		return nil, err
+	}
+	if !hostCmp(member, db.this) {
+		req := &protocol.Message{
+			DMap: name,
+			Key:  key,
+		}
+		resp, err := db.requestTo(member.String(), protocol.OpGetDelete, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkCodec(resp, db.serializer); err != nil {
+			return nil, err
+		}
+		return resp.Value, nil
+	}
+
+	if err := db.checkWritable(name); err != nil {
+		return nil, err
+	}
+	dm, err := db.getDMap(name, hkey)
+	if err != nil {
+		return nil, err
+	}
+	dm.Lock()
+	defer dm.Unlock()
+	winner, err := db.liveVersionOnOwners(dm, hkey, name, key)
+	if err != nil {
+		return nil, err
+	}
+	if winner == nil {
+		return nil, ErrKeyNotFound
+	}
+	if err = db.delKeyVal(dm, hkey, name, key); err != nil {
+		return nil, err
+	}
+	db.publishChange(name, ChangeDelete, key, nil, time.Now().UnixNano())
+	return winner.Data.Value, nil
+}
+
+// GetDelete atomically gets the value for the given key and deletes it. The
+// partition owner reads and deletes the key under the same lock, and deletes
+// it on the backup owners before returning the value. So the value is returned
+// to only one of the concurrent callers. It returns ErrKeyNotFound if the DB
+// does not contains the key. It's thread-safe.
+func (dm *DMap) GetDelete(key string) (interface{}, error) {
+	rawval, err := dm.db.getDelete(dm.target(), key)
+	if err != nil {
+		return nil, err
+	}
+	return dm.db.unmarshalValue(rawval)
+}
+
+func (db *Olric) getDeleteOperation(req *protocol.Message) *protocol.Message {
+	value, err := db.getDelete(req.DMap, req.Key)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	resp.Extra = protocol.GetResponseExtra{
+		Codec: serializer.Codec(db.serializer),
+	}
+	return resp
+}
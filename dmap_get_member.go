@@ -0,0 +1,84 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ErrMemberReadsDisabled is returned by GetFromMember if config.EnableMemberReads
+// is not set.
+var ErrMemberReadsDisabled = errors.New("member reads are disabled")
+
+// MemberVersion is the version of a key on a single member.
+type MemberVersion struct {
+	Value interface{}
+
+	// Timestamp is the time of the write in nanoseconds.
+	Timestamp int64
+
+	// TTL is the expiry time of the key in milliseconds. Zero means no expiry.
+	TTL int64
+
+	// Backup is true if the version is found in a backup partition.
+	Backup bool
+}
+
+// GetFromMember returns the version of the key on the given member, without
+// quorum or read-repair. The primary copy is looked up first, then the backup
+// copy. It returns ErrKeyNotFound if the member has neither of them.
+//
+// It's meant for testing and debugging the divergence of the replicas and
+// requires config.EnableMemberReads. member is the address of the member.
+func (db *Olric) GetFromMember(name, key, member string) (*MemberVersion, error) {
+	if !db.config.EnableMemberReads {
+		return nil, ErrMemberReadsDisabled
+	}
+	if err := db.checkOperationStatus(); err != nil {
+		return nil, err
+	}
+	req := &protocol.Message{
+		DMap: db.aliases.resolve(name),
+		Key:  key,
+	}
+	backup := false
+	resp, err := db.requestTo(member, protocol.OpGetPrev, req)
+	if err == ErrKeyNotFound {
+		backup = true
+		resp, err = db.requestTo(member, protocol.OpGetBackup, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := storage.VData{}
+	if err = msgpack.Unmarshal(resp.Value, &data); err != nil {
+		return nil, err
+	}
+	value, err := db.unmarshalValue(data.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &MemberVersion{
+		Value:     value,
+		Timestamp: data.Timestamp,
+		TTL:       data.TTL,
+		Backup:    backup,
+	}, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+func TestDMap_GetFromMember(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put(bkey(1), bval(1))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	hkey := db1.getHKey("mymap", bkey(1))
+	owner := db1.getPartitionOwners(hkey)[0]
+	backup := db1.getBackupPartitionOwners(hkey)[0]
+
+	_, err = db1.GetFromMember("mymap", bkey(1), owner.String())
+	if err != ErrMemberReadsDisabled {
+		t.Fatalf("Expected ErrMemberReadsDisabled. Got: %v", err)
+	}
+	db1.config.EnableMemberReads = true
+
+	mv, err := db1.GetFromMember("mymap", bkey(1), owner.String())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if mv.Backup {
+		t.Fatalf("Expected the primary copy on %s", owner)
+	}
+	if !bytes.Equal(mv.Value.([]byte), bval(1)) {
+		t.Fatalf("Expected value: %s. Got: %v", bval(1), mv.Value)
+	}
+
+	// Diverge the backup and read it as is.
+	bdb := db1
+	if hostCmp(backup, db2.this) {
+		bdb = db2
+	}
+	bdm, err := bdb.getBackupDMap("mymap", hkey)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	value, err := db1.serializer.Marshal("stale")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	stale := &storage.VData{
+		Key:       bkey(1),
+		Value:     value,
+		Timestamp: time.Now().UnixNano() - int64(time.Minute),
+	}
+	bdm.Lock()
+	err = bdm.storage.Put(hkey, stale)
+	bdm.Unlock()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	mv, err = db1.GetFromMember("mymap", bkey(1), backup.String())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !mv.Backup {
+		t.Fatalf("Expected the backup copy on %s", backup)
+	}
+	if mv.Value != "stale" {
+		t.Fatalf("Expected value: stale. Got: %v", mv.Value)
+	}
+	if mv.Timestamp != stale.Timestamp {
+		t.Fatalf("Expected timestamp: %d. Got: %d", stale.Timestamp, mv.Timestamp)
+	}
+
+	_, err = db1.GetFromMember("mymap", bkey(2), owner.String())
+	if err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+	}
+}
@@ -17,8 +17,18 @@ package olric
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/buraksezer/olric/serializer"
 )
 
 func TestDMap_Get(t *testing.T) {
@@ -256,6 +266,141 @@ func TestDMap_GetReadQuorum(t *testing.T) {
 	}
 }
 
+func TestDMap_GetAllowStale(t *testing.T) {
+	cfg := newTestCustomConfig()
+	cfg.ReadQuorum = 2
+	c := newTestCluster(cfg)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	err = db2.Shutdown(context.Background())
+	if err != nil {
+		db1.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+	}
+
+	var maxIteration int
+	for {
+		<-time.After(10 * time.Millisecond)
+		members := db1.discovery.GetMembers()
+		if len(members) == 1 {
+			break
+		}
+		maxIteration++
+		if maxIteration >= 1000 {
+			t.Fatalf("Routing table has not been updated yet: %v", members)
+		}
+	}
+	syncClusterMembers(db1)
+
+	var hit bool
+	for i := 0; i < 10; i++ {
+		key := bkey(i)
+		host, _ := db1.findPartitionOwner(dm.name, key)
+		if !hostCmp(db1.this, host) {
+			continue
+		}
+		res, err := dm.GetWithOptions(key, &ReadOptions{AllowStale: true})
+		if err == ErrReadQuorum {
+			// No version is available on this member.
+			continue
+		}
+		if err != ErrStaleRead {
+			t.Fatalf("Expected ErrStaleRead. Got: %v", err)
+		}
+		if !bytes.Equal(res.Value.([]byte), bval(i)) {
+			t.Fatalf("Expected the stale value. Got: %v", res.Value)
+		}
+		hit = true
+	}
+	if !hit {
+		t.Fatalf("No keys checked on %v", db1)
+	}
+}
+
+func TestDMap_GetExpiryReason(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	// This is not recommended but forgivable for testing.
+	db.config.Cache = &config.CacheConfig{
+		MaxIdleDuration:    50 * time.Millisecond,
+		NumEvictionWorkers: 1,
+	}
+
+	expired, err := db.NewDMap("expired")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	idle, err := db.NewDMap("idle")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = expired.PutEx(bkey(i), bval(i), 10*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		err = idle.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	<-time.After(60 * time.Millisecond)
+
+	check := func(dm *DMap, reason error) {
+		var hit bool
+		for i := 0; i < 10; i++ {
+			_, err := dm.Get(bkey(i))
+			if err != ErrKeyNotFound {
+				t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+			}
+			_, err = dm.GetWithOptions(bkey(i), &ReadOptions{ExpiryReason: true})
+			if err == ErrKeyNotFound {
+				// Already evicted
+				continue
+			}
+			if err != reason {
+				t.Fatalf("Expected %v. Got: %v", reason, err)
+			}
+			hit = true
+		}
+		if !hit {
+			t.Fatalf("All the keys have been evicted on %s", dm.name)
+		}
+	}
+	check(expired, ErrKeyExpired)
+	check(idle, ErrKeyIdle)
+}
+
 func TestDMap_ReadRepair(t *testing.T) {
 	cfg := newTestCustomConfig()
 	cfg.ReadRepair = true
@@ -340,3 +485,1047 @@ func TestDMap_ReadRepair(t *testing.T) {
 	}
 
 }
+
+func TestDMap_ReadRepairTTL(t *testing.T) {
+	cfg := newTestCustomConfig()
+	cfg.ReadRepair = true
+	c := newTestCluster(cfg)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// Even keys have no TTL on the partition owner, odd keys have one hour.
+	for i := 0; i < 10; i++ {
+		if i%2 == 0 {
+			err = dm.Put(bkey(i), bval(i))
+		} else {
+			err = dm.PutEx(bkey(i), bval(i), time.Hour)
+		}
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	findDB := func(member string) *Olric {
+		for _, db := range []*Olric{db1, db2} {
+			if db.this.String() == member {
+				return db
+			}
+		}
+		t.Fatalf("Unknown member: %s", member)
+		return nil
+	}
+
+	// Replace the backups with stale versions with mismatched TTLs.
+	for i := 0; i < 10; i++ {
+		hkey := db1.getHKey("mymap", bkey(i))
+		backup := findDB(db1.getBackupPartitionOwners(hkey)[0].String())
+		bdm, err := backup.getBackupDMap("mymap", hkey)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		stale := &storage.VData{
+			Key:       bkey(i),
+			Value:     bval(i),
+			Timestamp: time.Now().UnixNano() - int64(time.Minute),
+		}
+		if i%2 == 0 {
+			stale.TTL = getTTL(time.Minute)
+		}
+		bdm.Lock()
+		err = bdm.storage.Put(hkey, stale)
+		bdm.Unlock()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err := dm.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		hkey := db1.getHKey("mymap", bkey(i))
+		owner := findDB(db1.getPartitionOwners(hkey)[0].String())
+		odm, err := owner.getDMap("mymap", hkey)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		odm.RLock()
+		winner, err := odm.storage.Get(hkey)
+		odm.RUnlock()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+
+		backup := findDB(db1.getBackupPartitionOwners(hkey)[0].String())
+		bdm, err := backup.getBackupDMap("mymap", hkey)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		bdm.RLock()
+		vdata, err := bdm.storage.Get(hkey)
+		bdm.RUnlock()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if vdata.Timestamp != winner.Timestamp {
+			t.Fatalf("Expected timestamp: %d. Got: %d", winner.Timestamp, vdata.Timestamp)
+		}
+		if winner.TTL == 0 {
+			if vdata.TTL != 0 {
+				t.Fatalf("Expected TTL is zero on the backup. Got: %d", vdata.TTL)
+			}
+			continue
+		}
+		// TTL is in milliseconds. Allow a small difference between the hosts.
+		if diff := vdata.TTL - winner.TTL; diff < -1000 || diff > 1000 {
+			t.Fatalf("Expected TTL: %d. Got: %d", winner.TTL, vdata.TTL)
+		}
+	}
+}
+
+func TestDMap_ReadRepairMinLag(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 2; i++ {
+		c := testConfig(dbs)
+		c.ReadRepair = true
+		c.ReadRepairMinLag = 10 * time.Second
+		db, err := newDB(c, dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	findDB := func(member string) *Olric {
+		for _, db := range dbs {
+			if db.this.String() == member {
+				return db
+			}
+		}
+		t.Fatalf("Unknown member: %s", member)
+		return nil
+	}
+	backupOf := func(i int) *dmap {
+		hkey := dbs[0].getHKey("mymap", bkey(i))
+		backup := findDB(dbs[0].getBackupPartitionOwners(hkey)[0].String())
+		bdm, err := backup.getBackupDMap("mymap", hkey)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		return bdm
+	}
+
+	// Even keys lag slightly behind on the backups, odd keys lag by a minute.
+	stale := make(map[int]int64)
+	for i := 0; i < 10; i++ {
+		lag := time.Millisecond
+		if i%2 == 1 {
+			lag = time.Minute
+		}
+		hkey := dbs[0].getHKey("mymap", bkey(i))
+		owner := findDB(dbs[0].getPartitionOwners(hkey)[0].String())
+		odm, err := owner.getDMap("mymap", hkey)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		odm.RLock()
+		winner, err := odm.storage.Get(hkey)
+		odm.RUnlock()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		stale[i] = winner.Timestamp - int64(lag)
+
+		bdm := backupOf(i)
+		bdm.Lock()
+		err = bdm.storage.Put(hkey, &storage.VData{
+			Key:       bkey(i),
+			Value:     winner.Value,
+			Timestamp: stale[i],
+		})
+		bdm.Unlock()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err := dm.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		hkey := dbs[0].getHKey("mymap", bkey(i))
+		bdm := backupOf(i)
+		bdm.RLock()
+		vdata, err := bdm.storage.Get(hkey)
+		bdm.RUnlock()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		repaired := vdata.Timestamp != stale[i]
+		if i%2 == 0 && repaired {
+			t.Fatalf("Expected %s not to be repaired", bkey(i))
+		}
+		if i%2 == 1 && !repaired {
+			t.Fatalf("Expected %s to be repaired", bkey(i))
+		}
+	}
+}
+
+func TestDMap_ReadRepairNewerVersion(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	hkey := db.getHKey("mymap", bkey(1))
+	dm, err := db.getDMap("mymap", hkey)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	now := time.Now().UnixNano()
+	winner := &version{
+		host: &db.this,
+		Data: &storage.VData{Key: bkey(1), Value: bval(1), Timestamp: now},
+	}
+	// An expired newer version, PreferUnexpiredVersions passes over it.
+	newer := &version{
+		host: &db.this,
+		Data: &storage.VData{Key: bkey(1), Value: bval(2), Timestamp: now + 1, TTL: getTTL(-time.Second)},
+	}
+	for _, minLag := range []time.Duration{0, time.Minute} {
+		repaired := db.readRepair("mymap", dm, winner, []*version{winner, newer}, minLag)
+		if repaired != 1 {
+			t.Fatalf("Expected the newer version to be repaired with minLag: %v. Got: %d", minLag, repaired)
+		}
+	}
+}
+
+func TestDMap_GetWithOptionsReadAll(t *testing.T) {
+	cfg := newTestCustomConfig()
+	cfg.ReadRepair = true
+	c := newTestCluster(cfg)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	// Replace the backups with stale versions.
+	for i := 0; i < 10; i++ {
+		hkey := db1.getHKey("mymap", bkey(i))
+		backup := db1
+		if hostCmp(db1.getBackupPartitionOwners(hkey)[0], db2.this) {
+			backup = db2
+		}
+		bdm, err := backup.getBackupDMap("mymap", hkey)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		stale := &storage.VData{
+			Key:       bkey(i),
+			Value:     bval(i),
+			Timestamp: time.Now().UnixNano() - int64(time.Minute),
+		}
+		bdm.Lock()
+		err = bdm.storage.Put(hkey, stale)
+		bdm.Unlock()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	check := func(opts *ReadOptions, diverged bool, dmaps ...*DMap) {
+		for i := 0; i < 10; i++ {
+			for _, d := range dmaps {
+				res, err := d.GetWithOptions(bkey(i), opts)
+				if err != nil {
+					t.Fatalf("Expected nil. Got: %v", err)
+				}
+				if !bytes.Equal(res.Value.([]byte), bval(i)) {
+					t.Fatalf("Expected the same value. Got: %s", string(res.Value.([]byte)))
+				}
+				if res.Diverged != diverged {
+					t.Fatalf("Expected Diverged: %v. Got: %v", diverged, res.Diverged)
+				}
+			}
+		}
+	}
+	// ReadAll doesn't trigger read-repair, even if it's enabled. Call it on
+	// both members to test the redirects.
+	check(&ReadOptions{ReadAll: true}, true, dm, dm2)
+	check(&ReadOptions{ReadAll: true, ReadRepair: true}, true, dm2)
+	check(&ReadOptions{ReadAll: true}, false, dm, dm2)
+}
+
+func TestDMap_GetWithOptionsMajorityAgreement(t *testing.T) {
+	cfg := newTestCustomConfig()
+	cfg.ReplicaCount = 3
+	c := newTestCluster(cfg)
+	defer c.teardown()
+
+	var peers []*Olric
+	for i := 0; i < 3; i++ {
+		db, err := c.newDB()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		peers = append(peers, db)
+	}
+	db1 := peers[0]
+	findPeer := func(member discovery.Member) *Olric {
+		for _, db := range peers {
+			if hostCmp(db.this, member) {
+				return db
+			}
+		}
+		t.Fatalf("Unknown member: %s", member)
+		return nil
+	}
+	replaceBackup := func(key string, member discovery.Member) {
+		hkey := db1.getHKey("mymap", key)
+		bdm, err := findPeer(member).getBackupDMap("mymap", hkey)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		stale := &storage.VData{
+			Key:       key,
+			Value:     []byte("stale"),
+			Timestamp: time.Now().UnixNano() - int64(time.Minute),
+		}
+		bdm.Lock()
+		err = bdm.storage.Put(hkey, stale)
+		bdm.Unlock()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	opts := &ReadOptions{MajorityAgreement: true}
+	check := func(agreed int) {
+		for i := 0; i < 10; i++ {
+			res, err := dm.GetWithOptions(bkey(i), opts)
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if !bytes.Equal(res.Value.([]byte), bval(i)) {
+				t.Fatalf("Expected the same value. Got: %v", res.Value)
+			}
+			if res.Agreed != agreed {
+				t.Fatalf("Expected %d agreed versions. Got: %d", agreed, res.Agreed)
+			}
+		}
+	}
+
+	// One outlier is outvoted and repaired.
+	for i := 0; i < 10; i++ {
+		hkey := db1.getHKey("mymap", bkey(i))
+		replaceBackup(bkey(i), db1.getBackupPartitionOwners(hkey)[0])
+	}
+	check(2)
+	check(3)
+
+	// Two outliers out of three versions fail the read.
+	hkey := db1.getHKey("mymap", bkey(0))
+	for _, member := range db1.getBackupPartitionOwners(hkey) {
+		replaceBackup(bkey(0), member)
+	}
+	_, err = dm.GetWithOptions(bkey(0), opts)
+	if err != ErrNoMajority {
+		t.Fatalf("Expected ErrNoMajority. Got: %v", err)
+	}
+}
+
+func TestDMap_GetReadRegionQuorum(t *testing.T) {
+	newRegionalDB := func(region string, peers ...*Olric) *Olric {
+		cfg := testConfig(peers)
+		cfg.Region = region
+		cfg.ReadRegionQuorum = 2
+		db, err := newDB(cfg, peers...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		return db
+	}
+	shutdown := func(db *Olric) {
+		err := db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}
+	check := func(db1 *Olric, expected error) {
+		dm, err := db1.NewDMap("mymap")
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			err = dm.Put(bkey(i), bval(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+		}
+		for i := 0; i < 10; i++ {
+			_, err = dm.Get(bkey(i))
+			if err != expected {
+				t.Fatalf("Expected %v. Got: %v", expected, err)
+			}
+		}
+	}
+
+	// Members in distinct regions satisfy the region quorum.
+	db1 := newRegionalDB("eu-west")
+	defer shutdown(db1)
+	db2 := newRegionalDB("us-east", db1)
+	defer shutdown(db2)
+	syncClusterMembers(db1, db2)
+	check(db1, nil)
+
+	// All versions come from the same region.
+	db3 := newRegionalDB("eu-west")
+	defer shutdown(db3)
+	db4 := newRegionalDB("eu-west", db3)
+	defer shutdown(db4)
+	syncClusterMembers(db3, db4)
+	check(db3, ErrReadQuorum)
+}
+
+func TestDMap_SortVersionsValueEqual(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	newVersions := func() []*version {
+		return []*version{
+			{Data: &storage.VData{Timestamp: 1, Value: []byte(`{"a":1,"b":2}`)}},
+			{Data: &storage.VData{Timestamp: 1, Value: []byte(`{"b":2,"a":1}`)}},
+		}
+	}
+	sorted := db.sortVersions(newVersions())
+	if string(sorted[0].Data.Value) != `{"b":2,"a":1}` {
+		t.Fatalf("Expected the greater value first. Got: %s", sorted[0].Data.Value)
+	}
+
+	// A replica with an older timestamp and a logically equal value.
+	winner := &version{Data: &storage.VData{Timestamp: 2, Value: []byte(`{"a":1,"b":2}`)}}
+	replica := &version{host: &db.this, Data: &storage.VData{Timestamp: 1, Value: []byte(`{"b":2,"a":1}`)}}
+	if !db.isDiverged(winner, []*version{replica}) {
+		t.Fatalf("Expected the replica to be diverged without ValueEqual")
+	}
+
+	db.config.ValueEqual = func(a, b []byte) bool {
+		var x, y map[string]int
+		if err := json.Unmarshal(a, &x); err != nil {
+			return false
+		}
+		if err := json.Unmarshal(b, &y); err != nil {
+			return false
+		}
+		return reflect.DeepEqual(x, y)
+	}
+	sorted = db.sortVersions(newVersions())
+	if string(sorted[0].Data.Value) != `{"a":1,"b":2}` {
+		t.Fatalf("Expected the order to be kept. Got: %s", sorted[0].Data.Value)
+	}
+
+	if db.isDiverged(winner, []*version{replica}) {
+		t.Fatalf("Expected the replica not to be diverged with ValueEqual")
+	}
+	if n := db.readRepair("mymap", nil, winner, []*version{replica}, 0); n != 0 {
+		t.Fatalf("Expected no repaired versions. Got: %d", n)
+	}
+	other := &version{host: &db.this, Data: &storage.VData{Timestamp: 1, Value: []byte(`{"a":2}`)}}
+	if !db.isDiverged(winner, []*version{replica, other}) {
+		t.Fatalf("Expected a different value to be diverged")
+	}
+}
+
+func TestDMap_SortByReadWeight(t *testing.T) {
+	members := []discovery.Member{
+		{Name: "a", Weight: 1},
+		{Name: "b"},
+		{Name: "c", Weight: 5},
+		{Name: "d", Weight: 1},
+	}
+	sorted := sortByReadWeight(members)
+	var names []string
+	for _, member := range sorted {
+		names = append(names, member.Name)
+	}
+	// The members without a weight have the default one.
+	expected := []string{"c", "a", "b", "d"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v. Got: %v", expected, names)
+	}
+	if members[0].Name != "a" {
+		t.Fatalf("Expected the original slice unchanged")
+	}
+}
+
+func TestDMap_ReadWeightWithMaxReadVersions(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 3; i++ {
+		c := testConfig(nil)
+		c.ReplicaCount = 3
+		c.WriteQuorum = 3
+		c.ReadQuorum = 2
+		c.MaxReadVersions = 2
+		// The operations are counted only if the metrics are enabled.
+		c.MetricsAddr = "127.0.0.1:0"
+		if i == 2 {
+			c.ReadWeight = 10
+		}
+		db, err := newDB(c, dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	heavy := dbs[2]
+	var onHeavy uint64
+	for i := 0; i < 20; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if owner, _ := heavy.findPartitionOwner("mymap", bkey(i)); hostCmp(owner, heavy.this) {
+			onHeavy++
+		}
+	}
+
+	replicaReads := func(db *Olric) uint64 {
+		c, _ := db.metrics.load("mymap", protocol.OpGetBackup)
+		return atomic.LoadUint64(&c.total)
+	}
+	for i := 0; i < 20; i++ {
+		_, err = dm.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	// The reads stop after a single replica. It's the heavy member unless it
+	// owns the partition.
+	if count := replicaReads(heavy); count != 20-onHeavy {
+		t.Fatalf("Expected %d replica reads on the heavy member. Got: %d", 20-onHeavy, count)
+	}
+	if count := replicaReads(dbs[0]) + replicaReads(dbs[1]); count != onHeavy {
+		t.Fatalf("Expected %d replica reads on the other members. Got: %d", onHeavy, count)
+	}
+}
+
+func TestDMap_GetSerializerMismatch(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put("mykey", "myvalue")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	req := &protocol.Message{
+		DMap: "mymap",
+		Key:  "mykey",
+	}
+	resp, err := db.requestTo(db.this.String(), protocol.OpGet, req)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	extra, ok := resp.Extra.(protocol.GetResponseExtra)
+	if !ok {
+		t.Fatalf("Expected GetResponseExtra. Got: %v", resp.Extra)
+	}
+	if extra.Codec != serializer.GobCodec {
+		t.Fatalf("Expected codec: %d. Got: %d", serializer.GobCodec, extra.Codec)
+	}
+	if err = checkCodec(resp, db.serializer); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if err = checkCodec(resp, serializer.NewJSONSerializer()); err != ErrSerializerMismatch {
+		t.Fatalf("Expected ErrSerializerMismatch. Got: %v", err)
+	}
+
+	// A peer which doesn't negotiate the capabilities receives no extras.
+	conn, err := net.Dial("tcp", db.this.String())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer conn.Close()
+	req = &protocol.Message{
+		Header: protocol.Header{
+			Magic: protocol.MagicReq,
+			Op:    protocol.OpGet,
+		},
+		DMap: "mymap",
+		Key:  "mykey",
+	}
+	if err = req.Write(conn); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	var legacy protocol.Message
+	if err = legacy.Read(conn); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if legacy.ExtraLen != 0 {
+		t.Fatalf("Expected no extras. Got: %d bytes", legacy.ExtraLen)
+	}
+	if !bytes.Equal(legacy.Value, resp.Value) {
+		t.Fatalf("Expected the same value")
+	}
+}
+
+func TestDMap_GetBeforePartitionAssignment(t *testing.T) {
+	// The member is not started, the partitions have no owner.
+	db, err := New(testConfig(nil))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	dm := &DMap{name: "mymap", db: db}
+	_, err = dm.Get("mykey")
+	if err != ErrClusterNotReady {
+		t.Fatalf("Expected ErrClusterNotReady. Got: %v", err)
+	}
+	_, err = dm.GetWithOptions("mykey", &ReadOptions{ReadAll: true})
+	if err != ErrClusterNotReady {
+		t.Fatalf("Expected ErrClusterNotReady. Got: %v", err)
+	}
+
+	// A request which is routed to this member before the assignment.
+	hkey := db.getHKey("mymap", "mykey")
+	_, err = db.callGetOnCluster(hkey, "mymap", "mykey", nil)
+	if err != ErrClusterNotReady {
+		t.Fatalf("Expected ErrClusterNotReady. Got: %v", err)
+	}
+}
+
+func TestDMap_PickWinnerWithExpiredVersions(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	sorted := db.sortVersions([]*version{
+		{Data: &storage.VData{Timestamp: 1, Value: []byte("oldest")}},
+		{Data: &storage.VData{Timestamp: 3, TTL: getTTL(-time.Second), Value: []byte("expired")}},
+		{Data: &storage.VData{Timestamp: 2, TTL: getTTL(time.Hour), Value: []byte("valid")}},
+	})
+	if winner := db.pickWinner(sorted); string(winner.Data.Value) != "expired" {
+		t.Fatalf("Expected the newest version. Got: %s", winner.Data.Value)
+	}
+
+	db.config.PreferUnexpiredVersions = true
+	if winner := db.pickWinner(sorted); string(winner.Data.Value) != "valid" {
+		t.Fatalf("Expected the newest non-expired version. Got: %s", winner.Data.Value)
+	}
+
+	// Fall back to the newest one if all of them are expired.
+	sorted = db.sortVersions([]*version{
+		{Data: &storage.VData{Timestamp: 1, TTL: getTTL(-time.Second), Value: []byte("old")}},
+		{Data: &storage.VData{Timestamp: 2, TTL: getTTL(-time.Second), Value: []byte("new")}},
+	})
+	if winner := db.pickWinner(sorted); string(winner.Data.Value) != "new" {
+		t.Fatalf("Expected the newest version. Got: %s", winner.Data.Value)
+	}
+}
+
+func TestDMap_GetMixedTTLVersions(t *testing.T) {
+	cfg := newTestCustomConfig()
+	cfg.ReadQuorum = 2
+	c := newTestCluster(cfg)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	key := bkey(1)
+	err = dm.PutEx(key, bval(1), time.Hour)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// Put a newer but expired version on the partition owner. The backup owner
+	// keeps the valid one.
+	hkey := db1.getHKey("mymap", key)
+	owner := db1
+	if hostCmp(db1.getPartition(hkey).owner(), db2.this) {
+		owner = db2
+	}
+	pdm, err := owner.getDMap("mymap", hkey)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	pdm.Lock()
+	vdata, err := pdm.storage.Get(hkey)
+	if err != nil {
+		pdm.Unlock()
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	vdata.Timestamp++
+	vdata.TTL = getTTL(-time.Second)
+	err = pdm.storage.Put(hkey, vdata)
+	pdm.Unlock()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	_, err = dm.Get(key)
+	if err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+	}
+
+	for _, db := range []*Olric{db1, db2} {
+		db.config.PreferUnexpiredVersions = true
+	}
+	value, err := dm.Get(key)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(value.([]byte), bval(1)) {
+		t.Fatalf("Expected the non-expired version. Got: %v", value)
+	}
+	ok, err := dm.Exists(key)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !ok {
+		t.Fatalf("Expected the key to exist")
+	}
+}
+
+func TestDMap_AvoidReplicaReads(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 2; i++ {
+		c := testConfig(nil)
+		c.WriteQuorum = 2
+		c.ReadQuorum = 1
+		// The operations are counted only if the metrics are enabled.
+		c.MetricsAddr = "127.0.0.1:0"
+		db, err := newDB(c, dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	replicaReads := func() uint64 {
+		var total uint64
+		for _, db := range dbs {
+			c, _ := db.metrics.load("mymap", protocol.OpGetBackup)
+			total += atomic.LoadUint64(&c.total)
+		}
+		return total
+	}
+	readAll := func() {
+		for i := 0; i < 10; i++ {
+			value, err := dm.Get(bkey(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if !bytes.Equal(value.([]byte), bval(i)) {
+				t.Fatalf("Value is different for key: %s", bkey(i))
+			}
+		}
+	}
+
+	readAll()
+	if count := replicaReads(); count != 10 {
+		t.Fatalf("Expected 10 replica reads. Got: %d", count)
+	}
+
+	for _, db := range dbs {
+		db.config.AvoidReplicaReads = true
+	}
+	readAll()
+	if count := replicaReads(); count != 10 {
+		t.Fatalf("Expected no more replica reads. Got: %d", count-10)
+	}
+
+	// The replicas are consulted if the partition owner has lost the key.
+	for _, db := range dbs {
+		hkey := db.getHKey("mymap", bkey(0))
+		part := db.getPartition(hkey)
+		if !hostCmp(part.owner(), db.this) {
+			continue
+		}
+		tmp, _ := part.m.Load("mymap")
+		err = tmp.(*dmap).storage.Delete(hkey)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	readAll()
+	if count := replicaReads(); count != 11 {
+		t.Fatalf("Expected a replica read. Got: %d", count-10)
+	}
+}
+
+func TestDMap_GetBackupWithoutDMap(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 2; i++ {
+		c := testConfig(nil)
+		c.WriteQuorum = 1
+		c.ReadQuorum = 2
+		db, err := newDB(c, dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	// Simulate the backups which haven't received the DMap yet during rebalancing.
+	for _, db := range dbs {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			db.backups[partID].m.Delete("mymap")
+		}
+	}
+
+	// The replicas answer with an absent version, the read quorum is satisfied.
+	for i := 10; i < 20; i++ {
+		_, err = dm.Get(bkey(i))
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		// The partition owner has the only version.
+		res, err := dm.GetWithOptions(bkey(i), &ReadOptions{AllowStale: true})
+		if err != ErrStaleRead {
+			t.Fatalf("Expected ErrStaleRead. Got: %v", err)
+		}
+		if !bytes.Equal(res.Value.([]byte), bval(i)) {
+			t.Fatalf("Value is different for key: %s", bkey(i))
+		}
+	}
+
+	// The reads don't create the DMap on the backups.
+	for _, db := range dbs {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			if _, ok := db.backups[partID].m.Load("mymap"); ok {
+				t.Fatalf("Expected no DMap on the backup of PartID: %d", partID)
+			}
+		}
+	}
+}
+
+func TestDMap_GetReplicaNetworkError(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 2; i++ {
+		c := testConfig(nil)
+		c.ReadQuorum = 2
+		db, err := newDB(c, dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	var keys []string
+	for i := 0; i < 20; i++ {
+		if i < 10 {
+			err = dm.Put(bkey(i), bval(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+		}
+		owner, _ := dbs[0].findPartitionOwner("mymap", bkey(i))
+		if hostCmp(owner, dbs[0].this) {
+			keys = append(keys, bkey(i))
+		}
+	}
+	if len(keys) == 0 {
+		t.Fatalf("Expected at least one key on %s", dbs[0].this)
+	}
+
+	// The replica is still a member of the cluster but it doesn't respond. It's
+	// not an absent version, even the missing keys cannot be read.
+	err = dbs[1].server.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for _, key := range keys {
+		_, err = dm.Get(key)
+		if err != ErrReadQuorum {
+			t.Fatalf("Expected ErrReadQuorum for %s. Got: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+// importSnapshot writes the entries with the given timestamp. The keys of
+// a partition are written sequentially, config.FanoutConcurrency partitions
+// in parallel.
+func (db *Olric) importSnapshot(name string, entries map[string]interface{}, ts int64) error {
+	if err := db.checkOperationStatus(); err != nil {
+		return err
+	}
+	// The timestamp must not be clamped by the partition owners, it's checked
+	// before writing anything.
+	if skew, exceeded := db.skewOf(ts); exceeded {
+		db.log.V(2).Printf("[WARN] Snapshot timestamp for DMap: %s is %v ahead, rejected", name, skew)
+		return ErrClockSkew
+	}
+
+	parts := make(map[uint64]map[string][]byte)
+	for key, value := range entries {
+		val, err := db.serializer.Marshal(value)
+		if err != nil {
+			return err
+		}
+		partID := db.getPartitionID(db.getHKey(name, key))
+		if _, ok := parts[partID]; !ok {
+			parts[partID] = make(map[string][]byte)
+		}
+		parts[partID][key] = val
+	}
+
+	batches := make([]map[string][]byte, 0, len(parts))
+	for _, items := range parts {
+		batches = append(batches, items)
+	}
+	return db.fanoutN(len(batches), func(i int) error {
+		for key, value := range batches[i] {
+			w := &writeop{
+				opcode:        protocol.OpPut,
+				replicaOpcode: protocol.OpPutReplica,
+				dmap:          name,
+				key:           key,
+				value:         value,
+				timestamp:     ts,
+			}
+			// put finds the owner of the key.
+			if err := db.put(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ImportSnapshot bulk-loads the entries with a single timestamp, ts is in
+// nanoseconds. Every entry is written on its partition owner and replicated
+// with exactly the same timestamp, so the imported keys are a consistent
+// snapshot for the last write wins resolution. It pairs with Backup and Restore
+// to load a snapshot exported from another system.
+//
+// It returns ErrClockSkew without writing anything if ts is ahead of the local
+// clock more than MaxClockSkew. If it returns another error, some of the
+// entries may have been written. It's thread-safe.
+func (dm *DMap) ImportSnapshot(entries map[string]interface{}, ts int64) error {
+	return dm.db.importSnapshot(dm.target(), entries, ts)
+}
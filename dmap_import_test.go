@@ -0,0 +1,126 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+func TestDMap_ImportSnapshot(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	entries := make(map[string]interface{})
+	for i := 0; i < 100; i++ {
+		entries[bkey(i)] = bval(i)
+	}
+	ts := time.Now().Add(-time.Hour).UnixNano()
+	// The partitions are written in waves.
+	db1.config.FanoutConcurrency = 2
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm1.ImportSnapshot(entries, ts)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		entry, err := dm2.GetEntry(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(entry.Value.([]byte), bval(i)) {
+			t.Fatalf("Value is different for key: %s", bkey(i))
+		}
+		if entry.Version != ts {
+			t.Fatalf("Expected version: %d. Got: %d", ts, entry.Version)
+		}
+	}
+
+	// The backups are written with the same timestamp.
+	var total int
+	for _, db := range []*Olric{db1, db2} {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			tmp, ok := db.backups[partID].m.Load("mymap")
+			if !ok {
+				continue
+			}
+			dm := tmp.(*dmap)
+			dm.RLock()
+			dm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+				total++
+				if vdata.Timestamp != ts {
+					t.Errorf("Expected timestamp: %d on the backup. Got: %d", ts, vdata.Timestamp)
+				}
+				return true
+			})
+			dm.RUnlock()
+		}
+	}
+	if total != 100 {
+		t.Fatalf("Expected 100 keys on the backups. Got: %d", total)
+	}
+}
+
+func TestDMap_ImportSnapshotClockSkew(t *testing.T) {
+	for _, clamp := range []bool{false, true} {
+		c := testSingleReplicaConfig()
+		c.MaxClockSkew = time.Second
+		c.ClampClockSkew = clamp
+		db, err := newDB(c)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dm, err := db.NewDMap("mymap")
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+
+		entries := map[string]interface{}{"mykey": "myvalue"}
+		// It's never clamped.
+		err = dm.ImportSnapshot(entries, time.Now().Add(time.Hour).UnixNano())
+		if err != ErrClockSkew {
+			t.Fatalf("Expected ErrClockSkew. Got: %v", err)
+		}
+		_, err = dm.Get("mykey")
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
+)
+
+// matchGlob reports whether s matches the pattern. '*' matches any sequence
+// of characters, including an empty one, and '?' matches a single character.
+// Unlike path.Match, '/' is not treated specially.
+func matchGlob(pattern, s string) bool {
+	p, t := []rune(pattern), []rune(s)
+	var pi, ti int
+	// Position of the last '*' in the pattern and the text index it matched.
+	star, mark := -1, 0
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == t[ti]):
+			pi++
+			ti++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ti
+			pi++
+		case star != -1:
+			// Let the last '*' match one more character.
+			pi = star + 1
+			mark++
+			ti = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// localKeys returns the keys of a DMap which match the pattern on the primary
+// partitions of this member.
+func (db *Olric) localKeys(name, pattern string) []string {
+	var result []string
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		tmp, ok := part.m.Load(name)
+		if !ok {
+			continue
+		}
+		dm := tmp.(*dmap)
+		dm.RLock()
+		dm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+			if !isKeyExpired(vdata.TTL) && matchGlob(pattern, vdata.Key) {
+				result = append(result, vdata.Key)
+			}
+			return true
+		})
+		dm.RUnlock()
+	}
+	return result
+}
+
+func (db *Olric) keys(name, pattern string) ([]string, error) {
+	if err := db.checkDMapAvailable(name); err != nil {
+		return nil, err
+	}
+	var mtx sync.Mutex
+	// A key may be found on the previous owners of a partition, too.
+	unique := make(map[string]struct{})
+	merge := func(keys []string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, key := range keys {
+			unique[key] = struct{}{}
+		}
+	}
+
+	err := db.fanout(db.discovery.GetMembers(), func(mem discovery.Member) error {
+		if hostCmp(mem, db.this) {
+			merge(db.localKeys(name, pattern))
+			return nil
+		}
+		return db.requestKeys(mem, name, pattern, merge)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(unique))
+	for key := range unique {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (db *Olric) requestKeys(member discovery.Member, name, pattern string, merge func([]string)) error {
+	ok, err := db.client.Supports(member.String(), protocol.CapKeys)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s doesn't support listing keys", member)
+	}
+
+	req := &protocol.Message{
+		DMap:  name,
+		Value: []byte(pattern),
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpKeys, req)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	err = msgpack.Unmarshal(resp.Value, &keys)
+	if err != nil {
+		return err
+	}
+	merge(keys)
+	return nil
+}
+
+// Keys returns the keys in the DMap which match the glob pattern, in ascending
+// order. '*' matches any sequence of characters and '?' matches a single
+// character. The expired keys are skipped.
+//
+// Keys scans all the partitions on all members. Don't use it on the hot path.
+func (dm *DMap) Keys(pattern string) ([]string, error) {
+	return dm.db.keys(dm.target(), pattern)
+}
+
+func (db *Olric) keysOperation(req *protocol.Message) *protocol.Message {
+	value, err := msgpack.Marshal(db.localKeys(req.DMap, string(req.Value)))
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -0,0 +1,106 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDMap_MatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "user/1", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"user:?", "user:1", true},
+		{"user:?", "user:10", false},
+		{"*:1?", "user:10", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"", "", true},
+		{"", "a", false},
+	}
+	for _, c := range cases {
+		if matchGlob(c.pattern, c.s) != c.match {
+			t.Fatalf("Expected matchGlob(%q, %q) is %v", c.pattern, c.s, c.match)
+		}
+	}
+}
+
+func TestDMap_Keys(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(fmt.Sprintf("user:%d", i), i)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		err = dm.Put(fmt.Sprintf("order:%d", i), i)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm.PutEx("user:expired", 1, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	<-time.After(10 * time.Millisecond)
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	keys, err := dm2.Keys("user:*")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(keys) != 100 {
+		t.Fatalf("Expected key count is 100. Got: %d", len(keys))
+	}
+	for i, key := range keys {
+		if i > 0 && keys[i-1] >= key {
+			t.Fatalf("Expected sorted and unique keys. Got: %s after %s", key, keys[i-1])
+		}
+	}
+
+	keys, err = dm2.Keys("order:?")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(keys) != 10 {
+		t.Fatalf("Expected key count is 10. Got: %d", len(keys))
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ttlEntry is the expiry time of a key, as stored in storage.VData.TTL, with the
+// timestamp of the version.
+type ttlEntry struct {
+	TTL       int64
+	Timestamp int64
+}
+
+// localKeysByTTL returns the keys of a DMap which expire within the given
+// duration on the primary partitions of this member. The keys without a TTL
+// and the expired ones are skipped.
+func (db *Olric) localKeysByTTL(name string, within time.Duration) map[string]ttlEntry {
+	deadline := getTTL(within)
+	result := make(map[string]ttlEntry)
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		tmp, ok := part.m.Load(name)
+		if !ok {
+			continue
+		}
+		dm := tmp.(*dmap)
+		dm.RLock()
+		dm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+			if vdata.TTL != 0 && vdata.TTL < deadline && !isKeyExpired(vdata.TTL) {
+				result[vdata.Key] = ttlEntry{
+					TTL:       vdata.TTL,
+					Timestamp: vdata.Timestamp,
+				}
+			}
+			return true
+		})
+		dm.RUnlock()
+	}
+	return result
+}
+
+func (db *Olric) keysByTTL(name string, within time.Duration) (map[string]time.Duration, error) {
+	if err := db.checkDMapAvailable(name); err != nil {
+		return nil, err
+	}
+	var mtx sync.Mutex
+	// There may be more than one version of a key on the previous owners
+	// of a partition. The last write wins.
+	latest := make(map[string]ttlEntry)
+	merge := func(entries map[string]ttlEntry) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for key, entry := range entries {
+			cur, ok := latest[key]
+			if !ok || cur.Timestamp < entry.Timestamp {
+				latest[key] = entry
+			}
+		}
+	}
+
+	err := db.fanout(db.discovery.GetMembers(), func(mem discovery.Member) error {
+		if hostCmp(mem, db.this) {
+			merge(db.localKeysByTTL(name, within))
+			return nil
+		}
+		return db.requestKeysByTTL(mem, name, within, merge)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]time.Duration, len(latest))
+	for key, entry := range latest {
+		result[key] = getTimeout(entry.TTL)
+	}
+	return result, nil
+}
+
+func (db *Olric) requestKeysByTTL(member discovery.Member, name string, within time.Duration,
+	merge func(map[string]ttlEntry)) error {
+	ok, err := db.client.Supports(member.String(), protocol.CapKeysByTTL)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s doesn't support querying keys by TTL", member)
+	}
+
+	data, err := msgpack.Marshal(within)
+	if err != nil {
+		return err
+	}
+	req := &protocol.Message{
+		DMap:  name,
+		Value: data,
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpKeysByTTL, req)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]ttlEntry)
+	err = msgpack.Unmarshal(resp.Value, &entries)
+	if err != nil {
+		return err
+	}
+	merge(entries)
+	return nil
+}
+
+// KeysExpiringWithin returns the keys in the DMap whose remaining TTL is less
+// than the given duration, with their remaining TTLs. The keys without a TTL
+// and the expired ones are skipped. The remaining TTLs are computed against the
+// clock of this member.
+//
+// It scans all the partitions on all members, like Keys. Don't use it on the
+// hot path.
+func (dm *DMap) KeysExpiringWithin(within time.Duration) (map[string]time.Duration, error) {
+	return dm.db.keysByTTL(dm.target(), within)
+}
+
+func (db *Olric) keysByTTLOperation(req *protocol.Message) *protocol.Message {
+	var within time.Duration
+	err := msgpack.Unmarshal(req.Value, &within)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(db.localKeysByTTL(req.DMap, within))
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
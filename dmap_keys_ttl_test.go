@@ -0,0 +1,83 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDMap_KeysExpiringWithin(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	_, err = c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 30; i++ {
+		switch {
+		case i < 10:
+			err = dm.PutEx(bkey(i), bval(i), time.Minute)
+		case i < 20:
+			err = dm.PutEx(bkey(i), bval(i), time.Hour)
+		default:
+			err = dm.Put(bkey(i), bval(i))
+		}
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm.PutEx("expired", bval(0), time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	<-time.After(10 * time.Millisecond)
+
+	keys, err := dm.KeysExpiringWithin(10 * time.Minute)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(keys) != 10 {
+		t.Fatalf("Expected 10 keys. Got: %d", len(keys))
+	}
+	for i := 0; i < 10; i++ {
+		remaining, ok := keys[bkey(i)]
+		if !ok {
+			t.Fatalf("Expected %s in the result", bkey(i))
+		}
+		if remaining <= 0 || remaining > time.Minute {
+			t.Fatalf("Expected a remaining TTL up to a minute. Got: %v", remaining)
+		}
+	}
+
+	keys, err = dm.KeysExpiringWithin(2 * time.Hour)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(keys) != 20 {
+		t.Fatalf("Expected 20 keys. Got: %d", len(keys))
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
+)
+
+// localLastAccess returns the last access time of the key in nanoseconds on the
+// partition owner. It's zero if the access log is not maintained for the DMap.
+// It doesn't update the access log.
+func (db *Olric) localLastAccess(name string, hkey uint64) (int64, error) {
+	part := db.getPartition(hkey)
+	tmp, ok := part.m.Load(name)
+	if !ok {
+		return 0, ErrKeyNotFound
+	}
+	dm := tmp.(*dmap)
+	dm.RLock()
+	defer dm.RUnlock()
+
+	vdata, err := dm.storage.Get(hkey)
+	if err == storage.ErrKeyNotFound {
+		return 0, ErrKeyNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if isKeyExpired(vdata.TTL) {
+		return 0, ErrKeyNotFound
+	}
+	accessedAt, _ := dm.lastAccess(hkey)
+	return accessedAt, nil
+}
+
+func (db *Olric) lastAccess(name, key string) (int64, error) {
+	member, hkey, err := db.lookupPartitionOwner(name, key)
+	if err != nil {
+		return 0, err
+	}
+	if hostCmp(member, db.this) {
+		return db.localLastAccess(name, hkey)
+	}
+
+	// The access log lives on the partition owner.
+	req := &protocol.Message{
+		DMap: name,
+		Key:  key,
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpLastAccess, req)
+	if err != nil {
+		return 0, err
+	}
+	var accessedAt int64
+	err = msgpack.Unmarshal(resp.Value, &accessedAt)
+	return accessedAt, err
+}
+
+// LastAccess returns the time of the last read or write access on the key. The
+// access log is only maintained on the partition owners of the DMaps with
+// LRUEviction or a MaxIdleDuration, it returns the zero time for the other DMaps.
+// Calling LastAccess doesn't count as an access. It returns ErrKeyNotFound if
+// the DB does not contains the key. It's thread-safe.
+func (dm *DMap) LastAccess(key string) (time.Time, error) {
+	accessedAt, err := dm.db.lastAccess(dm.target(), key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return unixNanoTime(accessedAt), nil
+}
+
+// unixNanoTime converts the access times in the access log to time.Time. Zero
+// means no access is recorded.
+func unixNanoTime(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
+
+func (db *Olric) lastAccessOperation(req *protocol.Message) *protocol.Message {
+	hkey := db.getHKey(req.DMap, req.Key)
+	accessedAt, err := db.localLastAccess(req.DMap, hkey)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(accessedAt)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
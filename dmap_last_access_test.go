@@ -0,0 +1,114 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+)
+
+func TestDMap_LastAccess(t *testing.T) {
+	newConfig := func() *config.Config {
+		c := testConfig(nil)
+		c.Cache = &config.CacheConfig{
+			DMapConfigs: map[string]config.DMapCacheConfig{
+				"idle": {MaxIdleDuration: time.Hour},
+			},
+		}
+		return c
+	}
+
+	var dbs []*Olric
+	for i := 0; i < 2; i++ {
+		db, err := newDB(newConfig(), dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("idle")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	written := time.Now()
+
+	// Some of the keys are owned by the other member.
+	for i := 0; i < 10; i++ {
+		accessedAt, err := dm.LastAccess(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if accessedAt.Before(start) || accessedAt.After(written) {
+			t.Fatalf("Expected the time of Put. Got: %v", accessedAt)
+		}
+		// LastAccess doesn't update the access log.
+		entry, err := dm.GetEntry(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !entry.LastAccess.Equal(accessedAt) {
+			t.Fatalf("Expected %v. Got: %v", accessedAt, entry.LastAccess)
+		}
+		updated, err := dm.LastAccess(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !updated.After(accessedAt) {
+			t.Fatalf("Expected GetEntry to update the access log")
+		}
+	}
+
+	_, err = dm.LastAccess("missing")
+	if err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+	}
+
+	// There is no access log for the other DMaps.
+	other, err := dbs[0].NewDMap("other")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = other.Put(bkey(0), bval(0))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	accessedAt, err := other.LastAccess(bkey(0))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !accessedAt.IsZero() {
+		t.Fatalf("Expected the zero time. Got: %v", accessedAt)
+	}
+}
@@ -71,7 +71,7 @@ func (db *Olric) unlockKey(name, key string, token []byte) error {
 	}
 
 	// release it.
-	err = db.deleteKey(name, key)
+	_, err = db.deleteKey(name, key)
 	if err != nil {
 		return fmt.Errorf("unlock failed because of delete: %w", err)
 	}
@@ -173,7 +173,7 @@ func (db *Olric) lockKey(opcode protocol.OpCode, name, key string,
 //
 // You should know that the locks are approximate, and only to be used for non-critical purposes.
 func (dm *DMap) LockWithTimeout(key string, timeout, deadline time.Duration) (*LockContext, error) {
-	return dm.db.lockKey(protocol.OpPutIfEx, dm.name, key, timeout, deadline)
+	return dm.db.lockKey(protocol.OpPutIfEx, dm.target(), key, timeout, deadline)
 }
 
 // Lock sets a lock for the given key. Acquired lock is only for the key in this DMap.
@@ -182,7 +182,7 @@ func (dm *DMap) LockWithTimeout(key string, timeout, deadline time.Duration) (*L
 //
 // You should know that the locks are approximate, and only to be used for non-critical purposes.
 func (dm *DMap) Lock(key string, deadline time.Duration) (*LockContext, error) {
-	return dm.db.lockKey(protocol.OpPutIf, dm.name, key, nilTimeout, deadline)
+	return dm.db.lockKey(protocol.OpPutIf, dm.target(), key, nilTimeout, deadline)
 }
 
 func (db *Olric) exLockWithTimeoutOperation(req *protocol.Message) *protocol.Message {
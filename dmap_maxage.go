@@ -0,0 +1,113 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"time"
+
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+// lookupOnLocalBackup returns the version of a key on the backup partition of
+// this member. It only looks at the partitions which are currently backed up
+// by this member, the leftovers of a previous layout don't receive the updates.
+func (db *Olric) lookupOnLocalBackup(name string, hkey uint64) (*storage.VData, error) {
+	var isBackupOwner bool
+	for _, owner := range db.getDMapBackupOwners(name, hkey) {
+		if hostCmp(owner, db.this) {
+			isBackupOwner = true
+			break
+		}
+	}
+	if !isBackupOwner {
+		return nil, ErrKeyNotFound
+	}
+
+	part := db.getBackupPartition(hkey)
+	tmp, ok := part.m.Load(name)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	dm := tmp.(*dmap)
+	dm.RLock()
+	defer dm.RUnlock()
+	vdata, err := dm.storage.Get(hkey)
+	if err != nil {
+		return nil, err
+	}
+	if isKeyExpired(vdata.TTL) {
+		return nil, ErrKeyNotFound
+	}
+	return vdata, nil
+}
+
+// ageOf returns the time passed since the given timestamp. It returns zero if
+// the timestamp is unknown.
+func ageOf(timestamp int64) time.Duration {
+	if timestamp == 0 {
+		return 0
+	}
+	age := time.Duration(time.Now().UnixNano() - timestamp)
+	if age < 0 {
+		// Clock skew between the members.
+		return 0
+	}
+	return age
+}
+
+func (db *Olric) getWithMaxAge(name, key string, maxAge time.Duration) ([]byte, time.Duration, error) {
+	if maxAge > 0 {
+		hkey := db.getHKey(name, key)
+		vdata, err := db.lookupOnLocalBackup(name, hkey)
+		if err == nil {
+			age := ageOf(vdata.Timestamp)
+			if age <= maxAge {
+				return vdata.Value, age, nil
+			}
+		} else if err != ErrKeyNotFound && err != storage.ErrKeyNotFound {
+			db.log.V(3).Printf("[ERROR] Failed to read backup of key: %s on DMap: %s: %v", key, name, err)
+		}
+	}
+
+	// The local backup is missing or too old. Ask the partition owner.
+	res, err := db.getWithOptions(name, key, &ReadOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	return res.Value, ageOf(res.Timestamp), nil
+}
+
+// GetWithMaxAge gets the value for the given key if its age, the time passed since
+// the last write, is not greater than maxAge. If this member keeps a backup of the
+// key which is fresh enough, the value is served locally without a round-trip to
+// the partition owner. Otherwise, it falls back to a regular read which respects
+// ReadQuorum. It returns the value and its age. The age may be zero if the partition
+// owner doesn't report it. It returns ErrKeyNotFound if the DB does not contains the
+// key. It's thread-safe.
+//
+// A backup may miss a write which failed to replicate. So the served value may not be
+// the latest one even if its age is within maxAge. Don't use it if you need to read
+// your own writes.
+func (dm *DMap) GetWithMaxAge(key string, maxAge time.Duration) (interface{}, time.Duration, error) {
+	rawval, age, err := dm.db.getWithMaxAge(dm.target(), key, maxAge)
+	if err != nil {
+		return nil, 0, err
+	}
+	value, err := dm.db.unmarshalValue(rawval)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, age, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+func TestDMap_GetWithMaxAge(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		val, age, err := dm2.GetWithMaxAge(bkey(i), time.Minute)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(val.([]byte), bval(i)) {
+			t.Fatalf("Expected the same value. Got: %s", string(val.([]byte)))
+		}
+		if age <= 0 || age > time.Minute {
+			t.Fatalf("Expected age is between zero and one minute. Got: %v", age)
+		}
+	}
+
+	// Update the keys on the owners without replicating them. The backups
+	// on db2 still have the previous version.
+	updated := []byte("updated")
+	raw, err := db1.serializer.Marshal(updated)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	var local []int
+	for i := 0; i < 10; i++ {
+		hkey := db2.getHKey("mymap", bkey(i))
+		owner := db1
+		if hostCmp(db2.getPartition(hkey).owner(), db2.this) {
+			owner = db2
+		} else {
+			local = append(local, i)
+		}
+		dm, err := owner.getDMap("mymap", hkey)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dm.Lock()
+		err = dm.storage.Put(hkey, &storage.VData{
+			Key:       bkey(i),
+			Value:     raw,
+			Timestamp: time.Now().UnixNano(),
+		})
+		dm.Unlock()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	if len(local) == 0 {
+		t.Fatalf("Expected at least one key backed up by db2")
+	}
+
+	for _, i := range local {
+		// Served from the backup on db2.
+		val, _, err := dm2.GetWithMaxAge(bkey(i), time.Minute)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(val.([]byte), bval(i)) {
+			t.Fatalf("Expected the previous value. Got: %s", string(val.([]byte)))
+		}
+
+		// The backup is too old, it falls back to the partition owner.
+		val, _, err = dm2.GetWithMaxAge(bkey(i), time.Nanosecond)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(val.([]byte), updated) {
+			t.Fatalf("Expected the updated value. Got: %s", string(val.([]byte)))
+		}
+	}
+}
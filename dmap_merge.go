@@ -0,0 +1,63 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+// mergeWrite calls the MergeFunc of the DMap if the write is not newer than
+// the stored version, and replaces the value and the timestamp of the write
+// with the merged ones. The caller must hold the DMap's lock.
+func (db *Olric) mergeWrite(hkey uint64, dm *dmap, w *writeop) error {
+	if dm.cache == nil || dm.cache.mergeFunc == nil {
+		return nil
+	}
+	vdata, err := dm.storage.Get(hkey)
+	if err == storage.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if isKeyExpired(vdata.TTL) || w.timestamp > vdata.Timestamp {
+		return nil
+	}
+
+	// The value points to the underlying table. Copy it before passing
+	// to the user.
+	value := make([]byte, len(vdata.Value))
+	copy(value, vdata.Value)
+	existing := config.VData{
+		Key:       vdata.Key,
+		Value:     value,
+		Timestamp: vdata.Timestamp,
+	}
+	incoming := config.VData{
+		Key:       w.key,
+		Value:     w.value,
+		Timestamp: w.timestamp,
+	}
+	merged := dm.cache.mergeFunc(existing, incoming)
+	w.value = merged.Value
+	w.timestamp = merged.Timestamp
+	if w.timestamp < vdata.Timestamp {
+		// The stored version never goes back in time. Otherwise, a stale
+		// replica would win the read-repair.
+		w.timestamp = vdata.Timestamp
+	}
+	return nil
+}
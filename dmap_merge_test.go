@@ -0,0 +1,126 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+func TestDMap_MergeFunc(t *testing.T) {
+	var calls int
+	var mergedValue []byte
+	c := testSingleReplicaConfig()
+	c.Cache = &config.CacheConfig{
+		DMapConfigs: map[string]config.DMapCacheConfig{
+			"mymap": {
+				MergeFunc: func(existing, incoming config.VData) config.VData {
+					calls++
+					return config.VData{
+						Key:       incoming.Key,
+						Value:     mergedValue,
+						Timestamp: incoming.Timestamp,
+					}
+				},
+			},
+		},
+	}
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	mergedValue, err = db.serializer.Marshal("merged")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put("mykey", "newer")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("Expected MergeFunc not to be called for a new key")
+	}
+	res, err := db.getWithOptions("mymap", "mykey", &ReadOptions{})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	stored := res.Timestamp
+
+	// An out of order write.
+	value, err := db.serializer.Marshal("older")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	w := &writeop{
+		opcode:        protocol.OpPut,
+		replicaOpcode: protocol.OpPutReplica,
+		dmap:          "mymap",
+		key:           "mykey",
+		value:         value,
+		timestamp:     stored - int64(time.Second),
+	}
+	err = db.put(w)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected MergeFunc to be called once. Got: %d", calls)
+	}
+	res, err = db.getWithOptions("mymap", "mykey", &ReadOptions{})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	merged, err := db.unmarshalValue(res.Value)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if merged != "merged" {
+		t.Fatalf("Expected merged. Got: %v", merged)
+	}
+	if res.Timestamp != stored {
+		t.Fatalf("Expected the timestamp not to go back. Got: %d", res.Timestamp)
+	}
+
+	// A newer write is applied as is.
+	err = dm.Put("mykey", "newest")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected MergeFunc not to be called for a newer write")
+	}
+	newest, err := dm.Get("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if newest != "newest" {
+		t.Fatalf("Expected newest. Got: %v", newest)
+	}
+}
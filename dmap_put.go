@@ -35,6 +35,10 @@ const (
 var (
 	ErrKeyFound    = errors.New("key found")
 	ErrWriteQuorum = errors.New("write quorum cannot be reached")
+
+	// ErrPartitionFull is returned when a DMap reaches MaxKeysPerPartition on
+	// the partition of the key and no key can be evicted to make room.
+	ErrPartitionFull = errors.New("partition is full")
 )
 
 // writeop contains various values whose participate a write operation.
@@ -47,6 +51,12 @@ type writeop struct {
 	timestamp     int64
 	timeout       time.Duration
 	flags         int16
+	consistency   ConsistencyLevel
+	// deadline is the hard expiry time of the key in milliseconds.
+	deadline int64
+	// ifVersion makes the write conditional on the stored version. See PutIfVersion.
+	ifVersion bool
+	version   int64
 }
 
 // fromReq generates a new protocol message from writeop instance.
@@ -66,6 +76,8 @@ func (w *writeop) fromReq(req *protocol.Message) {
 		w.replicaOpcode = protocol.OpPutIfReplica
 	case protocol.OpPutIfEx:
 		w.replicaOpcode = protocol.OpPutIfExReplica
+	case protocol.OpPutIfVersion:
+		w.replicaOpcode = protocol.OpPutReplica
 	}
 
 	// Extract extras
@@ -82,9 +94,27 @@ func (w *writeop) fromReq(req *protocol.Message) {
 		w.flags = req.Extra.(protocol.PutIfExExtra).Flags
 		w.timestamp = req.Extra.(protocol.PutIfExExtra).Timestamp
 		w.timeout = time.Duration(req.Extra.(protocol.PutIfExExtra).TTL)
+	case protocol.OpPutIfVersion:
+		w.timestamp = req.Extra.(protocol.PutIfVersionExtra).Timestamp
+		w.version = req.Extra.(protocol.PutIfVersionExtra).Version
+		w.ifVersion = true
 	case protocol.OpExpire:
 		w.timestamp = req.Extra.(protocol.ExpireExtra).Timestamp
 		w.timeout = time.Duration(req.Extra.(protocol.ExpireExtra).TTL)
+	case protocol.OpPutWithOptions, protocol.OpPutWithOptionsReplica:
+		extra := req.Extra.(protocol.PutWithOptionsExtra)
+		w.timestamp = extra.Timestamp
+		w.timeout = time.Duration(extra.TTL)
+		w.consistency = ConsistencyLevel(extra.Consistency)
+		w.deadline = extra.Deadline
+		w.replicaOpcode = protocol.OpPutReplica
+		if w.timeout != 0 {
+			w.replicaOpcode = protocol.OpPutExReplica
+		}
+		if w.deadline != 0 {
+			// The other replica operations cannot carry the deadline.
+			w.replicaOpcode = protocol.OpPutWithOptionsReplica
+		}
 	}
 }
 
@@ -118,11 +148,23 @@ func (w *writeop) toReq(opcode protocol.OpCode) *protocol.Message {
 			Timestamp: w.timestamp,
 			TTL:       w.timeout.Nanoseconds(),
 		}
+	case protocol.OpPutIfVersion:
+		req.Extra = protocol.PutIfVersionExtra{
+			Timestamp: w.timestamp,
+			Version:   w.version,
+		}
 	case protocol.OpExpire:
 		req.Extra = protocol.ExpireExtra{
 			Timestamp: w.timestamp,
 			TTL:       w.timeout.Nanoseconds(),
 		}
+	case protocol.OpPutWithOptions, protocol.OpPutWithOptionsReplica:
+		req.Extra = protocol.PutWithOptionsExtra{
+			TTL:         w.timeout.Nanoseconds(),
+			Timestamp:   w.timestamp,
+			Consistency: uint8(w.consistency),
+			Deadline:    w.deadline,
+		}
 	}
 	return req
 }
@@ -138,6 +180,10 @@ func (db *Olric) localPut(hkey uint64, dm *dmap, w *writeop) error {
 		Value:     w.value,
 		Timestamp: w.timestamp,
 		TTL:       ttl,
+		Deadline:  w.deadline,
+	}
+	if err := dm.wal.put(w.dmap, val); err != nil {
+		return err
 	}
 	err := dm.storage.Put(hkey, val)
 	if err == storage.ErrFragmented {
@@ -146,6 +192,9 @@ func (db *Olric) localPut(hkey uint64, dm *dmap, w *writeop) error {
 		err = nil
 	}
 	if err == nil {
+		if dm.index != nil {
+			dm.index.Insert(db.normalizeKey(w.key), hkey)
+		}
 		dm.updateAccessLog(hkey)
 		return nil
 	}
@@ -155,7 +204,7 @@ func (db *Olric) localPut(hkey uint64, dm *dmap, w *writeop) error {
 func (db *Olric) asyncPutOnCluster(hkey uint64, dm *dmap, w *writeop) error {
 	req := w.toReq(w.replicaOpcode)
 	// Fire and forget mode.
-	owners := db.getBackupPartitionOwners(hkey)
+	owners := db.getDMapBackupOwners(w.dmap, hkey)
 	for _, owner := range owners {
 		db.wg.Add(1)
 		go func(host discovery.Member) {
@@ -172,11 +221,15 @@ func (db *Olric) asyncPutOnCluster(hkey uint64, dm *dmap, w *writeop) error {
 }
 
 func (db *Olric) syncPutOnCluster(hkey uint64, dm *dmap, w *writeop) error {
+	writeQuorum, err := db.quorum(w.dmap, w.consistency, db.config.WriteQuorum)
+	if err != nil {
+		return err
+	}
 	req := w.toReq(w.replicaOpcode)
 
 	// Quorum based replication.
 	var successful int
-	owners := db.getBackupPartitionOwners(hkey)
+	owners := db.getDMapBackupOwners(w.dmap, hkey)
 	for _, owner := range owners {
 		_, err := db.requestTo(owner.String(), w.replicaOpcode, req)
 		if err != nil {
@@ -187,21 +240,27 @@ func (db *Olric) syncPutOnCluster(hkey uint64, dm *dmap, w *writeop) error {
 		}
 		successful++
 	}
-	err := db.localPut(hkey, dm, w)
+	err = db.localPut(hkey, dm, w)
 	if err != nil {
 		if db.log.V(3).Ok() {
 			db.log.V(3).Printf("[ERROR] Failed to call put command on %s for DMap: %s: %v", db.this, w.dmap, err)
 		}
+		if w.consistency == ConsistencyLocalOne {
+			return err
+		}
 	} else {
 		successful++
 	}
-	if successful >= db.config.WriteQuorum {
+	if successful >= writeQuorum {
 		return nil
 	}
 	return ErrWriteQuorum
 }
 
 func (db *Olric) callPutOnCluster(hkey uint64, w *writeop) error {
+	if err := db.checkWritable(w.dmap); err != nil {
+		return err
+	}
 	// Get the DMap and acquire its lock
 	dm, err := db.getDMap(w.dmap, hkey)
 	if err != nil {
@@ -209,6 +268,39 @@ func (db *Olric) callPutOnCluster(hkey uint64, w *writeop) error {
 	}
 	dm.Lock()
 	defer dm.Unlock()
+	return db.putOnCluster(hkey, dm, w)
+}
+
+// makeRoomOnPartition checks MaxKeysPerPartition before adding a new key to
+// the DMap. It evicts a key with LRU, if the DMap is configured so.
+func (db *Olric) makeRoomOnPartition(hkey uint64, dm *dmap, w *writeop) error {
+	if db.config.MaxKeysPerPartition == 0 || dm.storage.Check(hkey) {
+		// No limit or it's an update.
+		return nil
+	}
+	if dm.storage.Len() < db.config.MaxKeysPerPartition {
+		return nil
+	}
+	if dm.cache != nil && dm.cache.evictionPolicy == config.LRUEviction {
+		err := db.evictKeyWithLRU(dm, w.dmap)
+		if err == nil {
+			return nil
+		}
+		if db.log.V(3).Ok() {
+			db.log.V(3).Printf("[ERROR] Failed to evict a key on DMap: %s: %v", w.dmap, err)
+		}
+	}
+	part := db.getPartition(hkey)
+	atomic.AddUint64(&part.rejected, 1)
+	return ErrPartitionFull
+}
+
+// putOnCluster stores the key/value pair on the cluster. The caller must hold
+// the DMap's lock.
+func (db *Olric) putOnCluster(hkey uint64, dm *dmap, w *writeop) error {
+	if err := db.checkClockSkew(w); err != nil {
+		return err
+	}
 
 	// Only set the key if it does not already exist.
 	if w.flags&IfNotFound != 0 {
@@ -242,6 +334,16 @@ func (db *Olric) callPutOnCluster(hkey uint64, w *writeop) error {
 		}
 	}
 
+	if w.ifVersion {
+		if err := db.checkVersion(hkey, dm, w); err != nil {
+			return err
+		}
+	}
+
+	if err := db.mergeWrite(hkey, dm, w); err != nil {
+		return err
+	}
+
 	// MaxKeys and MaxInuse properties of LRU can be used in the same time.
 	// But I think that it's good to use only one of time in a production system.
 	// Because it should be easy to understand and debug.
@@ -281,16 +383,42 @@ func (db *Olric) callPutOnCluster(hkey uint64, w *writeop) error {
 		}
 	}
 
+	if err := db.makeRoomOnPartition(hkey, dm, w); err != nil {
+		return err
+	}
+
 	if dm.cache != nil && dm.cache.ttlDuration.Seconds() != 0 && w.timeout.Seconds() == 0 {
 		w.timeout = dm.cache.ttlDuration
 	}
 
-	if db.config.ReplicaCount == config.MinimumReplicaCount {
+	if err := db.storeOnCluster(hkey, dm, w); err != nil {
+		return err
+	}
+	db.recordWrite(w.dmap, w.key, w.value, w.timestamp)
+	db.recordValueSize(w.dmap, w.value)
+	db.publishChange(w.dmap, ChangePut, w.key, w.value, w.timestamp)
+	return nil
+}
+
+// storeOnCluster stores the key/value pair on this member and the backup owners
+// in the configured replication mode.
+func (db *Olric) storeOnCluster(hkey uint64, dm *dmap, w *writeop) error {
+	if db.replicaCount(w.dmap) == config.MinimumReplicaCount {
 		// MinimumReplicaCount is 1. So it's enough to put the key locally. There is no
 		// other replica host.
 		return db.localPut(hkey, dm, w)
 	}
 
+	if db.config.BackupMode == config.LazyBackupMode {
+		// Buffer the replica writes and send them in batches.
+		return db.lazyPutOnCluster(hkey, dm, w)
+	}
+
+	if db.config.ReplicationTopology == config.ChainReplicationTopology {
+		// Relay the replica writes through the backup owners.
+		return db.chainPutOnCluster(hkey, dm, w)
+	}
+
 	if db.config.ReplicationMode == config.AsyncReplicationMode {
 		// Fire and forget mode. Calls PutBackup command in different goroutines
 		// and stores the key/value pair on local storage instance.
@@ -310,6 +438,15 @@ func (db *Olric) put(w *writeop) error {
 		// We are on the partition owner.
 		return db.callPutOnCluster(hkey, w)
 	}
+	if w.consistency != ConsistencyDefault {
+		ok, err := db.client.Supports(member.String(), protocol.CapConsistencyLevel)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s doesn't support consistency levels", member)
+		}
+	}
 	// Redirect to the partition owner.
 	req := w.toReq(w.opcode)
 	_, err := db.requestTo(member.String(), w.opcode, req)
@@ -340,6 +477,13 @@ func (db *Olric) prepareWriteop(opcode protocol.OpCode, name, key string,
 		w.replicaOpcode = protocol.OpPutIfReplica
 	case opcode == protocol.OpPutIfEx:
 		w.replicaOpcode = protocol.OpPutIfExReplica
+	case opcode == protocol.OpPutIfVersion:
+		w.replicaOpcode = protocol.OpPutReplica
+	case opcode == protocol.OpPutWithOptions:
+		w.replicaOpcode = protocol.OpPutReplica
+		if timeout != 0 {
+			w.replicaOpcode = protocol.OpPutExReplica
+		}
 	}
 	return w, nil
 }
@@ -349,7 +493,7 @@ func (db *Olric) prepareWriteop(opcode protocol.OpCode, name, key string,
 // is arbitrary. It is safe to modify the contents of the arguments after
 // Put returns but not before.
 func (dm *DMap) PutEx(key string, value interface{}, timeout time.Duration) error {
-	w, err := dm.db.prepareWriteop(protocol.OpPutEx, dm.name, key, value, timeout, 0)
+	w, err := dm.db.prepareWriteop(protocol.OpPutEx, dm.target(), key, value, timeout, 0)
 	if err != nil {
 		return err
 	}
@@ -361,7 +505,7 @@ func (dm *DMap) PutEx(key string, value interface{}, timeout time.Duration) erro
 // is arbitrary. It is safe to modify the contents of the arguments after
 // Put returns but not before.
 func (dm *DMap) Put(key string, value interface{}) error {
-	w, err := dm.db.prepareWriteop(protocol.OpPut, dm.name, key, value, nilTimeout, 0)
+	w, err := dm.db.prepareWriteop(protocol.OpPut, dm.target(), key, value, nilTimeout, 0)
 	if err != nil {
 		return err
 	}
@@ -380,7 +524,7 @@ func (dm *DMap) Put(key string, value interface{}) error {
 // IfFound: Only set the key if it already exist.
 // It returns ErrKeyNotFound if the key does not exist.
 func (dm *DMap) PutIf(key string, value interface{}, flags int16) error {
-	w, err := dm.db.prepareWriteop(protocol.OpPutIf, dm.name, key, value, nilTimeout, flags)
+	w, err := dm.db.prepareWriteop(protocol.OpPutIf, dm.target(), key, value, nilTimeout, flags)
 	if err != nil {
 		return err
 	}
@@ -399,10 +543,50 @@ func (dm *DMap) PutIf(key string, value interface{}, flags int16) error {
 // IfFound: Only set the key if it already exist.
 // It returns ErrKeyNotFound if the key does not exist.
 func (dm *DMap) PutIfEx(key string, value interface{}, timeout time.Duration, flags int16) error {
-	w, err := dm.db.prepareWriteop(protocol.OpPutIfEx, dm.name, key, value, timeout, flags)
+	w, err := dm.db.prepareWriteop(protocol.OpPutIfEx, dm.target(), key, value, timeout, flags)
+	if err != nil {
+		return err
+	}
+	return dm.db.put(w)
+}
+
+// WriteOptions defines options for a write request. See DMap.PutWithOptions.
+type WriteOptions struct {
+	// Timeout sets a TTL for the key. Zero means no expiry.
+	Timeout time.Duration
+
+	// Consistency overrides WriteQuorum for the request. It has no effect
+	// in AsyncReplicationMode.
+	Consistency ConsistencyLevel
+
+	// MaxLifetime sets a hard limit on the lifetime of the key, counted from
+	// this write. The key expires when MaxLifetime passes even if its TTL is
+	// extended by Expire or GetAndTouch, or it's accessed constantly. It's
+	// cleared by the next write of the key without a MaxLifetime. Zero means
+	// no limit.
+	MaxLifetime time.Duration
+}
+
+// PutWithOptions sets the value for the given key with the given write options.
+// It overwrites any previous value for that key. It's thread-safe. It is safe
+// to modify the contents of the arguments after PutWithOptions returns but
+// not before.
+func (dm *DMap) PutWithOptions(key string, value interface{}, opts *WriteOptions) error {
+	if opts == nil {
+		opts = &WriteOptions{}
+	}
+	if _, err := dm.db.quorum(dm.target(), opts.Consistency, dm.db.config.WriteQuorum); err != nil {
+		return err
+	}
+	w, err := dm.db.prepareWriteop(protocol.OpPutWithOptions, dm.target(), key, value, opts.Timeout, 0)
 	if err != nil {
 		return err
 	}
+	w.consistency = opts.Consistency
+	if opts.MaxLifetime != 0 {
+		w.deadline = getTTL(opts.MaxLifetime)
+		w.replicaOpcode = protocol.OpPutWithOptionsReplica
+	}
 	return dm.db.put(w)
 }
 
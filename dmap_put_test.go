@@ -19,6 +19,9 @@ import (
 	"context"
 	"testing"
 	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
 )
 
 func TestDMap_Put(t *testing.T) {
@@ -233,3 +236,119 @@ func TestDMap_PutIfFound(t *testing.T) {
 		}
 	}
 }
+
+func TestDMap_MaxMessageSize(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.MaxMessageSize = 1024
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	req := &protocol.Message{
+		DMap:  "mymap",
+		Key:   "mykey",
+		Value: make([]byte, 2048),
+		Extra: protocol.PutExtra{Timestamp: time.Now().UnixNano()},
+	}
+	_, err = db.requestTo(db.this.String(), protocol.OpPut, req)
+	if err != ErrMessageTooLarge {
+		t.Fatalf("Expected ErrMessageTooLarge. Got: %v", err)
+	}
+
+	// The connection is still usable.
+	req = &protocol.Message{
+		DMap:  "mymap",
+		Key:   "mykey",
+		Value: make([]byte, 512),
+		Extra: protocol.PutExtra{Timestamp: time.Now().UnixNano()},
+	}
+	_, err = db.requestTo(db.this.String(), protocol.OpPut, req)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	stats := db.client.Stats()
+	if idle := stats[db.this.String()].Idle; idle != 1 {
+		t.Fatalf("Expected 1 idle connection. Got: %d", idle)
+	}
+}
+
+func TestDMap_PutWithMaxLifetime(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.PutWithOptions(bkey(i), bval(i), &WriteOptions{MaxLifetime: 100 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		// Expire cannot extend the lifetime of the key.
+		err = dm.Expire(bkey(i), time.Hour)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		ttl, err := dm.GetTTL(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if ttl > 100*time.Millisecond {
+			t.Fatalf("Expected TTL <= 100ms. Got: %v", ttl)
+		}
+	}
+
+	// The backups carry the deadline too.
+	var backups int
+	for _, db := range []*Olric{db1, db2} {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			part := db.backups[partID]
+			tmp, ok := part.m.Load("mymap")
+			if !ok {
+				continue
+			}
+			bdm := tmp.(*dmap)
+			bdm.RLock()
+			bdm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+				if vdata.Deadline == 0 {
+					t.Errorf("Expected a deadline on the backup of %s", vdata.Key)
+				}
+				backups++
+				return true
+			})
+			bdm.RUnlock()
+		}
+	}
+	if backups != 10 {
+		t.Fatalf("Expected backup count: 10. Got: %d", backups)
+	}
+
+	<-time.After(150 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		_, err = dm.Get(bkey(i))
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+	}
+}
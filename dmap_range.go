@@ -0,0 +1,193 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ErrNoOrderedIndex is returned when a range query is run on a DMap
+// without an ordered index. See config.OrderedIndexes.
+var ErrNoOrderedIndex = errors.New("DMap has no ordered index")
+
+type rangeQuery struct {
+	Lo string
+	Hi string
+}
+
+func (db *Olric) hasOrderedIndex(name string) bool {
+	for _, item := range db.config.OrderedIndexes {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// localRangeBetween scans the ordered indexes of a DMap on the primary
+// partitions of this member. The indexes keep the normalized keys, see
+// config.KeyNormalizer.
+func (db *Olric) localRangeBetween(name string, q rangeQuery) []storage.VData {
+	var result []storage.VData
+	lo, hi := db.normalizeKey(q.Lo), db.normalizeKey(q.Hi)
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		tmp, ok := part.m.Load(name)
+		if !ok {
+			continue
+		}
+		dm := tmp.(*dmap)
+		dm.RLock()
+		if dm.index != nil {
+			dm.index.Range(lo, hi, func(key string, hkey uint64) bool {
+				vdata, err := dm.storage.Get(hkey)
+				if err != nil {
+					if err != storage.ErrKeyNotFound {
+						db.log.V(3).Printf("[ERROR] Failed to get key: %s on DMap: %s: %v", key, name, err)
+					}
+					return true
+				}
+				if !isKeyExpired(vdata.TTL) {
+					result = append(result, *vdata)
+				}
+				return true
+			})
+		}
+		dm.RUnlock()
+	}
+	return result
+}
+
+func (db *Olric) rangeBetween(name string, q rangeQuery) ([]storage.VData, error) {
+	data, err := msgpack.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var mtx sync.Mutex
+	// There may be more than one version of a key on the previous owners
+	// of a partition. The last write wins.
+	latest := make(map[string]storage.VData)
+	merge := func(items []storage.VData) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, item := range items {
+			key := db.normalizeKey(item.Key)
+			cur, ok := latest[key]
+			if !ok || cur.Timestamp < item.Timestamp {
+				latest[key] = item
+			}
+		}
+	}
+
+	err = db.fanout(db.discovery.GetMembers(), func(mem discovery.Member) error {
+		if hostCmp(mem, db.this) {
+			merge(db.localRangeBetween(name, q))
+			return nil
+		}
+		return db.requestRangeBetween(mem, name, data, merge)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]storage.VData, 0, len(latest))
+	for _, item := range latest {
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return db.normalizeKey(result[i].Key) < db.normalizeKey(result[j].Key)
+	})
+	return result, nil
+}
+
+func (db *Olric) requestRangeBetween(member discovery.Member, name string, data []byte, merge func([]storage.VData)) error {
+	ok, err := db.client.Supports(member.String(), protocol.CapRangeBetween)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s doesn't support range queries", member)
+	}
+
+	req := &protocol.Message{
+		DMap:  name,
+		Value: data,
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpRangeBetween, req)
+	if err != nil {
+		return err
+	}
+	var items []storage.VData
+	err = msgpack.Unmarshal(resp.Value, &items)
+	if err != nil {
+		return err
+	}
+	merge(items)
+	return nil
+}
+
+// RangeBetween calls f sequentially for each key and value in the DMap whose
+// key is in [lo, hi), in ascending order of the keys. If f returns false, range
+// stops the iteration. The DMap has to maintain an ordered index, otherwise
+// it returns ErrNoOrderedIndex. See config.OrderedIndexes. If config.KeyNormalizer
+// is set, the keys and the bounds are compared in their normalized forms.
+//
+// RangeBetween collects the matching key/value pairs from all members before
+// calling f, so keep the range small enough to fit in memory. A partition is
+// scanned under the lock of its DMap, so the result is a consistent view of
+// each partition. There is no such guarantee across the partitions.
+func (dm *DMap) RangeBetween(lo, hi string, f func(key string, value interface{}) bool) error {
+	if !dm.db.hasOrderedIndex(dm.target()) {
+		return ErrNoOrderedIndex
+	}
+	result, err := dm.db.rangeBetween(dm.target(), rangeQuery{Lo: lo, Hi: hi})
+	if err != nil {
+		return err
+	}
+	for _, item := range result {
+		value, err := dm.db.unmarshalValue(item.Value)
+		if err != nil {
+			return err
+		}
+		if !f(item.Key, value) {
+			break
+		}
+	}
+	return nil
+}
+
+func (db *Olric) rangeBetweenOperation(req *protocol.Message) *protocol.Message {
+	q := rangeQuery{}
+	err := msgpack.Unmarshal(req.Value, &q)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(db.localRangeBetween(req.DMap, q))
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -0,0 +1,169 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDMap_RangeBetween(t *testing.T) {
+	newIndexedDB := func(peers ...*Olric) *Olric {
+		c := testConfig(peers)
+		c.OrderedIndexes = []string{"mymap"}
+		db, err := newDB(c, peers...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		return db
+	}
+	db1 := newIndexedDB()
+	defer func() {
+		err := db1.Shutdown(context.Background())
+		if err != nil {
+			db1.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	db2 := newIndexedDB(db1)
+	defer func() {
+		err := db2.Shutdown(context.Background())
+		if err != nil {
+			db2.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	syncClusterMembers(db1, db2)
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	// Insert in reverse order to check sorting.
+	for i := 99; i >= 0; i-- {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm.Delete(bkey(15))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	check := func(dm *DMap) {
+		var keys []string
+		err := dm.RangeBetween(bkey(10), bkey(20), func(key string, value interface{}) bool {
+			i, err := strconv.Atoi(key)
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if !bytes.Equal(value.([]byte), bval(i)) {
+				t.Fatalf("Unexpected value for key: %s: %s", key, string(value.([]byte)))
+			}
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if len(keys) != 9 {
+			t.Fatalf("Expected 9 keys. Got: %d: %v", len(keys), keys)
+		}
+		for i, key := range keys {
+			if i > 0 && keys[i-1] >= key {
+				t.Fatalf("Expected keys in ascending order. Got: %v", keys)
+			}
+			if key == bkey(15) {
+				t.Fatalf("Expected the deleted key is not found: %s", key)
+			}
+		}
+	}
+	check(dm)
+
+	// Move some partitions to a new member.
+	db3 := newIndexedDB(db1, db2)
+	defer func() {
+		err := db3.Shutdown(context.Background())
+		if err != nil {
+			db3.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	syncClusterMembers(db1, db2, db3)
+
+	dm3, err := db3.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	check(dm3)
+
+	dm, err = db1.NewDMap("foobar")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.RangeBetween(bkey(10), bkey(20), func(key string, value interface{}) bool {
+		return true
+	})
+	if err != ErrNoOrderedIndex {
+		t.Fatalf("Expected ErrNoOrderedIndex. Got: %v", err)
+	}
+}
+
+func TestDMap_RangeBetweenKeyNormalizer(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.OrderedIndexes = []string{"mymap"}
+	c.KeyNormalizer = strings.ToLower
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for _, key := range []string{"Key-1", "key-1", "KEY-2", "Key-3"} {
+		err = dm.Put(key, []byte(key))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm.Delete("key-2")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// The spellings of a key share a single entry in the index.
+	var keys []string
+	err = dm.RangeBetween("KEY-0", "KEY-9", func(key string, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	expected := []string{"key-1", "Key-3"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected %v. Got: %v", expected, keys)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+// ErrReadOnly is returned when a write operation is called on a read-only DMap.
+var ErrReadOnly = errors.New("dmap is read-only")
+
+// readOnlyDMaps keeps the read-only state of the DMaps which is set at runtime.
+// It overrides DMapCacheConfig.ReadOnly.
+type readOnlyDMaps struct {
+	mtx sync.RWMutex
+	m   map[string]bool
+}
+
+func newReadOnlyDMaps() *readOnlyDMaps {
+	return &readOnlyDMaps{
+		m: make(map[string]bool),
+	}
+}
+
+func (r *readOnlyDMaps) set(name string, readOnly bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.m[name] = readOnly
+}
+
+func (r *readOnlyDMaps) load(name string) (bool, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	readOnly, ok := r.m[name]
+	return readOnly, ok
+}
+
+// isReadOnly returns true if the writes are not allowed on the DMap.
+func (db *Olric) isReadOnly(name string) bool {
+	if readOnly, ok := db.readOnly.load(name); ok {
+		return readOnly
+	}
+	if db.config.Cache == nil {
+		return false
+	}
+	return db.config.Cache.DMapConfigs[name].ReadOnly
+}
+
+// checkWritable is called on the partition owner before the write operations.
+// It returns ErrWritesPaused while the writes are paused, ErrReadOnly for a
+// read-only DMap and waits for a DMap being destroyed. The writes on a DMap are
+// also paused while it's being renamed.
+func (db *Olric) checkWritable(name string) error {
+	if atomic.LoadInt32(&db.writesPaused) == 1 || db.aliases.isPaused(name) {
+		return ErrWritesPaused
+	}
+	if db.isReadOnly(name) {
+		return ErrReadOnly
+	}
+	return db.waitForDMap(name)
+}
+
+func (db *Olric) setReadOnly(name string, readOnly bool) error {
+	value := []byte{0}
+	if readOnly {
+		value[0] = 1
+	}
+	return db.fanout(db.discovery.GetMembers(), func(member discovery.Member) error {
+		addr := member.String()
+		req := &protocol.Message{
+			DMap:  name,
+			Value: value,
+		}
+		_, err := db.requestTo(addr, protocol.OpSetReadOnly, req)
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to set read-only state of DMap: %s on %s: %v",
+				name, addr, err)
+		}
+		return err
+	})
+}
+
+// MakeReadOnly rejects the write operations on the DMap with ErrReadOnly on all
+// the members. Get and the other read operations are still allowed. It overrides
+// DMapCacheConfig.ReadOnly. The members which join the cluster later use their
+// own configuration. It's thread-safe.
+func (dm *DMap) MakeReadOnly() error {
+	return dm.db.setReadOnly(dm.target(), true)
+}
+
+// MakeWritable allows the write operations on the DMap again. See MakeReadOnly.
+// It's thread-safe.
+func (dm *DMap) MakeWritable() error {
+	return dm.db.setReadOnly(dm.target(), false)
+}
+
+func (db *Olric) setReadOnlyOperation(req *protocol.Message) *protocol.Message {
+	db.readOnly.set(req.DMap, len(req.Value) == 1 && req.Value[0] == 1)
+	return req.Success()
+}
@@ -0,0 +1,121 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+
+	"github.com/buraksezer/olric/config"
+)
+
+func TestDMap_ReadOnlyConfig(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.Cache = &config.CacheConfig{
+		DMapConfigs: map[string]config.DMapCacheConfig{
+			"refdata": {ReadOnly: true},
+		},
+	}
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("refdata")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put("mykey", "myvalue")
+	if err != ErrReadOnly {
+		t.Fatalf("Expected ErrReadOnly. Got: %v", err)
+	}
+
+	other, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = other.Put("mykey", "myvalue")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+}
+
+func TestDMap_MakeReadOnly(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm1.MakeReadOnly()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm2.Put(bkey(i), bval(i))
+		if err != ErrReadOnly {
+			t.Fatalf("Expected ErrReadOnly. Got: %v", err)
+		}
+		err = dm2.Delete(bkey(i))
+		if err != ErrReadOnly {
+			t.Fatalf("Expected ErrReadOnly. Got: %v", err)
+		}
+		_, err = dm2.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	_, err = dm2.Incr("counter", 1)
+	if err != ErrReadOnly {
+		t.Fatalf("Expected ErrReadOnly. Got: %v", err)
+	}
+
+	err = dm2.MakeWritable()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm1.Put(bkey(0), bval(0))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+}
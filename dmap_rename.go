@@ -0,0 +1,326 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ErrDMapReferenced is returned by RenameDMap if another name already points to
+// the data of the DMap which is going to be replaced.
+var ErrDMapReferenced = errors.New("dmap is referenced by another name")
+
+// dmapAliases maps the names of the renamed DMaps to the names which their data
+// is stored under. The partition of a key is found by hashing the DMap name with
+// the key, so the data cannot be moved to another name in place.
+//
+// A stored name is never an alias itself, resolving a name twice is safe.
+type dmapAliases struct {
+	mtx sync.RWMutex
+	m   map[string]string
+
+	// Stored names which the writes are paused on while a rename is in progress.
+	// Concurrent renames may pause the same name, so it's a counter.
+	paused map[string]int
+}
+
+func newDMapAliases() *dmapAliases {
+	return &dmapAliases{
+		m:      make(map[string]string),
+		paused: make(map[string]int),
+	}
+}
+
+// resolve returns the name which the data of the DMap is stored under.
+func (a *dmapAliases) resolve(name string) string {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	if target, ok := a.m[name]; ok {
+		return target
+	}
+	return name
+}
+
+// set points name to target. It removes the alias if they are the same.
+func (a *dmapAliases) set(name, target string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if name == target {
+		delete(a.m, name)
+		return
+	}
+	a.m[name] = target
+}
+
+// isReferenced returns true if an alias points to the given stored name.
+func (a *dmapAliases) isReferenced(target string) bool {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	for _, t := range a.m {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// pause rejects the writes on the stored name until resume is called.
+func (a *dmapAliases) pause(target string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.paused[target]++
+}
+
+func (a *dmapAliases) resume(target string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.paused[target] <= 1 {
+		delete(a.paused, target)
+		return
+	}
+	a.paused[target]--
+}
+
+// isPaused returns true if a rename pauses the writes on the stored name.
+func (a *dmapAliases) isPaused(target string) bool {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	return a.paused[target] > 0
+}
+
+func (a *dmapAliases) snapshot() map[string]string {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	m := make(map[string]string, len(a.m))
+	for name, target := range a.m {
+		m[name] = target
+	}
+	return m
+}
+
+func (a *dmapAliases) load(m map[string]string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.m = m
+}
+
+// physicalOps carry the stored name of a DMap. Their names are not resolved.
+var physicalOps = map[protocol.OpCode]struct{}{
+	protocol.OpDestroyDMap:     {},
+	protocol.OpMarkDestroying:  {},
+	protocol.OpMoveDMap:        {},
+	protocol.OpRenameDMap:      {},
+	protocol.OpPauseDMapWrites: {},
+}
+
+// resolveRequest replaces the DMap name of an incoming request with the name
+// which its data is stored under.
+func (db *Olric) resolveRequest(req *protocol.Message) {
+	if req.DMap == "" {
+		return
+	}
+	if _, ok := physicalOps[req.Op]; ok {
+		return
+	}
+	req.DMap = db.aliases.resolve(req.DMap)
+}
+
+// target returns the name which the data of the DMap is stored under.
+func (dm *DMap) target() string {
+	return dm.db.aliases.resolve(dm.name)
+}
+
+func (db *Olric) setAliasOnMembers(name, target string) error {
+	return db.fanout(db.discovery.GetMembers(), func(member discovery.Member) error {
+		addr := member.String()
+		req := &protocol.Message{
+			DMap:  name,
+			Value: []byte(target),
+		}
+		_, err := db.requestTo(addr, protocol.OpRenameDMap, req)
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to point DMap: %s to %s on %s: %v",
+				name, target, addr, err)
+		}
+		return err
+	})
+}
+
+// setPausedOnMember pauses or resumes the writes on the stored names on a member.
+// It returns the names which the member acknowledged.
+func (db *Olric) setPausedOnMember(addr string, names []string, paused bool) ([]string, error) {
+	value := []byte{0}
+	if paused {
+		value[0] = 1
+	}
+	var acked []string
+	for _, name := range names {
+		req := &protocol.Message{
+			DMap:  name,
+			Value: value,
+		}
+		_, err := db.requestTo(addr, protocol.OpPauseDMapWrites, req)
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to set paused state of writes on DMap: %s on %s: %v",
+				name, addr, err)
+			return acked, err
+		}
+		acked = append(acked, name)
+	}
+	return acked, nil
+}
+
+// pauseOnMembers pauses the writes on the stored names on all the members. It
+// returns the names which are paused on every member, even if it fails.
+func (db *Olric) pauseOnMembers(names []string) (map[string][]string, error) {
+	var mtx sync.Mutex
+	paused := make(map[string][]string)
+	err := db.fanout(db.discovery.GetMembers(), func(member discovery.Member) error {
+		addr := member.String()
+		acked, err := db.setPausedOnMember(addr, names, true)
+		mtx.Lock()
+		paused[addr] = acked
+		mtx.Unlock()
+		return err
+	})
+	return paused, err
+}
+
+// resumeOnMembers resumes the writes which are paused by pauseOnMembers. The
+// pauses are counted, the other members are not touched not to lift the pause
+// of a concurrent rename.
+func (db *Olric) resumeOnMembers(paused map[string][]string) error {
+	var members []discovery.Member
+	for _, member := range db.discovery.GetMembers() {
+		if len(paused[member.String()]) != 0 {
+			members = append(members, member)
+		}
+	}
+	return db.fanout(members, func(member discovery.Member) error {
+		addr := member.String()
+		_, err := db.setPausedOnMember(addr, paused[addr], false)
+		return err
+	})
+}
+
+// RenameDMap points newName to the data of oldName on all the members. The
+// previous data of newName is destroyed if no other name refers to it. oldName
+// still refers to the same data, a DMap which is used by both names is shared.
+//
+// The rename is done in two phases. First, the writes on the data of both names
+// are paused on all the members and they fail with ErrWritesPaused. Then newName
+// is switched on all the members and the writes are resumed. No write is lost
+// or applied to the previous data after the switch has started. The reads are
+// not paused, a Get may return the previous data of newName until RenameDMap
+// returns. If a member fails in any phase, the others are rolled back and the
+// error is returned.
+//
+// The renames are kept in memory, a member which joins the cluster later fetches
+// them from the coordinator. Use a fresh name for every new dataset and rename
+// it to the name which is used by the readers:
+//
+//	// Populate "users-v2", then
+//	err := db.RenameDMap("users-v2", "users")
+//
+// It returns ErrDMapReferenced if another name refers to the data of newName.
+func (db *Olric) RenameDMap(oldName, newName string) error {
+	if err := db.checkOperationStatus(); err != nil {
+		return err
+	}
+	target := db.aliases.resolve(oldName)
+	previous := db.aliases.resolve(newName)
+	if target == previous {
+		return nil
+	}
+	if previous == newName && db.aliases.isReferenced(newName) {
+		return ErrDMapReferenced
+	}
+
+	// Prepare: the writes on newName go to either of them until all the
+	// members are switched.
+	paused, err := db.pauseOnMembers([]string{previous, target})
+	if err != nil {
+		if rerr := db.resumeOnMembers(paused); rerr != nil {
+			db.log.V(2).Printf("[ERROR] Failed to resume writes on DMap: %s: %v", newName, rerr)
+		}
+		return err
+	}
+
+	// Commit: the members have to agree on the data of newName.
+	err = db.setAliasOnMembers(newName, target)
+	if err != nil {
+		if rerr := db.setAliasOnMembers(newName, previous); rerr != nil {
+			db.log.V(2).Printf("[ERROR] Failed to roll back the rename of DMap: %s: %v", newName, rerr)
+		}
+	}
+	if rerr := db.resumeOnMembers(paused); rerr != nil {
+		db.log.V(2).Printf("[ERROR] Failed to resume writes on DMap: %s: %v", newName, rerr)
+		if err == nil {
+			err = rerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// The previous data is not reachable by any name anymore.
+	if db.aliases.resolve(previous) != previous && !db.aliases.isReferenced(previous) {
+		return db.destroyDMap(previous)
+	}
+	return nil
+}
+
+func (db *Olric) renameDMapOperation(req *protocol.Message) *protocol.Message {
+	db.aliases.set(req.DMap, string(req.Value))
+	return req.Success()
+}
+
+func (db *Olric) pauseDMapWritesOperation(req *protocol.Message) *protocol.Message {
+	if len(req.Value) == 1 && req.Value[0] == 1 {
+		db.aliases.pause(req.DMap)
+	} else {
+		db.aliases.resume(req.DMap)
+	}
+	return req.Success()
+}
+
+func (db *Olric) getAliasesOperation(req *protocol.Message) *protocol.Message {
+	data, err := msgpack.Marshal(db.aliases.snapshot())
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = data
+	return resp
+}
+
+// fetchAliases loads the renamed DMaps from the coordinator.
+func (db *Olric) fetchAliases(coordinator discovery.Member) error {
+	resp, err := db.requestTo(coordinator.String(), protocol.OpGetAliases, &protocol.Message{})
+	if err != nil {
+		return err
+	}
+	m := make(map[string]string)
+	if err = msgpack.Unmarshal(resp.Value, &m); err != nil {
+		return err
+	}
+	db.aliases.load(m)
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+func TestDMap_RenameDMap(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	live, err := db1.NewDMap("users")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	staging, err := db1.NewDMap("users-v2")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = live.Put(bkey(i), "old")
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		err = staging.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	err = db1.RenameDMap("users-v2", "users")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm2, err := db2.NewDMap("users")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		value, err := dm2.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), bval(i)) {
+			t.Fatalf("Expected value: %s. Got: %v", bval(i), value)
+		}
+	}
+
+	// Requests over the network are resolved too.
+	resp, err := db1.requestTo(db2.this.String(), protocol.OpGet, &protocol.Message{
+		DMap: "users",
+		Key:  bkey(0),
+	})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	value, err := db1.unmarshalValue(resp.Value)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(value.([]byte), bval(0)) {
+		t.Fatalf("Expected value: %s. Got: %v", bval(0), value)
+	}
+
+	// The previous data of "users" is destroyed.
+	for _, db := range []*Olric{db1, db2} {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			if _, ok := db.partitions[partID].m.Load("users"); ok {
+				t.Fatalf("Expected the previous data to be destroyed on %s", db.this)
+			}
+		}
+	}
+
+	// The data of "users-v2" is referenced by "users".
+	err = db1.RenameDMap("foobar", "users-v2")
+	if err != ErrDMapReferenced {
+		t.Fatalf("Expected ErrDMapReferenced. Got: %v", err)
+	}
+
+	// A new member fetches the aliases from the coordinator.
+	db3, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if target := db3.aliases.resolve("users"); target != "users-v2" {
+		t.Fatalf("Expected users-v2. Got: %s", target)
+	}
+}
+
+func TestDMap_RenameDMapPausesWrites(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	live, err := db2.NewDMap("users")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	staging, err := db2.NewDMap("users-v2")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// Prepare phase of a rename.
+	paused, err := db1.pauseOnMembers([]string{"users", "users-v2"})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = live.Put(bkey(i), bval(i))
+		if err != ErrWritesPaused {
+			t.Fatalf("Expected ErrWritesPaused. Got: %v", err)
+		}
+		err = staging.Put(bkey(i), bval(i))
+		if err != ErrWritesPaused {
+			t.Fatalf("Expected ErrWritesPaused. Got: %v", err)
+		}
+	}
+	other, err := db2.NewDMap("other")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if err = other.Put(bkey(0), bval(0)); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = db1.resumeOnMembers(paused)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err = staging.Put(bkey(i), bval(i)); err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = db1.RenameDMap("users-v2", "users")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for _, db := range []*Olric{db1, db2} {
+		if db.aliases.isPaused("users") || db.aliases.isPaused("users-v2") {
+			t.Fatalf("Expected the writes to be resumed on %s", db.this)
+		}
+	}
+	if err = live.Put(bkey(100), bval(100)); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	value, err := staging.Get(bkey(100))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(value.([]byte), bval(100)) {
+		t.Fatalf("Expected value: %s. Got: %v", bval(100), value)
+	}
+}
+
+func TestDMap_RenameDMapPauseRollback(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// A concurrent rename holds a pause on db2.
+	db2.aliases.pause("users")
+
+	err = db2.server.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	paused, err := db1.pauseOnMembers([]string{"users", "users-v2"})
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if len(paused[db2.this.String()]) != 0 {
+		t.Fatalf("Expected no acknowledged pause from %s", db2.this)
+	}
+	if len(paused[db1.this.String()]) != 2 {
+		t.Fatalf("Expected both names to be paused on %s. Got: %v", db1.this, paused[db1.this.String()])
+	}
+	if err = db1.resumeOnMembers(paused); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if db1.aliases.isPaused("users") || db1.aliases.isPaused("users-v2") {
+		t.Fatalf("Expected the writes to be resumed on %s", db1.this)
+	}
+
+	err = db1.RenameDMap("users-v2", "users")
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if db1.aliases.isPaused("users") || db1.aliases.isPaused("users-v2") {
+		t.Fatalf("Expected the writes to be resumed on %s", db1.this)
+	}
+	if !db2.aliases.isPaused("users") {
+		t.Fatalf("Expected the pause of the concurrent rename to be kept on %s", db2.this)
+	}
+}
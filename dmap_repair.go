@@ -0,0 +1,97 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// callRepairOnCluster collects the versions of a key on the owners and all the
+// replicas, and propagates the most up-to-date one to the stale versions.
+func (db *Olric) callRepairOnCluster(hkey uint64, name, key string) (int, error) {
+	if err := db.checkDMapAvailable(name); err != nil {
+		return 0, err
+	}
+	dm, err := db.getDMap(name, hkey)
+	if err != nil {
+		return 0, err
+	}
+	dm.RLock()
+	versions, err := db.lookupOnOwners(dm, hkey, name, key, nil)
+	if err != nil {
+		dm.RUnlock()
+		return 0, err
+	}
+	versions = append(versions, db.lookupOnReplicas(dm, hkey, name, key, nil)...)
+	dm.RUnlock()
+
+	sorted := db.sanitizeAndSortVersions(versions)
+	if len(sorted) == 0 {
+		return 0, ErrKeyNotFound
+	}
+	winner := sorted[0]
+	if isKeyExpired(winner.Data.TTL) {
+		return 0, ErrKeyNotFound
+	}
+	if !db.isDiverged(winner, versions) {
+		return 0, nil
+	}
+	// readRepair acquires the DMap's lock, if required.
+	return db.readRepair(name, dm, winner, versions, 0), nil
+}
+
+func (db *Olric) repair(name, key string) (int, error) {
+	member, hkey := db.findPartitionOwner(name, key)
+	// We are on the partition owner
+	if hostCmp(member, db.this) {
+		return db.callRepairOnCluster(hkey, name, key)
+	}
+	// Redirect to the partition owner
+	req := &protocol.Message{
+		DMap: name,
+		Key:  key,
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpRepair, req)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = msgpack.Unmarshal(resp.Value, &count)
+	return count, err
+}
+
+// Repair reconciles the versions of a key on the partition owners and all the
+// replicas, regardless of ReadRepair, and returns the number of updated versions.
+// It's useful to fix a key which is known to have diverged, e.g. after a network
+// partition heals. It returns ErrKeyNotFound if the key doesn't exist anywhere.
+// It's thread-safe.
+func (dm *DMap) Repair(key string) (int, error) {
+	return dm.db.repair(dm.target(), key)
+}
+
+func (db *Olric) repairOperation(req *protocol.Message) *protocol.Message {
+	count, err := db.repair(req.DMap, req.Key)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(count)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -0,0 +1,240 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/skiplist"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
+	"golang.org/x/sync/errgroup"
+)
+
+// loadDMap loads or creates a DMap on the given partition.
+func (db *Olric) loadDMap(part *partition, name string) (*dmap, error) {
+	dm, ok := part.m.Load(name)
+	if ok {
+		return dm.(*dmap), nil
+	}
+	return db.createDMap(part, name, nil)
+}
+
+// newReplacementStorage creates a shadow storage which keeps the new contents
+// of a DMap on a partition. The second return value is true if the storage has
+// more than one table and needs compaction.
+func (db *Olric) newReplacementStorage(dm *dmap, name string, entries map[string][]byte,
+	timestamp int64) (*storage.Storage, bool, error) {
+	var ttl int64
+	if dm.cache != nil && dm.cache.ttlDuration.Seconds() != 0 {
+		ttl = getTTL(dm.cache.ttlDuration)
+	}
+
+	var fragmented bool
+	str := storage.New(db.config.TableSize)
+	for key, value := range entries {
+		err := str.Put(db.getHKey(name, key), &storage.VData{
+			Key:       key,
+			Value:     value,
+			Timestamp: timestamp,
+			TTL:       ttl,
+		})
+		if err == storage.ErrFragmented {
+			fragmented = true
+			err = nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return str, fragmented, nil
+}
+
+// swapStorage replaces the storage of a DMap with the given one. The readers
+// see either the previous or the new contents. The swap is logged as a drop
+// of the DMap followed by the new entries.
+func (db *Olric) swapStorage(dm *dmap, name string, str *storage.Storage, fragmented bool) error {
+	dm.Lock()
+	defer dm.Unlock()
+
+	if err := dm.wal.drop(name); err != nil {
+		return err
+	}
+	var err error
+	str.Range(func(hkey uint64, vdata *storage.VData) bool {
+		err = dm.wal.put(name, vdata)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dm.storage = str
+	if dm.index != nil {
+		dm.index = skiplist.New()
+		str.Range(func(hkey uint64, vdata *storage.VData) bool {
+			dm.index.Insert(db.normalizeKey(vdata.Key), hkey)
+			return true
+		})
+	}
+	if dm.cache != nil && dm.cache.accessLog != nil {
+		now := time.Now().UnixNano()
+		dm.cache.Lock()
+		dm.cache.accessLog = make(map[uint64]int64)
+		str.Range(func(hkey uint64, _ *storage.VData) bool {
+			dm.cache.accessLog[hkey] = now
+			return true
+		})
+		dm.cache.Unlock()
+	}
+	if fragmented {
+		db.wg.Add(1)
+		go db.compactTables(dm)
+	}
+	return nil
+}
+
+func (db *Olric) replacePartition(name string, partID uint64, entries map[string][]byte, timestamp int64) error {
+	value, err := msgpack.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	req := &protocol.Message{
+		DMap:  name,
+		Value: value,
+		Extra: protocol.ReplaceExtra{
+			PartID:    partID,
+			Timestamp: timestamp,
+		},
+	}
+
+	owner := db.partitions[partID].owner()
+	if !hostCmp(owner, db.this) {
+		// Redirect to the partition owner
+		_, err = db.requestTo(owner.String(), protocol.OpReplace, req)
+		return err
+	}
+
+	if err = db.checkWritable(name); err != nil {
+		return err
+	}
+	dm, err := db.loadDMap(db.partitions[partID], name)
+	if err != nil {
+		return err
+	}
+	str, fragmented, err := db.newReplacementStorage(dm, name, entries, timestamp)
+	if err != nil {
+		return err
+	}
+
+	// Quorum based replication. The backups are replaced before the owner,
+	// like the other write operations.
+	var successful int
+	for _, backup := range db.dmapBackupOwners(name, db.backups[partID].loadOwners()) {
+		_, err := db.requestTo(backup.String(), protocol.OpReplaceReplica, req)
+		if err != nil {
+			if db.log.V(3).Ok() {
+				db.log.V(3).Printf("[ERROR] Failed to replace DMap: %s on PartID: %d on %s: %v",
+					name, partID, backup, err)
+			}
+			continue
+		}
+		successful++
+	}
+	if err = db.swapStorage(dm, name, str, fragmented); err != nil {
+		return err
+	}
+	successful++
+	if successful < db.capQuorum(name, db.config.WriteQuorum) {
+		return ErrWriteQuorum
+	}
+	return nil
+}
+
+func (db *Olric) replaceAll(name string, entries map[string]interface{}) error {
+	// Every partition is replaced, including the ones without a new key.
+	parts := make(map[uint64]map[string][]byte)
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		parts[partID] = make(map[string][]byte)
+	}
+	for key, value := range entries {
+		val, err := db.serializer.Marshal(value)
+		if err != nil {
+			return err
+		}
+		partID := db.getPartitionID(db.getHKey(name, key))
+		parts[partID][key] = val
+	}
+
+	timestamp := time.Now().UnixNano()
+	var g errgroup.Group
+	for partID, items := range parts {
+		id, data := partID, items
+		g.Go(func() error {
+			return db.replacePartition(name, id, data, timestamp)
+		})
+	}
+	return g.Wait()
+}
+
+// ReplaceAll replaces the whole contents of the DMap with the given entries. The
+// keys which are not in entries are deleted. The new contents are loaded into
+// a shadow storage on every partition, including the backups, and swapped in.
+//
+// The swap is atomic per partition, not globally: a reader may see the new
+// contents on a partition and the previous ones on another while ReplaceAll is
+// in progress. If it returns an error, some of the partitions may have been
+// replaced. Call it again to complete the replacement. It's thread-safe.
+func (dm *DMap) ReplaceAll(entries map[string]interface{}) error {
+	return dm.db.replaceAll(dm.target(), entries)
+}
+
+func (db *Olric) replaceOperation(req *protocol.Message) *protocol.Message {
+	extra := req.Extra.(protocol.ReplaceExtra)
+	if extra.PartID >= db.config.PartitionCount {
+		return req.Error(protocol.StatusBadRequest, fmt.Sprintf("invalid partID: %d", extra.PartID))
+	}
+	entries := make(map[string][]byte)
+	err := msgpack.Unmarshal(req.Value, &entries)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	err = db.replacePartition(req.DMap, extra.PartID, entries, extra.Timestamp)
+	return db.prepareResponse(req, err)
+}
+
+func (db *Olric) replaceReplicaOperation(req *protocol.Message) *protocol.Message {
+	extra := req.Extra.(protocol.ReplaceExtra)
+	if extra.PartID >= db.config.PartitionCount {
+		return req.Error(protocol.StatusBadRequest, fmt.Sprintf("invalid partID: %d", extra.PartID))
+	}
+	entries := make(map[string][]byte)
+	err := msgpack.Unmarshal(req.Value, &entries)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	dm, err := db.loadDMap(db.backups[extra.PartID], req.DMap)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	str, fragmented, err := db.newReplacementStorage(dm, req.DMap, entries, extra.Timestamp)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	err = db.swapStorage(dm, req.DMap, str, fragmented)
+	return db.prepareResponse(req, err)
+}
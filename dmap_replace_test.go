@@ -0,0 +1,131 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestDMap_ReplaceAll(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	entries := make(map[string]interface{})
+	for i := 50; i < 150; i++ {
+		entries[bkey(i)] = []byte("new")
+	}
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm2.ReplaceAll(entries)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		_, err = dm1.Get(bkey(i))
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+	}
+	for i := 50; i < 150; i++ {
+		value, err := dm1.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), []byte("new")) {
+			t.Fatalf("Expected the new value. Got: %s", string(value.([]byte)))
+		}
+	}
+
+	// The swap should be replicated to the backups.
+	for _, db := range []*Olric{db1, db2} {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			for _, part := range []*partition{db.partitions[partID], db.backups[partID]} {
+				tmp, ok := part.m.Load("mymap")
+				if !ok {
+					continue
+				}
+				d := tmp.(*dmap)
+				d.RLock()
+				d.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+					if _, ok := entries[vdata.Key]; !ok {
+						t.Errorf("Expected %s to be deleted (backup: %v)", vdata.Key, part.backup)
+					}
+					return true
+				})
+				d.RUnlock()
+			}
+		}
+	}
+}
+
+func TestDMap_ReplaceInvalidPartID(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	value, err := msgpack.Marshal(map[string][]byte{"mykey": []byte("myvalue")})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for _, op := range []protocol.OpCode{protocol.OpReplace, protocol.OpReplaceReplica} {
+		req := &protocol.Message{
+			DMap:  "mymap",
+			Value: value,
+			Extra: protocol.ReplaceExtra{
+				PartID: db.config.PartitionCount,
+			},
+		}
+		resp, err := db.client.RequestTo(db.this.String(), op, req)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if resp.Status != protocol.StatusBadRequest {
+			t.Fatalf("Expected StatusBadRequest for %s. Got: %d", op, resp.Status)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/buraksezer/olric/internal/discovery"
+)
+
+// errReplicaCountMismatch is returned by a joining member if the per-DMap
+// replica counts of the coordinator are different from its own.
+var errReplicaCountMismatch = errors.New("per-DMap replica counts are different from the coordinator")
+
+// replicaCount returns the replica count of the DMap. DMapCacheConfig.ReplicaCount
+// overrides the global one.
+func (db *Olric) replicaCount(name string) int {
+	if db.config.Cache != nil {
+		if dc, ok := db.config.Cache.DMapConfigs[name]; ok && dc.ReplicaCount > 0 {
+			return dc.ReplicaCount
+		}
+	}
+	return db.config.ReplicaCount
+}
+
+// capQuorum caps the configured quorum by the replica count of the DMap. There
+// are fewer copies of a DMap with a smaller replica count.
+func (db *Olric) capQuorum(name string, configured int) int {
+	if rc := db.replicaCount(name); configured > rc {
+		return rc
+	}
+	return configured
+}
+
+// dmapBackupOwners returns the backup owners of a partition which keep the
+// copies of the DMap. The list of a backup partition keeps the previous owners
+// which still have data, and the current ReplicaCount-1 owners at the end. A
+// DMap with a smaller replica count uses the first ones of the current owners.
+func (db *Olric) dmapBackupOwners(name string, backups []discovery.Member) []discovery.Member {
+	n := db.replicaCount(name) - 1
+	current := db.config.ReplicaCount - 1
+	if n >= current {
+		return backups
+	}
+	if len(backups) > current {
+		backups = backups[len(backups)-current:]
+	}
+	if len(backups) > n {
+		return backups[:n]
+	}
+	return backups
+}
+
+// hasFewerReplicas returns true if the DMap has a replica count smaller than
+// the global one.
+func (db *Olric) hasFewerReplicas(name string) bool {
+	return db.replicaCount(name) < db.config.ReplicaCount
+}
+
+// getDMapBackupOwners returns the backup owners of the DMap for the given hkey.
+func (db *Olric) getDMapBackupOwners(name string, hkey uint64) []discovery.Member {
+	return db.dmapBackupOwners(name, db.getBackupPartitionOwners(hkey))
+}
+
+// replicaChecksum returns a checksum of the per-DMap replica counts. The members
+// of a cluster have to agree on them.
+func (db *Olric) replicaChecksum() uint64 {
+	if db.config.Cache == nil {
+		return 0
+	}
+	var pairs []string
+	for name, dc := range db.config.Cache.DMapConfigs {
+		if dc.ReplicaCount > 0 && dc.ReplicaCount != db.config.ReplicaCount {
+			pairs = append(pairs, fmt.Sprintf("%s=%d", name, dc.ReplicaCount))
+		}
+	}
+	if len(pairs) == 0 {
+		return 0
+	}
+	sort.Strings(pairs)
+	return db.hasher.Sum64([]byte(strings.Join(pairs, "\n")))
+}
@@ -0,0 +1,213 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestDMap_ReplicaCountOverride(t *testing.T) {
+	newConfig := func() *config.Config {
+		c := testConfig(nil)
+		c.ReplicaCount = 3
+		c.WriteQuorum = 3
+		c.ReadQuorum = 3
+		// The operations are counted only if the metrics are enabled.
+		c.MetricsAddr = "127.0.0.1:0"
+		c.Cache = &config.CacheConfig{
+			DMapConfigs: map[string]config.DMapCacheConfig{
+				"sessions": {ReplicaCount: 1},
+			},
+		}
+		return c
+	}
+
+	var dbs []*Olric
+	for i := 0; i < 3; i++ {
+		db, err := newDB(newConfig(), dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	for _, name := range []string{"sessions", "users"} {
+		dm, err := dbs[0].NewDMap(name)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		// The quorums are capped by the replica count of the DMap.
+		for i := 0; i < 10; i++ {
+			err = dm.Put(bkey(i), bval(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v for %s", err, name)
+			}
+			value, err := dm.Get(bkey(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v for %s", err, name)
+			}
+			if !bytes.Equal(value.([]byte), bval(i)) {
+				t.Fatalf("Value is different for key: %s", bkey(i))
+			}
+		}
+	}
+
+	countBackups := func(name string) int {
+		var count int
+		for _, db := range dbs {
+			for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+				tmp, ok := db.backups[partID].m.Load(name)
+				if !ok {
+					continue
+				}
+				dm := tmp.(*dmap)
+				dm.RLock()
+				count += dm.storage.Len()
+				dm.RUnlock()
+			}
+		}
+		return count
+	}
+	if count := countBackups("sessions"); count != 0 {
+		t.Fatalf("Expected no backups for sessions. Got: %d", count)
+	}
+	if count := countBackups("users"); count != 20 {
+		t.Fatalf("Expected 20 backups for users. Got: %d", count)
+	}
+
+	// The deletes are sent only to the backup owners of the DMap.
+	for _, name := range []string{"sessions", "users"} {
+		dm, err := dbs[0].NewDMap(name)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			err = dm.Delete(bkey(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v for %s", err, name)
+			}
+		}
+	}
+	deleteBackups := func(name string) uint64 {
+		var total uint64
+		for _, db := range dbs {
+			c, _ := db.metrics.load(name, protocol.OpDeleteBackup)
+			total += atomic.LoadUint64(&c.total)
+		}
+		return total
+	}
+	if n := deleteBackups("sessions"); n != 0 {
+		t.Fatalf("Expected no backup deletes for sessions. Got: %d", n)
+	}
+	if n := deleteBackups("users"); n != 20 {
+		t.Fatalf("Expected 20 backup deletes for users. Got: %d", n)
+	}
+	if count := countBackups("users"); count != 0 {
+		t.Fatalf("Expected no backups for users. Got: %d", count)
+	}
+
+	// The members have to agree on the per-DMap replica counts.
+	c := newConfig()
+	c.Cache.DMapConfigs["sessions"] = config.DMapCacheConfig{ReplicaCount: 2}
+	other := &Olric{config: c, hasher: dbs[0].hasher}
+	if other.replicaChecksum() == dbs[0].replicaChecksum() {
+		t.Fatalf("Expected different checksums")
+	}
+
+	c.Cache.DMapConfigs["sessions"] = config.DMapCacheConfig{ReplicaCount: 4}
+	_, err := New(c)
+	if err == nil || !strings.Contains(err.Error(), "greater than the global ReplicaCount") {
+		t.Fatalf("Expected an error for a ReplicaCount greater than the global one. Got: %v", err)
+	}
+}
+
+func TestDMap_BackupOwnersWithPreviousOwners(t *testing.T) {
+	c := testConfig(nil)
+	c.ReplicaCount = 3
+	c.Cache = &config.CacheConfig{
+		DMapConfigs: map[string]config.DMapCacheConfig{
+			"sessions": {ReplicaCount: 2},
+		},
+	}
+	db := &Olric{config: c}
+
+	// The previous owners which still have data come first.
+	backups := []discovery.Member{{Name: "previous"}, {Name: "first"}, {Name: "second"}}
+	owners := db.dmapBackupOwners("users", backups)
+	if len(owners) != 3 {
+		t.Fatalf("Expected all the backup owners. Got: %v", owners)
+	}
+	owners = db.dmapBackupOwners("sessions", backups)
+	if len(owners) != 1 || owners[0].Name != "first" {
+		t.Fatalf("Expected the first current backup owner. Got: %v", owners)
+	}
+}
+
+func TestDMap_UpdateRoutingLegacyExtra(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	table, err := db1.distributePartitions()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	data, err := msgpack.Marshal(table)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// The older coordinators send UpdateRoutingExtra without ReplicaChecksum.
+	type legacyUpdateRoutingExtra struct {
+		CoordinatorID uint64
+	}
+	req := &protocol.Message{
+		Value: data,
+		Extra: legacyUpdateRoutingExtra{
+			CoordinatorID: db1.this.ID,
+		},
+	}
+	_, err = db1.requestTo(db2.this.String(), protocol.OpUpdateRouting, req)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+}
@@ -0,0 +1,465 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+const (
+	// changeQueueSize is the maximum number of events waiting on a member for
+	// a subscriber. The events are dropped if the subscriber is too slow.
+	changeQueueSize = 1024
+
+	// changeBatchSize is the maximum number of events returned by a poll.
+	changeBatchSize = 256
+
+	// changePollTimeout is the maximum duration a poll waits for an event.
+	changePollTimeout = 500 * time.Millisecond
+
+	// changeSubscriptionTimeout is the duration to keep a subscription which
+	// is not polled. The subscriber is assumed to be gone.
+	changeSubscriptionTimeout = 30 * time.Second
+
+	// changeMembersInterval is the interval to subscribe to the new members.
+	changeMembersInterval = time.Second
+)
+
+var errUnknownSubscription = errors.New("unknown subscription")
+
+// ChangeType denotes the type of a mutation on a DMap.
+type ChangeType string
+
+const (
+	// ChangePut is sent after a key is set by any write operation.
+	ChangePut ChangeType = "put"
+
+	// ChangeDelete is sent after a key is deleted by Delete.
+	ChangeDelete ChangeType = "delete"
+
+	// ChangeExpire is sent after the TTL of a key is updated by Expire.
+	ChangeExpire ChangeType = "expire"
+
+	// ChangeLost means that some events have been dropped by a member because
+	// the subscriber is too slow, or the subscription to a member has been
+	// lost and established again.
+	ChangeLost ChangeType = "lost"
+)
+
+// ChangeEvent is sent to the subscribers registered by SubscribeAll.
+type ChangeEvent struct {
+	Type ChangeType
+	Key  string
+
+	// Value is the new value of the key. It's only set on ChangePut.
+	Value interface{}
+
+	// Timestamp of the write in nanoseconds.
+	Timestamp int64
+
+	// Lost is the number of dropped events on ChangeLost. Zero means that
+	// the number is unknown.
+	Lost uint64
+}
+
+// changeRecord is the wire form of a ChangeEvent. The value is kept serialized.
+type changeRecord struct {
+	Type      ChangeType
+	Key       string
+	Value     []byte
+	Timestamp int64
+}
+
+// changeBatch is the response of a poll.
+type changeBatch struct {
+	Records []changeRecord
+	Lost    uint64
+}
+
+type changeSubscription struct {
+	dmap     string
+	queue    chan changeRecord
+	lost     uint64
+	lastPoll int64
+}
+
+// changeFeed keeps the subscriptions to the mutations on the primary partitions
+// owned by this member.
+type changeFeed struct {
+	mtx   sync.RWMutex
+	count int32
+	subs  map[uint64]*changeSubscription
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{
+		subs: make(map[uint64]*changeSubscription),
+	}
+}
+
+// publish queues a record for the subscribers of the DMap without blocking.
+// The caller holds the lock of the DMap, so the records of a key are queued
+// in the order of the writes.
+func (f *changeFeed) publish(name string, rec changeRecord) {
+	if atomic.LoadInt32(&f.count) == 0 {
+		return
+	}
+	f.mtx.RLock()
+	defer f.mtx.RUnlock()
+	for _, sub := range f.subs {
+		if sub.dmap != name {
+			continue
+		}
+		select {
+		case sub.queue <- rec:
+		default:
+			atomic.AddUint64(&sub.lost, 1)
+		}
+	}
+}
+
+// sweep removes the subscriptions which are not polled for a while.
+// The caller must hold the lock.
+func (f *changeFeed) sweep() {
+	deadline := time.Now().Add(-changeSubscriptionTimeout).UnixNano()
+	for id, sub := range f.subs {
+		if atomic.LoadInt64(&sub.lastPoll) < deadline {
+			delete(f.subs, id)
+		}
+	}
+	atomic.StoreInt32(&f.count, int32(len(f.subs)))
+}
+
+func (f *changeFeed) subscribe(name string) uint64 {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.sweep()
+	id := rand.Uint64()
+	for _, ok := f.subs[id]; ok || id == 0; _, ok = f.subs[id] {
+		id = rand.Uint64()
+	}
+	f.subs[id] = &changeSubscription{
+		dmap:     name,
+		queue:    make(chan changeRecord, changeQueueSize),
+		lastPoll: time.Now().UnixNano(),
+	}
+	atomic.StoreInt32(&f.count, int32(len(f.subs)))
+	return id
+}
+
+func (f *changeFeed) unsubscribe(id uint64) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	delete(f.subs, id)
+	atomic.StoreInt32(&f.count, int32(len(f.subs)))
+}
+
+// poll waits for the records of a subscription until changePollTimeout passes.
+func (f *changeFeed) poll(ctx context.Context, id uint64) (*changeBatch, error) {
+	f.mtx.Lock()
+	f.sweep()
+	sub, ok := f.subs[id]
+	f.mtx.Unlock()
+	if !ok {
+		return nil, errUnknownSubscription
+	}
+	atomic.StoreInt64(&sub.lastPoll, time.Now().UnixNano())
+
+	batch := &changeBatch{}
+	timer := time.NewTimer(changePollTimeout)
+	defer timer.Stop()
+	select {
+	case rec := <-sub.queue:
+		batch.Records = append(batch.Records, rec)
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+loop:
+	for len(batch.Records) > 0 && len(batch.Records) < changeBatchSize {
+		select {
+		case rec := <-sub.queue:
+			batch.Records = append(batch.Records, rec)
+		default:
+			break loop
+		}
+	}
+	batch.Lost = atomic.SwapUint64(&sub.lost, 0)
+	atomic.StoreInt64(&sub.lastPoll, time.Now().UnixNano())
+	return batch, nil
+}
+
+// publishChange queues a change on a primary partition owned by this member.
+func (db *Olric) publishChange(name string, typ ChangeType, key string, value []byte, timestamp int64) {
+	db.changes.publish(name, changeRecord{
+		Type:      typ,
+		Key:       key,
+		Value:     value,
+		Timestamp: timestamp,
+	})
+}
+
+func (db *Olric) subscribeOnMember(member discovery.Member, name string) (uint64, error) {
+	if hostCmp(member, db.this) {
+		return db.changes.subscribe(name), nil
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpSubscribeChanges, &protocol.Message{DMap: name})
+	if err != nil {
+		return 0, err
+	}
+	var id uint64
+	err = msgpack.Unmarshal(resp.Value, &id)
+	return id, err
+}
+
+func (db *Olric) unsubscribeOnMember(member discovery.Member, id uint64) {
+	if hostCmp(member, db.this) {
+		db.changes.unsubscribe(id)
+		return
+	}
+	req := &protocol.Message{
+		Extra: protocol.ChangesExtra{SubscriptionID: id},
+	}
+	_, err := db.requestTo(member.String(), protocol.OpUnsubscribeChanges, req)
+	if err != nil {
+		db.log.V(3).Printf("[DEBUG] Failed to unsubscribe from %s: %v", member, err)
+	}
+}
+
+func (db *Olric) pollOnMember(ctx context.Context, member discovery.Member, id uint64) (*changeBatch, error) {
+	if hostCmp(member, db.this) {
+		return db.changes.poll(ctx, id)
+	}
+	req := &protocol.Message{
+		Extra: protocol.ChangesExtra{SubscriptionID: id},
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpPollChanges, req)
+	if err != nil {
+		return nil, err
+	}
+	batch := &changeBatch{}
+	err = msgpack.Unmarshal(resp.Value, batch)
+	return batch, err
+}
+
+// followMember polls the changes on a member and sends them to out. It blocks
+// while out is full, the events are queued on the member in the meantime.
+func (db *Olric) followMember(ctx context.Context, member discovery.Member, name string,
+	id uint64, out chan<- ChangeEvent) {
+	defer db.unsubscribeOnMember(member, id)
+
+	send := func(e ChangeEvent) bool {
+		select {
+		case out <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		batch, err := db.pollOnMember(ctx, member, id)
+		if err != nil {
+			db.log.V(3).Printf("[DEBUG] Failed to poll the changes on %s: %v", member, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(changeMembersInterval):
+			}
+			nid, err := db.subscribeOnMember(member, name)
+			if err != nil {
+				continue
+			}
+			id = nid
+			if !send(ChangeEvent{Type: ChangeLost}) {
+				return
+			}
+			continue
+		}
+
+		if batch.Lost != 0 {
+			if !send(ChangeEvent{Type: ChangeLost, Lost: batch.Lost}) {
+				return
+			}
+		}
+		for _, rec := range batch.Records {
+			e := ChangeEvent{
+				Type:      rec.Type,
+				Key:       rec.Key,
+				Timestamp: rec.Timestamp,
+			}
+			if len(rec.Value) != 0 {
+				e.Value, err = db.unmarshalValue(rec.Value)
+				if err != nil {
+					db.log.V(2).Printf("[ERROR] Failed to unmarshal the value of %s on DMap: %s: %v",
+						rec.Key, name, err)
+					continue
+				}
+			}
+			if !send(e) {
+				return
+			}
+		}
+	}
+}
+
+// followMembers subscribes to the members which join the cluster until ctx is
+// done. It closes out after all the followers quit.
+func (db *Olric) followMembers(ctx context.Context, name string, following map[string]context.CancelFunc,
+	wg *sync.WaitGroup, out chan<- ChangeEvent) {
+	defer func() {
+		for _, cancel := range following {
+			cancel()
+		}
+		wg.Wait()
+		close(out)
+	}()
+
+	ticker := time.NewTicker(changeMembersInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-db.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		members := make(map[string]discovery.Member)
+		for _, member := range db.discovery.GetMembers() {
+			members[member.String()] = member
+		}
+		for addr, cancel := range following {
+			if _, ok := members[addr]; !ok {
+				// It's gone, its partitions are owned by the others now.
+				cancel()
+				delete(following, addr)
+			}
+		}
+		for addr, member := range members {
+			if _, ok := following[addr]; ok {
+				continue
+			}
+			id, err := db.subscribeOnMember(member, name)
+			if err != nil {
+				db.log.V(3).Printf("[DEBUG] Failed to subscribe to the changes on %s: %v", addr, err)
+				continue
+			}
+			fctx, cancel := context.WithCancel(ctx)
+			following[addr] = cancel
+			wg.Add(1)
+			go func(member discovery.Member) {
+				defer wg.Done()
+				db.followMember(fctx, member, name, id, out)
+			}(member)
+		}
+	}
+}
+
+// SubscribeAll returns a stream of the mutations on the DMap. Every member
+// streams the changes on its primary partitions and the streams are merged into
+// the returned channel. The members which join the cluster later are subscribed
+// to transparently. The channel is closed after ctx is done.
+//
+// The events of a key are delivered in the order of the writes as long as its
+// partition owner doesn't change. The events of different keys have no order.
+//
+// A member queues up to 1024 events for a subscriber. If the consumer is too
+// slow, the events are dropped on the member and a ChangeLost event is sent.
+// The keys removed by TTL, MaxIdleDuration or eviction don't produce events.
+func (dm *DMap) SubscribeAll(ctx context.Context) (<-chan ChangeEvent, error) {
+	db := dm.db
+	name := dm.target()
+	if err := db.checkDMapAvailable(name); err != nil {
+		return nil, err
+	}
+
+	following := make(map[string]context.CancelFunc)
+	var wg sync.WaitGroup
+	out := make(chan ChangeEvent)
+
+	// Subscribe to the current members before returning. The changes after
+	// SubscribeAll returns are not missed.
+	for _, member := range db.discovery.GetMembers() {
+		id, err := db.subscribeOnMember(member, name)
+		if err != nil {
+			for _, cancel := range following {
+				cancel()
+			}
+			wg.Wait()
+			return nil, err
+		}
+		fctx, cancel := context.WithCancel(ctx)
+		following[member.String()] = cancel
+		wg.Add(1)
+		go func(member discovery.Member) {
+			defer wg.Done()
+			db.followMember(fctx, member, name, id, out)
+		}(member)
+	}
+
+	db.wg.Add(1)
+	go func() {
+		defer db.wg.Done()
+		db.followMembers(ctx, name, following, &wg, out)
+	}()
+	return out, nil
+}
+
+func (db *Olric) subscribeChangesOperation(req *protocol.Message) *protocol.Message {
+	value, err := msgpack.Marshal(db.changes.subscribe(req.DMap))
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
+
+func (db *Olric) unsubscribeChangesOperation(req *protocol.Message) *protocol.Message {
+	extra := req.Extra.(protocol.ChangesExtra)
+	db.changes.unsubscribe(extra.SubscriptionID)
+	return req.Success()
+}
+
+func (db *Olric) pollChangesOperation(req *protocol.Message) *protocol.Message {
+	extra := req.Extra.(protocol.ChangesExtra)
+	batch, err := db.changes.poll(db.ctx, extra.SubscriptionID)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(batch)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -0,0 +1,140 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDMap_SubscribeAll(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := dm1.SubscribeAll(ctx)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm2.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm2.Expire(bkey(0), time.Hour)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm2.Delete(bkey(1))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	received := make(map[string][]ChangeEvent)
+	timeout := time.After(5 * time.Second)
+	for count := 0; count < 102; count++ {
+		select {
+		case e := <-events:
+			if e.Type == ChangeLost {
+				t.Fatalf("Expected no lost events")
+			}
+			received[e.Key] = append(received[e.Key], e)
+		case <-timeout:
+			t.Fatalf("Expected 102 events. Got: %d", count)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		e := received[bkey(i)]
+		if len(e) == 0 || e[0].Type != ChangePut {
+			t.Fatalf("Expected a put event for %s", bkey(i))
+		}
+		if !bytes.Equal(e[0].Value.([]byte), bval(i)) {
+			t.Fatalf("Expected value: %s. Got: %v", bval(i), e[0].Value)
+		}
+	}
+	// The events of a key are ordered.
+	if e := received[bkey(0)]; len(e) != 2 || e[1].Type != ChangeExpire {
+		t.Fatalf("Expected put and expire events for %s. Got: %v", bkey(0), e)
+	}
+	if e := received[bkey(1)]; len(e) != 2 || e[1].Type != ChangeDelete {
+		t.Fatalf("Expected put and delete events for %s. Got: %v", bkey(1), e)
+	}
+
+	cancel()
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the stream to be closed")
+		}
+	}
+}
+
+func TestDMap_SubscribeAllLost(t *testing.T) {
+	f := newChangeFeed()
+	id := f.subscribe("mymap")
+	for i := 0; i < changeQueueSize+10; i++ {
+		f.publish("mymap", changeRecord{Type: ChangePut, Key: bkey(i)})
+	}
+	// Another DMap
+	f.publish("foobar", changeRecord{Type: ChangePut, Key: bkey(0)})
+
+	batch, err := f.poll(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if batch.Lost != 10 {
+		t.Fatalf("Expected 10 lost events. Got: %d", batch.Lost)
+	}
+	if len(batch.Records) != changeBatchSize {
+		t.Fatalf("Expected %d records. Got: %d", changeBatchSize, len(batch.Records))
+	}
+	if batch.Records[0].Key != bkey(0) {
+		t.Fatalf("Expected key: %s. Got: %s", bkey(0), batch.Records[0].Key)
+	}
+
+	f.unsubscribe(id)
+	_, err = f.poll(context.Background(), id)
+	if err != errUnknownSubscription {
+		t.Fatalf("Expected errUnknownSubscription. Got: %v", err)
+	}
+}
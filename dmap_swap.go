@@ -0,0 +1,116 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+// ErrCrossPartitionSwap is returned by Swap if the keys are owned by different
+// members.
+var ErrCrossPartitionSwap = errors.New("keys are owned by different members")
+
+func (db *Olric) swapKeys(name, keyA, keyB string) error {
+	member, hkeyA := db.findPartitionOwner(name, keyA)
+	memberB, hkeyB := db.findPartitionOwner(name, keyB)
+	if !hostCmp(member, memberB) {
+		return ErrCrossPartitionSwap
+	}
+	if !hostCmp(member, db.this) {
+		// Redirect to the owner of both keys.
+		req := &protocol.Message{
+			DMap:  name,
+			Key:   keyA,
+			Value: []byte(keyB),
+		}
+		_, err := db.requestTo(member.String(), protocol.OpSwap, req)
+		return err
+	}
+
+	if err := db.checkWritable(name); err != nil {
+		return err
+	}
+	dmA, err := db.getDMap(name, hkeyA)
+	if err != nil {
+		return err
+	}
+	dmB, err := db.getDMap(name, hkeyB)
+	if err != nil {
+		return err
+	}
+
+	// The keys may live in different partitions of this member. Lock the DMaps
+	// in the order of the partition IDs to avoid a deadlock with another Swap.
+	first, second := dmA, dmB
+	if db.getPartitionID(hkeyB) < db.getPartitionID(hkeyA) {
+		first, second = dmB, dmA
+	}
+	first.Lock()
+	defer first.Unlock()
+	if second != first {
+		second.Lock()
+		defer second.Unlock()
+	}
+
+	vdataA, err := db.getForCopy(dmA, hkeyA)
+	if err != nil {
+		return err
+	}
+	vdataB, err := db.getForCopy(dmB, hkeyB)
+	if err != nil {
+		return err
+	}
+
+	// The new versions have to win over the current ones on the replicas.
+	timestamp := time.Now().UnixNano()
+	for _, current := range []int64{vdataA.Timestamp, vdataB.Timestamp} {
+		if timestamp <= current {
+			timestamp = current + 1
+		}
+	}
+
+	// The keys keep their own TTLs, only the values are swapped.
+	wA := db.prepareCopyWriteop(name, keyA, &storage.VData{Value: vdataB.Value, TTL: vdataA.TTL})
+	wA.timestamp = timestamp
+	wB := db.prepareCopyWriteop(name, keyB, &storage.VData{Value: vdataA.Value, TTL: vdataB.TTL})
+	wB.timestamp = timestamp
+	if err = db.putOnCluster(hkeyA, dmA, wA); err != nil {
+		return err
+	}
+	return db.putOnCluster(hkeyB, dmB, wB)
+}
+
+// Swap swaps the values of keyA and keyB. The keys keep their TTLs and the
+// timestamps of both are advanced. It returns ErrKeyNotFound if any of the keys
+// doesn't exist.
+//
+// Swap is atomic only if both keys are owned by the same member: the values are
+// read and written under the locks of their partitions, so no other write on
+// the keys interleaves with it. The keys in the same partition are always owned
+// by the same member. Otherwise, it returns ErrCrossPartitionSwap and nothing
+// is changed. If the replication of the second key fails, the first one may
+// have been updated. It's thread-safe.
+func (dm *DMap) Swap(keyA, keyB string) error {
+	return dm.db.swapKeys(dm.target(), keyA, keyB)
+}
+
+func (db *Olric) swapOperation(req *protocol.Message) *protocol.Message {
+	err := db.swapKeys(req.DMap, req.Key, string(req.Value))
+	return db.prepareResponse(req, err)
+}
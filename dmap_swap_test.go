@@ -0,0 +1,117 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDMap_Swap(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	// Find a key on the same member with bkey(0) and one on the other member.
+	owner, _ := db1.findPartitionOwner("mymap", bkey(0))
+	same, other := -1, -1
+	for i := 1; i < 100; i++ {
+		member, _ := db1.findPartitionOwner("mymap", bkey(i))
+		if hostCmp(member, owner) && same == -1 {
+			same = i
+		}
+		if !hostCmp(member, owner) && other == -1 {
+			other = i
+		}
+	}
+	if same == -1 || other == -1 {
+		t.Fatalf("Expected keys on both members")
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	before, err := dm2.GetEntry(bkey(0))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	// One of the members redirects the call to the owner.
+	a, b := 0, same
+	for _, dm := range []*DMap{dm1, dm2} {
+		err = dm.Swap(bkey(0), bkey(same))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		a, b = b, a
+		value, err := dm.Get(bkey(0))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), bval(a)) {
+			t.Fatalf("Expected value: %s. Got: %s", bval(a), value)
+		}
+		value, err = dm.Get(bkey(same))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), bval(b)) {
+			t.Fatalf("Expected value: %s. Got: %s", bval(b), value)
+		}
+	}
+	after, err := dm2.GetEntry(bkey(0))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if after.Version <= before.Version {
+		t.Fatalf("Expected a newer version than %d. Got: %d", before.Version, after.Version)
+	}
+
+	err = dm1.Swap(bkey(0), bkey(other))
+	if err != ErrCrossPartitionSwap {
+		t.Fatalf("Expected ErrCrossPartitionSwap. Got: %v", err)
+	}
+	for i := 100; i < 1000; i++ {
+		member, _ := db1.findPartitionOwner("mymap", bkey(i))
+		if !hostCmp(member, owner) {
+			continue
+		}
+		err = dm2.Swap(bkey(0), bkey(i))
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+		}
+		break
+	}
+}
@@ -15,9 +15,11 @@
 package olric
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -376,3 +378,74 @@ func TestDMap_CrashServer(t *testing.T) {
 		}
 	}
 }
+
+func TestDMap_KeyNormalizer(t *testing.T) {
+	newConfig := func() *config.Config {
+		c := testConfig(nil)
+		c.KeyNormalizer = strings.ToLower
+		return c
+	}
+	db1, err := newDB(newConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := newDB(newConfig(), db1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		for _, db := range []*Olric{db1, db2} {
+			err = db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(db1, db2)
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("Key-%d", i)
+		err = dm1.Put(key, bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		value, err := dm2.Get(strings.ToUpper(key))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), bval(i)) {
+			t.Fatalf("Value is different for key: %s", key)
+		}
+	}
+
+	for _, key := range []string{"Counter", "counter", "COUNTER"} {
+		_, err = dm2.Incr(key, 1)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	value, err := dm1.Get("counter")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value.(int) != 3 {
+		t.Fatalf("Expected 3. Got: %v", value)
+	}
+
+	err = dm2.Delete("key-0")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = dm1.Get("Key-0")
+	if err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+	}
+}
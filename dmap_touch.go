@@ -0,0 +1,120 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+func (db *Olric) callGetAndTouchOnCluster(hkey uint64, name, key string, ttl time.Duration) ([]byte, error) {
+	if err := db.checkWritable(name); err != nil {
+		return nil, err
+	}
+	dm, err := db.getDMap(name, hkey)
+	if err != nil {
+		return nil, err
+	}
+	// Hold the write lock during the whole operation. The key cannot expire
+	// between the read and the touch.
+	dm.Lock()
+	defer dm.Unlock()
+
+	versions, err := db.lookupOnOwners(dm, hkey, name, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	versions = append(versions, db.lookupOnReplicas(dm, hkey, name, key, nil)...)
+	readQuorum := db.capQuorum(name, db.config.ReadQuorum)
+	if len(versions) < readQuorum {
+		return nil, ErrReadQuorum
+	}
+	sorted := db.sanitizeAndSortVersions(versions)
+	if len(sorted) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	if len(sorted) < readQuorum {
+		return nil, ErrReadQuorum
+	}
+	winner := sorted[0]
+	if isKeyExpired(winner.Data.TTL) || dm.isKeyIdle(hkey) {
+		return nil, ErrKeyNotFound
+	}
+
+	// Store the winner with the new TTL. This also updates the access log
+	// and replicates the change to the backups.
+	w := &writeop{
+		opcode:        protocol.OpPut,
+		replicaOpcode: protocol.OpPutReplica,
+		dmap:          name,
+		key:           key,
+		value:         winner.Data.Value,
+		timestamp:     time.Now().UnixNano(),
+		timeout:       ttl,
+	}
+	if ttl != 0 {
+		w.opcode = protocol.OpPutEx
+		w.replicaOpcode = protocol.OpPutExReplica
+	}
+	if err = db.putOnCluster(hkey, dm, w); err != nil {
+		return nil, err
+	}
+	return winner.Data.Value, nil
+}
+
+func (db *Olric) getAndTouch(name, key string, ttl time.Duration) ([]byte, error) {
+	member, hkey := db.findPartitionOwner(name, key)
+	// We are on the partition owner
+	if hostCmp(member, db.this) {
+		return db.callGetAndTouchOnCluster(hkey, name, key, ttl)
+	}
+	// Redirect to the partition owner
+	req := &protocol.Message{
+		DMap: name,
+		Key:  key,
+		Extra: protocol.GetAndTouchExtra{
+			TTL: ttl.Nanoseconds(),
+		},
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpGetAndTouch, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Value, nil
+}
+
+// GetAndTouch gets the value for the given key and resets its TTL atomically.
+// Zero TTL removes the expiry. It also refreshes the last access time of the
+// key for MaxIdleDuration. It returns ErrKeyNotFound if the DB does not
+// contain the key. It's thread-safe.
+func (dm *DMap) GetAndTouch(key string, ttl time.Duration) (interface{}, error) {
+	rawval, err := dm.db.getAndTouch(dm.target(), key, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return dm.db.unmarshalValue(rawval)
+}
+
+func (db *Olric) getAndTouchOperation(req *protocol.Message) *protocol.Message {
+	ttl := time.Duration(req.Extra.(protocol.GetAndTouchExtra).TTL)
+	value, err := db.getAndTouch(req.DMap, req.Key, ttl)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -0,0 +1,95 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+func TestDMap_GetAndTouch(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm1.PutEx(bkey(i), bval(i), 100*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		val, err := dm2.GetAndTouch(bkey(i), time.Hour)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(val.([]byte), bval(i)) {
+			t.Fatalf("Expected the same value. Got: %s", string(val.([]byte)))
+		}
+	}
+
+	<-time.After(200 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		_, err := dm1.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	// The new TTL should be replicated to the backups.
+	for _, db := range []*Olric{db1, db2} {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			tmp, ok := db.backups[partID].m.Load("mymap")
+			if !ok {
+				continue
+			}
+			d := tmp.(*dmap)
+			d.RLock()
+			d.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+				if isKeyExpired(vdata.TTL) {
+					t.Errorf("Expected the backup of %s to be touched", vdata.Key)
+				}
+				return true
+			})
+			d.RUnlock()
+		}
+	}
+
+	_, err = dm2.GetAndTouch("absent", time.Hour)
+	if err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+	}
+}
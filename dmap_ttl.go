@@ -0,0 +1,78 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// NoTTL is returned by GetTTL if the key never expires.
+const NoTTL time.Duration = -1
+
+func (db *Olric) callGetTTLOnCluster(hkey uint64, name, key string) (time.Duration, error) {
+	vdata, err := db.lookupLatestVersion(hkey, name, key)
+	if err != nil {
+		return 0, err
+	}
+	if vdata.TTL == 0 {
+		return NoTTL, nil
+	}
+	return getTimeout(vdata.TTL), nil
+}
+
+func (db *Olric) getRemainingTTL(name, key string) (time.Duration, error) {
+	member, hkey := db.findPartitionOwner(name, key)
+	// We are on the partition owner
+	if hostCmp(member, db.this) {
+		return db.callGetTTLOnCluster(hkey, name, key)
+	}
+	// Redirect to the partition owner
+	req := &protocol.Message{
+		DMap: name,
+		Key:  key,
+	}
+	resp, err := db.requestWithRetry(member.String(), protocol.OpGetTTL, req)
+	if err != nil {
+		return 0, err
+	}
+	var ttl time.Duration
+	err = msgpack.Unmarshal(resp.Value, &ttl)
+	return ttl, err
+}
+
+// GetTTL returns the remaining time to live of the given key without fetching
+// its value. It honors ReadQuorum like Get. It returns NoTTL if the key never
+// expires and ErrKeyNotFound if the key doesn't exist or it's already expired.
+// It's thread-safe.
+func (dm *DMap) GetTTL(key string) (time.Duration, error) {
+	return dm.db.getRemainingTTL(dm.target(), key)
+}
+
+func (db *Olric) getTTLOperation(req *protocol.Message) *protocol.Message {
+	ttl, err := db.getRemainingTTL(req.DMap, req.Key)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	value, err := msgpack.Marshal(ttl)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
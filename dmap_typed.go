@@ -0,0 +1,101 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package olric
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTypeMismatch is returned by TypedDMap if a stored value cannot be decoded
+// into the type of the TypedDMap.
+var ErrTypeMismatch = errors.New("value cannot be asserted to the type")
+
+// TypedDMap is a type-safe wrapper around DMap. The values are stored with
+// the configured serializer as usual and decoded into T, so the serializers
+// which don't keep the type information, e.g. JSON, return T as well.
+type TypedDMap[T any] struct {
+	dm *DMap
+}
+
+// NewTypedDMap returns a TypedDMap which wraps the given DMap.
+func NewTypedDMap[T any](dm *DMap) *TypedDMap[T] {
+	return &TypedDMap[T]{dm: dm}
+}
+
+// DMap returns the underlying DMap.
+func (t *TypedDMap[T]) DMap() *DMap {
+	return t.dm
+}
+
+// decode decodes a stored value into T. The gob serializer stores the values
+// as interfaces, they cannot be decoded into a concrete type. The value is
+// decoded into an interface and asserted to T if the first attempt fails.
+func (t *TypedDMap[T]) decode(key string, rawval []byte) (T, error) {
+	var res T
+	if err := t.dm.db.unmarshal(rawval, &res); err == nil {
+		return res, nil
+	}
+	value, err := t.dm.db.unmarshalValue(rawval)
+	if err != nil {
+		return res, err
+	}
+	if value == nil {
+		return res, nil
+	}
+	res, ok := value.(T)
+	if !ok {
+		return res, errors.Wrapf(ErrTypeMismatch, "key: %s, type: %T, expected: %T", key, value, res)
+	}
+	return res, nil
+}
+
+// Get gets the value for the given key. It returns ErrKeyNotFound if the DB
+// does not contain the key and ErrTypeMismatch if the value cannot be decoded
+// into T. Like DMap.Get, it may return a result along with ErrDegradedRead.
+// It's thread-safe.
+func (t *TypedDMap[T]) Get(key string) (T, error) {
+	name := t.dm.target()
+	rawval, err := t.dm.db.get(name, key)
+	if err != nil {
+		res, derr := t.dm.db.degradedGet(name, key, err)
+		if derr != nil {
+			var zero T
+			return zero, derr
+		}
+		rawval, err = res.Value, ErrDegradedRead
+	}
+	res, derr := t.decode(key, rawval)
+	if derr != nil {
+		return res, derr
+	}
+	return res, err
+}
+
+// Put sets the value for the given key. It overwrites any previous value
+// for that key. It's thread-safe.
+func (t *TypedDMap[T]) Put(key string, value T) error {
+	return t.dm.Put(key, value)
+}
+
+// PutEx sets the value for the given key with TTL. It overwrites any previous
+// value for that key. It's thread-safe.
+func (t *TypedDMap[T]) PutEx(key string, value T, timeout time.Duration) error {
+	return t.dm.PutEx(key, value, timeout)
+}
@@ -0,0 +1,105 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package olric
+
+import (
+	"context"
+	"testing"
+
+	"github.com/buraksezer/olric/serializer"
+	"github.com/pkg/errors"
+)
+
+type typedValue struct {
+	Name  string
+	Count int
+}
+
+func TestTypedDMap(t *testing.T) {
+	serializers := map[string]serializer.Serializer{
+		"gob":     serializer.NewGobSerializer(),
+		"msgpack": serializer.NewMsgpackSerializer(),
+		"json":    serializer.NewJSONSerializer(),
+	}
+	for name, s := range serializers {
+		t.Run(name, func(t *testing.T) {
+			testTypedDMap(t, s)
+		})
+	}
+}
+
+func testTypedDMap(t *testing.T, s serializer.Serializer) {
+	c := testSingleReplicaConfig()
+	c.Serializer = s
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	tdm := NewTypedDMap[typedValue](dm)
+	expected := typedValue{Name: "foobar", Count: 10}
+	err = tdm.Put("mykey", expected)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	value, err := tdm.Get("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value != expected {
+		t.Fatalf("Expected %v. Got: %v", expected, value)
+	}
+
+	// The numbers are decoded into T, not into the default types of the serializer.
+	counter := NewTypedDMap[int64](dm)
+	err = counter.Put("counter", 42)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	count, err := counter.Get("counter")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if count != 42 {
+		t.Fatalf("Expected 42. Got: %v", count)
+	}
+
+	_, err = tdm.Get("absent")
+	if err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+	}
+
+	err = dm.Put("string", "value")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = tdm.Get("string")
+	if errors.Cause(err) != ErrTypeMismatch {
+		t.Fatalf("Expected ErrTypeMismatch. Got: %v", err)
+	}
+}
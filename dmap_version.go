@@ -0,0 +1,104 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/storage"
+)
+
+// errVersionMismatch is returned by the partition owner if the stored version
+// differs from the expected one. PutIfVersion reports it as false.
+var errVersionMismatch = errors.New("version mismatch")
+
+// Entry is a value with its version. See DMap.GetEntry.
+type Entry struct {
+	Value interface{}
+
+	// Version is the timestamp of the last write of the key in nanoseconds.
+	// It's zero if the partition owner doesn't report it.
+	Version int64
+
+	// LastAccess is the time of the previous access on the key, before GetEntry.
+	// It's the zero time if the access log is not maintained. See DMap.LastAccess.
+	LastAccess time.Time
+}
+
+// checkVersion returns errVersionMismatch unless the stored version of the key
+// is the expected one. A missing key has version zero. The caller must hold the
+// DMap's lock.
+func (db *Olric) checkVersion(hkey uint64, dm *dmap, w *writeop) error {
+	var current int64
+	vdata, err := dm.storage.Get(hkey)
+	if err == nil && !isKeyExpired(vdata.TTL) {
+		current = vdata.Timestamp
+	}
+	if err != nil && err != storage.ErrKeyNotFound {
+		return err
+	}
+	if current != w.version {
+		return errVersionMismatch
+	}
+	if w.timestamp <= current {
+		// The new version has to win over the current one on the replicas.
+		w.timestamp = current + 1
+	}
+	return nil
+}
+
+// GetEntry gets the value for the given key with its version. The version is
+// passed to PutIfVersion for a read-modify-write cycle. It returns ErrKeyNotFound
+// if the DB does not contains the key. It's thread-safe.
+func (dm *DMap) GetEntry(key string) (*Entry, error) {
+	res, err := dm.db.getWithOptions(dm.target(), key, &ReadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	value, err := dm.db.unmarshalValue(res.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{
+		Value:      value,
+		Version:    res.Timestamp,
+		LastAccess: unixNanoTime(res.LastAccess),
+	}, nil
+}
+
+// PutIfVersion sets the value for the given key only if the version of the key
+// on the partition owner is still the given one. Use zero to set the key only if
+// it doesn't exist. It returns false, without an error, if the version has
+// changed. The comparison and the write are done under the lock of the DMap on
+// the partition owner. The new version is greater than the previous one. It's
+// thread-safe.
+func (dm *DMap) PutIfVersion(key string, value interface{}, version int64) (bool, error) {
+	w, err := dm.db.prepareWriteop(protocol.OpPutIfVersion, dm.target(), key, value, nilTimeout, 0)
+	if err != nil {
+		return false, err
+	}
+	w.ifVersion = true
+	w.version = version
+	err = dm.db.put(w)
+	if err == errVersionMismatch {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func TestDMap_PutIfVersion(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = dm1.GetEntry("mykey")
+	if err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound. Got: %v", err)
+	}
+
+	// Zero means that the key doesn't exist.
+	ok, err := dm1.PutIfVersion("mykey", 0, 0)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !ok {
+		t.Fatalf("Expected the key to be written")
+	}
+	ok, err = dm1.PutIfVersion("mykey", 0, 0)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if ok {
+		t.Fatalf("Expected a version mismatch")
+	}
+
+	// Read-modify-write from both members.
+	dm2, err := db2.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	increment := func(dm *DMap) error {
+		for {
+			entry, err := dm.GetEntry("mykey")
+			if err != nil {
+				return err
+			}
+			ok, err := dm.PutIfVersion("mykey", entry.Value.(int)+1, entry.Version)
+			if err != nil {
+				return err
+			}
+			if ok {
+				return nil
+			}
+		}
+	}
+	var g errgroup.Group
+	for i := 0; i < 50; i++ {
+		for _, dm := range []*DMap{dm1, dm2} {
+			dm := dm
+			g.Go(func() error {
+				return increment(dm)
+			})
+		}
+	}
+	if err = g.Wait(); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	entry, err := dm2.GetEntry("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if entry.Value.(int) != 100 {
+		t.Fatalf("Expected 100. Got: %v", entry.Value)
+	}
+	ok, err = dm2.PutIfVersion("mykey", 0, entry.Version-1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if ok {
+		t.Fatalf("Expected a version mismatch")
+	}
+}
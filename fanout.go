@@ -0,0 +1,59 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"github.com/buraksezer/olric/internal/discovery"
+	"golang.org/x/sync/errgroup"
+)
+
+// fanout calls f for every member, config.FanoutConcurrency members at a time.
+// The next wave starts after the previous one is done. The remaining waves are
+// still processed after a failure, the first error is returned.
+func (db *Olric) fanout(members []discovery.Member, f func(discovery.Member) error) error {
+	return db.fanoutN(len(members), func(i int) error {
+		return f(members[i])
+	})
+}
+
+// fanoutN calls f for every index in [0, n) in waves, like fanout.
+func (db *Olric) fanoutN(n int, f func(i int) error) error {
+	size := db.config.FanoutConcurrency
+	if size <= 0 {
+		size = n
+	}
+
+	var result error
+	for start := 0; start < n; start += size {
+		if err := db.ctx.Err(); err != nil {
+			return err
+		}
+		end := start + size
+		if end > n {
+			end = n
+		}
+		var g errgroup.Group
+		for i := start; i < end; i++ {
+			idx := i
+			g.Go(func() error {
+				return f(idx)
+			})
+		}
+		if err := g.Wait(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
@@ -0,0 +1,126 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/discovery"
+)
+
+func TestFanout(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db3, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	var members []discovery.Member
+	for i := 0; i < 5; i++ {
+		members = append(members, discovery.Member{Name: fmt.Sprintf("127.0.0.1:%d", 3320+i)})
+	}
+	db1.config.FanoutConcurrency = 2
+	var current, peak, called int32
+	errFailed := errors.New("failed")
+	err = db1.fanout(members, func(member discovery.Member) error {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			m := atomic.LoadInt32(&peak)
+			if n <= m || atomic.CompareAndSwapInt32(&peak, m, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&called, 1)
+		<-time.After(10 * time.Millisecond)
+		if member.Name == members[0].Name {
+			return errFailed
+		}
+		return nil
+	})
+	if err != errFailed {
+		t.Fatalf("Expected errFailed. Got: %v", err)
+	}
+	if called != 5 {
+		t.Fatalf("Expected all the members to be called. Got: %d", called)
+	}
+	if peak > 2 {
+		t.Fatalf("Expected at most 2 parallel calls. Got: %d", peak)
+	}
+
+	// fanoutN calls every index once, in waves of the same size.
+	var seen [7]int32
+	current, peak = 0, 0
+	err = db1.fanoutN(len(seen), func(i int) error {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			m := atomic.LoadInt32(&peak)
+			if n <= m || atomic.CompareAndSwapInt32(&peak, m, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&seen[i], 1)
+		<-time.After(10 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("Expected index %d to be called once. Got: %d", i, n)
+		}
+	}
+	if peak > 2 {
+		t.Fatalf("Expected at most 2 parallel calls. Got: %d", peak)
+	}
+
+	// Cluster-wide operations still reach all the members one by one.
+	for _, db := range []*Olric{db1, db2, db3} {
+		db.config.FanoutConcurrency = 1
+	}
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	keys, err := dm.Keys("*")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(keys) != 100 {
+		t.Fatalf("Expected 100 keys. Got: %d", len(keys))
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// HistoryEntry is a write on a key, as recorded by the partition owner.
+// See DMap.History.
+type HistoryEntry struct {
+	// Timestamp is the timestamp of the write in nanoseconds. It's the time of
+	// the delete for the deletes.
+	Timestamp int64
+
+	// Member is the partition owner which has applied the write.
+	Member string
+
+	// ValueHash is the hash of the serialized value. It's zero for the deletes.
+	ValueHash uint64
+
+	// Deleted is true if the key is deleted, including the evictions.
+	Deleted bool
+}
+
+// keyHistory is the ring buffer of the last writes on a key.
+type keyHistory struct {
+	key     string
+	entries []HistoryEntry
+	// The index of the oldest entry if the buffer is full.
+	next int
+}
+
+func (k *keyHistory) add(entry HistoryEntry, size int) {
+	if len(k.entries) < size {
+		k.entries = append(k.entries, entry)
+		return
+	}
+	k.entries[k.next] = entry
+	k.next = (k.next + 1) % size
+}
+
+// list returns the entries from the oldest to the newest.
+func (k *keyHistory) list() []HistoryEntry {
+	res := make([]HistoryEntry, 0, len(k.entries))
+	res = append(res, k.entries[k.next:]...)
+	return append(res, k.entries[:k.next]...)
+}
+
+// history keeps the write history of the keys of a DMap. The number of the keys
+// is bounded with LRU. See config.DMapCacheConfig.HistorySize.
+type history struct {
+	mtx     sync.Mutex
+	size    int
+	maxKeys int
+	keys    map[string]*list.Element
+	lru     *list.List
+}
+
+// newHistories creates a history for every DMap with a HistorySize. The
+// returned map is read-only.
+func newHistories(c *config.CacheConfig) map[string]*history {
+	histories := make(map[string]*history)
+	if c == nil {
+		return histories
+	}
+	for name, dc := range c.DMapConfigs {
+		if dc.HistorySize <= 0 {
+			continue
+		}
+		maxKeys := dc.HistoryMaxKeys
+		if maxKeys == 0 {
+			maxKeys = config.DefaultHistoryMaxKeys
+		}
+		histories[name] = &history{
+			size:    dc.HistorySize,
+			maxKeys: maxKeys,
+			keys:    make(map[string]*list.Element),
+			lru:     list.New(),
+		}
+	}
+	return histories
+}
+
+func (h *history) record(key string, entry HistoryEntry) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if e, ok := h.keys[key]; ok {
+		h.lru.MoveToFront(e)
+		e.Value.(*keyHistory).add(entry, h.size)
+		return
+	}
+	k := &keyHistory{key: key}
+	k.add(entry, h.size)
+	h.keys[key] = h.lru.PushFront(k)
+	if h.lru.Len() > h.maxKeys {
+		oldest := h.lru.Back()
+		h.lru.Remove(oldest)
+		delete(h.keys, oldest.Value.(*keyHistory).key)
+	}
+}
+
+func (h *history) load(key string) []HistoryEntry {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	e, ok := h.keys[key]
+	if !ok {
+		return nil
+	}
+	return e.Value.(*keyHistory).list()
+}
+
+// recordWrite adds a write to the history of the key, if the DMap keeps one.
+func (db *Olric) recordWrite(name, key string, value []byte, timestamp int64) {
+	h, ok := db.histories[name]
+	if !ok {
+		return
+	}
+	h.record(key, HistoryEntry{
+		Timestamp: timestamp,
+		Member:    db.this.String(),
+		ValueHash: db.hasher.Sum64(value),
+	})
+}
+
+// recordDelete adds a delete to the history of the key, if the DMap keeps one.
+func (db *Olric) recordDelete(name, key string) {
+	h, ok := db.histories[name]
+	if !ok {
+		return
+	}
+	h.record(key, HistoryEntry{
+		Timestamp: time.Now().UnixNano(),
+		Member:    db.this.String(),
+		Deleted:   true,
+	})
+}
+
+func (db *Olric) localHistory(name, key string) []HistoryEntry {
+	h, ok := db.histories[name]
+	if !ok {
+		return nil
+	}
+	return h.load(key)
+}
+
+func (db *Olric) keyHistory(name, key string) ([]HistoryEntry, error) {
+	if err := db.checkDMapAvailable(name); err != nil {
+		return nil, err
+	}
+	var mtx sync.Mutex
+	var result []HistoryEntry
+	merge := func(entries []HistoryEntry) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		result = append(result, entries...)
+	}
+
+	// The previous owners of the partition keep the history of the writes
+	// applied by them.
+	err := db.fanout(db.discovery.GetMembers(), func(mem discovery.Member) error {
+		if hostCmp(mem, db.this) {
+			merge(db.localHistory(name, key))
+			return nil
+		}
+		return db.requestHistory(mem, name, key, merge)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp < result[j].Timestamp
+	})
+	return result, nil
+}
+
+func (db *Olric) requestHistory(member discovery.Member, name, key string, merge func([]HistoryEntry)) error {
+	ok, err := db.client.Supports(member.String(), protocol.CapHistory)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s doesn't support the write history", member)
+	}
+
+	req := &protocol.Message{
+		DMap: name,
+		Key:  key,
+	}
+	resp, err := db.requestTo(member.String(), protocol.OpHistory, req)
+	if err != nil {
+		return err
+	}
+	var entries []HistoryEntry
+	err = msgpack.Unmarshal(resp.Value, &entries)
+	if err != nil {
+		return err
+	}
+	merge(entries)
+	return nil
+}
+
+// History returns the last writes and deletes on the key, from the oldest to
+// the newest. It's a debugging aid to find out how a key has got its value.
+// The DMap has to be configured with a HistorySize, otherwise it returns nil.
+// See config.DMapCacheConfig.HistorySize.
+//
+// The history is kept on the partition owner which has applied the writes,
+// not on the replicas. History collects it from all members, so the writes
+// applied by the previous owners of the partition are included. The writes
+// are compared by the hashes of the values. It scans all members, don't use it
+// on the hot path.
+func (dm *DMap) History(key string) ([]HistoryEntry, error) {
+	return dm.db.keyHistory(dm.target(), key)
+}
+
+func (db *Olric) historyOperation(req *protocol.Message) *protocol.Message {
+	value, err := msgpack.Marshal(db.localHistory(req.DMap, req.Key))
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -0,0 +1,135 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+
+	"github.com/buraksezer/olric/config"
+)
+
+func TestDMap_History(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 2; i++ {
+		c := testConfig(nil)
+		c.Cache = &config.CacheConfig{
+			DMapConfigs: map[string]config.DMapCacheConfig{
+				"mymap": {
+					HistorySize:    3,
+					HistoryMaxKeys: 2,
+				},
+			},
+		}
+		db, err := newDB(c, dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		err = dm.Put("mykey", bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm.Delete("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	owner, _ := dbs[0].findPartitionOwner("mymap", "mykey")
+	entries, err := dm.History("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries. Got: %d", len(entries))
+	}
+	// The last two writes and the delete, from the oldest to the newest.
+	for i, entry := range entries[:2] {
+		value, err := dbs[0].serializer.Marshal(bval(i + 3))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if entry.ValueHash != dbs[0].hasher.Sum64(value) {
+			t.Fatalf("Expected the hash of value: %d", i+3)
+		}
+		if entry.Deleted {
+			t.Fatalf("Expected a write. Got a delete")
+		}
+		if entry.Member != owner.String() {
+			t.Fatalf("Expected member: %s. Got: %s", owner, entry.Member)
+		}
+	}
+	if !entries[2].Deleted {
+		t.Fatalf("Expected a delete. Got: %v", entries[2])
+	}
+	if entries[0].Timestamp > entries[1].Timestamp || entries[1].Timestamp > entries[2].Timestamp {
+		t.Fatalf("Expected the entries in order. Got: %v", entries)
+	}
+
+	// The least recently written key is forgotten. Write two keys on the same
+	// partition owner.
+	var written int
+	for i := 0; written < 2; i++ {
+		if member, _ := dbs[0].findPartitionOwner("mymap", bkey(i)); !hostCmp(member, owner) {
+			continue
+		}
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		written++
+	}
+	entries, err = dm.History("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Expected no entries. Got: %d", len(entries))
+	}
+
+	// The other DMaps don't keep a history.
+	other, err := dbs[0].NewDMap("other")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = other.Put("mykey", "value")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	entries, err = other.History("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Expected no entries. Got: %d", len(entries))
+	}
+}
@@ -79,6 +79,8 @@ type Member struct {
 	Name      string
 	ID        uint64
 	Birthdate int64
+	Region    string
+	Weight    int
 }
 
 func (m Member) String() string {
@@ -104,6 +106,8 @@ func New(log *flog.Logger, c *config.Config) *Discovery {
 		Name:      c.Name,
 		ID:        id,
 		Birthdate: birthdate,
+		Region:    c.Region,
+		Weight:    c.ReadWeight,
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Discovery{
@@ -20,6 +20,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 
 	"github.com/buraksezer/olric/internal/bufpool"
@@ -40,6 +41,61 @@ const (
 	MagicRes MagicCode = 0xE3
 )
 
+// Version is the current version of Olric Binary Protocol. Peers exchange
+// their versions at connection setup and use the smaller one.
+const Version uint8 = 1
+
+// Capability is a bitmask of the optional features of the protocol. The bits
+// are exchanged with the peers, append the new ones to the end of the list.
+type Capability uint64
+
+const (
+	// CapGetWithOptions means that the peer supports OpGetWithOptions.
+	CapGetWithOptions Capability = 1 << iota
+
+	// CapRangeBetween means that the peer supports OpRangeBetween.
+	CapRangeBetween
+
+	// CapConsistencyLevel means that the peer supports OpPutWithOptions and
+	// the consistency level in GetWithOptionsExtra.
+	CapConsistencyLevel
+
+	// CapKeys means that the peer supports OpKeys.
+	CapKeys
+
+	// CapWireCompression means that the connection stream is compressed after
+	// the handshake. It's not in Capabilities, the dialing side asks for it and
+	// the peer accepts it by returning the same bit.
+	CapWireCompression
+
+	// CapResponseExtras means that the peer reads the extras of the responses.
+	// The responses are sent without extras to the peers which don't have it.
+	CapResponseExtras
+
+	// CapKeysByTTL means that the peer supports OpKeysByTTL.
+	CapKeysByTTL
+
+	// CapGetAll means that the peer supports OpGetAll.
+	CapGetAll
+
+	// CapChainReplication means that the peer supports OpChainReplica.
+	CapChainReplication
+
+	// CapHistory means that the peer supports OpHistory.
+	CapHistory
+
+	// CapMultiplexing means that the requests are multiplexed over the connection
+	// after the handshake. Every message is prefixed with a 4-byte request ID
+	// and the responses may arrive in any order. It's not in Capabilities, like
+	// CapWireCompression.
+	CapMultiplexing
+)
+
+// Capabilities is the set of optional features supported by this node.
+const Capabilities = CapGetWithOptions | CapRangeBetween | CapConsistencyLevel | CapKeys |
+	CapResponseExtras | CapKeysByTTL | CapGetAll | CapChainReplication |
+	CapHistory
+
 type OpCode uint8
 
 // ops
@@ -74,8 +130,150 @@ const (
 	OpStats
 	OpExpire
 	OpExpireReplica
+	OpRangeBetween
+	OpGetWithOptions
+	OpHello
+	OpDeleteExpired
+	OpCopy
+	OpSyncBackup
+	OpPutWithOptions
+	OpGetAndTouch
+	OpGetPutEx
+	OpKeys
+	OpReplace
+	OpReplaceReplica
+	OpRepair
+	OpExists
+	OpExpireMany
+	OpExpireManyReplica
+	OpMarkDestroying
+	OpSetReadOnly
+	OpGetTTL
+	OpPutWithOptionsReplica
+	OpIncrFloat
+	OpSubscribeChanges
+	OpPollChanges
+	OpUnsubscribeChanges
+	OpRenameDMap
+	OpGetAliases
+	OpPutIfVersion
+	OpSwap
+	OpKeysByTTL
+	OpSetWritesPaused
+	OpLastAccess
+	OpGetRoutingTable
+	OpExistsMany
+	OpGetDelete
+	OpPartitionSizes
+	OpCompareAndDelete
+	OpDecrFloor
+	OpGetAll
+	OpChainReplica
+	OpHistory
+	OpSetBit
+	OpGetBit
+	OpPauseDMapWrites
 )
 
+// opNames is used by OpCode.String.
+var opNames = map[OpCode]string{
+	OpPut:                   "Put",
+	OpPutEx:                 "PutEx",
+	OpPutIf:                 "PutIf",
+	OpPutIfEx:               "PutIfEx",
+	OpGet:                   "Get",
+	OpDelete:                "Delete",
+	OpDestroy:               "Destroy",
+	OpLock:                  "Lock",
+	OpLockWithTimeout:       "LockWithTimeout",
+	OpUnlock:                "Unlock",
+	OpIncr:                  "Incr",
+	OpDecr:                  "Decr",
+	OpGetPut:                "GetPut",
+	OpUpdateRouting:         "UpdateRouting",
+	OpPutReplica:            "PutReplica",
+	OpPutIfReplica:          "PutIfReplica",
+	OpPutExReplica:          "PutExReplica",
+	OpPutIfExReplica:        "PutIfExReplica",
+	OpDeletePrev:            "DeletePrev",
+	OpGetPrev:               "GetPrev",
+	OpGetBackup:             "GetBackup",
+	OpDeleteBackup:          "DeleteBackup",
+	OpDestroyDMap:           "DestroyDMap",
+	OpMoveDMap:              "MoveDMap",
+	OpLengthOfPart:          "LengthOfPart",
+	OpPipeline:              "Pipeline",
+	OpPing:                  "Ping",
+	OpStats:                 "Stats",
+	OpExpire:                "Expire",
+	OpExpireReplica:         "ExpireReplica",
+	OpRangeBetween:          "RangeBetween",
+	OpGetWithOptions:        "GetWithOptions",
+	OpHello:                 "Hello",
+	OpDeleteExpired:         "DeleteExpired",
+	OpCopy:                  "Copy",
+	OpSyncBackup:            "SyncBackup",
+	OpPutWithOptions:        "PutWithOptions",
+	OpGetAndTouch:           "GetAndTouch",
+	OpGetPutEx:              "GetPutEx",
+	OpKeys:                  "Keys",
+	OpReplace:               "Replace",
+	OpReplaceReplica:        "ReplaceReplica",
+	OpRepair:                "Repair",
+	OpExists:                "Exists",
+	OpExpireMany:            "ExpireMany",
+	OpExpireManyReplica:     "ExpireManyReplica",
+	OpMarkDestroying:        "MarkDestroying",
+	OpSetReadOnly:           "SetReadOnly",
+	OpGetTTL:                "GetTTL",
+	OpPutWithOptionsReplica: "PutWithOptionsReplica",
+	OpIncrFloat:             "IncrFloat",
+	OpSubscribeChanges:      "SubscribeChanges",
+	OpPollChanges:           "PollChanges",
+	OpUnsubscribeChanges:    "UnsubscribeChanges",
+	OpRenameDMap:            "RenameDMap",
+	OpGetAliases:            "GetAliases",
+	OpPutIfVersion:          "PutIfVersion",
+	OpSwap:                  "Swap",
+	OpKeysByTTL:             "KeysByTTL",
+	OpSetWritesPaused:       "SetWritesPaused",
+	OpLastAccess:            "LastAccess",
+	OpGetRoutingTable:       "GetRoutingTable",
+	OpExistsMany:            "ExistsMany",
+	OpGetDelete:             "GetDelete",
+	OpPartitionSizes:        "PartitionSizes",
+	OpCompareAndDelete:      "CompareAndDelete",
+	OpDecrFloor:             "DecrFloor",
+	OpGetAll:                "GetAll",
+	OpChainReplica:          "ChainReplica",
+	OpHistory:               "History",
+	OpSetBit:                "SetBit",
+	OpGetBit:                "GetBit",
+	OpPauseDMapWrites:       "PauseDMapWrites",
+}
+
+// String returns the name of the OpCode without the Op prefix. It returns
+// the hex code of the unknown and the custom operations.
+func (op OpCode) String() string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", uint8(op))
+}
+
+// MinVersion returns the protocol version which introduced the OpCode. The
+// peers with an older version don't know it and the clients shouldn't send it.
+func (op OpCode) MinVersion() uint8 {
+	if op >= OpRangeBetween && op != OpHello {
+		return 1
+	}
+	return 0
+}
+
+// OpCustomBase is the first OpCode of the range which is reserved for the
+// operations registered by the users. The built-in operations never use it.
+const OpCustomBase OpCode = 0xC0
+
 type StatusCode uint8
 
 // status codes
@@ -92,6 +290,23 @@ const (
 	StatusErrKeyFound
 	StatusErrClusterQuorum
 	StatusErrUnknownOperation
+	StatusErrTooManyRequests
+	StatusErrKeyExpired
+	StatusErrKeyIdle
+	StatusErrPartitionFull
+	StatusErrClockSkew
+	StatusErrDMapUnavailable
+	StatusErrReadOnly
+	StatusErrMessageTooLarge
+	StatusErrNotNumeric
+	StatusErrSerializerMismatch
+	StatusErrNoMajority
+	StatusErrVersionMismatch
+	StatusErrCrossPartitionSwap
+	StatusErrClusterNotReady
+	StatusErrWritesPaused
+	StatusErrResultTooLarge
+	StatusErrNotBitmap
 )
 
 const headerSize int64 = 12
@@ -144,6 +359,12 @@ type PutIfExtra struct {
 	Timestamp int64
 }
 
+// PutIfVersionExtra defines extra values for this operation.
+type PutIfVersionExtra struct {
+	Timestamp int64
+	Version   int64
+}
+
 // PutIfExExtra defines extra values for this operation.
 type PutIfExExtra struct {
 	Flags     int16
@@ -157,9 +378,38 @@ type LengthOfPartExtra struct {
 	Backup bool
 }
 
-// AtomicExtra defines extra values for this operation.
+// AtomicExtra defines extra values for this operation. OpID is optional,
+// an operation with a non-zero OpID is applied only once. The older peers
+// don't send it, see readGrownExtra.
 type AtomicExtra struct {
 	Timestamp int64
+	OpID      uint64
+}
+
+// DecrFloorResult is the response of OpDecrFloor. It's encoded with msgpack.
+type DecrFloorResult struct {
+	Value   int
+	Applied bool
+}
+
+// SetBitExtra defines extra values for this operation.
+type SetBitExtra struct {
+	Offset    int64
+	Value     bool
+	Timestamp int64
+}
+
+// GetBitExtra defines extra values for this operation.
+type GetBitExtra struct {
+	Offset int64
+}
+
+// GetPutExExtra defines extra values for this operation. OpID is optional,
+// an operation with a non-zero OpID is applied only once.
+type GetPutExExtra struct {
+	TTL       int64
+	Timestamp int64
+	OpID      uint64
 }
 
 // ExpireExtrrea defines extra values for this operation.
@@ -168,15 +418,99 @@ type ExpireExtra struct {
 	Timestamp int64
 }
 
-// UpdateRoutingExtra defines extra values for this operation.
+// GetWithOptionsExtra defines extra values for this operation.
+type GetWithOptionsExtra struct {
+	ReadAll           bool
+	ReadRepair        bool
+	Consistency       uint8
+	AllowStale        bool
+	ExpiryReason      bool
+	MajorityAgreement bool
+}
+
+// PutWithOptionsExtra defines extra values for this operation.
+type PutWithOptionsExtra struct {
+	TTL         int64
+	Timestamp   int64
+	Consistency uint8
+	// Hard expiry time of the key in milliseconds. Zero means no deadline.
+	Deadline int64
+}
+
+// HelloExtra defines extra values for this operation. The response
+// carries the same structure in its value.
+type HelloExtra struct {
+	Version      uint8
+	Capabilities uint64
+}
+
+// GetResponseExtra defines extra values for the response of OpGet. Codec is
+// the serializer of the member which serves the request.
+type GetResponseExtra struct {
+	Codec uint8
+}
+
+// ChangesExtra defines extra values for OpPollChanges and OpUnsubscribeChanges.
+type ChangesExtra struct {
+	SubscriptionID uint64
+}
+
+// GetAndTouchExtra defines extra values for this operation.
+type GetAndTouchExtra struct {
+	TTL int64
+}
+
+// SyncBackupExtra defines extra values for this operation.
+type SyncBackupExtra struct {
+	PartID uint64
+}
+
+// ReplaceExtra defines extra values for this operation.
+type ReplaceExtra struct {
+	PartID    uint64
+	Timestamp int64
+}
+
+// ExpireManyExtra defines extra values for this operation.
+type ExpireManyExtra struct {
+	TTL int64
+}
+
+// UpdateRoutingExtra defines extra values for this operation. The older
+// coordinators send only CoordinatorID, see readGrownExtra.
 type UpdateRoutingExtra struct {
-	CoordinatorID uint64
+	CoordinatorID   uint64
+	ReplicaChecksum uint64
+}
+
+// RoutingTable is the payload of the OpGetRoutingTable response. The clients use
+// it to send the requests to the partition owners directly.
+type RoutingTable struct {
+	PartitionCount uint64
+
+	// Signature changes whenever the routing table is updated.
+	Signature uint64
+
+	// Owners keeps the address of the primary owner of each partition. It's
+	// empty for the partitions which have no owner yet.
+	Owners []string
 }
 
 // ErrConnClosed means that the underlying TCP connection has been closed
 // by the client or operating system.
 var ErrConnClosed = errors.New("connection closed")
 
+// ErrMessageTooLarge is returned by ReadWithLimit if the body length declared
+// in the header exceeds the limit.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// unlimitedOps carries the partitions between the members. They are exempted
+// from the message size limit.
+var unlimitedOps = map[OpCode]struct{}{
+	OpMoveDMap:      {},
+	OpUpdateRouting: {},
+}
+
 func filterNetworkErrors(err error) error {
 	if err == nil {
 		return nil
@@ -187,6 +521,30 @@ func filterNetworkErrors(err error) error {
 	return err
 }
 
+// loadResponseExtras decodes the extras of a response. The unknown extras are
+// skipped.
+func loadResponseExtras(raw []byte, op OpCode) (interface{}, error) {
+	switch op {
+	case OpGet, OpGetDelete:
+		extra := GetResponseExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	default:
+		return nil, nil
+	}
+}
+
+// readGrownExtra decodes the extras of an operation which got new fields at the
+// end. The older peers send the shorter form, the missing fields are left zero.
+func readGrownExtra(raw []byte, extra interface{}) error {
+	if size := binary.Size(extra); len(raw) < size {
+		padded := make([]byte, size)
+		copy(padded, raw)
+		raw = padded
+	}
+	return binary.Read(bytes.NewReader(raw), binary.BigEndian, extra)
+}
+
 func loadExtras(raw []byte, op OpCode) (interface{}, error) {
 	switch op {
 	case OpPutEx, OpPutExReplica:
@@ -209,8 +567,20 @@ func loadExtras(raw []byte, op OpCode) (interface{}, error) {
 		extra := LengthOfPartExtra{}
 		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
 		return extra, err
-	case OpIncr, OpDecr, OpGetPut:
+	case OpIncr, OpDecr, OpGetPut, OpIncrFloat, OpDecrFloor:
 		extra := AtomicExtra{}
+		err := readGrownExtra(raw, &extra)
+		return extra, err
+	case OpSetBit:
+		extra := SetBitExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	case OpGetBit:
+		extra := GetBitExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	case OpGetPutEx:
+		extra := GetPutExExtra{}
 		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
 		return extra, err
 	case OpExpire, OpExpireReplica:
@@ -225,8 +595,44 @@ func loadExtras(raw []byte, op OpCode) (interface{}, error) {
 		extra := PutIfExtra{}
 		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
 		return extra, err
+	case OpPutIfVersion:
+		extra := PutIfVersionExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
 	case OpUpdateRouting:
 		extra := UpdateRoutingExtra{}
+		err := readGrownExtra(raw, &extra)
+		return extra, err
+	case OpGetWithOptions:
+		extra := GetWithOptionsExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	case OpPutWithOptions, OpPutWithOptionsReplica:
+		extra := PutWithOptionsExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	case OpGetAndTouch:
+		extra := GetAndTouchExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	case OpSyncBackup:
+		extra := SyncBackupExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	case OpReplace, OpReplaceReplica:
+		extra := ReplaceExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	case OpExpireMany, OpExpireManyReplica:
+		extra := ExpireManyExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	case OpPollChanges, OpUnsubscribeChanges:
+		extra := ChangesExtra{}
+		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
+		return extra, err
+	case OpHello:
+		extra := HelloExtra{}
 		err := binary.Read(bytes.NewReader(raw), binary.BigEndian, &extra)
 		return extra, err
 	default:
@@ -238,6 +644,14 @@ func loadExtras(raw []byte, op OpCode) (interface{}, error) {
 // Read reads a whole protocol message(including the value) from given connection
 // by decoding it.
 func (m *Message) Read(conn io.Reader) error {
+	return m.ReadWithLimit(conn, 0)
+}
+
+// ReadWithLimit reads a protocol message like Read but rejects the messages
+// which declare a body longer than maxSize bytes in the header. The body is
+// discarded without buffering to keep the connection usable and
+// ErrMessageTooLarge is returned with the header filled. Zero means no limit.
+func (m *Message) ReadWithLimit(conn io.Reader, maxSize uint32) error {
 	buf := pool.Get()
 	defer pool.Put(buf)
 
@@ -253,15 +667,28 @@ func (m *Message) Read(conn io.Reader) error {
 		return fmt.Errorf("invalid message")
 	}
 
+	if _, ok := unlimitedOps[m.Op]; maxSize != 0 && m.BodyLen > maxSize && !ok {
+		_, err = io.CopyN(ioutil.Discard, conn, int64(m.BodyLen))
+		if err != nil {
+			return filterNetworkErrors(err)
+		}
+		return ErrMessageTooLarge
+	}
+
 	// Read Key, DMap name and message extras here.
 	_, err = io.CopyN(buf, conn, int64(m.BodyLen))
 	if err != nil {
 		return filterNetworkErrors(err)
 	}
 
-	if m.Magic == MagicReq && m.ExtraLen > 0 {
+	if m.ExtraLen > 0 {
 		raw := buf.Next(int(m.ExtraLen))
-		extra, err := loadExtras(raw, m.Op)
+		var extra interface{}
+		if m.Magic == MagicReq {
+			extra, err = loadExtras(raw, m.Op)
+		} else {
+			extra, err = loadResponseExtras(raw, m.Op)
+		}
 		if err != nil {
 			return err
 		}
@@ -270,8 +697,8 @@ func (m *Message) Read(conn io.Reader) error {
 	m.DMap = string(buf.Next(int(m.DMapLen)))
 	m.Key = string(buf.Next(int(m.KeyLen)))
 
-	// There is no maximum value for BodyLen which includes ValueLen.
-	// So our limit is available memory amount at the time of operation.
+	// BodyLen includes ValueLen. If maxSize is zero, our limit is available
+	// memory amount at the time of operation.
 	// Please note that maximum partition size should not exceed 50MB for a smooth operation.
 	vlen := int(m.BodyLen) - int(m.ExtraLen) - int(m.KeyLen) - int(m.DMapLen)
 	if vlen != 0 {
@@ -0,0 +1,146 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*Package skiplist implements a skip list of string keys with an uint64 value. It's used to keep an ordered index of keys in a DMap.*/
+package skiplist
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	maxLevel = 32
+	// Probability of adding a new level to a node. A smaller value
+	// consumes less memory.
+	p = 0.25
+)
+
+type node struct {
+	key   string
+	value uint64
+	next  []*node
+}
+
+// SkipList keeps the keys in lexicographical order. It's not thread-safe.
+type SkipList struct {
+	head   *node
+	level  int
+	length int
+	rnd    *rand.Rand
+}
+
+// New returns a new, empty SkipList.
+func New() *SkipList {
+	return &SkipList{
+		head:  &node{next: make([]*node, maxLevel)},
+		level: 1,
+		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (s *SkipList) randomLevel() int {
+	level := 1
+	for level < maxLevel && s.rnd.Float64() < p {
+		level++
+	}
+	return level
+}
+
+// findPrev fills update with the rightmost nodes before key on every level
+// and returns the node after them on the lowest level.
+func (s *SkipList) findPrev(key string, update []*node) *node {
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		if update != nil {
+			update[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+// Insert adds key to the list with the given value. It updates the value
+// if the key already exists.
+func (s *SkipList) Insert(key string, value uint64) {
+	update := make([]*node, maxLevel)
+	x := s.findPrev(key, update)
+	if x != nil && x.key == key {
+		x.value = value
+		return
+	}
+
+	level := s.randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+		}
+		s.level = level
+	}
+
+	n := &node{key: key, value: value, next: make([]*node, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	s.length++
+}
+
+// Delete removes key from the list. It returns false if the key doesn't exist.
+func (s *SkipList) Delete(key string) bool {
+	update := make([]*node, maxLevel)
+	x := s.findPrev(key, update)
+	if x == nil || x.key != key {
+		return false
+	}
+
+	for i := 0; i < s.level; i++ {
+		if update[i].next[i] != x {
+			break
+		}
+		update[i].next[i] = x.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.length--
+	return true
+}
+
+// Get returns the value for the given key. The second return value is false
+// if the key doesn't exist.
+func (s *SkipList) Get(key string) (uint64, bool) {
+	x := s.findPrev(key, nil)
+	if x == nil || x.key != key {
+		return 0, false
+	}
+	return x.value, true
+}
+
+// Range calls f sequentially for each key and value in [lo, hi) in ascending
+// order of the keys. If f returns false, range stops the iteration.
+func (s *SkipList) Range(lo, hi string, f func(key string, value uint64) bool) {
+	for x := s.findPrev(lo, nil); x != nil && x.key < hi; x = x.next[0] {
+		if !f(x.key, x.value) {
+			return
+		}
+	}
+}
+
+// Len returns the number of keys in the list.
+func (s *SkipList) Len() int {
+	return s.length
+}
@@ -0,0 +1,95 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skiplist
+
+import (
+	"fmt"
+	"testing"
+)
+
+func bkey(i int) string {
+	return fmt.Sprintf("%09d", i)
+}
+
+func Test_InsertDelete(t *testing.T) {
+	s := New()
+	for i := 0; i < 100; i++ {
+		s.Insert(bkey(i), 0)
+		// Update the value.
+		s.Insert(bkey(i), uint64(i))
+	}
+	if s.Len() != 100 {
+		t.Fatalf("Expected length is 100. Got: %d", s.Len())
+	}
+	for i := 0; i < 100; i++ {
+		value, ok := s.Get(bkey(i))
+		if !ok {
+			t.Fatalf("Expected key: %s is found", bkey(i))
+		}
+		if value != uint64(i) {
+			t.Fatalf("Expected value: %d. Got: %d", i, value)
+		}
+	}
+	for i := 0; i < 100; i += 2 {
+		if !s.Delete(bkey(i)) {
+			t.Fatalf("Expected key: %s is deleted", bkey(i))
+		}
+	}
+	if s.Delete(bkey(0)) {
+		t.Fatalf("Expected false for a deleted key")
+	}
+	if s.Len() != 50 {
+		t.Fatalf("Expected length is 50. Got: %d", s.Len())
+	}
+	for i := 0; i < 100; i++ {
+		if _, ok := s.Get(bkey(i)); ok != (i%2 == 1) {
+			t.Fatalf("Unexpected result for key: %s", bkey(i))
+		}
+	}
+}
+
+func Test_Range(t *testing.T) {
+	s := New()
+	// Insert in reverse order to check sorting.
+	for i := 99; i >= 0; i-- {
+		s.Insert(bkey(i), uint64(i))
+	}
+
+	var keys []string
+	s.Range(bkey(10), bkey(20), func(key string, value uint64) bool {
+		if key != bkey(int(value)) {
+			t.Fatalf("Expected value: %s. Got: %d", key, value)
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 10 {
+		t.Fatalf("Expected 10 keys. Got: %d", len(keys))
+	}
+	for i, key := range keys {
+		if key != bkey(10+i) {
+			t.Fatalf("Expected key: %s. Got: %s", bkey(10+i), key)
+		}
+	}
+
+	var count int
+	s.Range(bkey(0), bkey(100), func(key string, value uint64) bool {
+		count++
+		return count < 5
+	})
+	if count != 5 {
+		t.Fatalf("Expected 5 iterations. Got: %d", count)
+	}
+}
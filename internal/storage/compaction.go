@@ -40,6 +40,10 @@ func (s *Storage) CompactTables() bool {
 				log.Printf("[ERROR] Failed to compact tables. HKey: %d: %v", hkey, err)
 			}
 
+			if deadline, ok := old.deadlines[hkey]; ok {
+				fresh.deadlines[hkey] = deadline
+			}
+
 			// Dont check the returned val, it's useless because
 			// we are sure that the key is already there.
 			old.delete(hkey)
@@ -43,6 +43,9 @@ type VData struct {
 	Value     []byte
 	TTL       int64
 	Timestamp int64
+	// Deadline is the hard expiry time of the key in milliseconds, like TTL.
+	// TTL is never set beyond it. Zero means no deadline.
+	Deadline int64
 }
 
 // Storage implements a new off-heap data store which uses built-in map to
@@ -263,6 +266,9 @@ type transport struct {
 	Allocated int
 	Inuse     int
 	Garbage   int
+
+	// Deadlines is not sent by the older members.
+	Deadlines map[uint64]int64
 }
 
 // Export serializes underlying data structes into a byte slice. It may return
@@ -279,6 +285,7 @@ func (s *Storage) Export() ([]byte, error) {
 		Allocated: t.allocated,
 		Inuse:     t.inuse,
 		Garbage:   t.garbage,
+		Deadlines: t.deadlines,
 	}
 	tr.Memory = make([]byte, t.offset+1)
 	copy(tr.Memory, t.memory[:t.offset])
@@ -300,6 +307,9 @@ func Import(data []byte) (*Storage, error) {
 	t.offset = tr.Offset
 	t.inuse = tr.Inuse
 	t.garbage = tr.Garbage
+	if tr.Deadlines != nil {
+		t.deadlines = tr.Deadlines
+	}
 	copy(t.memory, tr.Memory)
 	return o, nil
 }
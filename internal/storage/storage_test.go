@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/cespare/xxhash"
+	"github.com/vmihailenco/msgpack"
 )
 
 var storageTestLock sync.RWMutex
@@ -495,3 +496,115 @@ func Test_GetTTL(t *testing.T) {
 		t.Fatalf("Expected TTL %d. Got %d", ttl, vdata.TTL)
 	}
 }
+
+func Test_Deadline(t *testing.T) {
+	s := New(0)
+	now := time.Now().UnixNano() / 1000000
+	vdata := &VData{
+		Key:       bkey(1),
+		Value:     bval(1),
+		TTL:       now + 60000,
+		Deadline:  now + 100,
+		Timestamp: time.Now().UnixNano(),
+	}
+	hkey := xxhash.Sum64([]byte(vdata.Key))
+	err := s.Put(hkey, vdata)
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	res, err := s.Get(hkey)
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	if res.Deadline != vdata.Deadline {
+		t.Fatalf("Expected Deadline: %d. Got %d", vdata.Deadline, res.Deadline)
+	}
+	if res.TTL != vdata.Deadline {
+		t.Fatalf("Expected TTL: %d. Got %d", vdata.Deadline, res.TTL)
+	}
+
+	// UpdateTTL cannot extend the lifetime beyond the deadline.
+	err = s.UpdateTTL(hkey, &VData{TTL: 0, Timestamp: time.Now().UnixNano()})
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	res, err = s.Get(hkey)
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	if res.TTL != vdata.Deadline {
+		t.Fatalf("Expected TTL: %d. Got %d", vdata.Deadline, res.TTL)
+	}
+}
+
+func Test_ExportImportDeadline(t *testing.T) {
+	s := New(0)
+	now := time.Now().UnixNano() / 1000000
+	for i := 0; i < 100; i++ {
+		vdata := &VData{
+			Key:       bkey(i),
+			Value:     bval(i),
+			Timestamp: time.Now().UnixNano(),
+		}
+		if i%2 == 0 {
+			vdata.Deadline = now + 60000
+		}
+		hkey := xxhash.Sum64([]byte(vdata.Key))
+		if err := s.Put(hkey, vdata); err != nil {
+			t.Fatalf("Expected nil. Got %v", err)
+		}
+	}
+	data, err := s.Export()
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+
+	// The older members don't know Deadlines.
+	legacy := struct {
+		HKeys     map[uint64]int
+		Memory    []byte
+		Offset    int
+		Allocated int
+		Inuse     int
+		Garbage   int
+	}{}
+	if err = msgpack.Unmarshal(data, &legacy); err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+	legacyData, err := msgpack.Marshal(legacy)
+	if err != nil {
+		t.Fatalf("Expected nil. Got %v", err)
+	}
+
+	for j, payload := range [][]byte{data, legacyData} {
+		fresh, err := Import(payload)
+		if err != nil {
+			t.Fatalf("Expected nil. Got %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			hkey := xxhash.Sum64([]byte(bkey(i)))
+			vdata, err := fresh.Get(hkey)
+			if err != nil {
+				t.Fatalf("Expected nil. Got %v", err)
+			}
+			if vdata.Key != bkey(i) {
+				t.Fatalf("Expected key: %s. Got %s", bkey(i), vdata.Key)
+			}
+			if !bytes.Equal(vdata.Value, bval(i)) {
+				t.Fatalf("Expected value: %s. Got %s", bval(i), vdata.Value)
+			}
+			var deadline int64
+			if i%2 == 0 && j == 0 {
+				deadline = now + 60000
+			}
+			if vdata.Deadline != deadline {
+				t.Fatalf("Expected Deadline: %d. Got %d", deadline, vdata.Deadline)
+			}
+		}
+		// A new key can be stored next to the imported ones.
+		hkey := xxhash.Sum64([]byte(bkey(100)))
+		if err = fresh.Put(hkey, &VData{Key: bkey(100), Value: bval(100)}); err != nil {
+			t.Fatalf("Expected nil. Got %v", err)
+		}
+	}
+}
@@ -38,6 +38,10 @@ type table struct {
 	memory []byte
 	offset int
 
+	// Deadlines of the keys which have one. They are kept out of the entries
+	// to keep the layout compatible with the older members, see Export.
+	deadlines map[uint64]int64
+
 	// In bytes
 	allocated int
 	inuse     int
@@ -50,6 +54,7 @@ func newTable(size int) *table {
 	}
 	t := &table{
 		hkeys:     make(map[uint64]int),
+		deadlines: make(map[uint64]int64),
 		allocated: size,
 	}
 	//  From builtin.go:
@@ -98,6 +103,9 @@ func (t *table) put(hkey uint64, value *VData) error {
 
 	t.hkeys[hkey] = t.offset
 	t.inuse += inuse
+	if value.Deadline != 0 {
+		t.deadlines[hkey] = value.Deadline
+	}
 
 	// Set key length. It's 1 byte.
 	klen := uint8(len(value.Key))
@@ -108,8 +116,8 @@ func (t *table) put(hkey uint64, value *VData) error {
 	copy(t.memory[t.offset:], value.Key)
 	t.offset += len(value.Key)
 
-	// Set the TTL. It's 8 bytes.
-	binary.BigEndian.PutUint64(t.memory[t.offset:], uint64(value.TTL))
+	// Set the TTL. It's 8 bytes. A key cannot live longer than its deadline.
+	binary.BigEndian.PutUint64(t.memory[t.offset:], uint64(clampTTL(value.TTL, value.Deadline)))
 	t.offset += 8
 
 	// Set the Timestamp. It's 8 bytes.
@@ -199,6 +207,8 @@ func (t *table) get(hkey uint64) (*VData, bool) {
 	vdata.Timestamp = int64(binary.BigEndian.Uint64(t.memory[offset : offset+8]))
 	offset += 8
 
+	vdata.Deadline = t.deadlines[hkey]
+
 	vlen := binary.BigEndian.Uint32(t.memory[offset : offset+4])
 	offset += 4
 	vdata.Value = t.memory[offset : offset+int(vlen)]
@@ -232,6 +242,7 @@ func (t *table) delete(hkey uint64) bool {
 
 	// Delete it from metadata
 	delete(t.hkeys, hkey)
+	delete(t.deadlines, hkey)
 
 	t.garbage += garbage
 	t.inuse -= garbage
@@ -249,11 +260,20 @@ func (t *table) updateTTL(hkey uint64, value *VData) bool {
 	klen := int(uint8(t.memory[offset]))
 	offset += 1 + klen
 
-	// Set the new TTL. It's 8 bytes.
-	binary.BigEndian.PutUint64(t.memory[offset:], uint64(value.TTL))
+	// Set the new TTL. It's 8 bytes. The deadline is kept.
+	binary.BigEndian.PutUint64(t.memory[offset:], uint64(clampTTL(value.TTL, t.deadlines[hkey])))
 	offset += 8
 
 	// Set the new Timestamp. It's 8 bytes.
 	binary.BigEndian.PutUint64(t.memory[offset:], uint64(value.Timestamp))
 	return false
 }
+
+// clampTTL returns the deadline if the TTL exceeds it. Zero means no expiry
+// for both of them.
+func clampTTL(ttl, deadline int64) int64 {
+	if deadline != 0 && (ttl == 0 || ttl > deadline) {
+		return deadline
+	}
+	return ttl
+}
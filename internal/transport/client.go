@@ -15,10 +15,14 @@
 package transport
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/buraksezer/olric/internal/protocol"
@@ -33,7 +37,10 @@ type Client struct {
 	dialer     *net.Dialer
 	config     *ClientConfig
 	roundrobin *RoundRobin
-	pools      map[string]pool.Pool
+	pools      map[string]*connPool
+	// muxes keeps the multiplexed connections by address. A nil value means
+	// that the peer doesn't support multiplexing, the pool is used instead.
+	muxes map[string]*muxConn
 }
 
 // ClientConfig configuration parameters of the client.
@@ -43,6 +50,53 @@ type ClientConfig struct {
 	KeepAlive   time.Duration
 	MinConn     int
 	MaxConn     int
+	IdleTimeout time.Duration
+
+	// WireCompression compresses the connection streams if the peer supports it.
+	WireCompression bool
+
+	// Multiplexing sends the requests to a peer over a single connection if the
+	// peer supports it. MaxMultiplexedRequests limits the concurrent requests on
+	// the connection, it's DefaultMaxMultiplexedRequests by default.
+	Multiplexing           bool
+	MaxMultiplexedRequests int
+}
+
+// PoolStats denotes utilization of a connection pool and the protocol
+// version negotiated with the peer.
+type PoolStats struct {
+	Idle            int
+	InUse           int
+	ProtocolVersion uint8
+	Compressed      bool
+	Multiplexed     bool
+	// MultiplexedRequests is the number of requests in flight on the
+	// multiplexed connection.
+	MultiplexedRequests int
+}
+
+// connPool wraps a pool.Pool to count the connections in use. It also keeps
+// the protocol version and the capabilities negotiated with the peer.
+type connPool struct {
+	pool.Pool
+	inUse        int32
+	negotiated   int32
+	version      uint32
+	capabilities uint64
+	// legacy is set if the peer drops the connection on OpHello. The next
+	// connections are used without the handshake.
+	legacy int32
+}
+
+// errHelloRejected means that the peer closed the connection instead of
+// answering OpHello.
+var errHelloRejected = errors.New("hello rejected")
+
+// timedConn records the last time a connection was released to its pool.
+// It's used to close the connections which stay idle for too long.
+type timedConn struct {
+	net.Conn
+	lastUsed int64
 }
 
 // NewClient returns a new Client.
@@ -54,6 +108,9 @@ func NewClient(cc *ClientConfig) *Client {
 	if cc.MaxConn == 0 {
 		cc.MaxConn = 1
 	}
+	if cc.MaxMultiplexedRequests == 0 {
+		cc.MaxMultiplexedRequests = DefaultMaxMultiplexedRequests
+	}
 
 	dialer := &net.Dialer{
 		Timeout:   cc.DialTimeout,
@@ -64,7 +121,8 @@ func NewClient(cc *ClientConfig) *Client {
 		roundrobin: NewRoundRobin(cc.Addrs),
 		dialer:     dialer,
 		config:     cc,
-		pools:      make(map[string]pool.Pool),
+		pools:      make(map[string]*connPool),
+		muxes:      make(map[string]*muxConn),
 	}
 	return c
 }
@@ -76,6 +134,12 @@ func (c *Client) Close() {
 	for _, p := range c.pools {
 		p.Close()
 	}
+	for _, m := range c.muxes {
+		if m != nil {
+			// The reader of the connection fails the pending requests.
+			_ = m.conn.Close()
+		}
+	}
 }
 
 // CloseWithAddr closes the connection for given addr, if any exists.
@@ -89,12 +153,150 @@ func (c *Client) CloseWithAddr(addr string) {
 	}
 }
 
-// getPool creates a new pool for a given addr or returns an exiting one.
-func (c *Client) getPool(addr string) (pool.Pool, error) {
-	factory := func() (net.Conn, error) {
-		return c.dialer.Dial("tcp", addr)
+// handshake exchanges the protocol version and the capabilities with the peer.
+// A peer which doesn't know OpHello is assumed to have version zero and
+// no optional capabilities. It returns errHelloRejected if the peer closes
+// the connection instead of responding.
+//
+// CapWireCompression is requested if WireCompression is set. The connection is
+// used without compression if the peer doesn't return it. CapMultiplexing is
+// requested for the multiplexed connections.
+func (c *Client) handshake(conn net.Conn, multiplex bool) (uint8, protocol.Capability, error) {
+	if c.config.DialTimeout != 0 {
+		if err := conn.SetDeadline(time.Now().Add(c.config.DialTimeout)); err != nil {
+			return 0, 0, err
+		}
+		defer func() {
+			_ = conn.SetDeadline(time.Time{})
+		}()
+	}
+
+	capabilities := protocol.Capabilities
+	if c.config.WireCompression {
+		capabilities |= protocol.CapWireCompression
+	}
+	if multiplex {
+		capabilities |= protocol.CapMultiplexing
+	}
+	req := &protocol.Message{
+		Header: protocol.Header{
+			Magic: protocol.MagicReq,
+			Op:    protocol.OpHello,
+		},
+		Extra: protocol.HelloExtra{
+			Version:      protocol.Version,
+			Capabilities: uint64(capabilities),
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return 0, 0, err
+	}
+	var resp protocol.Message
+	if err := resp.Read(conn); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return 0, 0, err
+		}
+		return 0, 0, errHelloRejected
+	}
+	if resp.Status != protocol.StatusOK {
+		// Legacy peer
+		return 0, 0, nil
+	}
+
+	peer := protocol.HelloExtra{}
+	err := binary.Read(bytes.NewReader(resp.Value), binary.BigEndian, &peer)
+	if err != nil {
+		return 0, 0, err
+	}
+	version := protocol.Version
+	if peer.Version < version {
+		version = peer.Version
+	}
+	return version, capabilities & protocol.Capability(peer.Capabilities), nil
+}
+
+// dial connects to addr, negotiates the protocol with the peer and records
+// the result in the pool.
+func (c *Client) dial(cpool *connPool, addr string, multiplex bool) (net.Conn, error) {
+	conn, err := c.dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.LoadInt32(&cpool.legacy) == 1 {
+		if multiplex {
+			_ = conn.Close()
+			return nil, nil
+		}
+		return conn, nil
+	}
+	version, capabilities, err := c.handshake(conn, multiplex)
+	if err == errHelloRejected {
+		// The peer predates OpHello. Dial again and use the connection as
+		// version zero with no capabilities.
+		_ = conn.Close()
+		atomic.StoreUint32(&cpool.version, 0)
+		atomic.StoreUint64(&cpool.capabilities, 0)
+		atomic.StoreInt32(&cpool.legacy, 1)
+		atomic.StoreInt32(&cpool.negotiated, 1)
+		return c.dial(cpool, addr, multiplex)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	// The capabilities of the pool don't include CapMultiplexing, it's only
+	// negotiated for the multiplexed connection.
+	atomic.StoreUint32(&cpool.version, uint32(version))
+	atomic.StoreUint64(&cpool.capabilities, uint64(capabilities&^protocol.CapMultiplexing))
+	atomic.StoreInt32(&cpool.negotiated, 1)
+	if capabilities&protocol.CapWireCompression != 0 {
+		conn = newCompressedConn(conn)
+	}
+	if multiplex && capabilities&protocol.CapMultiplexing == 0 {
+		// The peer doesn't support it.
+		_ = conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// getMux returns the multiplexed connection to addr. It dials a new one if
+// there isn't any. It returns nil if the peer doesn't support multiplexing.
+func (c *Client) getMux(addr string) (*muxConn, error) {
+	cpool, err := c.getPool(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.muxes[addr]
+	if ok {
+		return m, nil
+	}
+	conn, err := c.dial(cpool, addr, true)
+	if err != nil {
+		return nil, err
 	}
+	if conn != nil {
+		m = newMuxConn(conn, c.config.MaxMultiplexedRequests, func() {
+			c.removeMux(addr, m)
+		})
+	}
+	c.muxes[addr] = m
+	return m, nil
+}
 
+func (c *Client) removeMux(addr string, m *muxConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cur, ok := c.muxes[addr]; ok && cur == m {
+		delete(c.muxes, addr)
+	}
+}
+
+// getPool creates a new pool for a given addr or returns an exiting one.
+func (c *Client) getPool(addr string) (*connPool, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -103,14 +305,106 @@ func (c *Client) getPool(addr string) (pool.Pool, error) {
 		return cpool, nil
 	}
 
-	cpool, err := pool.NewChannelPool(c.config.MinConn, c.config.MaxConn, factory)
+	cpool = &connPool{}
+	factory := func() (net.Conn, error) {
+		conn, err := c.dial(cpool, addr, false)
+		if err != nil {
+			return nil, err
+		}
+		return &timedConn{
+			Conn:     conn,
+			lastUsed: time.Now().UnixNano(),
+		}, nil
+	}
+
+	p, err := pool.NewChannelPool(c.config.MinConn, c.config.MaxConn, factory)
 	if err != nil {
 		return nil, err
 	}
+	cpool.Pool = p
 	c.pools[addr] = cpool
 	return cpool, nil
 }
 
+// getConn returns a connection from the pool. It closes the connections which
+// stay idle longer than IdleTimeout and tries again.
+func (c *Client) getConn(cpool *connPool) (net.Conn, error) {
+	for {
+		conn, err := cpool.Get()
+		if err != nil {
+			return nil, err
+		}
+		if c.config.IdleTimeout == 0 {
+			return conn, nil
+		}
+		pc, _ := conn.(*pool.PoolConn)
+		tc, ok := pc.Conn.(*timedConn)
+		if !ok {
+			return conn, nil
+		}
+		idle := time.Duration(time.Now().UnixNano() - atomic.LoadInt64(&tc.lastUsed))
+		if idle < c.config.IdleTimeout {
+			return conn, nil
+		}
+		// It's stale. Let the pool close it and try the next one.
+		pc.MarkUnusable()
+		if err = pc.Close(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "[ERROR] Failed to close idle connection: %v", err)
+		}
+	}
+}
+
+// Stats returns utilization of the connection pools by address.
+func (c *Client) Stats() map[string]PoolStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res := make(map[string]PoolStats, len(c.pools))
+	for addr, p := range c.pools {
+		capabilities := protocol.Capability(atomic.LoadUint64(&p.capabilities))
+		ps := PoolStats{
+			Idle:            p.Len(),
+			InUse:           int(atomic.LoadInt32(&p.inUse)),
+			ProtocolVersion: uint8(atomic.LoadUint32(&p.version)),
+			Compressed:      capabilities&protocol.CapWireCompression != 0,
+		}
+		if m := c.muxes[addr]; m != nil {
+			ps.Multiplexed = true
+			ps.MultiplexedRequests = int(atomic.LoadInt32(&m.inFlight))
+		}
+		res[addr] = ps
+	}
+	return res
+}
+
+// Supports returns true if the peer on the given address supports the given
+// capability. It dials the peer to negotiate the protocol version, if it's
+// not done yet.
+func (c *Client) Supports(addr string, cp protocol.Capability) (bool, error) {
+	if c.config.Multiplexing {
+		// Negotiate on the multiplexed connection instead of a pooled one.
+		if _, err := c.getMux(addr); err != nil {
+			return false, err
+		}
+	}
+	cpool, err := c.getPool(addr)
+	if err != nil {
+		return false, err
+	}
+	if atomic.LoadInt32(&cpool.negotiated) == 0 {
+		conn, err := c.getConn(cpool)
+		if err != nil {
+			return false, err
+		}
+		// Return it to the pool.
+		if err = conn.Close(); err != nil {
+			return false, err
+		}
+	}
+	capabilities := protocol.Capability(atomic.LoadUint64(&cpool.capabilities))
+	return capabilities&cp == cp, nil
+}
+
 // ClosePool closes the underlying connections in a pool,
 // deletes from Olric's pools map and frees resources.
 func (c *Client) ClosePool(addr string) {
@@ -124,27 +418,52 @@ func (c *Client) ClosePool(addr string) {
 		// Delete from Olric.
 		delete(c.pools, addr)
 	}
+	if m := c.muxes[addr]; m != nil {
+		_ = m.conn.Close()
+	}
+	delete(c.muxes, addr)
 }
 
 // RequestTo initiates a request-response cycle to given host.
 func (c *Client) RequestTo(addr string, op protocol.OpCode, req *protocol.Message) (*protocol.Message, error) {
+	req.Magic = protocol.MagicReq
+	req.Op = op
+	if c.config.Multiplexing {
+		m, err := c.getMux(addr)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			return m.request(req)
+		}
+	}
+
 	cpool, err := c.getPool(addr)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Magic = protocol.MagicReq
-	req.Op = op
-
-	conn, err := cpool.Get()
+	conn, err := c.getConn(cpool)
 	if err != nil {
 		return nil, err
 	}
+	if uint32(op.MinVersion()) > atomic.LoadUint32(&cpool.version) {
+		// The peer doesn't know the operation. Don't send it.
+		if err = conn.Close(); err != nil {
+			return nil, err
+		}
+		return req.Error(protocol.StatusErrUnknownOperation, fmt.Errorf("%s is not supported by %s", op, addr)), nil
+	}
+	atomic.AddInt32(&cpool.inUse, 1)
 
 	var deadConn bool
 	defer func() {
+		atomic.AddInt32(&cpool.inUse, -1)
 		var connErr error
 		if !(deadConn) {
+			if tc, ok := conn.(*pool.PoolConn).Conn.(*timedConn); ok {
+				atomic.StoreInt64(&tc.lastUsed, time.Now().UnixNano())
+			}
 			// The conn returns to the pool
 			connErr = conn.Close()
 		} else {
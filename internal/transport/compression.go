@@ -0,0 +1,58 @@
+// Copyright 2018 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"compress/flate"
+	"io"
+	"net"
+)
+
+// compressedConn compresses a connection stream with DEFLATE. A message is
+// written with a single Write call and every call is flushed, so the peer is
+// able to decode the message without waiting for the next one.
+type compressedConn struct {
+	net.Conn
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+func newCompressedConn(conn net.Conn) *compressedConn {
+	// NewWriter returns an error only for an invalid level.
+	w, _ := flate.NewWriter(conn, flate.BestSpeed)
+	return &compressedConn{
+		Conn: conn,
+		r:    flate.NewReader(conn),
+		w:    w,
+	}
+}
+
+func (c *compressedConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.ErrUnexpectedEOF {
+		// The stream is never finished, the decompressor reports a closed
+		// connection as an unexpected EOF.
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (c *compressedConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+// DefaultMaxMultiplexedRequests is the default number of concurrent requests
+// on a multiplexed connection.
+const DefaultMaxMultiplexedRequests = 256
+
+// writeFrame writes the message prefixed with its request ID in a single Write
+// call. The frames of a multiplexed connection are written by many goroutines.
+func writeFrame(w io.Writer, id uint32, msg *protocol.Message) error {
+	var buf bytes.Buffer
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], id)
+	buf.Write(hdr[:])
+	if err := msg.Write(&buf); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readFrameID reads the request ID of the next frame.
+func readFrameID(r io.Reader) (uint32, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(hdr[:]), nil
+}
+
+type muxResult struct {
+	resp *protocol.Message
+	err  error
+}
+
+// muxConn multiplexes the concurrent requests over a single connection. The
+// messages are prefixed with a request ID and the responses are matched by it,
+// they may arrive in any order.
+type muxConn struct {
+	conn    net.Conn
+	wmtx    sync.Mutex
+	slots   chan struct{}
+	onClose func()
+
+	mtx     sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan muxResult
+	err     error
+
+	inFlight int32
+}
+
+func newMuxConn(conn net.Conn, limit int, onClose func()) *muxConn {
+	m := &muxConn{
+		conn:    conn,
+		slots:   make(chan struct{}, limit),
+		onClose: onClose,
+		pending: make(map[uint32]chan muxResult),
+	}
+	go m.readLoop()
+	return m
+}
+
+func (m *muxConn) readLoop() {
+	for {
+		id, err := readFrameID(m.conn)
+		if err != nil {
+			m.close(err)
+			return
+		}
+		var resp protocol.Message
+		if err = resp.Read(m.conn); err != nil {
+			m.close(err)
+			return
+		}
+		m.mtx.Lock()
+		ch, ok := m.pending[id]
+		delete(m.pending, id)
+		m.mtx.Unlock()
+		if ok {
+			ch <- muxResult{resp: &resp}
+		}
+	}
+}
+
+// close fails the pending requests and closes the connection. The next request
+// to the peer dials a new one.
+func (m *muxConn) close(err error) {
+	if err == nil || err == io.EOF {
+		err = protocol.ErrConnClosed
+	}
+	m.mtx.Lock()
+	if m.err != nil {
+		m.mtx.Unlock()
+		return
+	}
+	m.err = err
+	for id, ch := range m.pending {
+		ch <- muxResult{err: err}
+		delete(m.pending, id)
+	}
+	m.mtx.Unlock()
+
+	_ = m.conn.Close()
+	if m.onClose != nil {
+		m.onClose()
+	}
+}
+
+// request sends the request and waits for its response. It blocks if there are
+// already MaxMultiplexedRequests requests in flight on the connection.
+func (m *muxConn) request(req *protocol.Message) (*protocol.Message, error) {
+	m.slots <- struct{}{}
+	defer func() { <-m.slots }()
+	atomic.AddInt32(&m.inFlight, 1)
+	defer atomic.AddInt32(&m.inFlight, -1)
+
+	ch := make(chan muxResult, 1)
+	m.mtx.Lock()
+	if m.err != nil {
+		m.mtx.Unlock()
+		return nil, m.err
+	}
+	m.nextID++
+	id := m.nextID
+	m.pending[id] = ch
+	m.mtx.Unlock()
+
+	m.wmtx.Lock()
+	err := writeFrame(m.conn, id, req)
+	m.wmtx.Unlock()
+	if err != nil {
+		m.close(err)
+	}
+	res := <-ch
+	return res.resp, res.err
+}
@@ -15,7 +15,10 @@
 package transport
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"fmt"
 	"io"
 	"net"
 	"sync"
@@ -42,11 +45,21 @@ type Server struct {
 	wg              sync.WaitGroup
 	listener        net.Listener
 	dispatcher      func(*protocol.Message) *protocol.Message
+	maxMessageSize  uint32
 	StartCh         chan struct{}
 	ctx             context.Context
 	cancel          context.CancelFunc
 }
 
+// serverConn is an incoming connection. The stream is replaced with a compressed
+// one if the peer asks for it during the handshake.
+type serverConn struct {
+	net.Conn
+	stream io.ReadWriter
+	// capabilities negotiated with the peer. It's zero for a legacy peer.
+	capabilities protocol.Capability
+}
+
 // NewServer creates and returns a new Server.
 func NewServer(addr string, logger *flog.Logger, keepalivePeriod time.Duration) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -64,10 +77,23 @@ func (s *Server) SetDispatcher(f func(*protocol.Message) *protocol.Message) {
 	s.dispatcher = f
 }
 
+// SetMaxMessageSize sets the maximum body length of the incoming requests.
+// Zero means no limit.
+func (s *Server) SetMaxMessageSize(size uint32) {
+	s.maxMessageSize = size
+}
+
 // processRequest waits for a new request, handles it and returns the appropriate response.
-func (s *Server) processRequest(req *protocol.Message, conn io.ReadWriter, connStatus *uint32) error {
+func (s *Server) processRequest(req *protocol.Message, sc *serverConn, connStatus *uint32) error {
+	conn := sc.stream
 	// Read reads the incoming message from the underlying TCP socket and parses
-	err := req.Read(conn)
+	err := req.ReadWithLimit(conn, s.maxMessageSize)
+	if err == protocol.ErrMessageTooLarge {
+		// The body has already been discarded, the connection is still usable.
+		resp := req.Error(protocol.StatusErrMessageTooLarge,
+			fmt.Sprintf("message body is %d bytes, limit is %d", req.BodyLen, s.maxMessageSize))
+		return errors.WithMessage(resp.Write(conn), "failed to write response")
+	}
 	if err != nil {
 		return errors.WithMessage(err, "failed to read request")
 	}
@@ -78,13 +104,57 @@ func (s *Server) processRequest(req *protocol.Message, conn io.ReadWriter, connS
 	// Mark connection as idle before start waiting a new request
 	defer atomic.StoreUint32(connStatus, idleConn)
 
-	// The dispatcher is defined by olric package and responsible to evaluate the incoming message.
-	resp := s.dispatcher(req)
+	var resp *protocol.Message
+	if req.Op == protocol.OpHello {
+		// Protocol negotiation is handled here. It doesn't depend on the state of the node.
+		resp, sc.capabilities, err = hello(req)
+		if err != nil {
+			return errors.WithMessage(err, "failed to negotiate protocol version")
+		}
+		if sc.capabilities&protocol.CapWireCompression != 0 {
+			// The response is not compressed, the peer switches after reading it.
+			if err = resp.Write(conn); err != nil {
+				return errors.WithMessage(err, "failed to write response")
+			}
+			sc.stream = newCompressedConn(sc.Conn)
+			return nil
+		}
+	} else {
+		// The dispatcher is defined by olric package and responsible to evaluate the incoming message.
+		resp = s.dispatcher(req)
+		if sc.capabilities&protocol.CapResponseExtras == 0 {
+			// The peer cannot skip the extras of a response.
+			resp.Extra = nil
+		}
+	}
 	err = resp.Write(conn)
 	// WithMessage returns nil, if the err is nil.
 	return errors.WithMessage(err, "failed to write response")
 }
 
+// hello returns the protocol version and the capabilities of this node. It also
+// returns the capabilities negotiated with the peer. CapWireCompression and
+// CapMultiplexing are always accepted if the peer asks for them.
+func hello(req *protocol.Message) (*protocol.Message, protocol.Capability, error) {
+	capabilities := protocol.Capabilities
+	var peer protocol.Capability
+	if extra, ok := req.Extra.(protocol.HelloExtra); ok {
+		peer = protocol.Capability(extra.Capabilities)
+	}
+	capabilities |= peer & (protocol.CapWireCompression | protocol.CapMultiplexing)
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.BigEndian, protocol.HelloExtra{
+		Version:      protocol.Version,
+		Capabilities: uint64(capabilities),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	resp := req.Success()
+	resp.Value = buf.Bytes()
+	return resp, capabilities & peer, nil
+}
+
 // processConn waits for requests and calls request handlers to generate a response. The connections are reusable.
 func (s *Server) processConn(conn net.Conn) {
 	defer s.wg.Done()
@@ -140,11 +210,19 @@ func (s *Server) processConn(conn net.Conn) {
 		}
 	}()
 
+	sc := &serverConn{
+		Conn:   conn,
+		stream: conn,
+	}
 	for {
+		if sc.capabilities&protocol.CapMultiplexing != 0 {
+			s.processMux(sc, &connStatus)
+			break
+		}
 		var req protocol.Message
 		// processRequest waits to read a message from the TCP socket.
 		// Then calls its handler to generate a response.
-		err := s.processRequest(&req, conn, &connStatus)
+		err := s.processRequest(&req, sc, &connStatus)
 		if err != nil {
 			// The socket probably would have been closed by the client.
 			if errors.Cause(err) == io.EOF || errors.Cause(err) == protocol.ErrConnClosed {
@@ -153,7 +231,7 @@ func (s *Server) processConn(conn net.Conn) {
 
 			// Protocol error. Prepare an error message and return it.
 			errResp := req.Error(protocol.StatusInternalServerError, err)
-			err = errResp.Write(conn)
+			err = errResp.Write(sc.stream)
 			if err != nil {
 				// Failed to write to the socket. Fail early. This should be a bug or
 				// the underlying TCP socket is unstable or unusable.
@@ -165,6 +243,72 @@ func (s *Server) processConn(conn net.Conn) {
 	}
 }
 
+// processMux serves a multiplexed connection. The requests are dispatched
+// concurrently and the responses are written with their request IDs as they
+// are ready. The client limits the number of concurrent requests.
+func (s *Server) processMux(sc *serverConn, connStatus *uint32) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var mtx sync.Mutex
+	var inFlight int
+	track := func(delta int) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		inFlight += delta
+		if inFlight == 0 {
+			atomic.StoreUint32(connStatus, idleConn)
+		} else {
+			atomic.StoreUint32(connStatus, busyConn)
+		}
+	}
+
+	var wmtx sync.Mutex
+	respond := func(id uint32, resp *protocol.Message) {
+		if sc.capabilities&protocol.CapResponseExtras == 0 {
+			resp.Extra = nil
+		}
+		wmtx.Lock()
+		defer wmtx.Unlock()
+		if err := writeFrame(sc.stream, id, resp); err != nil {
+			s.log.V(2).Printf("[ERROR] Failed to write response: %v", err)
+		}
+	}
+
+	for {
+		id, err := readFrameID(sc.stream)
+		if err != nil {
+			if err != io.EOF {
+				s.log.V(5).Printf("[DEBUG] Failed to read request: %v", err)
+			}
+			return
+		}
+		req := &protocol.Message{}
+		err = req.ReadWithLimit(sc.stream, s.maxMessageSize)
+		if err == protocol.ErrMessageTooLarge {
+			// The body has already been discarded, the connection is still usable.
+			respond(id, req.Error(protocol.StatusErrMessageTooLarge,
+				fmt.Sprintf("message body is %d bytes, limit is %d", req.BodyLen, s.maxMessageSize)))
+			continue
+		}
+		if err != nil {
+			if errors.Cause(err) != protocol.ErrConnClosed {
+				s.log.V(2).Printf("[ERROR] Failed to read request: %v", err)
+			}
+			return
+		}
+
+		track(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer track(-1)
+			// The dispatcher is defined by olric package and responsible to evaluate the incoming message.
+			respond(id, s.dispatcher(req))
+		}()
+	}
+}
+
 // listenAndServe calls Accept on given net.Listener.
 func (s *Server) listenAndServe() error {
 	close(s.StartCh)
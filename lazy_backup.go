@@ -0,0 +1,228 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/stats"
+)
+
+// lazyBuffer keeps the pending replica writes to a backup owner.
+type lazyBuffer struct {
+	// Serializes the flushes to keep the order of the writes.
+	flushMtx sync.Mutex
+
+	buf   bytes.Buffer
+	count int
+	// The time when the oldest pending write is buffered, in nanoseconds.
+	oldest int64
+	failed uint64
+}
+
+// lazyBackups buffers the replica writes per backup owner in LazyBackupMode.
+type lazyBackups struct {
+	mtx     sync.Mutex
+	size    int
+	buffers map[string]*lazyBuffer
+	full    chan struct{}
+}
+
+func newLazyBackups(size int) *lazyBackups {
+	return &lazyBackups{
+		size:    size,
+		buffers: make(map[string]*lazyBuffer),
+		full:    make(chan struct{}, 1),
+	}
+}
+
+// add appends a replica write to the buffer of the backup owner. It signals
+// the flusher if the buffer is full.
+func (l *lazyBackups) add(addr string, op protocol.OpCode, req *protocol.Message) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	b, ok := l.buffers[addr]
+	if !ok {
+		b = &lazyBuffer{}
+		l.buffers[addr] = b
+	}
+	req.Magic = protocol.MagicReq
+	req.Op = op
+	if err := req.Write(&b.buf); err != nil {
+		return err
+	}
+	b.count++
+	if b.count == 1 {
+		b.oldest = time.Now().UnixNano()
+	}
+	if b.count >= l.size {
+		select {
+		case l.full <- struct{}{}:
+		default:
+			// A flush is already requested.
+		}
+	}
+	return nil
+}
+
+// take returns the pending writes of the backup owner and resets its buffer.
+func (l *lazyBackups) take(b *lazyBuffer) ([]byte, int) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	data := make([]byte, b.buf.Len())
+	copy(data, b.buf.Bytes())
+	count := b.count
+	b.buf.Reset()
+	b.count = 0
+	b.oldest = 0
+	return data, count
+}
+
+func (l *lazyBackups) load(addr string) (*lazyBuffer, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	b, ok := l.buffers[addr]
+	return b, ok
+}
+
+func (l *lazyBackups) addrs() []string {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	addrs := make([]string, 0, len(l.buffers))
+	for addr := range l.buffers {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+func (l *lazyBackups) stats() map[string]stats.LazyBackup {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := time.Now().UnixNano()
+	res := make(map[string]stats.LazyBackup, len(l.buffers))
+	for addr, b := range l.buffers {
+		s := stats.LazyBackup{
+			Pending: b.count,
+			Failed:  atomic.LoadUint64(&b.failed),
+		}
+		if b.count > 0 {
+			s.Lag = time.Duration(now - b.oldest)
+		}
+		res[addr] = s
+	}
+	return res
+}
+
+// flushLazyBackup sends the pending replica writes to a backup owner in
+// a pipelined request.
+func (db *Olric) flushLazyBackup(addr string) {
+	b, ok := db.lazyBackups.load(addr)
+	if !ok {
+		return
+	}
+	b.flushMtx.Lock()
+	defer b.flushMtx.Unlock()
+
+	data, count := db.lazyBackups.take(b)
+	if count == 0 {
+		return
+	}
+	req := &protocol.Message{Value: data}
+	resp, err := db.requestTo(addr, protocol.OpPipeline, req)
+	if err != nil {
+		atomic.AddUint64(&b.failed, uint64(count))
+		db.log.V(3).Printf("[ERROR] Failed to flush %d replica writes to %s: %v", count, addr, err)
+		return
+	}
+
+	conn := bytes.NewBuffer(resp.Value)
+	for {
+		var pres protocol.Message
+		err = pres.Read(conn)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			db.log.V(3).Printf("[ERROR] Failed to read pipelined response from %s: %v", addr, err)
+			break
+		}
+		if pres.Status != protocol.StatusOK {
+			atomic.AddUint64(&b.failed, 1)
+			db.log.V(3).Printf("[ERROR] Failed to apply replica write of key: %s on DMap: %s on %s: %s",
+				pres.Key, pres.DMap, addr, string(pres.Value))
+		}
+	}
+}
+
+func (db *Olric) flushLazyBackups() {
+	for _, addr := range db.lazyBackups.addrs() {
+		db.flushLazyBackup(addr)
+	}
+}
+
+// lazyBackupFlusher flushes the buffered replica writes periodically or when
+// a buffer is full.
+func (db *Olric) lazyBackupFlusher() {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(db.config.LazyBackupFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.ctx.Done():
+			// Try to deliver the last writes before leaving.
+			db.flushLazyBackups()
+			return
+		case <-ticker.C:
+			db.flushLazyBackups()
+		case <-db.lazyBackups.full:
+			db.flushLazyBackups()
+		}
+	}
+}
+
+// lazyPutOnCluster stores the key/value pair on the partition owner and buffers
+// the replica writes. See config.LazyBackupMode.
+func (db *Olric) lazyPutOnCluster(hkey uint64, dm *dmap, w *writeop) error {
+	err := db.localPut(hkey, dm, w)
+	if err != nil {
+		return err
+	}
+	for _, owner := range db.getDMapBackupOwners(w.dmap, hkey) {
+		err = db.lazyBackups.add(owner.String(), w.replicaOpcode, w.toReq(w.replicaOpcode))
+		if err != nil {
+			db.log.V(3).Printf("[ERROR] Failed to buffer replica write for %s: %v", owner, err)
+		}
+	}
+	return nil
+}
+
+// flushBeforeDelete sends the buffered writes to a backup owner before a delete
+// request. Otherwise, a buffered write may bring the deleted key back.
+func (db *Olric) flushBeforeDelete(backup discovery.Member) {
+	if db.config.BackupMode == config.LazyBackupMode {
+		db.flushLazyBackup(backup.String())
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+)
+
+func testLazyBackupConfig() *config.Config {
+	c := testConfig(nil)
+	c.BackupMode = config.LazyBackupMode
+	// Flush manually.
+	c.LazyBackupFlushInterval = time.Hour
+	return c
+}
+
+func TestLazyBackup(t *testing.T) {
+	db1, err := newDB(testLazyBackupConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db1.Shutdown(context.Background())
+		if err != nil {
+			db1.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	db2, err := newDB(testLazyBackupConfig(), db1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db2.Shutdown(context.Background())
+		if err != nil {
+			db2.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	syncClusterMembers(db1, db2)
+
+	dbs := []*Olric{db1, db2}
+	backupLength := func() int {
+		var total int
+		for _, db := range dbs {
+			for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+				total += db.backups[partID].length()
+			}
+		}
+		return total
+	}
+	pending := func() int {
+		var total int
+		for _, db := range dbs {
+			s, err := db.Stats()
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			for _, lb := range s.LazyBackups {
+				total += lb.Pending
+			}
+		}
+		return total
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	if backupLength() != 0 {
+		t.Fatalf("Expected backup key count: 0. Got: %d", backupLength())
+	}
+	if pending() != 10 {
+		t.Fatalf("Expected pending replica write count: 10. Got: %d", pending())
+	}
+
+	for _, db := range dbs {
+		db.flushLazyBackups()
+	}
+	if backupLength() != 10 {
+		t.Fatalf("Expected backup key count: 10. Got: %d", backupLength())
+	}
+	if pending() != 0 {
+		t.Fatalf("Expected pending replica write count: 0. Got: %d", pending())
+	}
+
+	// A buffered write shouldn't bring a deleted key back.
+	err = dm.Put(bkey(100), bval(100))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Delete(bkey(100))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for _, db := range dbs {
+		db.flushLazyBackups()
+	}
+	if backupLength() != 10 {
+		t.Fatalf("Expected backup key count: 10. Got: %d", backupLength())
+	}
+}
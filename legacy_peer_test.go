@@ -0,0 +1,131 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/transport"
+)
+
+// legacyPeer is a server which drops the connection on OpHello and responds
+// to the other operations with StatusOK.
+type legacyPeer struct {
+	mu       sync.Mutex
+	listener net.Listener
+	ops      []protocol.OpCode
+}
+
+func newLegacyPeer(t *testing.T) *legacyPeer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	p := &legacyPeer{listener: l}
+	go p.serve()
+	return p
+}
+
+func (p *legacyPeer) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				var req protocol.Message
+				if err := req.Read(conn); err != nil {
+					return
+				}
+				p.mu.Lock()
+				p.ops = append(p.ops, req.Op)
+				p.mu.Unlock()
+				if req.Op == protocol.OpHello {
+					return
+				}
+				if err := req.Success().Write(conn); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (p *legacyPeer) received() []protocol.OpCode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]protocol.OpCode(nil), p.ops...)
+}
+
+func TestTransport_LegacyPeer(t *testing.T) {
+	peer := newLegacyPeer(t)
+	defer peer.listener.Close()
+	addr := peer.listener.Addr().String()
+
+	c := transport.NewClient(&transport.ClientConfig{
+		Addrs:       []string{addr},
+		DialTimeout: time.Second,
+		MaxConn:     2,
+	})
+	defer c.Close()
+
+	req := &protocol.Message{DMap: "mymap", Key: "mykey"}
+	resp, err := c.RequestTo(addr, protocol.OpGet, req)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if resp.Status != protocol.StatusOK {
+		t.Fatalf("Expected StatusOK. Got: %d", resp.Status)
+	}
+	if v := c.Stats()[addr].ProtocolVersion; v != 0 {
+		t.Fatalf("Expected protocol version 0. Got: %d", v)
+	}
+
+	ok, err := c.Supports(addr, protocol.CapGetAll)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if ok {
+		t.Fatalf("Expected the legacy peer not to support CapGetAll")
+	}
+
+	// The new operations are not sent to the legacy peer.
+	resp, err = c.RequestTo(addr, protocol.OpGetAll, &protocol.Message{DMap: "mymap"})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if resp.Status != protocol.StatusErrUnknownOperation {
+		t.Fatalf("Expected StatusErrUnknownOperation. Got: %d", resp.Status)
+	}
+
+	var hello int
+	for _, op := range peer.received() {
+		switch op {
+		case protocol.OpHello:
+			hello++
+		case protocol.OpGetAll:
+			t.Fatalf("Expected OpGetAll not to be sent to the legacy peer")
+		}
+	}
+	if hello != 1 {
+		t.Fatalf("Expected one OpHello. Got: %d", hello)
+	}
+}
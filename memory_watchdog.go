@@ -0,0 +1,162 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/stats"
+)
+
+// memoryWatchdogInterval is the period to check the memory usage against
+// GlobalMaxMemory.
+const memoryWatchdogInterval = time.Second
+
+// memoryStats keeps the state of the global eviction.
+type memoryStats struct {
+	usage   int64
+	runs    uint64
+	evicted uint64
+}
+
+func (m *memoryStats) stats() stats.Memory {
+	return stats.Memory{
+		Usage:   atomic.LoadInt64(&m.usage),
+		Runs:    atomic.LoadUint64(&m.runs),
+		Evicted: atomic.LoadUint64(&m.evicted),
+	}
+}
+
+// memoryUsage returns the number of bytes in use by the keys and the values
+// on this member, including the backups.
+func (db *Olric) memoryUsage() int {
+	var total int
+	for _, parts := range []map[uint64]*partition{db.partitions, db.backups} {
+		for _, part := range parts {
+			part.m.Range(func(_, tmp interface{}) bool {
+				dm := tmp.(*dmap)
+				dm.RLock()
+				total += dm.storage.Inuse()
+				dm.RUnlock()
+				return true
+			})
+		}
+	}
+	return total
+}
+
+// reclaimMemory deletes the expired keys and evicts the keys of the DMaps with
+// LRU eviction policy on the primary partitions of this member to bring the
+// memory usage down to the target. It returns the number of deleted keys.
+func (db *Olric) reclaimMemory(target int) int {
+	type candidate struct {
+		name  string
+		dm    *dmap
+		inuse int
+	}
+
+	var evicted int
+	var candidates []candidate
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		if !hostCmp(part.owner(), db.this) {
+			continue
+		}
+		part.m.Range(func(name, tmp interface{}) bool {
+			dm := tmp.(*dmap)
+			// The expired keys go first.
+			evicted += db.deleteExpiredOnPartition(name.(string), dm)
+			if dm.cache != nil && dm.cache.evictionPolicy == config.LRUEviction {
+				dm.RLock()
+				candidates = append(candidates, candidate{
+					name:  name.(string),
+					dm:    dm,
+					inuse: dm.storage.Inuse(),
+				})
+				dm.RUnlock()
+			}
+			return true
+		})
+	}
+
+	usage := db.memoryUsage()
+	if usage <= target {
+		return evicted
+	}
+	var total int
+	for _, c := range candidates {
+		total += c.inuse
+	}
+	if total == 0 {
+		return evicted
+	}
+
+	// Every DMap frees memory in proportion to its usage.
+	excess := usage - target
+	for _, c := range candidates {
+		share := excess * c.inuse / total
+		c.dm.Lock()
+		start := c.dm.storage.Inuse()
+		for start-c.dm.storage.Inuse() < share {
+			if err := db.evictKeyWithLRU(c.dm, c.name); err != nil {
+				db.log.V(3).Printf("[ERROR] Failed to evict a key on DMap: %s: %v", c.name, err)
+				break
+			}
+			evicted++
+		}
+		c.dm.Unlock()
+	}
+	return evicted
+}
+
+// checkMemory runs the global eviction if the memory usage exceeds GlobalMaxMemory.
+func (db *Olric) checkMemory() {
+	usage := db.memoryUsage()
+	atomic.StoreInt64(&db.memory.usage, int64(usage))
+	if usage <= db.config.GlobalMaxMemory {
+		return
+	}
+
+	target := int(float64(db.config.GlobalMaxMemory) * db.config.GlobalMemoryLowWatermark)
+	evicted := db.reclaimMemory(target)
+	atomic.AddUint64(&db.memory.runs, 1)
+	atomic.AddUint64(&db.memory.evicted, uint64(evicted))
+
+	reclaimed := db.memoryUsage()
+	atomic.StoreInt64(&db.memory.usage, int64(reclaimed))
+	db.log.V(2).Printf("[INFO] Global eviction deleted %d keys. Memory usage: %d -> %d bytes",
+		evicted, usage, reclaimed)
+	if reclaimed > db.config.GlobalMaxMemory {
+		db.log.V(2).Printf("[WARN] Memory usage is still above GlobalMaxMemory: %d bytes", reclaimed)
+	}
+}
+
+// memoryWatchdog checks the memory usage periodically. See config.GlobalMaxMemory.
+func (db *Olric) memoryWatchdog() {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(memoryWatchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.ctx.Done():
+			return
+		case <-ticker.C:
+			db.checkMemory()
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+
+	"github.com/buraksezer/olric/config"
+)
+
+func TestMemoryWatchdog(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.GlobalMaxMemory = 1 << 30
+	c.Cache = &config.CacheConfig{
+		DMapConfigs: map[string]config.DMapCacheConfig{
+			"lru": {EvictionPolicy: config.LRUEviction},
+		},
+	}
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	lru, err := db.NewDMap("lru")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	plain, err := db.NewDMap("plain")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		err = lru.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		err = plain.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	length := func(name string) int {
+		var total int
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			tmp, ok := db.partitions[partID].m.Load(name)
+			if !ok {
+				continue
+			}
+			total += tmp.(*dmap).storage.Len()
+		}
+		return total
+	}
+
+	// Cut the limit by half.
+	db.config.GlobalMaxMemory = db.memoryUsage() / 2
+	db.checkMemory()
+
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if s.Memory.Runs != 1 {
+		t.Fatalf("Expected global eviction run count: 1. Got: %d", s.Memory.Runs)
+	}
+	if s.Memory.Evicted == 0 {
+		t.Fatalf("Expected evicted key count is greater than zero")
+	}
+	if s.Memory.Usage > int64(db.config.GlobalMaxMemory) {
+		t.Fatalf("Expected memory usage is less than %d. Got: %d", db.config.GlobalMaxMemory, s.Memory.Usage)
+	}
+	if length("lru") >= 1000 {
+		t.Fatalf("Expected some keys to be evicted on the LRU DMap")
+	}
+	if length("plain") != 10 {
+		t.Fatalf("Expected key count on the DMap without eviction policy: 10. Got: %d", length("plain"))
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+// latencyBuckets are the upper bounds of the operation latency histogram, in seconds.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// opCounters keeps the counters of an operation on a DMap.
+type opCounters struct {
+	total               uint64
+	hits                uint64
+	misses              uint64
+	readQuorumFailures  uint64
+	writeQuorumFailures uint64
+}
+
+// opHistogram keeps the latency distribution of an operation.
+type opHistogram struct {
+	buckets []uint64
+	count   uint64
+	sum     int64
+}
+
+type opCountersKey struct {
+	dmap string
+	op   protocol.OpCode
+}
+
+// metrics keeps the counters and the histograms exported in Prometheus text
+// format. See config.MetricsAddr.
+type metrics struct {
+	mtx        sync.RWMutex
+	counters   map[opCountersKey]*opCounters
+	histograms map[protocol.OpCode]*opHistogram
+
+	readRepairs uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		counters:   make(map[opCountersKey]*opCounters),
+		histograms: make(map[protocol.OpCode]*opHistogram),
+	}
+}
+
+func (m *metrics) load(dmap string, op protocol.OpCode) (*opCounters, *opHistogram) {
+	key := opCountersKey{dmap: dmap, op: op}
+	m.mtx.RLock()
+	c, cok := m.counters[key]
+	h, hok := m.histograms[op]
+	m.mtx.RUnlock()
+	if cok && hok {
+		return c, h
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if c, cok = m.counters[key]; !cok {
+		c = &opCounters{}
+		m.counters[key] = c
+	}
+	if h, hok = m.histograms[op]; !hok {
+		h = &opHistogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.histograms[op] = h
+	}
+	return c, h
+}
+
+// isReadOp returns true if the operation reports a hit or a miss.
+func isReadOp(op protocol.OpCode) bool {
+	switch op {
+	case protocol.OpGet, protocol.OpGetWithOptions, protocol.OpGetAndTouch, protocol.OpExists, protocol.OpGetTTL:
+		return true
+	}
+	return false
+}
+
+// observe records the outcome and the latency of an operation.
+func (m *metrics) observe(req, resp *protocol.Message, elapsed time.Duration) {
+	c, h := m.load(req.DMap, req.Op)
+	atomic.AddUint64(&c.total, 1)
+	switch resp.Status {
+	case protocol.StatusOK:
+		if isReadOp(req.Op) {
+			atomic.AddUint64(&c.hits, 1)
+		}
+	case protocol.StatusErrKeyNotFound:
+		if isReadOp(req.Op) {
+			atomic.AddUint64(&c.misses, 1)
+		}
+	case protocol.StatusErrReadQuorum:
+		atomic.AddUint64(&c.readQuorumFailures, 1)
+	case protocol.StatusErrWriteQuorum:
+		atomic.AddUint64(&c.writeQuorumFailures, 1)
+	}
+
+	seconds := elapsed.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			atomic.AddUint64(&h.buckets[i], 1)
+			break
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(elapsed))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// writeMetrics writes the metrics in Prometheus text exposition format.
+func (db *Olric) writeMetrics(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	header := func(name, typ, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	m := db.metrics
+	m.mtx.RLock()
+	keys := make([]opCountersKey, 0, len(m.counters))
+	counterOf := make(map[opCountersKey]*opCounters, len(m.counters))
+	for key, c := range m.counters {
+		keys = append(keys, key)
+		counterOf[key] = c
+	}
+	ops := make([]protocol.OpCode, 0, len(m.histograms))
+	histogramOf := make(map[protocol.OpCode]*opHistogram, len(m.histograms))
+	for op, h := range m.histograms {
+		ops = append(ops, op)
+		histogramOf[op] = h
+	}
+	m.mtx.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].dmap == keys[j].dmap {
+			return keys[i].op < keys[j].op
+		}
+		return keys[i].dmap < keys[j].dmap
+	})
+	sort.Slice(ops, func(i, j int) bool { return ops[i] < ops[j] })
+
+	counters := func(name, help string, value func(c *opCounters) uint64, readOnly bool) {
+		header(name, "counter", help)
+		for _, key := range keys {
+			if readOnly && !isReadOp(key.op) {
+				continue
+			}
+			c := counterOf[key]
+			fmt.Fprintf(bw, "%s{dmap=%q,op=%q} %d\n", name, key.dmap, key.op, value(c))
+		}
+	}
+	counters("olric_operations_total", "Number of the operations served.",
+		func(c *opCounters) uint64 { return atomic.LoadUint64(&c.total) }, false)
+	counters("olric_hits_total", "Number of the reads which found the key.",
+		func(c *opCounters) uint64 { return atomic.LoadUint64(&c.hits) }, true)
+	counters("olric_misses_total", "Number of the reads which didn't find the key.",
+		func(c *opCounters) uint64 { return atomic.LoadUint64(&c.misses) }, true)
+	counters("olric_read_quorum_failures_total", "Number of the operations failed with ErrReadQuorum.",
+		func(c *opCounters) uint64 { return atomic.LoadUint64(&c.readQuorumFailures) }, false)
+	counters("olric_write_quorum_failures_total", "Number of the operations failed with ErrWriteQuorum.",
+		func(c *opCounters) uint64 { return atomic.LoadUint64(&c.writeQuorumFailures) }, false)
+
+	header("olric_read_repairs_total", "counter", "Number of the versions updated by read-repair.")
+	fmt.Fprintf(bw, "olric_read_repairs_total %d\n", atomic.LoadUint64(&m.readRepairs))
+
+	name := "olric_operation_duration_seconds"
+	header(name, "histogram", "Latency of the operations served.")
+	for _, op := range ops {
+		h := histogramOf[op]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += atomic.LoadUint64(&h.buckets[i])
+			fmt.Fprintf(bw, "%s_bucket{op=%q,le=%q} %d\n", name, op, formatFloat(bound), cumulative)
+		}
+		count := atomic.LoadUint64(&h.count)
+		fmt.Fprintf(bw, "%s_bucket{op=%q,le=\"+Inf\"} %d\n", name, op, count)
+		fmt.Fprintf(bw, "%s_sum{op=%q} %s\n", name, op,
+			formatFloat(time.Duration(atomic.LoadInt64(&h.sum)).Seconds()))
+		fmt.Fprintf(bw, "%s_count{op=%q} %d\n", name, op, count)
+	}
+
+	header("olric_partition_keys", "gauge", "Number of the keys on a partition.")
+	routingMtx.RLock()
+	for _, parts := range []map[uint64]*partition{db.partitions, db.backups} {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			part := parts[partID]
+			fmt.Fprintf(bw, "olric_partition_keys{partition=\"%d\",backup=\"%t\"} %d\n",
+				partID, part.backup, part.length())
+		}
+	}
+	routingMtx.RUnlock()
+	return bw.Flush()
+}
+
+func (db *Olric) metricsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := db.writeMetrics(w); err != nil {
+		db.log.V(3).Printf("[ERROR] Failed to write metrics: %v", err)
+	}
+}
+
+// startMetricsServer serves the metrics on MetricsAddr at /metrics.
+func (db *Olric) startMetricsServer() error {
+	ln, err := net.Listen("tcp", db.config.MetricsAddr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", db.metricsHandler)
+	db.metricsServer = &http.Server{
+		Addr:    ln.Addr().String(),
+		Handler: mux,
+	}
+
+	db.wg.Add(1)
+	go func() {
+		defer db.wg.Done()
+		err := db.metricsServer.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			db.log.V(2).Printf("[ERROR] Metrics server failed: %v", err)
+		}
+	}()
+	db.log.V(2).Printf("[INFO] Metrics are served on http://%s/metrics", ln.Addr())
+	return nil
+}
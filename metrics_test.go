@@ -0,0 +1,97 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+func TestMetrics(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.MetricsAddr = "127.0.0.1:0"
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	// newDB doesn't call Start.
+	err = db.startMetricsServer()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put("mykey", "myvalue")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	// Only the operations served through the protocol are measured.
+	for _, key := range []string{"mykey", "mykey", "missing"} {
+		req := &protocol.Message{
+			DMap: "mymap",
+			Key:  key,
+		}
+		_, err = db.requestTo(db.this.String(), protocol.OpGet, req)
+		if err != nil && err != ErrKeyNotFound {
+			t.Fatalf("Expected nil or ErrKeyNotFound. Got: %v", err)
+		}
+	}
+
+	var sb strings.Builder
+	err = db.writeMetrics(&sb)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	output := sb.String()
+	for _, line := range []string{
+		`olric_operations_total{dmap="mymap",op="Get"} 3`,
+		`olric_hits_total{dmap="mymap",op="Get"} 2`,
+		`olric_misses_total{dmap="mymap",op="Get"} 1`,
+		`olric_operation_duration_seconds_count{op="Get"} 3`,
+		`olric_partition_keys{partition="0",backup="false"}`,
+	} {
+		if !strings.Contains(output, line) {
+			t.Fatalf("Expected %s in the metrics. Got:\n%s", line, output)
+		}
+	}
+
+	resp, err := http.Get("http://" + db.metricsServer.Addr + "/metrics")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !strings.Contains(string(body), "# TYPE olric_operations_total counter") {
+		t.Fatalf("Expected the metrics to be served. Got:\n%s", body)
+	}
+}
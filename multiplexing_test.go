@@ -0,0 +1,112 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/transport"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestMultiplexing(t *testing.T) {
+	newConfig := func() *config.Config {
+		c := testConfig(nil)
+		c.Multiplexing = true
+		c.MaxMultiplexedRequests = 8
+		c.WireCompression = true
+		return c
+	}
+	db1, err := newDB(newConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db1.Shutdown(context.Background())
+		if err != nil {
+			db1.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	db2, err := newDB(newConfig(), db1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db2.Shutdown(context.Background())
+		if err != nil {
+			db2.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	syncClusterMembers(db1, db2)
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	var g errgroup.Group
+	for i := 0; i < 100; i++ {
+		i := i
+		g.Go(func() error {
+			if err := dm.Put(bkey(i), bval(i)); err != nil {
+				return err
+			}
+			value, err := dm.Get(bkey(i))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(value.([]byte), bval(i)) {
+				t.Errorf("Value is different for key: %s", bkey(i))
+			}
+			return nil
+		})
+	}
+	if err = g.Wait(); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	ps := db1.client.Stats()[db2.this.String()]
+	if !ps.Multiplexed || !ps.Compressed {
+		t.Fatalf("Expected a multiplexed and compressed connection. Got: %+v", ps)
+	}
+	if ps.Idle != 0 || ps.InUse != 0 {
+		t.Fatalf("Expected no pooled connections. Got: %+v", ps)
+	}
+
+	// A client without multiplexing is served as usual.
+	cc := transport.NewClient(&transport.ClientConfig{MaxConn: 1})
+	defer cc.Close()
+	resp, err := cc.RequestTo(db2.this.String(), protocol.OpGet, &protocol.Message{
+		DMap: "mymap",
+		Key:  bkey(0),
+	})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	value, err := db1.unmarshalValue(resp.Value)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(value.([]byte), bval(0)) {
+		t.Fatalf("Value is different for key: %s", bkey(0))
+	}
+	if cc.Stats()[db2.this.String()].Multiplexed {
+		t.Fatalf("Expected a pooled connection")
+	}
+}
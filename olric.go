@@ -18,6 +18,7 @@ package olric
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -35,6 +36,7 @@ import (
 	"github.com/buraksezer/olric/internal/flog"
 	"github.com/buraksezer/olric/internal/locker"
 	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/skiplist"
 	"github.com/buraksezer/olric/internal/storage"
 	"github.com/buraksezer/olric/internal/transport"
 	"github.com/buraksezer/olric/serializer"
@@ -55,6 +57,18 @@ var (
 
 	// ErrUnknownOperation means that an unidentified message has been received from a client.
 	ErrUnknownOperation = errors.New("unknown operation")
+
+	// ErrMessageTooLarge means that the request exceeds the MaxMessageSize of the member.
+	ErrMessageTooLarge = errors.New("message too large")
+
+	// ErrSerializerMismatch means that the value is returned by a member which
+	// uses a different serializer.
+	ErrSerializerMismatch = errors.New("serializer mismatch")
+
+	// ErrClusterNotReady means that the partitions are not assigned to the member
+	// yet or MinimumMemberQuorum is not met. It's returned while the member is
+	// joining the cluster, retry later.
+	ErrClusterNotReady = errors.New("cluster is not ready")
 )
 
 // ReleaseVersion is the current stable version of Olric
@@ -68,6 +82,10 @@ type Olric struct {
 	bootstrapped int32
 	// numMembers is used to check cluster quorum.
 	numMembers int32
+	// memberQuorumMet is set once MinimumMemberQuorum is met.
+	memberQuorumMet int32
+	// hadPeers is set once the member sees another member in the cluster.
+	hadPeers int32
 
 	// Currently owned partition count. Approximate LRU implementation
 	// uses that.
@@ -83,12 +101,91 @@ type Olric struct {
 
 	// Fine-grained lock implementation. Useful to implement atomic operations
 	// and distributed, optimistic lock implementation.
-	locker     *locker.Locker
+	locker *locker.Locker
+
+	// Keeps the results of the atomic operations with an OpID to recognize
+	// the replayed ones.
+	opcache *opCache
+
+	// Short-circuits the read requests to the consistently failing members.
+	breakers *circuitBreakers
+	// Backoff state of the retried requests per member.
+	rpcBackoff *rpcBackoff
+
+	// Buffered replica writes in LazyBackupMode.
+	lazyBackups *lazyBackups
+
+	// DMaps being destroyed. See config.DestroyWaitTimeout.
+	destroying *destroyingDMaps
+	// Read-only state of the DMaps set at runtime. See DMap.MakeReadOnly.
+	readOnly *readOnlyDMaps
+	// Set while the writes are paused on the cluster. See PauseWrites.
+	writesPaused int32
+	// Names of the DMaps which point to another DMap. See RenameDMap.
+	aliases *dmapAliases
+
+	// Bounds the in-flight operations on the DMaps with a MaxConcurrentOps.
+	opsLimiters map[string]*opsLimiter
+
+	// Limits the data transferred by the rebalancer and the backup warm-up.
+	rebalanceLimiter *rateLimiter
+	// Set after the backups are warmed up once on join.
+	backupsWarmedUp int32
+	// Primary partitions waiting to be copied to their new backup owners.
+	replication *replication
+	// The last time the rebalancer ran, in nanoseconds.
+	lastRebalance int64
+	// Set while the coordinator waits for RebalanceDelay to update the routing table.
+	rebalancePending int32
+	// Subscriptions to the changes on the primary partitions. See SubscribeAll.
+	changes *changeFeed
+	// Subscribers of the rebalancer. See OnRebalance.
+	rebalanceEvents rebalanceEvents
+
+	// Progress of the background scrubber.
+	scrub scrubStats
+
+	// State of the global eviction. See config.GlobalMaxMemory.
+	memory memoryStats
+
+	// Timestamps beyond MaxClockSkew. See config.MaxClockSkew.
+	clockSkew clockSkewStats
+
+	// Activity of the expiry reaper. See config.ReaperInterval.
+	reaper reaperStats
+
+	// Timing breakdown of the sampled reads. See config.ReadProfileSampleRate.
+	readProfile readProfile
+
+	// Number of the versions collected per read. See config.MaxReadVersions.
+	readVersions readVersionsStats
+
+	// Coalesces the redirected reads. See config.RedirectedReadCacheTTL.
+	readCoalescer *readCoalescer
+
+	// Write history of the keys. See config.DMapCacheConfig.HistorySize.
+	histories map[string]*history
+
+	// The keys served from the local storage. See config.AllowLocalOnlyOnPartition.
+	degradedReads *degradedReads
+
+	// Sizes of the written values per DMap. See config.TrackValueSizes.
+	valueSizes valueSizes
+
+	// Write-ahead logs of the partitions. See config.WALDir.
+	wal *writeAheadLog
+
+	// Prometheus metrics. See config.MetricsAddr.
+	metrics       *metrics
+	metricsServer *http.Server
+
 	serializer serializer.Serializer
-	discovery  *discovery.Discovery
+	// Number of the values decoded by config.MigrationSerializer.
+	serializerFallbacks uint64
+	discovery           *discovery.Discovery
 
-	// consistent hash ring implementation.
-	consistent *consistent.Consistent
+	// Assigns the partitions to the members. See config.Distribution.
+	distributor distributor
 
 	// Logical units for data storage
 	partitions map[uint64]*partition
@@ -96,6 +193,8 @@ type Olric struct {
 
 	// Matches opcodes to functions. It's somewhat like an HTTP request multiplexer
 	operations map[protocol.OpCode]func(*protocol.Message) *protocol.Message
+	// Operations registered by the user. See RegisterOperation.
+	customOps customOps
 
 	// Internal TCP server and its client for peer-to-peer communication.
 	client *transport.Client
@@ -118,6 +217,8 @@ type cache struct {
 	accessLog       map[uint64]int64
 	lruSamples      int
 	evictionPolicy  config.EvictionPolicy
+	mergeFunc       config.MergeFunc
+	demoteTo        string
 }
 
 // dmap defines the internal representation of a DMap.
@@ -126,6 +227,11 @@ type dmap struct {
 
 	cache   *cache
 	storage *storage.Storage
+	// index keeps the keys in order, if the DMap has an ordered index.
+	// It's nil on the backup partitions.
+	index *skiplist.SkipList
+	// wal is the write-ahead log of the partition. It's nil unless WALDir is set.
+	wal *partitionLog
 }
 
 // partition is a basic, logical storage unit in Olric and stores DMaps in a sync.Map.
@@ -136,6 +242,9 @@ type partition struct {
 	backup bool
 	m      sync.Map
 	owners atomic.Value
+
+	// Number of the writes rejected with ErrPartitionFull.
+	rejected uint64
 }
 
 // owner returns partition owner. It's not thread-safe.
@@ -226,16 +335,16 @@ func New(c *config.Config) (*Olric, error) {
 		return nil, err
 	}
 
-	cfg := consistent.Config{
-		Hasher:            c.Hasher,
-		PartitionCount:    int(c.PartitionCount),
-		ReplicationFactor: 20, // TODO: This also may be a configuration param.
-		Load:              c.LoadFactor,
-	}
 	cc := &transport.ClientConfig{
 		DialTimeout: c.DialTimeout,
 		KeepAlive:   c.KeepAlivePeriod,
-		MaxConn:     1024, // TODO: Make this configurable.
+		MinConn:     c.MinConnsPerMember,
+		MaxConn:     c.MaxConnsPerMember,
+		IdleTimeout: c.IdleConnTimeout,
+
+		WireCompression:        c.WireCompression,
+		Multiplexing:           c.Multiplexing,
+		MaxMultiplexedRequests: c.MaxMultiplexedRequests,
 	}
 	client := transport.NewClient(cc)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -254,22 +363,38 @@ func New(c *config.Config) (*Olric, error) {
 	}
 
 	db := &Olric{
-		ctx:        ctx,
-		cancel:     cancel,
-		log:        flogger,
-		config:     c,
-		hasher:     c.Hasher,
-		locker:     locker.New(),
-		serializer: c.Serializer,
-		consistent: consistent.New(nil, cfg),
-		client:     client,
-		partitions: make(map[uint64]*partition),
-		backups:    make(map[uint64]*partition),
-		operations: make(map[protocol.OpCode]func(*protocol.Message) *protocol.Message),
-		server:     transport.NewServer(c.Name, flogger, c.KeepAlivePeriod),
+		ctx:              ctx,
+		cancel:           cancel,
+		log:              flogger,
+		config:           c,
+		hasher:           c.Hasher,
+		locker:           locker.New(),
+		opcache:          newOpCache(c.OpIDCacheSize, c.OpIDCacheTTL),
+		breakers:         newCircuitBreakers(c.CircuitBreakerThreshold, c.CircuitBreakerCooldown),
+		rpcBackoff:       newRPCBackoff(c.RPCRetryBackoff),
+		rebalanceLimiter: newRateLimiter(c.RebalanceRateLimit),
+		opsLimiters:      newOpsLimiters(c.Cache),
+		lazyBackups:      newLazyBackups(c.LazyBackupBufferSize),
+		readCoalescer:    newReadCoalescer(c.RedirectedReadCacheTTL),
+		histories:        newHistories(c.Cache),
+		degradedReads:    newDegradedReads(),
+		replication:      newReplication(),
+		changes:          newChangeFeed(),
+		destroying:       newDestroyingDMaps(),
+		readOnly:         newReadOnlyDMaps(),
+		aliases:          newDMapAliases(),
+		metrics:          newMetrics(),
+		serializer:       c.Serializer,
+		distributor:      newDistributor(c),
+		client:           client,
+		partitions:       make(map[uint64]*partition),
+		backups:          make(map[uint64]*partition),
+		operations:       make(map[protocol.OpCode]func(*protocol.Message) *protocol.Message),
+		server:           transport.NewServer(c.Name, flogger, c.KeepAlivePeriod),
 	}
 
 	db.server.SetDispatcher(db.requestDispatcher)
+	db.server.SetMaxMessageSize(uint32(c.MaxMessageSize))
 
 	// Create all the partitions. It's read-only. No need for locking.
 	for i := uint64(0); i < c.PartitionCount; i++ {
@@ -284,6 +409,12 @@ func New(c *config.Config) (*Olric, error) {
 		}
 	}
 
+	if c.WALDir != "" {
+		if err := db.openWAL(); err != nil {
+			return nil, errors.WithMessage(err, "failed to open write-ahead log")
+		}
+	}
+
 	db.registerOperations()
 	return db, nil
 }
@@ -291,18 +422,35 @@ func New(c *config.Config) (*Olric, error) {
 func (db *Olric) requestDispatcher(req *protocol.Message) *protocol.Message {
 	// Check bootstrapping status
 	// Exclude protocol.OpUpdateRouting. The node is bootstrapped by this operation.
-	if req.Op != protocol.OpUpdateRouting {
+	// The joining members call protocol.OpGetAliases before they are bootstrapped
+	// and the coordinator sends protocol.OpSetWritesPaused to them while the writes
+	// are paused.
+	if req.Op != protocol.OpUpdateRouting && req.Op != protocol.OpGetAliases &&
+		req.Op != protocol.OpSetWritesPaused {
 		if err := db.checkOperationStatus(); err != nil {
 			return db.prepareResponse(req, err)
 		}
 	}
+	db.resolveRequest(req)
 
 	// Run the incoming command.
 	opr, ok := db.operations[req.Op]
+	if !ok && req.Op >= protocol.OpCustomBase {
+		var cop *customOp
+		if cop, ok = db.customOps.load(req.Op); ok {
+			opr = cop.operation
+		}
+	}
 	if !ok {
 		return db.prepareResponse(req, ErrUnknownOperation)
 	}
-	return opr(req)
+	if db.config.MetricsAddr == "" {
+		return opr(req)
+	}
+	start := time.Now()
+	resp := opr(req)
+	db.metrics.observe(req, resp, time.Since(start))
+	return resp
 }
 
 // bootstrapCoordinator prepares the very first routing table and bootstraps the coordinator node.
@@ -393,7 +541,7 @@ func (db *Olric) startDiscovery() error {
 		}
 	}
 
-	db.consistent.Add(db.this)
+	db.distributor.Add(db.this)
 	if db.discovery.IsCoordinator() {
 		err = db.bootstrapCoordinator()
 		if err == consistent.ErrInsufficientMemberCount {
@@ -429,6 +577,12 @@ func (db *Olric) Start() error {
 	default:
 	}
 
+	if db.config.MetricsAddr != "" {
+		if err := db.startMetricsServer(); err != nil {
+			return err
+		}
+	}
+
 	if err := db.startDiscovery(); err != nil {
 		return err
 	}
@@ -440,33 +594,62 @@ func (db *Olric) Start() error {
 				db.config.WriteQuorum)
 	}
 
+	if db.config.BackupMode == config.LazyBackupMode && db.config.WriteQuorum > 1 {
+		db.log.V(2).
+			Printf("[WARN] Olric is running in lazy backup mode. WriteQuorum (%d) is ineffective for Put",
+				db.config.WriteQuorum)
+	}
+
 	// Start periodic tasks.
 	db.wg.Add(2)
 	go db.updateRoutingPeriodically()
 	go db.evictKeysAtBackground()
+	if db.config.EnableScrubber {
+		db.wg.Add(1)
+		go db.scrubber()
+	}
+	if db.config.BackupMode == config.LazyBackupMode {
+		db.wg.Add(1)
+		go db.lazyBackupFlusher()
+	}
+	if db.config.AllowLocalOnlyOnPartition {
+		db.wg.Add(1)
+		go db.degradedReadsReconciler()
+	}
+	if db.config.GlobalMaxMemory > 0 {
+		db.wg.Add(1)
+		go db.memoryWatchdog()
+	}
 	return <-errCh
 }
 
 func (db *Olric) registerOperations() {
 	// Put
-	db.operations[protocol.OpPut] = db.exPutOperation
-	db.operations[protocol.OpPutEx] = db.exPutOperation
+	db.operations[protocol.OpPut] = db.limitOps(db.exPutOperation)
+	db.operations[protocol.OpPutEx] = db.limitOps(db.exPutOperation)
 	db.operations[protocol.OpPutReplica] = db.putReplicaOperation
+	db.operations[protocol.OpChainReplica] = db.chainReplicaOperation
 	db.operations[protocol.OpPutExReplica] = db.putReplicaOperation
-	db.operations[protocol.OpPutIf] = db.exPutOperation
-	db.operations[protocol.OpPutIfEx] = db.exPutOperation
+	db.operations[protocol.OpPutWithOptionsReplica] = db.putReplicaOperation
+	db.operations[protocol.OpPutIf] = db.limitOps(db.exPutOperation)
+	db.operations[protocol.OpPutIfEx] = db.limitOps(db.exPutOperation)
+	db.operations[protocol.OpPutIfVersion] = db.limitOps(db.exPutOperation)
+	db.operations[protocol.OpPutWithOptions] = db.limitOps(db.exPutOperation)
 	db.operations[protocol.OpPutIfReplica] = db.putReplicaOperation
 	db.operations[protocol.OpPutIfExReplica] = db.putReplicaOperation
 
 	// Get
-	db.operations[protocol.OpGet] = db.exGetOperation
+	db.operations[protocol.OpGet] = db.limitOps(db.exGetOperation)
 	db.operations[protocol.OpGetPrev] = db.getPrevOperation
 	db.operations[protocol.OpGetBackup] = db.getBackupOperation
+	db.operations[protocol.OpGetWithOptions] = db.limitOps(db.getWithOptionsOperation)
+	db.operations[protocol.OpGetAndTouch] = db.limitOps(db.getAndTouchOperation)
 
 	// Delete
-	db.operations[protocol.OpDelete] = db.exDeleteOperation
+	db.operations[protocol.OpDelete] = db.limitOps(db.exDeleteOperation)
 	db.operations[protocol.OpDeleteBackup] = db.deleteBackupOperation
 	db.operations[protocol.OpDeletePrev] = db.deletePrevOperation
+	db.operations[protocol.OpDeleteExpired] = db.deleteExpiredOperation
 
 	// Lock/Unlock
 	db.operations[protocol.OpLockWithTimeout] = db.exLockWithTimeoutOperation
@@ -476,29 +659,68 @@ func (db *Olric) registerOperations() {
 	// Destroy
 	db.operations[protocol.OpDestroy] = db.exDestroyOperation
 	db.operations[protocol.OpDestroyDMap] = db.destroyDMapOperation
+	db.operations[protocol.OpMarkDestroying] = db.markDestroyingOperation
+	db.operations[protocol.OpSetReadOnly] = db.setReadOnlyOperation
+	db.operations[protocol.OpSetWritesPaused] = db.setWritesPausedOperation
+	db.operations[protocol.OpRenameDMap] = db.renameDMapOperation
+	db.operations[protocol.OpPauseDMapWrites] = db.pauseDMapWritesOperation
 
 	// Atomic
-	db.operations[protocol.OpIncr] = db.exIncrDecrOperation
-	db.operations[protocol.OpDecr] = db.exIncrDecrOperation
-	db.operations[protocol.OpGetPut] = db.exGetPutOperation
+	db.operations[protocol.OpIncr] = db.limitOps(db.exIncrDecrOperation)
+	db.operations[protocol.OpDecr] = db.limitOps(db.exIncrDecrOperation)
+	db.operations[protocol.OpGetPut] = db.limitOps(db.exGetPutOperation)
+	db.operations[protocol.OpIncrFloat] = db.limitOps(db.exIncrFloatOperation)
+	db.operations[protocol.OpDecrFloor] = db.limitOps(db.exDecrFloorOperation)
+	db.operations[protocol.OpSetBit] = db.limitOps(db.setBitOperation)
+	db.operations[protocol.OpGetBit] = db.limitOps(db.getBitOperation)
+	db.operations[protocol.OpGetPutEx] = db.limitOps(db.exGetPutExOperation)
 
 	// Pipeline
 	db.operations[protocol.OpPipeline] = db.pipelineOperation
 
 	// Expire
-	db.operations[protocol.OpExpire] = db.exExpireOperation
+	db.operations[protocol.OpExpire] = db.limitOps(db.exExpireOperation)
 	db.operations[protocol.OpExpireReplica] = db.expireReplicaOperation
+	db.operations[protocol.OpExpireMany] = db.limitOps(db.expireManyOperation)
+	db.operations[protocol.OpExpireManyReplica] = db.expireManyReplicaOperation
+	db.operations[protocol.OpCopy] = db.limitOps(db.copyOperation)
+	db.operations[protocol.OpSwap] = db.limitOps(db.swapOperation)
+
+	// Range
+	db.operations[protocol.OpRangeBetween] = db.limitOps(db.rangeBetweenOperation)
+	db.operations[protocol.OpKeys] = db.limitOps(db.keysOperation)
+	db.operations[protocol.OpKeysByTTL] = db.limitOps(db.keysByTTLOperation)
+	db.operations[protocol.OpGetAll] = db.limitOps(db.getAllOperation)
+	db.operations[protocol.OpHistory] = db.limitOps(db.historyOperation)
+	db.operations[protocol.OpLastAccess] = db.limitOps(db.lastAccessOperation)
+	db.operations[protocol.OpExistsMany] = db.limitOps(db.existsManyOperation)
+	db.operations[protocol.OpGetDelete] = db.limitOps(db.getDeleteOperation)
+	db.operations[protocol.OpCompareAndDelete] = db.limitOps(db.compareAndDeleteOperation)
+	db.operations[protocol.OpReplace] = db.limitOps(db.replaceOperation)
+	db.operations[protocol.OpReplaceReplica] = db.replaceReplicaOperation
+	db.operations[protocol.OpRepair] = db.limitOps(db.repairOperation)
+	db.operations[protocol.OpExists] = db.limitOps(db.existsOperation)
+	db.operations[protocol.OpGetTTL] = db.limitOps(db.getTTLOperation)
 
 	// Internal
 	db.operations[protocol.OpUpdateRouting] = db.updateRoutingOperation
 	db.operations[protocol.OpMoveDMap] = db.moveDMapOperation
 	db.operations[protocol.OpLengthOfPart] = db.keyCountOnPartOperation
+	db.operations[protocol.OpSyncBackup] = db.syncBackupOperation
+	db.operations[protocol.OpSubscribeChanges] = db.subscribeChangesOperation
+	db.operations[protocol.OpPollChanges] = db.pollChangesOperation
+	db.operations[protocol.OpUnsubscribeChanges] = db.unsubscribeChangesOperation
+	db.operations[protocol.OpGetAliases] = db.getAliasesOperation
+	db.operations[protocol.OpPartitionSizes] = db.partitionSizesOperation
 
 	// Aliveness
 	db.operations[protocol.OpPing] = db.pingOperation
 
 	// Node Stats
 	db.operations[protocol.OpStats] = db.statsOperation
+
+	// Routing table for the clients
+	db.operations[protocol.OpGetRoutingTable] = db.getRoutingTableOperation
 }
 
 // Shutdown stops background servers and leaves the cluster.
@@ -510,6 +732,12 @@ func (db *Olric) Shutdown(ctx context.Context) error {
 		result = multierror.Append(result, err)
 	}
 
+	if db.metricsServer != nil {
+		if err := db.metricsServer.Shutdown(ctx); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
 	if db.discovery != nil {
 		err := db.discovery.Shutdown()
 		if err != nil {
@@ -519,6 +747,12 @@ func (db *Olric) Shutdown(ctx context.Context) error {
 
 	db.wg.Wait()
 
+	if db.wal != nil {
+		if err := db.wal.close(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
 	// If the user kills the server before bootstrapping, db.this is going to empty.
 	var name string
 	if db.this.String() != "" {
@@ -550,18 +784,26 @@ func (db *Olric) getBackupPartition(hkey uint64) *partition {
 // getBackupOwners returns the backup owners list for a given hkey.
 func (db *Olric) getBackupPartitionOwners(hkey uint64) []discovery.Member {
 	part := db.getBackupPartition(hkey)
-	return part.owners.Load().([]discovery.Member)
+	return part.loadOwners()
 }
 
 // getPartitionOwners loads the partition owners list for a given hkey.
 func (db *Olric) getPartitionOwners(hkey uint64) []discovery.Member {
 	part := db.getPartition(hkey)
-	return part.owners.Load().([]discovery.Member)
+	return part.loadOwners()
+}
+
+// normalizeKey returns the normalized form of the key. See config.KeyNormalizer.
+func (db *Olric) normalizeKey(key string) string {
+	if db.config.KeyNormalizer == nil {
+		return key
+	}
+	return db.config.KeyNormalizer(key)
 }
 
 // getHKey returns hash-key, a.k.a hkey, for a key on a DMap.
 func (db *Olric) getHKey(name, key string) uint64 {
-	tmp := name + key
+	tmp := name + db.normalizeKey(key)
 	return db.hasher.Sum64(*(*[]byte)(unsafe.Pointer(&tmp)))
 }
 
@@ -571,6 +813,17 @@ func (db *Olric) findPartitionOwner(name, key string) (discovery.Member, uint64)
 	return db.getPartition(hkey).owner(), hkey
 }
 
+// lookupPartitionOwner works like findPartitionOwner, but it returns
+// ErrClusterNotReady instead of panicking if the partition has no owner yet.
+func (db *Olric) lookupPartitionOwner(name, key string) (discovery.Member, uint64, error) {
+	hkey := db.getHKey(name, key)
+	part := db.getPartition(hkey)
+	if part.ownerCount() == 0 {
+		return discovery.Member{}, 0, ErrClusterNotReady
+	}
+	return part.owner(), hkey, nil
+}
+
 func (db *Olric) setCacheConfiguration(dm *dmap, name string) error {
 	// Try to set cache configuration for this DMap.
 	dm.cache = &cache{}
@@ -606,6 +859,8 @@ func (db *Olric) setCacheConfiguration(dm *dmap, name string) error {
 			if dm.cache.evictionPolicy != c.EvictionPolicy {
 				dm.cache.evictionPolicy = c.EvictionPolicy
 			}
+			dm.cache.mergeFunc = c.MergeFunc
+			dm.cache.demoteTo = c.DemoteTo
 		}
 	}
 
@@ -615,8 +870,9 @@ func (db *Olric) setCacheConfiguration(dm *dmap, name string) error {
 
 	// TODO: Create a new function to verify cache config.
 	if dm.cache.evictionPolicy == config.LRUEviction {
-		if dm.cache.maxInuse <= 0 && dm.cache.maxKeys <= 0 {
-			return fmt.Errorf("maxInuse or maxKeys have to be greater than zero")
+		if dm.cache.maxInuse <= 0 && dm.cache.maxKeys <= 0 &&
+			db.config.MaxKeysPerPartition <= 0 && db.config.GlobalMaxMemory <= 0 {
+			return fmt.Errorf("maxInuse, maxKeys, MaxKeysPerPartition or GlobalMaxMemory have to be greater than zero")
 		}
 		// set the default value.
 		if dm.cache.lruSamples == 0 {
@@ -657,6 +913,22 @@ func (db *Olric) createDMap(part *partition, name string, str *storage.Storage)
 		nm.storage = storage.New(db.config.TableSize)
 	}
 
+	if db.wal != nil {
+		wal, err := db.wal.open(part)
+		if err != nil {
+			return nil, err
+		}
+		nm.wal = wal
+	}
+
+	if !part.backup && db.hasOrderedIndex(name) {
+		nm.index = skiplist.New()
+		nm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+			nm.index.Insert(db.normalizeKey(vdata.Key), hkey)
+			return true
+		})
+	}
+
 	part.m.Store(name, nm)
 	return nm, nil
 }
@@ -711,6 +983,42 @@ func (db *Olric) prepareResponse(req *protocol.Message, err error) *protocol.Mes
 		return req.Error(protocol.StatusErrClusterQuorum, err)
 	case err == ErrUnknownOperation:
 		return req.Error(protocol.StatusErrUnknownOperation, err)
+	case err == ErrTooManyRequests:
+		return req.Error(protocol.StatusErrTooManyRequests, err)
+	case err == ErrKeyExpired:
+		return req.Error(protocol.StatusErrKeyExpired, err)
+	case err == ErrKeyIdle:
+		return req.Error(protocol.StatusErrKeyIdle, err)
+	case err == ErrPartitionFull:
+		return req.Error(protocol.StatusErrPartitionFull, err)
+	case err == ErrClockSkew:
+		return req.Error(protocol.StatusErrClockSkew, err)
+	case err == ErrDMapUnavailable:
+		return req.Error(protocol.StatusErrDMapUnavailable, err)
+	case err == ErrReadOnly:
+		return req.Error(protocol.StatusErrReadOnly, err)
+	case err == ErrMessageTooLarge:
+		return req.Error(protocol.StatusErrMessageTooLarge, err)
+	case err == ErrNotNumeric:
+		return req.Error(protocol.StatusErrNotNumeric, err)
+	case err == ErrSerializerMismatch:
+		return req.Error(protocol.StatusErrSerializerMismatch, err)
+	case err == ErrNoMajority:
+		return req.Error(protocol.StatusErrNoMajority, err)
+	case err == errVersionMismatch:
+		return req.Error(protocol.StatusErrVersionMismatch, err)
+	case err == ErrCrossPartitionSwap:
+		return req.Error(protocol.StatusErrCrossPartitionSwap, err)
+	case err == ErrClusterNotReady:
+		return req.Error(protocol.StatusErrClusterNotReady, err)
+	case err == ErrWritesPaused:
+		return req.Error(protocol.StatusErrWritesPaused, err)
+	case err == ErrResultTooLarge:
+		return req.Error(protocol.StatusErrResultTooLarge, err)
+	case err == ErrNotBitmap:
+		return req.Error(protocol.StatusErrNotBitmap, err)
+	case err == ErrInvalidBitOffset:
+		return req.Error(protocol.StatusBadRequest, err)
 	default:
 		return req.Error(protocol.StatusInternalServerError, err)
 	}
@@ -745,6 +1053,40 @@ func (db *Olric) requestTo(addr string, opcode protocol.OpCode, req *protocol.Me
 		return nil, ErrClusterQuorum
 	case resp.Status == protocol.StatusErrUnknownOperation:
 		return nil, ErrUnknownOperation
+	case resp.Status == protocol.StatusErrTooManyRequests:
+		return nil, ErrTooManyRequests
+	case resp.Status == protocol.StatusErrKeyExpired:
+		return nil, ErrKeyExpired
+	case resp.Status == protocol.StatusErrKeyIdle:
+		return nil, ErrKeyIdle
+	case resp.Status == protocol.StatusErrPartitionFull:
+		return nil, ErrPartitionFull
+	case resp.Status == protocol.StatusErrClockSkew:
+		return nil, ErrClockSkew
+	case resp.Status == protocol.StatusErrDMapUnavailable:
+		return nil, ErrDMapUnavailable
+	case resp.Status == protocol.StatusErrReadOnly:
+		return nil, ErrReadOnly
+	case resp.Status == protocol.StatusErrMessageTooLarge:
+		return nil, ErrMessageTooLarge
+	case resp.Status == protocol.StatusErrNotNumeric:
+		return nil, ErrNotNumeric
+	case resp.Status == protocol.StatusErrSerializerMismatch:
+		return nil, ErrSerializerMismatch
+	case resp.Status == protocol.StatusErrNoMajority:
+		return nil, ErrNoMajority
+	case resp.Status == protocol.StatusErrVersionMismatch:
+		return nil, errVersionMismatch
+	case resp.Status == protocol.StatusErrCrossPartitionSwap:
+		return nil, ErrCrossPartitionSwap
+	case resp.Status == protocol.StatusErrClusterNotReady:
+		return nil, ErrClusterNotReady
+	case resp.Status == protocol.StatusErrWritesPaused:
+		return nil, ErrWritesPaused
+	case resp.Status == protocol.StatusErrResultTooLarge:
+		return nil, ErrResultTooLarge
+	case resp.Status == protocol.StatusErrNotBitmap:
+		return nil, ErrNotBitmap
 	}
 	return nil, fmt.Errorf("unknown status code: %d", resp.Status)
 }
@@ -754,6 +1096,22 @@ func getTTL(timeout time.Duration) int64 {
 	return (timeout.Nanoseconds() + time.Now().UnixNano()) / 1000000
 }
 
+// getTimeout converts an absolute expiry time in milliseconds, as returned by
+// getTTL, back to a timeout relative to now. It returns zero if ttl is zero,
+// which means the key never expires.
+func getTimeout(ttl int64) time.Duration {
+	if ttl == 0 {
+		return 0
+	}
+	timeout := time.Duration(ttl*1000000 - time.Now().UnixNano())
+	if timeout <= 0 {
+		// Already expired. Zero means no expiry, so return the smallest
+		// possible timeout instead.
+		return time.Nanosecond
+	}
+	return timeout
+}
+
 func isKeyExpired(ttl int64) bool {
 	if ttl == 0 {
 		return false
@@ -803,6 +1161,9 @@ func (db *Olric) storeNumMembers() {
 	// It's rarely updated. Just call this when the membership info changed.
 	nr := int32(db.discovery.NumMembers())
 	atomic.StoreInt32(&db.numMembers, nr)
+	if nr > 1 {
+		atomic.StoreInt32(&db.hadPeers, 1)
+	}
 }
 
 func (db *Olric) checkMemberCountQuorum() error {
@@ -815,11 +1176,44 @@ func (db *Olric) checkMemberCountQuorum() error {
 	return nil
 }
 
+// checkMinimumMemberQuorum returns ErrClusterNotReady until MinimumMemberQuorum
+// is met. It's not checked again once it's met, the members which leave later
+// are handled by MemberCountQuorum.
+func (db *Olric) checkMinimumMemberQuorum() error {
+	if db.config.MinimumMemberQuorum == 0 || atomic.LoadInt32(&db.memberQuorumMet) == 1 {
+		return nil
+	}
+	if atomic.LoadInt32(&db.numMembers) < db.config.MinimumMemberQuorum {
+		return ErrClusterNotReady
+	}
+	if atomic.CompareAndSwapInt32(&db.memberQuorumMet, 0, 1) {
+		db.log.V(2).Printf("[INFO] MinimumMemberQuorum: %d is met, serving the requests",
+			db.config.MinimumMemberQuorum)
+	}
+	return nil
+}
+
+// Ready returns true if the member is bootstrapped and the member quorums,
+// MemberCountQuorum and MinimumMemberQuorum, are satisfied. The reads and
+// writes are served only if it's ready.
+func (db *Olric) Ready() bool {
+	if atomic.LoadInt32(&db.bootstrapped) != 1 {
+		return false
+	}
+	if err := db.checkMemberCountQuorum(); err != nil {
+		return false
+	}
+	return db.checkMinimumMemberQuorum() == nil
+}
+
 // checkOperationStatus controls bootstrapping status and cluster quorum to prevent split-brain syndrome.
 func (db *Olric) checkOperationStatus() error {
 	if err := db.checkMemberCountQuorum(); err != nil {
 		return err
 	}
+	if err := db.checkMinimumMemberQuorum(); err != nil {
+		return err
+	}
 	// An Olric node has to be bootstrapped to function properly.
 	return db.checkBootstrap()
 }
@@ -0,0 +1,100 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// opKey identifies an operation with an OpID.
+type opKey struct {
+	dmap string
+	key  string
+	id   uint64
+}
+
+type opResult struct {
+	key      opKey
+	value    []byte
+	deadline int64
+}
+
+// opCache keeps the results of the operations with an OpID for a while. It's
+// bounded. All the results have the same TTL, so the oldest one is always
+// at the front of the list.
+type opCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	results map[opKey]*list.Element
+	order   *list.List
+}
+
+func newOpCache(size int, ttl time.Duration) *opCache {
+	return &opCache{
+		size:    size,
+		ttl:     ttl,
+		results: make(map[opKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the result of an operation, if it's still in the cache.
+func (c *opCache) get(k opKey) (*opResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.results[k]
+	if !ok {
+		return nil, false
+	}
+	res := e.Value.(*opResult)
+	if time.Now().UnixNano() >= res.deadline {
+		c.order.Remove(e)
+		delete(c.results, k)
+		return nil, false
+	}
+	return res, true
+}
+
+// set stores the result of a successful operation and evicts the expired results or
+// the oldest ones if the cache is full.
+func (c *opCache) set(k opKey, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	if e, ok := c.results[k]; ok {
+		c.order.Remove(e)
+		delete(c.results, k)
+	}
+	res := &opResult{
+		key:      k,
+		value:    value,
+		deadline: now + c.ttl.Nanoseconds(),
+	}
+	c.results[k] = c.order.PushBack(res)
+
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		res := e.Value.(*opResult)
+		if c.order.Len() <= c.size && now < res.deadline {
+			break
+		}
+		c.order.Remove(e)
+		delete(c.results, res.key)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+// ErrTooManyRequests is returned when the number of concurrent operations on
+// a DMap reaches its MaxConcurrentOps. Clients should back off and try again.
+var ErrTooManyRequests = errors.New("too many requests")
+
+// opsLimiter is a non-blocking semaphore which bounds the number of in-flight
+// operations on a DMap.
+type opsLimiter struct {
+	limit    int32
+	inflight int32
+}
+
+// acquire takes a slot. It returns false if all the slots are in use.
+func (l *opsLimiter) acquire() bool {
+	if atomic.AddInt32(&l.inflight, 1) > l.limit {
+		atomic.AddInt32(&l.inflight, -1)
+		return false
+	}
+	return true
+}
+
+func (l *opsLimiter) release() {
+	atomic.AddInt32(&l.inflight, -1)
+}
+
+// newOpsLimiters creates a limiter for every DMap with a MaxConcurrentOps.
+// The returned map is read-only.
+func newOpsLimiters(c *config.CacheConfig) map[string]*opsLimiter {
+	limiters := make(map[string]*opsLimiter)
+	if c == nil {
+		return limiters
+	}
+	for name, dc := range c.DMapConfigs {
+		if dc.MaxConcurrentOps > 0 {
+			limiters[name] = &opsLimiter{limit: int32(dc.MaxConcurrentOps)}
+		}
+	}
+	return limiters
+}
+
+// limitOps wraps an operation to reject the requests when the DMap is saturated.
+func (db *Olric) limitOps(f func(*protocol.Message) *protocol.Message) func(*protocol.Message) *protocol.Message {
+	return func(req *protocol.Message) *protocol.Message {
+		l, ok := db.opsLimiters[req.DMap]
+		if !ok {
+			return f(req)
+		}
+		if !l.acquire() {
+			return db.prepareResponse(req, ErrTooManyRequests)
+		}
+		defer l.release()
+		return f(req)
+	}
+}
+
+// inflightOps returns the number of in-flight operations on the limited DMaps.
+func (db *Olric) inflightOps() map[string]int {
+	res := make(map[string]int, len(db.opsLimiters))
+	for name, l := range db.opsLimiters {
+		res[name] = int(atomic.LoadInt32(&l.inflight))
+	}
+	return res
+}
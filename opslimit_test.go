@@ -0,0 +1,94 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+func TestDMap_MaxConcurrentOps(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.Cache = &config.CacheConfig{
+		DMapConfigs: map[string]config.DMapCacheConfig{
+			"mymap": {MaxConcurrentOps: 1},
+		},
+	}
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	// Occupy the only slot.
+	l := db.opsLimiters["mymap"]
+	if !l.acquire() {
+		t.Fatalf("Expected to acquire a slot")
+	}
+
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if s.InFlightOps["mymap"] != 1 {
+		t.Fatalf("Expected InFlightOps: 1. Got: %d", s.InFlightOps["mymap"])
+	}
+
+	for _, op := range []protocol.OpCode{protocol.OpGet, protocol.OpPut} {
+		req := &protocol.Message{
+			DMap:  "mymap",
+			Key:   bkey(1),
+			Value: bval(1),
+		}
+		req.Op = op
+		resp := db.requestDispatcher(req)
+		if resp.Status != protocol.StatusErrTooManyRequests {
+			t.Fatalf("Expected StatusErrTooManyRequests for %d. Got: %d", op, resp.Status)
+		}
+	}
+
+	// The other DMaps are not limited.
+	req := &protocol.Message{
+		DMap: "othermap",
+		Key:  bkey(1),
+	}
+	req.Op = protocol.OpGet
+	resp := db.requestDispatcher(req)
+	if resp.Status != protocol.StatusErrKeyNotFound {
+		t.Fatalf("Expected StatusErrKeyNotFound. Got: %d", resp.Status)
+	}
+
+	l.release()
+	req = &protocol.Message{
+		DMap: "mymap",
+		Key:  bkey(1),
+	}
+	req.Op = protocol.OpGet
+	resp = db.requestDispatcher(req)
+	if resp.Status != protocol.StatusErrKeyNotFound {
+		t.Fatalf("Expected StatusErrKeyNotFound. Got: %d", resp.Status)
+	}
+	if l.inflight != 0 {
+		t.Fatalf("Expected no in-flight operation. Got: %d", l.inflight)
+	}
+}
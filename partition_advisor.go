@@ -0,0 +1,229 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// partitionSize is the number of keys and the in-use bytes of a primary partition.
+type partitionSize struct {
+	Keys  int
+	Bytes int
+}
+
+// PartitionCountAdvice is returned by SuggestPartitionCount. The sizes cover the
+// primary partitions, the backups are not included.
+type PartitionCountAdvice struct {
+	// Current is the configured PartitionCount.
+	Current uint64
+
+	// Suggested is the suggested PartitionCount. It's equal to Current if the
+	// partition count is fine.
+	Suggested uint64
+
+	// Reason explains the suggestion.
+	Reason string
+
+	TotalKeys  int
+	TotalBytes int
+
+	// Mean and maximum sizes of the partitions.
+	MeanKeys  float64
+	MaxKeys   int
+	MeanBytes float64
+	MaxBytes  int
+
+	// Ratios of the largest partition to the mean. 1 means the data is evenly
+	// distributed.
+	KeyImbalance  float64
+	ByteImbalance float64
+
+	// IDs of the partitions larger than HotPartitionRatio times the mean.
+	HotPartitions []uint64
+}
+
+// localPartitionSizes returns the sizes of the primary partitions owned by this
+// member.
+func (db *Olric) localPartitionSizes() map[uint64]partitionSize {
+	sizes := make(map[uint64]partitionSize)
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		owners := part.loadOwners()
+		if len(owners) == 0 || !hostCmp(owners[len(owners)-1], db.this) {
+			continue
+		}
+		var size partitionSize
+		part.m.Range(func(_, tmp interface{}) bool {
+			dm := tmp.(*dmap)
+			dm.RLock()
+			size.Keys += dm.storage.Len()
+			size.Bytes += dm.storage.SlabInfo().Inuse
+			dm.RUnlock()
+			return true
+		})
+		sizes[partID] = size
+	}
+	return sizes
+}
+
+func (db *Olric) collectPartitionSizes() (map[uint64]partitionSize, error) {
+	var mtx sync.Mutex
+	sizes := make(map[uint64]partitionSize)
+	merge := func(s map[uint64]partitionSize) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for partID, size := range s {
+			sizes[partID] = size
+		}
+	}
+	err := db.fanout(db.discovery.GetMembers(), func(member discovery.Member) error {
+		if hostCmp(member, db.this) {
+			merge(db.localPartitionSizes())
+			return nil
+		}
+		resp, err := db.requestTo(member.String(), protocol.OpPartitionSizes, &protocol.Message{})
+		if err != nil {
+			return err
+		}
+		s := make(map[uint64]partitionSize)
+		if err = msgpack.Unmarshal(resp.Value, &s); err != nil {
+			return err
+		}
+		merge(s)
+		return nil
+	})
+	return sizes, err
+}
+
+// nextPrime returns the smallest prime number greater than or equal to n.
+func nextPrime(n uint64) uint64 {
+	if n <= 2 {
+		return 2
+	}
+	for ; ; n++ {
+		prime := true
+		for i := uint64(2); i*i <= n; i++ {
+			if n%i == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
+
+// adviseOnPartitionCount computes the imbalance metrics and the suggestion from
+// the sizes of the primary partitions.
+func (db *Olric) adviseOnPartitionCount(sizes map[uint64]partitionSize, memberCount int) *PartitionCountAdvice {
+	advice := &PartitionCountAdvice{
+		Current:   db.config.PartitionCount,
+		Suggested: db.config.PartitionCount,
+	}
+	for _, size := range sizes {
+		advice.TotalKeys += size.Keys
+		advice.TotalBytes += size.Bytes
+		if size.Keys > advice.MaxKeys {
+			advice.MaxKeys = size.Keys
+		}
+		if size.Bytes > advice.MaxBytes {
+			advice.MaxBytes = size.Bytes
+		}
+	}
+	count := float64(db.config.PartitionCount)
+	advice.MeanKeys = float64(advice.TotalKeys) / count
+	advice.MeanBytes = float64(advice.TotalBytes) / count
+	if advice.MeanKeys > 0 {
+		advice.KeyImbalance = float64(advice.MaxKeys) / advice.MeanKeys
+	}
+	if advice.MeanBytes > 0 {
+		advice.ByteImbalance = float64(advice.MaxBytes) / advice.MeanBytes
+		for partID, size := range sizes {
+			if float64(size.Bytes) > advice.MeanBytes*db.config.HotPartitionRatio {
+				advice.HotPartitions = append(advice.HotPartitions, partID)
+			}
+		}
+		sort.Slice(advice.HotPartitions, func(i, j int) bool {
+			return advice.HotPartitions[i] < advice.HotPartitions[j]
+		})
+	}
+
+	high := float64(db.config.PartitionSizeHighWatermark)
+	low := float64(db.config.PartitionSizeLowWatermark)
+	switch {
+	case advice.MeanBytes > high:
+		// Leave room to grow. Aim for the middle of the watermarks.
+		target := (high + low) / 2
+		advice.Suggested = nextPrime(uint64(math.Ceil(float64(advice.TotalBytes) / target)))
+		advice.Reason = fmt.Sprintf("mean partition size %.0f bytes is above PartitionSizeHighWatermark", advice.MeanBytes)
+	case low > 0 && advice.MeanBytes < low:
+		target := (high + low) / 2
+		suggested := uint64(math.Ceil(float64(advice.TotalBytes) / target))
+		if suggested < uint64(memberCount) {
+			// Every member should own a partition at least.
+			suggested = uint64(memberCount)
+		}
+		advice.Suggested = nextPrime(suggested)
+		if advice.Suggested >= advice.Current {
+			advice.Suggested = advice.Current
+			advice.Reason = "partition count is fine"
+			break
+		}
+		advice.Reason = fmt.Sprintf("mean partition size %.0f bytes is below PartitionSizeLowWatermark", advice.MeanBytes)
+	default:
+		advice.Reason = "partition count is fine"
+	}
+	if len(advice.HotPartitions) > 0 && advice.Suggested == advice.Current {
+		advice.Reason = fmt.Sprintf("partition count is fine, %d hot partitions may hold large or skewed keys",
+			len(advice.HotPartitions))
+	}
+	return advice
+}
+
+// SuggestPartitionCount analyzes the distribution of the keys and the in-use
+// bytes on the primary partitions of the cluster and suggests a PartitionCount.
+// It suggests more partitions if the mean size is above PartitionSizeHighWatermark
+// and fewer if it's below PartitionSizeLowWatermark. It's advisory only, the
+// partition count cannot be changed without migrating the data to a new cluster.
+// It contacts all the members, don't call it on the hot path.
+func (db *Olric) SuggestPartitionCount() (*PartitionCountAdvice, error) {
+	if err := db.checkOperationStatus(); err != nil {
+		return nil, err
+	}
+	sizes, err := db.collectPartitionSizes()
+	if err != nil {
+		return nil, err
+	}
+	return db.adviseOnPartitionCount(sizes, len(db.discovery.GetMembers())), nil
+}
+
+func (db *Olric) partitionSizesOperation(req *protocol.Message) *protocol.Message {
+	value, err := msgpack.Marshal(db.localPartitionSizes())
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -0,0 +1,110 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestPartitionCount(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	advice, err := db1.SuggestPartitionCount()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if advice.TotalKeys != 100 {
+		t.Fatalf("Expected 100 keys. Got: %d", advice.TotalKeys)
+	}
+	if advice.Suggested != advice.Current {
+		t.Fatalf("Expected no change. Got: %d: %s", advice.Suggested, advice.Reason)
+	}
+	if advice.KeyImbalance < 1 {
+		t.Fatalf("Expected KeyImbalance to be at least 1. Got: %f", advice.KeyImbalance)
+	}
+
+	db1.config.PartitionSizeHighWatermark = advice.TotalBytes / 20
+	advice, err = db1.SuggestPartitionCount()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	// The mean size is aimed at the half of the high watermark.
+	if advice.Suggested != 41 {
+		t.Fatalf("Expected 41 partitions. Got: %d: %s", advice.Suggested, advice.Reason)
+	}
+}
+
+func TestAdviseOnPartitionCount(t *testing.T) {
+	c := testConfig(nil)
+	c.PartitionSizeHighWatermark = 1000
+	c.PartitionSizeLowWatermark = 100
+	c.HotPartitionRatio = 2
+	db := &Olric{config: c}
+
+	sizes := map[uint64]partitionSize{
+		0: {Keys: 10, Bytes: 50},
+		1: {Keys: 10, Bytes: 50},
+		2: {Keys: 10, Bytes: 50},
+		3: {Keys: 10, Bytes: 50},
+		4: {Keys: 10, Bytes: 50},
+		5: {Keys: 10, Bytes: 50},
+		6: {Keys: 40, Bytes: 400},
+	}
+	advice := db.adviseOnPartitionCount(sizes, 1)
+	if advice.TotalKeys != 100 || advice.TotalBytes != 700 {
+		t.Fatalf("Unexpected totals: %d keys, %d bytes", advice.TotalKeys, advice.TotalBytes)
+	}
+	if advice.ByteImbalance != 4 {
+		t.Fatalf("Expected ByteImbalance: 4. Got: %f", advice.ByteImbalance)
+	}
+	if !reflect.DeepEqual(advice.HotPartitions, []uint64{6}) {
+		t.Fatalf("Expected partition 6 to be hot. Got: %v", advice.HotPartitions)
+	}
+	// The mean size is 100 bytes, it's not below the low watermark.
+	if advice.Suggested != 7 {
+		t.Fatalf("Expected no change. Got: %d", advice.Suggested)
+	}
+
+	for partID := range sizes {
+		sizes[partID] = partitionSize{Keys: 1, Bytes: 10}
+	}
+	advice = db.adviseOnPartitionCount(sizes, 3)
+	// Every member owns a partition at least.
+	if advice.Suggested != 3 {
+		t.Fatalf("Expected 3 partitions. Got: %d: %s", advice.Suggested, advice.Reason)
+	}
+}
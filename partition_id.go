@@ -0,0 +1,42 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"fmt"
+
+	"github.com/buraksezer/olric/internal/discovery"
+)
+
+// PartitionID returns the ID of the partition which the key belongs to. It's
+// computed locally. It's useful to check the distribution of the keys.
+// It's thread-safe.
+func (db *Olric) PartitionID(name, key string) int {
+	return int(db.getPartitionID(db.getHKey(name, key)))
+}
+
+// PartitionOwners returns the primary owner and the backup owners of the
+// partition in the local routing table. It's thread-safe.
+func (db *Olric) PartitionOwners(partID int) (discovery.Member, []discovery.Member, error) {
+	if partID < 0 || uint64(partID) >= db.config.PartitionCount {
+		return discovery.Member{}, nil, fmt.Errorf("invalid partition ID: %d", partID)
+	}
+	if err := db.checkOperationStatus(); err != nil {
+		return discovery.Member{}, nil, err
+	}
+	owner := db.partitions[uint64(partID)].owner()
+	backups := db.backups[uint64(partID)].loadOwners()
+	return owner, backups, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+)
+
+func TestPartitionID(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		partID := db1.PartitionID("mymap", bkey(i))
+		if partID != db2.PartitionID("mymap", bkey(i)) {
+			t.Fatalf("Expected the same partition ID on all members")
+		}
+		member, hkey := db1.findPartitionOwner("mymap", bkey(i))
+		if uint64(partID) != db1.getPartitionID(hkey) {
+			t.Fatalf("Expected partition ID: %d. Got: %d", db1.getPartitionID(hkey), partID)
+		}
+		owner, backups, err := db1.PartitionOwners(partID)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !hostCmp(owner, member) {
+			t.Fatalf("Expected owner: %s. Got: %s", member, owner)
+		}
+		if len(backups) != 1 || hostCmp(backups[0], owner) {
+			t.Fatalf("Expected one backup owner other than the owner. Got: %v", backups)
+		}
+	}
+
+	_, _, err = db1.PartitionOwners(int(db1.config.PartitionCount))
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid partition ID")
+	}
+}
@@ -41,6 +41,7 @@ func (db *Olric) pipelineOperation(req *protocol.Message) *protocol.Message {
 			}
 			continue
 		}
+		db.resolveRequest(&preq)
 		f, ok := db.operations[preq.Op]
 		if !ok {
 			err = preq.Error(protocol.StatusInternalServerError, ErrUnknownOperation).Write(response)
@@ -50,8 +51,10 @@ func (db *Olric) pipelineOperation(req *protocol.Message) *protocol.Message {
 			continue
 		}
 
-		// Call its function to prepare a response.
+		// Call its function to prepare a response. The extras of the responses
+		// are negotiated per connection, the pipelined responses don't have them.
 		pres := f(&preq)
+		pres.Extra = nil
 		err = pres.Write(response)
 		if err != nil {
 			return req.Error(protocol.StatusInternalServerError, err)
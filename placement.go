@@ -0,0 +1,74 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/discovery"
+)
+
+// hintedDistributor prefers the members in config.PlacementHints as the
+// primary owners of the partitions. A hinted member is only promoted on the
+// partitions which the underlying distributor already assigns to it as a
+// backup owner, so the load of the members doesn't change. The hints apply
+// to all DMaps, the partitions are shared by them.
+type hintedDistributor struct {
+	distributor
+	config *config.Config
+}
+
+// hintedMembers returns the names of the members in the placement hints of
+// all DMaps.
+func (d *hintedDistributor) hintedMembers() map[string]struct{} {
+	hinted := make(map[string]struct{})
+	for _, members := range d.config.PlacementHints {
+		for _, member := range members {
+			hinted[member] = struct{}{}
+		}
+	}
+	return hinted
+}
+
+func (d *hintedDistributor) Owners(partID uint64, count int) ([]discovery.Member, error) {
+	hinted := d.hintedMembers()
+	if len(hinted) == 0 {
+		return d.distributor.Owners(partID, count)
+	}
+
+	// Find the primary owner in the replica set of the partition, so the
+	// primary and the backup owners agree with each other regardless of count.
+	n := d.config.ReplicaCount
+	if total := len(d.GetMembers()); n > total {
+		n = total
+	}
+	if n < count {
+		n = count
+	}
+	owners, err := d.distributor.Owners(partID, n)
+	if err != nil {
+		return nil, err
+	}
+	for i, owner := range owners {
+		if _, ok := hinted[owner.Name]; !ok {
+			continue
+		}
+		if i != 0 {
+			promoted := append([]discovery.Member{owner}, owners[:i]...)
+			owners = append(promoted, owners[i+1:]...)
+		}
+		break
+	}
+	return owners[:count], nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestPlacementHints(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 3; i++ {
+		db, err := newDB(testConfig(dbs), dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	hinted := dbs[2]
+	for _, db := range dbs {
+		db.config.PlacementHints = map[string][]string{
+			"mymap": {hinted.this.Name},
+		}
+	}
+	syncClusterMembers(dbs...)
+
+	d := dbs[0].distributor.(*hintedDistributor)
+	for partID := uint64(0); partID < dbs[0].config.PartitionCount; partID++ {
+		replicas, err := d.distributor.Owners(partID, 2)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		owner := dbs[0].partitions[partID].owner()
+		switch {
+		case hostCmp(replicas[0], hinted.this) || hostCmp(replicas[1], hinted.this):
+			// The hinted member is preferred where it already keeps a copy.
+			if !hostCmp(owner, hinted.this) {
+				t.Fatalf("Expected %s as the owner of PartID: %d. Got: %s", hinted.this, partID, owner)
+			}
+		default:
+			if !hostCmp(owner, replicas[0]) {
+				t.Fatalf("Expected %s as the owner of PartID: %d. Got: %s", replicas[0], partID, owner)
+			}
+		}
+	}
+
+	// The keys are hashed to the same partitions, so they are still found.
+	for i := 0; i < 100; i++ {
+		hkey := dbs[0].getHKey("mymap", bkey(i))
+		if hkey != dbs[0].hasher.Sum64([]byte("mymap"+bkey(i))) {
+			t.Fatalf("Expected the hkey to depend on the key only: %s", bkey(i))
+		}
+		val, err := dm.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(val.([]byte), bval(i)) {
+			t.Fatalf("Expected the same value. Got: %s", string(val.([]byte)))
+		}
+	}
+
+	// None of the hinted members is available. The partitions should be
+	// distributed as usual.
+	for _, db := range dbs {
+		db.config.PlacementHints = map[string][]string{
+			"mymap": {"127.0.0.1:0"},
+		}
+	}
+	for partID := uint64(0); partID < dbs[0].config.PartitionCount; partID++ {
+		expected, err := d.distributor.Owners(partID, 2)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		owners, err := d.Owners(partID, 2)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		for i := range expected {
+			if !hostCmp(expected[i], owners[i]) {
+				t.Fatalf("Expected the normal placement for PartID: %d", partID)
+			}
+		}
+	}
+}
+
+func TestPlacementHintsReplicaCount(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.PlacementHints = map[string][]string{
+		"mymap": {"127.0.0.1:3320"},
+	}
+	if err := c.Sanitize(); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if err := c.Validate(); err == nil {
+		t.Fatalf("Expected an error for PlacementHints with ReplicaCount: %d", c.ReplicaCount)
+	}
+	c.ReplicaCount = 2
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+}
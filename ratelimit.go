@@ -0,0 +1,57 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter limits the number of bytes transferred per second. A transfer
+// is never split, it delays the next one instead.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int
+	next time.Time
+}
+
+func newRateLimiter(rate int) *rateLimiter {
+	return &rateLimiter{rate: rate}
+}
+
+// wait blocks until n bytes can be transferred or the context is done.
+func (r *rateLimiter) wait(ctx context.Context, n int) {
+	if r.rate <= 0 {
+		// Unlimited
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	delay := r.next.Sub(now)
+	r.next = r.next.Add(time.Duration(n) * time.Second / time.Duration(r.rate))
+	r.mu.Unlock()
+
+	if delay <= 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	}
+}
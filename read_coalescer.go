@@ -0,0 +1,140 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/olric/stats"
+	"golang.org/x/sync/singleflight"
+)
+
+// readCoalescerPurgeSize is the number of the cached responses which triggers
+// a purge of the expired ones.
+const readCoalescerPurgeSize = 4096
+
+type coalescedRead struct {
+	value   []byte
+	expires int64
+}
+
+// readCoalescer coalesces the concurrent identical reads redirected to the
+// partition owners into a single request, and keeps the responses for
+// a short while. See config.RedirectedReadCacheTTL.
+type readCoalescer struct {
+	ttl   time.Duration
+	group singleflight.Group
+
+	mtx     sync.Mutex
+	entries map[string]coalescedRead
+
+	reads     uint64
+	requests  uint64
+	coalesced uint64
+	cacheHits uint64
+}
+
+func newReadCoalescer(ttl time.Duration) *readCoalescer {
+	return &readCoalescer{
+		ttl:     ttl,
+		entries: make(map[string]coalescedRead),
+	}
+}
+
+// coalescerKey returns a unique key for the given DMap and key.
+func coalescerKey(name, key string) string {
+	return strconv.Itoa(len(name)) + ":" + name + key
+}
+
+func (r *readCoalescer) load(k string) ([]byte, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	entry, ok := r.entries[k]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().UnixNano() >= entry.expires {
+		delete(r.entries, k)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (r *readCoalescer) store(k string, value []byte) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	now := time.Now().UnixNano()
+	if len(r.entries) >= readCoalescerPurgeSize {
+		for key, entry := range r.entries {
+			if now >= entry.expires {
+				delete(r.entries, key)
+			}
+		}
+	}
+	r.entries[k] = coalescedRead{
+		value:   value,
+		expires: now + r.ttl.Nanoseconds(),
+	}
+}
+
+// get returns the cached response or calls fetch. The concurrent calls for the
+// same key share the result of a single fetch. Only the successful responses
+// are cached.
+func (r *readCoalescer) get(name, key string, fetch func() ([]byte, error)) ([]byte, error) {
+	atomic.AddUint64(&r.reads, 1)
+	k := coalescerKey(name, key)
+	if value, ok := r.load(k); ok {
+		atomic.AddUint64(&r.cacheHits, 1)
+		return copyBytes(value), nil
+	}
+
+	var fetched bool
+	v, err, _ := r.group.Do(k, func() (interface{}, error) {
+		fetched = true
+		atomic.AddUint64(&r.requests, 1)
+		value, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		r.store(k, value)
+		return value, nil
+	})
+	if !fetched {
+		atomic.AddUint64(&r.coalesced, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return copyBytes(v.([]byte)), nil
+}
+
+// copyBytes returns a copy of the shared response. The callers may modify it.
+func copyBytes(value []byte) []byte {
+	res := make([]byte, len(value))
+	copy(res, value)
+	return res
+}
+
+func (r *readCoalescer) stats() stats.ReadCoalescing {
+	return stats.ReadCoalescing{
+		Reads:     atomic.LoadUint64(&r.reads),
+		Requests:  atomic.LoadUint64(&r.requests),
+		Coalesced: atomic.LoadUint64(&r.coalesced),
+		CacheHits: atomic.LoadUint64(&r.cacheHits),
+	}
+}
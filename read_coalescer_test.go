@@ -0,0 +1,141 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadCoalescer(t *testing.T) {
+	r := newReadCoalescer(50 * time.Millisecond)
+	release := make(chan struct{})
+	fetch := func() ([]byte, error) {
+		<-release
+		return []byte("value"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := r.get("mymap", "mykey", fetch)
+			if err != nil {
+				t.Errorf("Expected nil. Got: %v", err)
+				return
+			}
+			if !bytes.Equal(value, []byte("value")) {
+				t.Errorf("Expected value. Got: %s", value)
+			}
+		}()
+	}
+	for atomic.LoadUint64(&r.reads) != 10 {
+		<-time.After(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	s := r.stats()
+	if s.Requests != 1 {
+		t.Fatalf("Expected a single request. Got: %d", s.Requests)
+	}
+	if s.Coalesced+s.CacheHits != 9 {
+		t.Fatalf("Expected 9 coalesced or cached reads. Got: %v", s)
+	}
+
+	// The cached response expires.
+	<-time.After(60 * time.Millisecond)
+	_, err := r.get("mymap", "mykey", fetch)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if s = r.stats(); s.Requests != 2 {
+		t.Fatalf("Expected 2 requests. Got: %d", s.Requests)
+	}
+}
+
+func TestDMap_RedirectedReadCacheTTL(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 2; i++ {
+		c := testConfig(nil)
+		c.RedirectedReadCacheTTL = 100 * time.Millisecond
+		db, err := newDB(c, dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	// Find a key which is owned by the second member.
+	var key string
+	for i := 0; ; i++ {
+		owner, _ := dbs[0].findPartitionOwner("mymap", bkey(i))
+		if hostCmp(owner, dbs[1].this) {
+			key = bkey(i)
+			break
+		}
+	}
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put(key, "first")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	get := func() interface{} {
+		value, err := dm.Get(key)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		return value
+	}
+	get()
+
+	// The cached response is served until it expires.
+	err = dm.Put(key, "second")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value := get(); value != "first" {
+		t.Fatalf("Expected the cached value. Got: %v", value)
+	}
+	<-time.After(150 * time.Millisecond)
+	if value := get(); value != "second" {
+		t.Fatalf("Expected second. Got: %v", value)
+	}
+
+	s, err := dbs[0].Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if s.ReadCoalescing.Reads != 3 || s.ReadCoalescing.Requests != 2 || s.ReadCoalescing.CacheHits != 1 {
+		t.Fatalf("Unexpected read coalescing stats: %v", s.ReadCoalescing)
+	}
+}
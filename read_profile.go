@@ -0,0 +1,93 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/olric/stats"
+)
+
+// readProfile aggregates the time spent in the stages of the sampled reads.
+// See config.ReadProfileSampleRate.
+type readProfile struct {
+	counter  uint64
+	samples  uint64
+	owners   int64
+	replicas int64
+	sort     int64
+	repair   int64
+}
+
+// readSample measures the stages of a single read. It's a no-op if the read
+// is not sampled.
+type readSample struct {
+	enabled  bool
+	last     time.Time
+	owners   time.Duration
+	replicas time.Duration
+	sort     time.Duration
+	repair   time.Duration
+}
+
+// lap returns the time passed since the previous call.
+func (s *readSample) lap() time.Duration {
+	if !s.enabled {
+		return 0
+	}
+	now := time.Now()
+	elapsed := now.Sub(s.last)
+	s.last = now
+	return elapsed
+}
+
+// sample decides whether the read is sampled. It's one atomic operation for
+// the reads which are not.
+func (p *readProfile) sample(rate int) readSample {
+	if rate <= 0 || atomic.AddUint64(&p.counter, 1)%uint64(rate) != 0 {
+		return readSample{}
+	}
+	return readSample{enabled: true, last: time.Now()}
+}
+
+func (p *readProfile) record(s *readSample) {
+	if !s.enabled {
+		return
+	}
+	atomic.AddUint64(&p.samples, 1)
+	atomic.AddInt64(&p.owners, int64(s.owners))
+	atomic.AddInt64(&p.replicas, int64(s.replicas))
+	atomic.AddInt64(&p.sort, int64(s.sort))
+	atomic.AddInt64(&p.repair, int64(s.repair))
+}
+
+func (p *readProfile) stats() stats.ReadProfile {
+	samples := atomic.LoadUint64(&p.samples)
+	res := stats.ReadProfile{
+		Samples: samples,
+	}
+	if samples == 0 {
+		return res
+	}
+	mean := func(total *int64) time.Duration {
+		return time.Duration(atomic.LoadInt64(total) / int64(samples))
+	}
+	res.LookupOnOwners = mean(&p.owners)
+	res.LookupOnReplicas = mean(&p.replicas)
+	res.Sort = mean(&p.sort)
+	res.ReadRepair = mean(&p.repair)
+	return res
+}
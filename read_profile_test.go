@@ -0,0 +1,77 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReadProfile_Sample(t *testing.T) {
+	p := &readProfile{}
+	for i := 0; i < 10; i++ {
+		s := p.sample(0)
+		p.record(&s)
+	}
+	if p.stats().Samples != 0 {
+		t.Fatalf("Expected no samples. Got: %d", p.stats().Samples)
+	}
+	for i := 0; i < 10; i++ {
+		s := p.sample(3)
+		p.record(&s)
+	}
+	if p.stats().Samples != 3 {
+		t.Fatalf("Expected 3 samples. Got: %d", p.stats().Samples)
+	}
+}
+
+func TestDMap_ReadProfile(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.ReadProfileSampleRate = 2
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		_, err = dm.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	s := db.readProfile.stats()
+	if s.Samples != 5 {
+		t.Fatalf("Expected 5 samples. Got: %d", s.Samples)
+	}
+	if s.LookupOnOwners <= 0 {
+		t.Fatalf("Expected LookupOnOwners to be measured. Got: %v", s.LookupOnOwners)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"sync/atomic"
+
+	"github.com/buraksezer/olric/stats"
+)
+
+// readVersionsBuckets is the number of the buckets in the distribution of the
+// versions per read. The reads with more versions are counted in the last one.
+const readVersionsBuckets = 16
+
+// readVersionsStats keeps the distribution of the number of versions collected
+// per read.
+type readVersionsStats struct {
+	buckets   [readVersionsBuckets + 1]uint64
+	max       int64
+	truncated uint64
+}
+
+func (r *readVersionsStats) observe(count int, truncated bool) {
+	bucket := count
+	if bucket > readVersionsBuckets {
+		bucket = readVersionsBuckets
+	}
+	atomic.AddUint64(&r.buckets[bucket], 1)
+	if truncated {
+		atomic.AddUint64(&r.truncated, 1)
+	}
+	for {
+		current := atomic.LoadInt64(&r.max)
+		if int64(count) <= current || atomic.CompareAndSwapInt64(&r.max, current, int64(count)) {
+			return
+		}
+	}
+}
+
+func (r *readVersionsStats) stats() stats.ReadVersions {
+	s := stats.ReadVersions{
+		Distribution: make(map[int]uint64),
+		Max:          int(atomic.LoadInt64(&r.max)),
+		Truncated:    atomic.LoadUint64(&r.truncated),
+	}
+	for count := range r.buckets {
+		if n := atomic.LoadUint64(&r.buckets[count]); n != 0 {
+			s.Distribution[count] = n
+		}
+	}
+	return s
+}
+
+// readLimit stops collecting the versions of a key once enough of them are
+// found. A nil readLimit doesn't limit anything.
+type readLimit struct {
+	max       int
+	found     int
+	truncated bool
+}
+
+// newReadLimit returns the limit of a read with the given quorum. It's nil if
+// MaxReadVersions is disabled or the read has to consult every owner.
+func (db *Olric) newReadLimit(readQuorum int, opts *ReadOptions) *readLimit {
+	if db.config.MaxReadVersions == 0 || opts.ReadAll || opts.MajorityAgreement {
+		return nil
+	}
+	// The versions may not span enough regions if we stop early.
+	if db.config.ReadRegionQuorum > 0 {
+		return nil
+	}
+	max := db.config.MaxReadVersions
+	if max < readQuorum {
+		// Never stop before reaching the quorum.
+		max = readQuorum
+	}
+	return &readLimit{max: max}
+}
+
+// observe counts the version if it's found.
+func (l *readLimit) observe(ver *version) {
+	if l != nil && ver.Data != nil {
+		l.found++
+	}
+}
+
+// reached returns true if enough versions are found. It marks the read as
+// truncated, the caller is expected to stop querying the other members.
+func (l *readLimit) reached() bool {
+	if l == nil || l.found < l.max {
+		return false
+	}
+	l.truncated = true
+	return true
+}
@@ -0,0 +1,111 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/buraksezer/olric/stats"
+)
+
+func TestDMap_MaxReadVersions(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 3; i++ {
+		c := testConfig(nil)
+		c.ReplicaCount = 3
+		c.WriteQuorum = 3
+		c.ReadQuorum = 2
+		db, err := newDB(c, dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	// Sums the read versions of the cluster and resets them.
+	collect := func() stats.ReadVersions {
+		total := stats.ReadVersions{Distribution: make(map[int]uint64)}
+		for _, db := range dbs {
+			s := db.readVersions.stats()
+			for count, n := range s.Distribution {
+				total.Distribution[count] += n
+			}
+			total.Truncated += s.Truncated
+			db.readVersions = readVersionsStats{}
+		}
+		return total
+	}
+	readAll := func() {
+		for i := 0; i < 10; i++ {
+			value, err := dm.Get(bkey(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if !bytes.Equal(value.([]byte), bval(i)) {
+				t.Fatalf("Value is different for key: %s", bkey(i))
+			}
+		}
+	}
+
+	readAll()
+	s := collect()
+	if s.Distribution[3] != 10 || s.Truncated != 0 {
+		t.Fatalf("Expected 10 reads with 3 versions. Got: %v", s)
+	}
+
+	// It's never less than the read quorum.
+	for _, maxVersions := range []int{1, 2} {
+		for _, db := range dbs {
+			db.config.MaxReadVersions = maxVersions
+		}
+		readAll()
+		s = collect()
+		if s.Distribution[2] != 10 || s.Truncated != 10 {
+			t.Fatalf("Expected 10 truncated reads with 2 versions. Got: %v", s)
+		}
+	}
+
+	// ReadAll consults every owner.
+	_, err = dm.GetWithOptions(bkey(0), &ReadOptions{ReadAll: true})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	s = collect()
+	if s.Distribution[3] != 1 || s.Truncated != 0 {
+		t.Fatalf("Expected a read with 3 versions. Got: %v", s)
+	}
+}
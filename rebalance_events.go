@@ -0,0 +1,158 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"sync"
+	"time"
+)
+
+// rebalanceEventQueueSize is the maximum number of events waiting for delivery.
+// The events are dropped if the subscribers are too slow.
+const rebalanceEventQueueSize = 64
+
+// RebalanceEventType denotes the phase of a rebalance.
+type RebalanceEventType string
+
+const (
+	// RebalanceStarted is sent before the rebalancer starts moving the partitions.
+	RebalanceStarted RebalanceEventType = "started"
+
+	// RebalanceCompleted is sent after the rebalancer has finished.
+	RebalanceCompleted RebalanceEventType = "completed"
+)
+
+// RebalanceTrigger denotes the reason of a rebalance.
+type RebalanceTrigger string
+
+const (
+	// TriggerMemberJoined means that a member has joined the cluster.
+	TriggerMemberJoined RebalanceTrigger = "member-joined"
+
+	// TriggerMemberLeft means that a member has left the cluster.
+	TriggerMemberLeft RebalanceTrigger = "member-left"
+
+	// TriggerRoutingUpdate means that the cluster coordinator has pushed
+	// a routing table without a membership change.
+	TriggerRoutingUpdate RebalanceTrigger = "routing-update"
+)
+
+// RebalanceEvent is sent to the subscribers registered by OnRebalance. Every
+// member runs its own rebalancer, so the events are local to a member.
+type RebalanceEvent struct {
+	Type    RebalanceEventType
+	Trigger RebalanceTrigger
+
+	// Member is the name of the member which has joined or left the cluster.
+	Member string
+
+	// The following fields are only set on RebalanceCompleted.
+
+	// Number of partitions, including the backups, moved to another member.
+	PartitionsMoved int
+
+	// Number of bytes sent to the other members.
+	BytesTransferred int64
+
+	Duration time.Duration
+}
+
+// rebalanceProgress collects the metrics of a single rebalancer run.
+type rebalanceProgress struct {
+	partitions int
+	bytes      int64
+}
+
+type rebalanceEvents struct {
+	mu          sync.RWMutex
+	subscribers []func(RebalanceEvent)
+	trigger     RebalanceTrigger
+	member      string
+
+	once  sync.Once
+	queue chan RebalanceEvent
+}
+
+// setTrigger records the last membership change.
+func (r *rebalanceEvents) setTrigger(trigger RebalanceTrigger, member string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.trigger = trigger
+	r.member = member
+}
+
+// takeTrigger returns the last membership change and resets it.
+func (r *rebalanceEvents) takeTrigger() (RebalanceTrigger, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	trigger, member := r.trigger, r.member
+	if trigger == "" {
+		trigger = TriggerRoutingUpdate
+	}
+	r.trigger, r.member = "", ""
+	return trigger, member
+}
+
+// publishRebalanceEvent queues an event without blocking the rebalancer.
+func (db *Olric) publishRebalanceEvent(e RebalanceEvent) {
+	r := &db.rebalanceEvents
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.subscribers) == 0 {
+		return
+	}
+	select {
+	case r.queue <- e:
+	default:
+		db.log.V(2).Printf("[WARN] Rebalance event queue is full. Event dropped: %s", e.Type)
+	}
+}
+
+// deliverRebalanceEvents calls the subscribers in the order of the events.
+func (db *Olric) deliverRebalanceEvents() {
+	defer db.wg.Done()
+
+	r := &db.rebalanceEvents
+	for {
+		select {
+		case <-db.ctx.Done():
+			return
+		case e := <-r.queue:
+			r.mu.RLock()
+			subscribers := r.subscribers
+			r.mu.RUnlock()
+			for _, f := range subscribers {
+				f(e)
+			}
+		}
+	}
+}
+
+// OnRebalance registers fn to be called when the rebalancer starts and
+// completes on this member. The subscribers are called sequentially on
+// a separate goroutine, so a slow subscriber delays the next events but
+// not the rebalancer. It's thread-safe.
+func (db *Olric) OnRebalance(fn func(RebalanceEvent)) {
+	r := &db.rebalanceEvents
+	r.once.Do(func() {
+		r.queue = make(chan RebalanceEvent, rebalanceEventQueueSize)
+		db.wg.Add(1)
+		go db.deliverRebalanceEvents()
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/buraksezer/olric/config"
 
@@ -41,7 +42,13 @@ type dmapbox struct {
 	AccessLog map[uint64]int64
 }
 
-func (db *Olric) moveDMap(part *partition, name string, dm *dmap, owner discovery.Member) error {
+func (db *Olric) moveDMap(part *partition, name string, dm *dmap, owner discovery.Member, progress *rebalanceProgress) error {
+	// Wait before acquiring the lock. Don't block the other requests.
+	dm.RLock()
+	inuse := dm.storage.Inuse()
+	dm.RUnlock()
+	db.rebalanceLimiter.wait(db.ctx, inuse)
+
 	dm.Lock()
 	defer dm.Unlock()
 
@@ -71,8 +78,12 @@ func (db *Olric) moveDMap(part *partition, name string, dm *dmap, owner discover
 	if err != nil {
 		return err
 	}
+	progress.bytes += int64(len(value))
 
 	// Delete moved dmap instance. the gc will free the allocated memory.
+	if err = dm.wal.drop(name); err != nil {
+		db.log.V(2).Printf("[ERROR] Failed to log moved DMap: %s on PartID: %d: %v", name, part.id, err)
+	}
 	part.m.Delete(name)
 	return nil
 }
@@ -123,7 +134,12 @@ func (db *Olric) mergeDMaps(part *partition, data *dmapbox) error {
 
 	// We do not need the following loop if the DMap is created here.
 	if !exist {
-		return nil
+		var walErr error
+		str.Range(func(hkey uint64, vdata *storage.VData) bool {
+			walErr = dm.wal.put(data.Name, vdata)
+			return walErr == nil
+		})
+		return walErr
 	}
 
 	var mergeErr error
@@ -133,6 +149,9 @@ func (db *Olric) mergeDMaps(part *partition, data *dmapbox) error {
 			mergeErr = err
 			return false
 		}
+		if mergeErr = dm.wal.put(data.Name, winner); mergeErr != nil {
+			return false
+		}
 		mergeErr = dm.storage.Put(hkey, winner)
 		if mergeErr == storage.ErrFragmented {
 			db.wg.Add(1)
@@ -142,12 +161,15 @@ func (db *Olric) mergeDMaps(part *partition, data *dmapbox) error {
 		if mergeErr != nil {
 			return false
 		}
+		if dm.index != nil {
+			dm.index.Insert(db.normalizeKey(winner.Key), hkey)
+		}
 		return true
 	})
 	return mergeErr
 }
 
-func (db *Olric) rebalancePrimaryPartitions() {
+func (db *Olric) rebalancePrimaryPartitions(progress *rebalanceProgress) {
 	rsign := atomic.LoadUint64(&routingSignature)
 	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
 		if !db.isAlive() {
@@ -173,21 +195,27 @@ func (db *Olric) rebalancePrimaryPartitions() {
 			continue
 		}
 		// This is a previous owner. Move the keys.
+		var moved bool
 		part.m.Range(func(name, dm interface{}) bool {
 			db.log.V(2).Printf("[INFO] Moving DMap: %s (backup: %v) on PartID: %d to %s",
 				name, part.backup, partID, owner)
-			err := db.moveDMap(part, name.(string), dm.(*dmap), owner)
+			err := db.moveDMap(part, name.(string), dm.(*dmap), owner, progress)
 			if err != nil {
 				db.log.V(3).Printf("[ERROR] Failed to move DMap: %s on PartID: %d to %s: %v",
 					name, partID, owner, err)
+			} else {
+				moved = true
 			}
 			// if this returns true, the iteration continues
 			return rsign == atomic.LoadUint64(&routingSignature)
 		})
+		if moved {
+			progress.partitions++
+		}
 	}
 }
 
-func (db *Olric) rebalanceBackupPartitions() {
+func (db *Olric) rebalanceBackupPartitions(progress *rebalanceProgress) {
 	rsign := atomic.LoadUint64(&routingSignature)
 	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
 		if !db.isAlive() {
@@ -234,17 +262,23 @@ func (db *Olric) rebalanceBackupPartitions() {
 				continue
 			}
 
+			var moved bool
 			part.m.Range(func(name, dm interface{}) bool {
 				db.log.V(2).Printf("[INFO] Moving DMap: %s (backup: %v) on PartID: %d to %s",
 					name, part.backup, partID, owner)
-				err := db.moveDMap(part, name.(string), dm.(*dmap), owner)
+				err := db.moveDMap(part, name.(string), dm.(*dmap), owner, progress)
 				if err != nil {
 					db.log.V(3).Printf("[ERROR] Failed to move backup DMap: %s on PartID: %d to %s: %v",
 						name, partID, owner, err)
+				} else {
+					moved = true
 				}
 				// if this returns true, the iteration continues
 				return rsign == atomic.LoadUint64(&routingSignature)
 			})
+			if moved {
+				progress.partitions++
+			}
 		}
 	}
 }
@@ -257,10 +291,30 @@ func (db *Olric) rebalancer() {
 		db.log.V(1).Printf("[WARN] Rebalancer awaits for bootstrapping")
 		return
 	}
-	db.rebalancePrimaryPartitions()
+
+	start := time.Now()
+	trigger, member := db.rebalanceEvents.takeTrigger()
+	db.publishRebalanceEvent(RebalanceEvent{
+		Type:    RebalanceStarted,
+		Trigger: trigger,
+		Member:  member,
+	})
+
+	progress := &rebalanceProgress{}
+	db.rebalancePrimaryPartitions(progress)
 	if db.config.ReplicaCount > config.MinimumReplicaCount {
-		db.rebalanceBackupPartitions()
+		db.rebalanceBackupPartitions(progress)
 	}
+	atomic.StoreInt64(&db.lastRebalance, time.Now().UnixNano())
+
+	db.publishRebalanceEvent(RebalanceEvent{
+		Type:             RebalanceCompleted,
+		Trigger:          trigger,
+		Member:           member,
+		PartitionsMoved:  progress.partitions,
+		BytesTransferred: progress.bytes,
+		Duration:         time.Since(start),
+	})
 }
 
 func (db *Olric) checkOwnership(part *partition) bool {
@@ -311,3 +365,173 @@ func (db *Olric) moveDMapOperation(req *protocol.Message) *protocol.Message {
 	}
 	return req.Success()
 }
+
+// warmUpBackups pulls the keys of the empty backup partitions from the primary
+// owners. It's called once on join to populate the backups of a node which is
+// restarted with an empty storage. The owners push the partitions in chunks,
+// see copyPartition.
+func (db *Olric) warmUpBackups() {
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		if !db.isAlive() {
+			// The server is gone.
+			break
+		}
+
+		part := db.backups[partID]
+		if part.length() != 0 || !db.checkOwnership(part) {
+			continue
+		}
+		owner := db.partitions[partID].owner()
+		if hostCmp(owner, db.this) {
+			continue
+		}
+
+		// The value is the address of this member, the owner sends the chunks to it.
+		req := &protocol.Message{
+			Value: []byte(db.this.String()),
+			Extra: protocol.SyncBackupExtra{
+				PartID: partID,
+			},
+		}
+		_, err := db.requestTo(owner.String(), protocol.OpSyncBackup, req)
+		if err != nil {
+			db.log.V(3).Printf("[ERROR] Failed to sync backup PartID: %d from %s: %v",
+				partID, owner, err)
+		}
+	}
+}
+
+// syncChunkSize is the approximate size of the keys and values sent to a backup
+// owner in a single message while copying a partition.
+const syncChunkSize = 1 << 20
+
+// exportDMapChunks exports a DMap on a primary partition as backups, in chunks
+// of about chunkSize bytes of keys and values, and calls f for every chunk.
+// The lock of the DMap is not held while f runs, the keys written meanwhile
+// are replicated by the regular write path.
+func (db *Olric) exportDMapChunks(part *partition, name string, dm *dmap, chunkSize int, f func(*dmapbox) error) error {
+	dm.RLock()
+	hkeys := make([]uint64, 0, dm.storage.Len())
+	dm.storage.Range(func(hkey uint64, _ *storage.VData) bool {
+		hkeys = append(hkeys, hkey)
+		return true
+	})
+	dm.RUnlock()
+
+	for len(hkeys) > 0 {
+		var (
+			entries []*storage.VData
+			chunk   []uint64
+			size    int
+		)
+		dm.RLock()
+		for len(hkeys) > 0 && size < chunkSize {
+			hkey := hkeys[0]
+			hkeys = hkeys[1:]
+			vdata, err := dm.storage.Get(hkey)
+			if err == storage.ErrKeyNotFound {
+				// Deleted meanwhile.
+				continue
+			}
+			if err != nil {
+				dm.RUnlock()
+				return err
+			}
+			entries = append(entries, vdata)
+			chunk = append(chunk, hkey)
+			// See the layout of the storage tables.
+			size += len(vdata.Key) + len(vdata.Value) + 21
+		}
+		dm.RUnlock()
+		if len(entries) == 0 {
+			continue
+		}
+
+		// A single table, it cannot be exported if it's fragmented.
+		str := storage.New(size + 1)
+		for i, vdata := range entries {
+			if err := str.Put(chunk[i], vdata); err != nil {
+				return err
+			}
+		}
+		payload, err := str.Export()
+		if err != nil {
+			return err
+		}
+		err = f(&dmapbox{
+			PartID:  part.id,
+			Backup:  true,
+			Name:    name,
+			Payload: payload,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportPartition exports the DMaps on a primary partition as backups.
+func (db *Olric) exportPartition(part *partition) []*dmapbox {
+	var boxes []*dmapbox
+	part.m.Range(func(name, tmp interface{}) bool {
+		dm := tmp.(*dmap)
+		dm.RLock()
+		payload, err := dm.storage.Export()
+		dm.RUnlock()
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to export DMap: %s on PartID: %d: %v", name, part.id, err)
+			return true
+		}
+		boxes = append(boxes, &dmapbox{
+			PartID:  part.id,
+			Backup:  true,
+			Name:    name.(string),
+			Payload: payload,
+		})
+		return true
+	})
+	return boxes
+}
+
+// syncBackupOperation returns the DMaps on a primary partition if the request
+// has no value. Otherwise, the value is the address of a backup owner of the
+// partition and the DMaps are copied to it in chunks.
+func (db *Olric) syncBackupOperation(req *protocol.Message) *protocol.Message {
+	err := db.checkOperationStatus()
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+
+	partID := req.Extra.(protocol.SyncBackupExtra).PartID
+	if partID >= db.config.PartitionCount {
+		return req.Error(protocol.StatusBadRequest, fmt.Sprintf("invalid partID: %d", partID))
+	}
+	part := db.partitions[partID]
+	if !hostCmp(part.owner(), db.this) {
+		return req.Error(protocol.StatusBadRequest,
+			fmt.Sprintf("partID: %d doesn't belong to %s", partID, db.this))
+	}
+
+	if len(req.Value) == 0 {
+		// Return the whole partition, see collectPartition.
+		value, err := msgpack.Marshal(db.exportPartition(part))
+		if err != nil {
+			return db.prepareResponse(req, err)
+		}
+		res := req.Success()
+		res.Value = value
+		return res
+	}
+
+	// Push the partition to the backup owner in chunks, see warmUpBackups.
+	addr := string(req.Value)
+	for _, backup := range db.backups[partID].loadOwners() {
+		if backup.String() == addr {
+			err = db.copyPartition(part, backup)
+			return db.prepareResponse(req, err)
+		}
+	}
+	return req.Error(protocol.StatusBadRequest,
+		fmt.Sprintf("%s is not a backup owner of partID: %d", addr, partID))
+}
@@ -21,6 +21,8 @@ import (
 	"strconv"
 	"testing"
 	"time"
+
+	"github.com/buraksezer/olric/internal/storage"
 )
 
 func TestRebalance_Merge(t *testing.T) {
@@ -247,6 +249,180 @@ func TestRebalance_CheckOwnership(t *testing.T) {
 	checkOwnership(db3)
 }
 
+func TestRebalance_WarmUpBackups(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	backupLength := func() int {
+		var total int
+		for partID := uint64(0); partID < db2.config.PartitionCount; partID++ {
+			total += db2.backups[partID].length()
+		}
+		return total
+	}
+	expected := backupLength()
+	if expected == 0 {
+		t.Fatalf("Expected some backups on %s", db2.this)
+	}
+
+	// Simulate a cold restart.
+	for partID := uint64(0); partID < db2.config.PartitionCount; partID++ {
+		part := db2.backups[partID]
+		part.m.Range(func(name, dm interface{}) bool {
+			part.m.Delete(name)
+			return true
+		})
+	}
+	if backupLength() != 0 {
+		t.Fatalf("Expected no backups on %s", db2.this)
+	}
+
+	db2.warmUpBackups()
+	if backupLength() != expected {
+		t.Fatalf("Expected backup key count: %d. Got: %d", expected, backupLength())
+	}
+}
+
+func TestRebalance_ImbalanceThreshold(t *testing.T) {
+	c1 := testSingleReplicaConfig()
+	// The partitions are never moved, unless an owner leaves the cluster.
+	c1.RebalanceImbalanceThreshold = 1
+	db1, err := newDB(c1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db1.Shutdown(context.Background())
+		if err != nil {
+			db1.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	db2, err := newDB(testSingleReplicaConfig(), db1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db2.Shutdown(context.Background())
+		if err != nil {
+			db2.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	syncClusterMembers(db1, db2)
+
+	if err = db2.checkOperationStatus(); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for partID := uint64(0); partID < db2.config.PartitionCount; partID++ {
+		if !hostCmp(db2.partitions[partID].owner(), db1.this) {
+			t.Fatalf("Expected owner of PartID: %d is %s. Got: %s",
+				partID, db1.this, db2.partitions[partID].owner())
+		}
+	}
+
+	s, err := db2.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if s.Rebalancer.LastRun == 0 {
+		t.Fatalf("Expected LastRun to be set")
+	}
+}
+
+func TestRebalance_OnRebalance(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	events := make(chan RebalanceEvent, 100)
+	db1.OnRebalance(func(e RebalanceEvent) {
+		events <- e
+	})
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	syncClusterMembers(db1, db2)
+
+	var started bool
+	for {
+		select {
+		case e := <-events:
+			if e.Type == RebalanceStarted {
+				started = true
+				continue
+			}
+			if !started {
+				t.Fatalf("Expected RebalanceStarted before RebalanceCompleted")
+			}
+			if e.PartitionsMoved == 0 {
+				// Nothing moved by this run.
+				continue
+			}
+			if e.Trigger != TriggerMemberJoined {
+				t.Fatalf("Expected trigger: %s. Got: %s", TriggerMemberJoined, e.Trigger)
+			}
+			if e.Member != db2.this.String() {
+				t.Fatalf("Expected member: %s. Got: %s", db2.this, e.Member)
+			}
+			if e.BytesTransferred == 0 {
+				t.Fatalf("Expected BytesTransferred to be greater than zero")
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No RebalanceCompleted event with moved partitions")
+		}
+	}
+}
+
 func TestSplitBrain_ErrClusterQuorum(t *testing.T) {
 	cfg := newTestCustomConfig()
 	c := newTestCluster(cfg)
@@ -277,6 +453,53 @@ func TestSplitBrain_ErrClusterQuorum(t *testing.T) {
 	}
 }
 
+func TestMinimumMemberQuorum(t *testing.T) {
+	cfg := newTestCustomConfig()
+	c := newTestCluster(cfg)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db1.config.MinimumMemberQuorum = 2
+
+	mname := "mymap"
+	_, err = db1.NewDMap(mname)
+	if err != ErrClusterNotReady {
+		t.Fatalf("Expected ErrClusterNotReady. Got: %v", err)
+	}
+	if db1.Ready() {
+		t.Fatalf("Expected the member not to be ready")
+	}
+
+	_, err = c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !db1.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the member to be ready")
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+	_, err = db1.NewDMap(mname)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	// It's not checked again once it's met.
+	db1.config.MinimumMemberQuorum = 3
+	if !db1.Ready() {
+		t.Fatalf("Expected the member to be ready")
+	}
+	_, err = db1.NewDMap(mname)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+}
+
 func TestSplitBrain_SimpleMerge(t *testing.T) {
 	cfg1 := newTestCustomConfig()
 	cfg1.ReplicaCount = 1
@@ -345,3 +568,62 @@ func TestSplitBrain_SimpleMerge(t *testing.T) {
 		}
 	}
 }
+
+func TestRebalance_ExportDMapChunks(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	const chunkSize = 1024
+	var keys, chunks int
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		tmp, ok := part.m.Load("mymap")
+		if !ok {
+			continue
+		}
+		err = db.exportDMapChunks(part, "mymap", tmp.(*dmap), chunkSize, func(box *dmapbox) error {
+			str, err := storage.Import(box.Payload)
+			if err != nil {
+				return err
+			}
+			if !box.Backup || box.PartID != partID {
+				t.Fatalf("Unexpected chunk of PartID: %d (backup: %v)", box.PartID, box.Backup)
+			}
+			// A chunk exceeds the limit by one entry at most.
+			if inuse := str.Inuse(); inuse >= 2*chunkSize {
+				t.Fatalf("Expected a chunk smaller than %d. Got: %d", 2*chunkSize, inuse)
+			}
+			keys += str.Len()
+			chunks++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	if keys != 1000 {
+		t.Fatalf("Expected 1000 keys. Got: %d", keys)
+	}
+	if chunks <= int(db.config.PartitionCount) {
+		t.Fatalf("Expected the DMaps to be split into chunks. Got: %d", chunks)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/stats"
+	"github.com/vmihailenco/msgpack"
+)
+
+// replication keeps the new backup owners of the primary partitions owned by
+// this member until the partitions are copied to them. A backup owner only
+// receives the new writes, the existing keys have to be copied to restore
+// ReplicaCount after a member loss.
+type replication struct {
+	mtx     sync.Mutex
+	pending map[uint64][]discovery.Member
+	copied  uint64
+}
+
+func newReplication() *replication {
+	return &replication{
+		pending: make(map[uint64][]discovery.Member),
+	}
+}
+
+// schedule records the backup owners in r which aren't in the previous backup
+// owners list of the partition.
+func (rp *replication) schedule(partID uint64, previous []discovery.Member, r route) {
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+
+	for _, backup := range r.Backups {
+		if containsMember(previous, backup) || containsMember(rp.pending[partID], backup) {
+			continue
+		}
+		rp.pending[partID] = append(rp.pending[partID], backup)
+	}
+}
+
+// isPending returns true if the partition is not copied to the backup owner yet.
+func (rp *replication) isPending(partID uint64, backup discovery.Member) bool {
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+	return containsMember(rp.pending[partID], backup)
+}
+
+// snapshot returns a copy of the pending copies.
+func (rp *replication) snapshot() map[uint64][]discovery.Member {
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+
+	pending := make(map[uint64][]discovery.Member, len(rp.pending))
+	for partID, backups := range rp.pending {
+		pending[partID] = append([]discovery.Member(nil), backups...)
+	}
+	return pending
+}
+
+// done removes a pending copy.
+func (rp *replication) done(partID uint64, backup discovery.Member) {
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+
+	backups := rp.pending[partID]
+	for i, m := range backups {
+		if hostCmp(m, backup) {
+			backups = append(backups[:i], backups[i+1:]...)
+			break
+		}
+	}
+	if len(backups) == 0 {
+		delete(rp.pending, partID)
+		return
+	}
+	rp.pending[partID] = backups
+}
+
+func containsMember(members []discovery.Member, member discovery.Member) bool {
+	for _, m := range members {
+		if hostCmp(m, member) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyPartition copies the DMaps on a primary partition to a backup owner.
+// The existing keys on the backup owner are merged by their timestamps. The
+// DMaps are sent in chunks of about syncChunkSize bytes, the rebalance rate
+// limit is applied before every chunk.
+func (db *Olric) copyPartition(part *partition, backup discovery.Member) error {
+	send := func(box *dmapbox) error {
+		db.rebalanceLimiter.wait(db.ctx, len(box.Payload))
+		value, err := msgpack.Marshal(box)
+		if err != nil {
+			return err
+		}
+		req := &protocol.Message{
+			Value: value,
+		}
+		_, err = db.requestTo(backup.String(), protocol.OpMoveDMap, req)
+		return err
+	}
+
+	var err error
+	part.m.Range(func(name, dm interface{}) bool {
+		if db.hasFewerReplicas(name.(string)) &&
+			!containsMember(db.dmapBackupOwners(name.(string), db.backups[part.id].loadOwners()), backup) {
+			// The DMap has fewer replicas.
+			return true
+		}
+		err = db.exportDMapChunks(part, name.(string), dm.(*dmap), syncChunkSize, send)
+		return err == nil
+	})
+	return err
+}
+
+// replicatePartitions copies the primary partitions owned by this member to
+// their new backup owners. It's called after every routing table update. The
+// failed copies are tried again on the next update.
+func (db *Olric) replicatePartitions() {
+	rebalanceMtx.Lock()
+	defer rebalanceMtx.Unlock()
+
+	for partID, backups := range db.replication.snapshot() {
+		for _, backup := range backups {
+			if !db.isAlive() {
+				// The server is gone.
+				return
+			}
+
+			part := db.partitions[partID]
+			if !hostCmp(part.owner(), db.this) ||
+				!containsMember(db.backups[partID].loadOwners(), backup) ||
+				!db.isMemberAlive(backup) {
+				// The routing table has been changed.
+				db.replication.done(partID, backup)
+				continue
+			}
+			if part.length() == 0 {
+				// Nothing to copy. The new writes are already replicated.
+				db.replication.done(partID, backup)
+				continue
+			}
+
+			db.log.V(2).Printf("[INFO] Copying PartID: %d to the new backup owner: %s", partID, backup)
+			err := db.copyPartition(part, backup)
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to copy PartID: %d to %s: %v", partID, backup, err)
+				continue
+			}
+			db.replication.done(partID, backup)
+			atomic.AddUint64(&db.replication.copied, 1)
+		}
+	}
+}
+
+// replicationStats returns the number of the primary partitions on this member
+// which have fewer live and up-to-date backups than ReplicaCount-1.
+func (db *Olric) replicationStats() stats.Replication {
+	s := stats.Replication{
+		Copied: atomic.LoadUint64(&db.replication.copied),
+	}
+	if db.config.ReplicaCount <= config.MinimumReplicaCount {
+		return s
+	}
+
+	routingMtx.RLock()
+	defer routingMtx.RUnlock()
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		if part.ownerCount() == 0 || !hostCmp(part.owner(), db.this) {
+			continue
+		}
+		var live int
+		for _, backup := range db.backups[partID].loadOwners() {
+			if db.isMemberAlive(backup) && !db.replication.isPending(partID, backup) {
+				live++
+			}
+		}
+		if live < db.config.ReplicaCount-1 {
+			s.UnderReplicated++
+		}
+	}
+	return s
+}
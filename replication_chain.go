@@ -0,0 +1,186 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// chainReplica is a replica write relayed through the backup owners. Message
+// is the encoded replica request, Chain is the list of the next backup owners.
+type chainReplica struct {
+	Chain   []string
+	Message []byte
+}
+
+// chainReplicaOps are the replica writes which can be relayed through the
+// backup owners. The other operations are rejected by chainReplicaOperation.
+var chainReplicaOps = map[protocol.OpCode]struct{}{
+	protocol.OpPutReplica:            {},
+	protocol.OpPutExReplica:          {},
+	protocol.OpPutIfReplica:          {},
+	protocol.OpPutIfExReplica:        {},
+	protocol.OpPutWithOptionsReplica: {},
+	protocol.OpExpireReplica:         {},
+}
+
+// supportsChain returns true if all the backup owners support
+// OpChainReplica.
+func (db *Olric) supportsChain(owners []discovery.Member) bool {
+	for _, owner := range owners {
+		ok, err := db.client.Supports(owner.String(), protocol.CapChainReplication)
+		if err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// relayReplica sends the replica write to the first reachable member of the
+// chain with the rest of the chain. It returns the number of the backup owners
+// which have stored it.
+func (db *Olric) relayReplica(name, key string, chain []string, message []byte) int {
+	for i, addr := range chain {
+		value, err := msgpack.Marshal(chainReplica{
+			Chain:   chain[i+1:],
+			Message: message,
+		})
+		if err != nil {
+			db.log.V(3).Printf("[ERROR] Failed to encode chain replica of key: %s: %v", key, err)
+			return 0
+		}
+		req := &protocol.Message{
+			DMap:  name,
+			Key:   key,
+			Value: value,
+		}
+		resp, err := db.requestTo(addr, protocol.OpChainReplica, req)
+		if err != nil {
+			// Skip the unreachable member.
+			if db.log.V(3).Ok() {
+				db.log.V(3).Printf("[ERROR] Failed to relay replica write to %s for DMap: %s: %v", addr, name, err)
+			}
+			continue
+		}
+		var stored int
+		if err = msgpack.Unmarshal(resp.Value, &stored); err != nil {
+			db.log.V(3).Printf("[ERROR] Failed to decode chain replica response from %s: %v", addr, err)
+		}
+		return stored
+	}
+	return 0
+}
+
+// chainPutOnCluster stores the key/value pair on this member and relays the
+// replica write through the backup owners. See config.ChainReplicationTopology.
+func (db *Olric) chainPutOnCluster(hkey uint64, dm *dmap, w *writeop) error {
+	owners := db.getDMapBackupOwners(w.dmap, hkey)
+	if !db.supportsChain(owners) {
+		// Fall back to the star topology.
+		if db.config.ReplicationMode == config.AsyncReplicationMode {
+			return db.asyncPutOnCluster(hkey, dm, w)
+		}
+		return db.syncPutOnCluster(hkey, dm, w)
+	}
+
+	req := w.toReq(w.replicaOpcode)
+	req.Magic = protocol.MagicReq
+	req.Op = w.replicaOpcode
+	buf := &bytes.Buffer{}
+	if err := req.Write(buf); err != nil {
+		return err
+	}
+	chain := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		chain = append(chain, owner.String())
+	}
+
+	if db.config.ReplicationMode == config.AsyncReplicationMode {
+		db.wg.Add(1)
+		go func() {
+			defer db.wg.Done()
+			db.relayReplica(w.dmap, w.key, chain, buf.Bytes())
+		}()
+		return db.localPut(hkey, dm, w)
+	}
+
+	writeQuorum, err := db.quorum(w.dmap, w.consistency, db.config.WriteQuorum)
+	if err != nil {
+		return err
+	}
+	successful := db.relayReplica(w.dmap, w.key, chain, buf.Bytes())
+	err = db.localPut(hkey, dm, w)
+	if err != nil {
+		if db.log.V(3).Ok() {
+			db.log.V(3).Printf("[ERROR] Failed to call put command on %s for DMap: %s: %v", db.this, w.dmap, err)
+		}
+		if w.consistency == ConsistencyLocalOne {
+			return err
+		}
+	} else {
+		successful++
+	}
+	if successful >= writeQuorum {
+		return nil
+	}
+	return ErrWriteQuorum
+}
+
+// chainReplicaOperation applies a relayed replica write on this member and
+// relays it to the next backup owner.
+func (db *Olric) chainReplicaOperation(req *protocol.Message) *protocol.Message {
+	c := chainReplica{}
+	err := msgpack.Unmarshal(req.Value, &c)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	var preq protocol.Message
+	if err = preq.Read(bytes.NewBuffer(c.Message)); err != nil {
+		return db.prepareResponse(req, err)
+	}
+	if _, ok := chainReplicaOps[preq.Op]; !ok {
+		return req.Error(protocol.StatusBadRequest,
+			fmt.Sprintf("%s cannot be relayed as a replica write", preq.Op))
+	}
+	f, ok := db.operations[preq.Op]
+	if !ok {
+		return db.prepareResponse(req, ErrUnknownOperation)
+	}
+
+	var stored int
+	pres := f(&preq)
+	if pres.Status == protocol.StatusOK {
+		stored++
+	} else {
+		db.log.V(3).Printf("[ERROR] Failed to apply relayed replica write of key: %s on DMap: %s: %s",
+			preq.Key, preq.DMap, string(pres.Value))
+	}
+	// Keep relaying even if this member has failed.
+	stored += db.relayReplica(req.DMap, req.Key, c.Chain, c.Message)
+
+	value, err := msgpack.Marshal(stored)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
@@ -0,0 +1,146 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestDMap_ChainReplicationTopology(t *testing.T) {
+	var dbs []*Olric
+	for i := 0; i < 3; i++ {
+		c := testConfig(nil)
+		c.ReplicaCount = 3
+		c.WriteQuorum = 3
+		c.ReplicationTopology = config.ChainReplicationTopology
+		// The operations are counted only if the metrics are enabled.
+		c.MetricsAddr = "127.0.0.1:0"
+		db, err := newDB(c, dbs...)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	defer func() {
+		for _, db := range dbs {
+			err := db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}
+	}()
+	syncClusterMembers(dbs...)
+
+	dm, err := dbs[0].NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	count := func(op protocol.OpCode) uint64 {
+		var total uint64
+		for _, db := range dbs {
+			c, _ := db.metrics.load("mymap", op)
+			total += atomic.LoadUint64(&c.total)
+		}
+		return total
+	}
+	// The partition owner relays a write to the first backup owner, which
+	// relays it to the second one.
+	if n := count(protocol.OpChainReplica); n != 20 {
+		t.Fatalf("Expected 20 relayed replica writes. Got: %d", n)
+	}
+	if n := count(protocol.OpPutReplica); n != 0 {
+		t.Fatalf("Expected no direct replica writes. Got: %d", n)
+	}
+
+	// Every backup owner has the keys.
+	for i := 0; i < 10; i++ {
+		hkey := dbs[0].getHKey("mymap", bkey(i))
+		expected, err := dbs[0].serializer.Marshal(bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		var backups int
+		for _, db := range dbs {
+			tmp, ok := db.getBackupPartition(hkey).m.Load("mymap")
+			if !ok {
+				continue
+			}
+			dmp := tmp.(*dmap)
+			dmp.RLock()
+			vdata, err := dmp.storage.Get(hkey)
+			dmp.RUnlock()
+			if err != nil {
+				continue
+			}
+			if !bytes.Equal(vdata.Value, expected) {
+				t.Fatalf("Value is different for key: %s", bkey(i))
+			}
+			backups++
+		}
+		if backups != 2 {
+			t.Fatalf("Expected 2 backups of %s. Got: %d", bkey(i), backups)
+		}
+	}
+}
+
+func TestDMap_ChainReplicaRejectsOtherOps(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	relay := func(op protocol.OpCode) *protocol.Message {
+		preq := &protocol.Message{
+			Header: protocol.Header{Magic: protocol.MagicReq, Op: op},
+			DMap:   "mymap",
+		}
+		buf := &bytes.Buffer{}
+		if err := preq.Write(buf); err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		value, err := msgpack.Marshal(chainReplica{Message: buf.Bytes()})
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		return db.chainReplicaOperation(&protocol.Message{DMap: "mymap", Value: value})
+	}
+
+	// A relayed message cannot run an arbitrary operation, e.g. OpDestroy.
+	for _, op := range []protocol.OpCode{protocol.OpDestroy, protocol.OpDestroyDMap, protocol.OpPut} {
+		if resp := relay(op); resp.Status != protocol.StatusBadRequest {
+			t.Fatalf("Expected StatusBadRequest for %s. Got: %d", op, resp.Status)
+		}
+	}
+}
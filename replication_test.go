@@ -0,0 +1,89 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+)
+
+func TestReplication_CopyToNewBackups(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	// Simulate a new backup owner which has only seen the new writes.
+	var expected int
+	for partID := uint64(0); partID < db1.config.PartitionCount; partID++ {
+		part := db1.partitions[partID]
+		if !hostCmp(part.owner(), db1.this) {
+			continue
+		}
+		expected += part.length()
+		backup := db2.backups[partID]
+		backup.m.Range(func(name, dm interface{}) bool {
+			backup.m.Delete(name)
+			return true
+		})
+		db1.replication.schedule(partID, nil, route{Backups: db1.backups[partID].loadOwners()})
+	}
+	if expected == 0 {
+		t.Fatalf("Expected some keys on %s", db1.this)
+	}
+
+	s := db1.replicationStats()
+	if s.UnderReplicated == 0 {
+		t.Fatalf("Expected some under-replicated partitions on %s", db1.this)
+	}
+
+	db1.replicatePartitions()
+
+	s = db1.replicationStats()
+	if s.UnderReplicated != 0 {
+		t.Fatalf("Expected no under-replicated partitions. Got: %d", s.UnderReplicated)
+	}
+	if s.Copied == 0 {
+		t.Fatalf("Expected some copied partitions")
+	}
+
+	var total int
+	for partID := uint64(0); partID < db1.config.PartitionCount; partID++ {
+		if hostCmp(db1.partitions[partID].owner(), db1.this) {
+			total += db2.backups[partID].length()
+		}
+	}
+	if total != expected {
+		t.Fatalf("Expected backup key count: %d. Got: %d", expected, total)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+type memberBackoff struct {
+	// Number of consecutive failures. It's reset by a successful request.
+	failures int
+	// Total number of retries.
+	retries uint64
+}
+
+// rpcBackoff keeps the backoff state per member. The members which keep failing
+// are retried less frequently and the retries of the concurrent requests are
+// spread by jitter.
+type rpcBackoff struct {
+	mu  sync.Mutex
+	cfg config.RetryBackoff
+	m   map[string]*memberBackoff
+}
+
+func newRPCBackoff(cfg config.RetryBackoff) *rpcBackoff {
+	return &rpcBackoff{
+		cfg: cfg,
+		m:   make(map[string]*memberBackoff),
+	}
+}
+
+// jitter returns a random duration in [0, d).
+func jitter(d time.Duration) time.Duration {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return d / 2
+	}
+	return time.Duration(binary.BigEndian.Uint64(b[:]) % uint64(d))
+}
+
+// next records a retry to the member and returns the delay before it.
+func (b *rpcBackoff) next(addr string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	mb, ok := b.m[addr]
+	if !ok {
+		mb = &memberBackoff{}
+		b.m[addr] = mb
+	}
+	mb.retries++
+	delay := b.cfg.MinDelay
+	for i := 0; i < mb.failures && delay < b.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.cfg.MaxDelay {
+		delay = b.cfg.MaxDelay
+	}
+	mb.failures++
+	if delay <= 0 {
+		return 0
+	}
+	return jitter(delay)
+}
+
+// reset clears the consecutive failures of the member.
+func (b *rpcBackoff) reset(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if mb, ok := b.m[addr]; ok {
+		mb.failures = 0
+	}
+}
+
+// stats returns the total number of retries per member.
+func (b *rpcBackoff) stats() map[string]uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := make(map[string]uint64, len(b.m))
+	for addr, mb := range b.m {
+		res[addr] = mb.retries
+	}
+	return res
+}
+
+// isNetworkError returns true if the request may succeed when it's sent again.
+// The errors returned by the member itself are not retried.
+func isNetworkError(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// requestWithRetry calls requestTo and retries the network errors with
+// backoff. See config.RPCRetryBackoff. Use it only for idempotent requests.
+func (db *Olric) requestWithRetry(addr string, opcode protocol.OpCode, req *protocol.Message) (*protocol.Message, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := db.requestTo(addr, opcode, req)
+		if err == nil || !isNetworkError(err) {
+			db.rpcBackoff.reset(addr)
+			return resp, err
+		}
+		if attempt >= db.config.RPCRetryBackoff.MaxRetries {
+			return nil, err
+		}
+		select {
+		case <-time.After(db.rpcBackoff.next(addr)):
+		case <-db.ctx.Done():
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+func TestRPCBackoff(t *testing.T) {
+	addr := "127.0.0.1:3320"
+	b := newRPCBackoff(config.RetryBackoff{
+		MaxRetries: 10,
+		MinDelay:   10 * time.Millisecond,
+		MaxDelay:   40 * time.Millisecond,
+	})
+	limits := []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		40 * time.Millisecond,
+	}
+	for _, limit := range limits {
+		if delay := b.next(addr); delay >= limit {
+			t.Fatalf("Expected a delay less than %v. Got: %v", limit, delay)
+		}
+	}
+	if b.stats()[addr] != uint64(len(limits)) {
+		t.Fatalf("Expected %d retries. Got: %d", len(limits), b.stats()[addr])
+	}
+
+	// The consecutive failures are reset. The total number of retries is kept.
+	b.reset(addr)
+	if delay := b.next(addr); delay >= limits[0] {
+		t.Fatalf("Expected a delay less than %v. Got: %v", limits[0], delay)
+	}
+	if b.stats()[addr] != uint64(len(limits)+1) {
+		t.Fatalf("Expected %d retries. Got: %d", len(limits)+1, b.stats()[addr])
+	}
+}
+
+func TestRPCBackoff_RequestWithRetry(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.RPCRetryBackoff = config.RetryBackoff{
+		MaxRetries: 2,
+		MinDelay:   time.Millisecond,
+		MaxDelay:   10 * time.Millisecond,
+	}
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	// Nothing listens on this address.
+	addr, err := getRandomAddr()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = db.requestWithRetry(addr, protocol.OpPing, &protocol.Message{})
+	if !isNetworkError(err) {
+		t.Fatalf("Expected a network error. Got: %v", err)
+	}
+
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if s.RPCRetries[addr] != 2 {
+		t.Fatalf("Expected 2 retries. Got: %d", s.RPCRetries[addr])
+	}
+}
@@ -16,7 +16,6 @@ package olric
 
 import (
 	"fmt"
-	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -28,8 +27,6 @@ import (
 
 	"github.com/hashicorp/memberlist"
 	"github.com/vmihailenco/msgpack"
-	"golang.org/x/sync/errgroup"
-	"golang.org/x/sync/semaphore"
 )
 
 var routingUpdateMtx sync.Mutex
@@ -42,9 +39,9 @@ type route struct {
 
 type routingTable map[uint64]route
 
-func (db *Olric) getReplicaOwners(partID uint64) ([]consistent.Member, error) {
+func (db *Olric) getReplicaOwners(partID uint64) ([]discovery.Member, error) {
 	for i := db.config.ReplicaCount; i > 0; i-- {
-		newOwners, err := db.consistent.GetClosestNForPartition(int(partID), i)
+		newOwners, err := db.distributor.Owners(partID, i)
 		if err == consistent.ErrInsufficientMemberCount {
 			continue
 		}
@@ -74,10 +71,7 @@ func (db *Olric) distributeBackups(partID uint64) []discovery.Member {
 
 	// First run
 	if len(owners) == 0 {
-		for _, owner := range newOwners {
-			owners = append(owners, owner.(discovery.Member))
-		}
-		return owners
+		return append(owners, newOwners...)
 	}
 
 	// Prune dead nodes
@@ -137,17 +131,17 @@ func (db *Olric) distributeBackups(partID uint64) []discovery.Member {
 	for _, backup := range newOwners {
 		var exists bool
 		for i, bkp := range owners {
-			if hostCmp(bkp, backup.(discovery.Member)) {
+			if hostCmp(bkp, backup) {
 				exists = true
 				// Remove it from the current position
 				owners = append(owners[:i], owners[i+1:]...)
 				// Append it again to head
-				owners = append(owners, backup.(discovery.Member))
+				owners = append(owners, backup)
 				break
 			}
 		}
 		if !exists {
-			owners = append(owners, backup.(discovery.Member))
+			owners = append(owners, backup)
 		}
 	}
 	return owners
@@ -160,11 +154,16 @@ func (db *Olric) distributePrimaryCopies(partID uint64) []discovery.Member {
 	copy(owners, part.loadOwners())
 
 	// Find the new partition owner.
-	newOwner := db.consistent.GetPartitionOwner(int(partID))
+	res, err := db.distributor.Owners(partID, 1)
+	if err != nil {
+		db.log.V(2).Printf("[ERROR] Failed to get the owner of PartID: %d: %v", partID, err)
+		return owners
+	}
+	newOwner := res[0]
 
 	// First run.
 	if len(owners) == 0 {
-		owners = append(owners, newOwner.(discovery.Member))
+		owners = append(owners, newOwner)
 		return owners
 	}
 
@@ -218,14 +217,14 @@ func (db *Olric) distributePrimaryCopies(partID uint64) []discovery.Member {
 
 	// Here add the new partition newOwner.
 	for i, owner := range owners {
-		if hostCmp(owner, newOwner.(discovery.Member)) {
+		if hostCmp(owner, newOwner) {
 			// Remove it from the current position
 			owners = append(owners[:i], owners[i+1:]...)
 			// Append it again to head
-			return append(owners, newOwner.(discovery.Member))
+			return append(owners, newOwner)
 		}
 	}
-	return append(owners, newOwner.(discovery.Member))
+	return append(owners, newOwner)
 }
 
 func (db *Olric) distributePartitions() (routingTable, error) {
@@ -248,46 +247,44 @@ func (db *Olric) updateRoutingTableOnCluster(table routingTable) (map[discovery.
 	}
 
 	var mtx sync.Mutex
-	var g errgroup.Group
 	ownershipReports := make(map[discovery.Member]ownershipReport)
-	num := int64(runtime.NumCPU())
-	sem := semaphore.NewWeighted(num)
-	for _, member := range db.consistent.GetMembers() {
-		mem := member.(discovery.Member)
-		g.Go(func() error {
-			if err := sem.Acquire(db.ctx, 1); err != nil {
-				db.log.V(3).Printf("[ERROR] Failed to acquire semaphore to update routing table on %s: %v", mem, err)
-				return err
-			}
-			defer sem.Release(1)
-
-			msg := &protocol.Message{
-				Value: data,
-				Extra: protocol.UpdateRoutingExtra{
-					CoordinatorID: db.this.ID,
-				},
+	err = db.fanout(db.distributor.GetMembers(), func(mem discovery.Member) error {
+		if atomic.LoadInt32(&db.writesPaused) == 1 {
+			// Pause the writes on a joining member before it's bootstrapped. See PauseWrites.
+			req := &protocol.Message{
+				Value: []byte{1},
 			}
-			// TODO: This blocks whole flow. Use timeout for smooth operation.
-			resp, err := db.requestTo(mem.String(), protocol.OpUpdateRouting, msg)
-			if err != nil {
-				db.log.V(3).Printf("[ERROR] Failed to update routing table on %s: %v", mem, err)
-				return err
+			if _, err := db.requestTo(mem.String(), protocol.OpSetWritesPaused, req); err != nil {
+				db.log.V(3).Printf("[ERROR] Failed to pause writes on %s: %v", mem, err)
 			}
+		}
+		msg := &protocol.Message{
+			Value: data,
+			Extra: protocol.UpdateRoutingExtra{
+				CoordinatorID:   db.this.ID,
+				ReplicaChecksum: db.replicaChecksum(),
+			},
+		}
+		// TODO: This blocks whole flow. Use timeout for smooth operation.
+		resp, err := db.requestTo(mem.String(), protocol.OpUpdateRouting, msg)
+		if err != nil {
+			db.log.V(3).Printf("[ERROR] Failed to update routing table on %s: %v", mem, err)
+			return err
+		}
 
-			ow := ownershipReport{}
-			err = msgpack.Unmarshal(resp.Value, &ow)
-			if err != nil {
-				db.log.V(3).Printf("[ERROR] Failed to call decode ownership report from %s: %v", mem, err)
-				return err
-			}
-			mtx.Lock()
-			ownershipReports[mem] = ow
-			mtx.Unlock()
+		ow := ownershipReport{}
+		err = msgpack.Unmarshal(resp.Value, &ow)
+		if err != nil {
+			db.log.V(3).Printf("[ERROR] Failed to call decode ownership report from %s: %v", mem, err)
+			return err
+		}
+		mtx.Lock()
+		ownershipReports[mem] = ow
+		mtx.Unlock()
 
-			return nil
-		})
-	}
-	return ownershipReports, g.Wait()
+		return nil
+	})
+	return ownershipReports, err
 }
 
 func (db *Olric) updateRouting() {
@@ -314,6 +311,13 @@ func (db *Olric) updateRouting() {
 		db.log.V(2).Printf("[ERROR] Failed to distribute partitions: %v", err)
 		return
 	}
+	if !db.exceedsImbalanceThreshold(table) {
+		// Keep the partitions where they are. The new members are still
+		// bootstrapped by the current routing table.
+		db.log.V(3).Printf("[INFO] Ownership imbalance is under RebalanceImbalanceThreshold. " +
+			"Partitions are not moved")
+		table = db.currentRoutingTable()
+	}
 	reports, err := db.updateRoutingTableOnCluster(table)
 	if err != nil {
 		db.log.V(2).Printf("[ERROR] Failed to update routing table on cluster: %v", err)
@@ -321,6 +325,64 @@ func (db *Olric) updateRouting() {
 	db.processOwnershipReports(reports)
 }
 
+// currentRoutingTable returns the routing table in use.
+func (db *Olric) currentRoutingTable() routingTable {
+	table := make(routingTable)
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		table[partID] = route{
+			Owners:  db.partitions[partID].loadOwners(),
+			Backups: db.backups[partID].loadOwners(),
+		}
+	}
+	return table
+}
+
+// isMemberAlive returns true if the member is still in the cluster and
+// it has not been restarted.
+func (db *Olric) isMemberAlive(member discovery.Member) bool {
+	current, err := db.discovery.FindMemberByName(member.Name)
+	if err != nil {
+		return false
+	}
+	return hostCmp(member, current)
+}
+
+// exceedsImbalanceThreshold returns true if the new routing table has to be
+// applied. See config.RebalanceImbalanceThreshold.
+func (db *Olric) exceedsImbalanceThreshold(table routingTable) bool {
+	if db.config.RebalanceImbalanceThreshold == 0 {
+		return true
+	}
+
+	var moved int
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		part := db.partitions[partID]
+		if part.ownerCount() == 0 {
+			// First run
+			return true
+		}
+		owner := part.owner()
+		if !db.isMemberAlive(owner) {
+			return true
+		}
+		backups := db.backups[partID].loadOwners()
+		for _, backup := range backups {
+			if !db.isMemberAlive(backup) {
+				return true
+			}
+		}
+		if len(backups) < db.config.ReplicaCount-1 && len(table[partID].Backups) > len(backups) {
+			// Restore the missing replicas.
+			return true
+		}
+		owners := table[partID].Owners
+		if len(owners) == 0 || !hostCmp(owners[len(owners)-1], owner) {
+			moved++
+		}
+	}
+	return float64(moved)/float64(db.config.PartitionCount) > db.config.RebalanceImbalanceThreshold
+}
+
 func (db *Olric) processOwnershipReports(reports map[discovery.Member]ownershipReport) {
 	check := func(member discovery.Member, owners []discovery.Member) bool {
 		for _, owner := range owners {
@@ -364,12 +426,14 @@ func (db *Olric) processOwnershipReports(reports map[discovery.Member]ownershipR
 func (db *Olric) processNodeEvent(event *discovery.ClusterEvent) {
 	if event.Event == memberlist.NodeJoin {
 		member, _ := db.discovery.DecodeNodeMeta(event.NodeMeta)
-		db.consistent.Add(member)
+		db.distributor.Add(member)
+		db.rebalanceEvents.setTrigger(TriggerMemberJoined, member.String())
 		db.log.V(1).Printf("[INFO] Node joined: %s", member)
 	} else if event.Event == memberlist.NodeLeave {
-		db.consistent.Remove(event.NodeName)
+		db.distributor.Remove(event.NodeName)
 		// Don't try to used closed sockets again.
 		db.client.ClosePool(event.NodeName)
+		db.rebalanceEvents.setTrigger(TriggerMemberLeft, event.NodeName)
 		db.log.V(1).Printf("[INFO] Node leaved: %s", event.NodeName)
 	} else {
 		db.log.V(1).Printf("[ERROR] Unknown event received: %v", event)
@@ -383,12 +447,24 @@ func (db *Olric) processNodeEvent(event *discovery.ClusterEvent) {
 
 func (db *Olric) listenMemberlistEvents(eventCh chan *discovery.ClusterEvent) {
 	defer db.wg.Done()
+	// It's nil unless an update is delayed. Receiving from a nil channel blocks forever.
+	var delayed <-chan time.Time
 	for {
 		select {
 		case <-db.ctx.Done():
 			return
 		case e := <-eventCh:
 			db.processNodeEvent(e)
+			if db.config.RebalanceDelay == 0 {
+				db.updateRouting()
+				continue
+			}
+			// Wait for the membership to stabilize. Every event restarts the delay.
+			delayed = time.After(db.config.RebalanceDelay)
+			atomic.StoreInt32(&db.rebalancePending, 1)
+		case <-delayed:
+			delayed = nil
+			atomic.StoreInt32(&db.rebalancePending, 0)
 			db.updateRouting()
 		}
 	}
@@ -445,12 +521,22 @@ func (db *Olric) updateRoutingOperation(req *protocol.Message) *protocol.Message
 		return req.Error(protocol.StatusInternalServerError, err)
 	}
 
-	coordinatorId := req.Extra.(protocol.UpdateRoutingExtra).CoordinatorID
-	coordinator, err := db.checkAndGetCoordinator(coordinatorId)
+	extra := req.Extra.(protocol.UpdateRoutingExtra)
+	coordinator, err := db.checkAndGetCoordinator(extra.CoordinatorID)
 	if err != nil {
 		db.log.V(2).Printf("[ERROR] Routing table cannot be updated: %v", err)
 		return req.Error(protocol.StatusInternalServerError, err)
 	}
+	// An older coordinator doesn't send ReplicaChecksum. It doesn't support the
+	// replica count overrides, zero is its checksum.
+	if extra.ReplicaChecksum != db.replicaChecksum() {
+		if atomic.LoadInt32(&db.bootstrapped) == 0 {
+			// Don't join a cluster which keeps the DMaps with different replica counts.
+			db.log.V(2).Printf("[ERROR] Routing table cannot be updated: %v", errReplicaCountMismatch)
+			return req.Error(protocol.StatusInternalServerError, errReplicaCountMismatch)
+		}
+		db.log.V(2).Printf("[WARN] %v: %s", errReplicaCountMismatch, coordinator)
+	}
 
 	// owners(atomic.Value) is guarded by routingUpdateMtx against parallel writers.
 	// Calculate routing signature. This is useful to control rebalancing tasks.
@@ -462,11 +548,23 @@ func (db *Olric) updateRoutingOperation(req *protocol.Message) *protocol.Message
 
 		// Set backup owners
 		bpart := db.backups[partID]
+		if db.config.ReplicaCount > config.MinimumReplicaCount &&
+			len(data.Owners) != 0 && hostCmp(data.Owners[len(data.Owners)-1], db.this) {
+			// Find the new backup owners of my partitions.
+			db.replication.schedule(partID, bpart.loadOwners(), data)
+		}
 		bpart.owners.Store(data.Backups)
 	}
 
 	db.setOwnedPartitionCount()
 
+	if atomic.LoadInt32(&db.bootstrapped) == 0 && !hostCmp(coordinator, db.this) {
+		// Fetch the renamed DMaps before serving any request.
+		if err := db.fetchAliases(coordinator); err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to fetch DMap aliases from the coordinator: %v", err)
+		}
+	}
+
 	// Bootstrapped by the coordinator.
 	atomic.StoreInt32(&db.bootstrapped, 1)
 	// Collect report
@@ -483,6 +581,17 @@ func (db *Olric) updateRoutingOperation(req *protocol.Message) *protocol.Message
 		defer db.wg.Done()
 		db.rebalancer()
 
+		// Populate the backups after a cold restart.
+		if db.config.ReplicaCount > config.MinimumReplicaCount &&
+			atomic.CompareAndSwapInt32(&db.backupsWarmedUp, 0, 1) {
+			db.warmUpBackups()
+		}
+
+		// Restore the replica count of my partitions.
+		if db.config.ReplicaCount > config.MinimumReplicaCount {
+			db.replicatePartitions()
+		}
+
 		// Clean stale dmaps
 		db.deleteStaleDMaps()
 	}()
@@ -531,3 +640,27 @@ func (db *Olric) keyCountOnPartOperation(req *protocol.Message) *protocol.Messag
 	res.Value = value
 	return res
 }
+
+func (db *Olric) getRoutingTableOperation(req *protocol.Message) *protocol.Message {
+	if err := db.checkOperationStatus(); err != nil {
+		return db.prepareResponse(req, err)
+	}
+	table := protocol.RoutingTable{
+		PartitionCount: db.config.PartitionCount,
+		Signature:      atomic.LoadUint64(&routingSignature),
+		Owners:         make([]string, db.config.PartitionCount),
+	}
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		owners := db.partitions[partID].loadOwners()
+		if len(owners) > 0 {
+			table.Owners[partID] = owners[len(owners)-1].String()
+		}
+	}
+	value, err := msgpack.Marshal(table)
+	if err != nil {
+		return db.prepareResponse(req, err)
+	}
+	resp := req.Success()
+	resp.Value = value
+	return resp
+}
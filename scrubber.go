@@ -0,0 +1,116 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/buraksezer/olric/stats"
+)
+
+// scrubStats keeps the progress of the scrubber. It's accessed atomically.
+type scrubStats struct {
+	passes   uint64
+	partID   uint64
+	scanned  uint64
+	repaired uint64
+}
+
+func (s *scrubStats) stats() stats.Scrubber {
+	return stats.Scrubber{
+		Passes:   atomic.LoadUint64(&s.passes),
+		PartID:   atomic.LoadUint64(&s.partID),
+		Scanned:  atomic.LoadUint64(&s.scanned),
+		Repaired: atomic.LoadUint64(&s.repaired),
+	}
+}
+
+// scrubKey compares the versions of a key on the owners and the replicas and
+// repairs the stale ones. It returns true if a repair is done.
+func (db *Olric) scrubKey(name string, hkey uint64, key string) bool {
+	repaired, err := db.callRepairOnCluster(hkey, name, key)
+	if err != nil {
+		// Deleted or expired in the meantime.
+		return false
+	}
+	return repaired > 0
+}
+
+// scrubPartition scrubs the DMaps on a primary partition owned by this node.
+func (db *Olric) scrubPartition(part *partition, limiter *rateLimiter) {
+	type item struct {
+		hkey uint64
+		key  string
+	}
+
+	part.m.Range(func(name, tmp interface{}) bool {
+		dm := tmp.(*dmap)
+		// Take a snapshot of the keys. Don't hold the lock while scrubbing.
+		var items []item
+		dm.RLock()
+		dm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+			items = append(items, item{hkey: hkey, key: vdata.Key})
+			return true
+		})
+		dm.RUnlock()
+
+		for _, i := range items {
+			if !db.isAlive() || !hostCmp(part.owner(), db.this) {
+				// The server is gone or the partition has been moved.
+				return false
+			}
+			limiter.wait(db.ctx, 1)
+			if db.scrubKey(name.(string), i.hkey, i.key) {
+				atomic.AddUint64(&db.scrub.repaired, 1)
+			}
+			atomic.AddUint64(&db.scrub.scanned, 1)
+		}
+		return true
+	})
+}
+
+// scrubber walks the primary partitions owned by this node periodically and
+// repairs the stale replicas, proactively. The number of scanned keys per
+// second is limited by ScrubRate.
+func (db *Olric) scrubber() {
+	defer db.wg.Done()
+
+	limiter := newRateLimiter(db.config.ScrubRate)
+	for {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			if !db.isAlive() {
+				return
+			}
+			if err := db.checkOperationStatus(); err != nil {
+				break
+			}
+			part := db.partitions[partID]
+			if !hostCmp(part.owner(), db.this) {
+				continue
+			}
+			atomic.StoreUint64(&db.scrub.partID, partID)
+			db.scrubPartition(part, limiter)
+		}
+		atomic.AddUint64(&db.scrub.passes, 1)
+
+		select {
+		case <-db.ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+)
+
+func TestScrubber(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	dbs := []*Olric{db1, db2}
+	backupLength := func() int {
+		var total int
+		for _, db := range dbs {
+			for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+				total += db.backups[partID].length()
+			}
+		}
+		return total
+	}
+
+	// Lose the backups silently.
+	for _, db := range dbs {
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			part := db.backups[partID]
+			part.m.Range(func(name, dm interface{}) bool {
+				part.m.Delete(name)
+				return true
+			})
+		}
+	}
+
+	var repaired uint64
+	for _, db := range dbs {
+		limiter := newRateLimiter(0)
+		for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+			part := db.partitions[partID]
+			if hostCmp(part.owner(), db.this) {
+				db.scrubPartition(part, limiter)
+			}
+		}
+		repaired += db.scrub.stats().Repaired
+	}
+	if repaired != 100 {
+		t.Fatalf("Expected repaired key count: 100. Got: %d", repaired)
+	}
+	if backupLength() != 100 {
+		t.Fatalf("Expected backup key count: 100. Got: %d", backupLength())
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/vmihailenco/msgpack"
+)
+
+// maxPooledBufferSize is the capacity beyond which an encoding buffer is not
+// recycled. A single large value shouldn't be retained by the pool.
+const maxPooledBufferSize = 1 << 16
+
+// vdataEncoder is a msgpack encoder which writes into its own buffer. They are
+// recycled together.
+type vdataEncoder struct {
+	buf *bytes.Buffer
+	enc *msgpack.Encoder
+}
+
+var vdataEncoders = sync.Pool{
+	New: func() interface{} {
+		buf := new(bytes.Buffer)
+		return &vdataEncoder{
+			buf: buf,
+			enc: msgpack.NewEncoder(buf),
+		}
+	},
+}
+
+// marshalVData works like msgpack.Marshal but recycles the encoder and its
+// buffer. The returned slice is a copy, it doesn't refer to the pooled buffer.
+func marshalVData(vdata *storage.VData) ([]byte, error) {
+	e := vdataEncoders.Get().(*vdataEncoder)
+	defer func() {
+		if e.buf.Cap() > maxPooledBufferSize {
+			return
+		}
+		e.buf.Reset()
+		vdataEncoders.Put(e)
+	}()
+
+	if err := e.enc.Encode(vdata); err != nil {
+		return nil, err
+	}
+	value := make([]byte, e.buf.Len())
+	copy(value, e.buf.Bytes())
+	return value, nil
+}
+
+// unmarshal decodes a stored value with the serializer. It falls back to the
+// MigrationSerializer if the serializer cannot decode it.
+func (db *Olric) unmarshal(data []byte, v interface{}) error {
+	err := db.serializer.Unmarshal(data, v)
+	if err == nil || db.config.MigrationSerializer == nil {
+		return err
+	}
+	if merr := db.config.MigrationSerializer.Unmarshal(data, v); merr != nil {
+		return err
+	}
+	atomic.AddUint64(&db.serializerFallbacks, 1)
+	return nil
+}
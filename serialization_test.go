@@ -0,0 +1,166 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/buraksezer/olric/serializer"
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestMarshalVData(t *testing.T) {
+	large := &storage.VData{
+		Key:       "large",
+		Value:     bytes.Repeat([]byte("olric"), 1000),
+		Timestamp: time.Now().UnixNano(),
+	}
+	small := &storage.VData{
+		Key:       "small",
+		Value:     []byte("olric"),
+		TTL:       time.Now().UnixNano(),
+		Timestamp: time.Now().UnixNano(),
+	}
+
+	first, err := marshalVData(large)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	expected, err := msgpack.Marshal(*large)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(first, expected) {
+		t.Fatalf("Expected the same encoding with msgpack.Marshal")
+	}
+
+	// The next call reuses the buffer. It must neither see the previous
+	// contents nor change the returned slice.
+	second, err := marshalVData(small)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(first, expected) {
+		t.Fatalf("Expected the returned slice not to be modified")
+	}
+	var vdata storage.VData
+	err = msgpack.Unmarshal(second, &vdata)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !reflect.DeepEqual(vdata, *small) {
+		t.Fatalf("Expected %v. Got: %v", *small, vdata)
+	}
+}
+
+func BenchmarkMarshalVData(b *testing.B) {
+	vdata := &storage.VData{
+		Key:       bkey(1),
+		Value:     bytes.Repeat([]byte("olric"), 20),
+		Timestamp: time.Now().UnixNano(),
+	}
+	b.Run("msgpack.Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := msgpack.Marshal(*vdata); err != nil {
+				b.Fatalf("Expected nil. Got: %v", err)
+			}
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := marshalVData(vdata); err != nil {
+				b.Fatalf("Expected nil. Got: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkGobSerializer(b *testing.B) {
+	s := serializer.NewGobSerializer()
+	value := bytes.Repeat([]byte("olric"), 20)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Marshal(value); err != nil {
+			b.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+}
+
+func TestMigrationSerializer(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.Serializer = serializer.NewMsgpackSerializer()
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Put(bkey(i), bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	// Migrate from msgpack to gob.
+	db.serializer = serializer.NewGobSerializer()
+	_, err = dm.Get(bkey(0))
+	if err == nil {
+		t.Fatalf("Expected an error without a MigrationSerializer")
+	}
+	db.config.MigrationSerializer = serializer.NewMsgpackSerializer()
+	for i := 0; i < 10; i++ {
+		value, err := dm.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if value.(string) != bkey(i) {
+			t.Fatalf("Expected %s. Got: %v", bkey(i), value)
+		}
+	}
+
+	// The rewritten values are decoded by the new serializer.
+	err = dm.Put(bkey(0), bkey(0))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = dm.Get(bkey(0))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if s.SerializerFallbacks != 10 {
+		t.Fatalf("Expected 10 fallbacks. Got: %d", s.SerializerFallbacks)
+	}
+}
@@ -20,9 +20,14 @@ import (
 	"encoding/json"
 	"reflect"
 
+	"github.com/buraksezer/olric/internal/bufpool"
 	"github.com/vmihailenco/msgpack"
 )
 
+// pool recycles the buffers of the gob encoder. The encoded value is copied out
+// before a buffer is put back.
+var pool = bufpool.New()
+
 // Serializer interface responsible for encoding/decoding values to transmit over network between Olric nodes.
 type Serializer interface {
 	// Marshal encodes v and returns a byte slice and possible error.
@@ -32,6 +37,33 @@ type Serializer interface {
 	Unmarshal(data []byte, v interface{}) error
 }
 
+// Codec identifiers of the built-in serializers. The identifiers up to 15 are
+// reserved for the built-in serializers.
+const (
+	// UnknownCodec is returned for a serializer which doesn't report its codec.
+	UnknownCodec uint8 = iota
+	GobCodec
+	JSONCodec
+	MsgpackCodec
+)
+
+// Codec returns the codec identifier of s. A custom serializer may implement
+// a Codec() uint8 method to report its own identifier, it's UnknownCodec
+// otherwise. The unknown codecs are never reported as a mismatch.
+func Codec(s Serializer) uint8 {
+	switch v := s.(type) {
+	case gobSerializer:
+		return GobCodec
+	case jsonSerializer:
+		return JSONCodec
+	case msgpackSerializer:
+		return MsgpackCodec
+	case interface{ Codec() uint8 }:
+		return v.Codec()
+	}
+	return UnknownCodec
+}
+
 // Default serializer implementation which uses encoding/gob.
 type gobSerializer struct{}
 
@@ -46,11 +78,14 @@ func (g gobSerializer) Marshal(value interface{}) ([]byte, error) {
 		v := reflect.New(t).Elem().Interface()
 		gob.Register(v)
 	}
-	// TODO: As an optimization, you may want to a bytes.Buffer pool to reduce
-	// memory consumption.
-	var res bytes.Buffer
-	err := gob.NewEncoder(&res).Encode(&value)
-	return res.Bytes(), err
+	buf := pool.Get()
+	defer pool.Put(buf)
+	if err := gob.NewEncoder(buf).Encode(&value); err != nil {
+		return nil, err
+	}
+	res := make([]byte, buf.Len())
+	copy(res, buf.Bytes())
+	return res, nil
 }
 
 func (g gobSerializer) Unmarshal(data []byte, v interface{}) error {
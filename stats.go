@@ -17,6 +17,7 @@ package olric
 import (
 	"os"
 	"runtime"
+	"sync/atomic"
 
 	"github.com/buraksezer/olric/internal/protocol"
 	"github.com/buraksezer/olric/stats"
@@ -39,14 +40,39 @@ func (db *Olric) stats() stats.Stats {
 		},
 		Partitions: make(map[uint64]stats.Partition),
 		Backups:    make(map[uint64]stats.Partition),
+		ConnPools:  make(map[string]stats.ConnPool),
+	}
+
+	for addr, ps := range db.client.Stats() {
+		s.ConnPools[addr] = stats.ConnPool(ps)
+	}
+	s.CircuitBreakers = db.breakers.stats()
+	s.Scrubber = db.scrub.stats()
+	s.InFlightOps = db.inflightOps()
+	s.RPCRetries = db.rpcBackoff.stats()
+	s.LazyBackups = db.lazyBackups.stats()
+	s.Memory = db.memory.stats()
+	s.ClockSkew = db.clockSkew.stats()
+	s.Reaper = db.reaper.stats()
+	s.ReadProfile = db.readProfile.stats()
+	s.ReadVersions = db.readVersions.stats()
+	s.ReadCoalescing = db.readCoalescer.stats()
+	s.ValueSizes = db.valueSizes.stats()
+	s.Replication = db.replicationStats()
+	s.WritesPaused = atomic.LoadInt32(&db.writesPaused) == 1
+	s.SerializerFallbacks = atomic.LoadUint64(&db.serializerFallbacks)
+	s.Rebalancer = stats.Rebalancer{
+		LastRun: atomic.LoadInt64(&db.lastRebalance),
+		Pending: atomic.LoadInt32(&db.rebalancePending) == 1,
 	}
 
 	collect := func(partID uint64, part *partition) stats.Partition {
 		owners := part.loadOwners()
 		p := stats.Partition{
-			Backups: db.backups[partID].loadOwners(),
-			Length:  part.length(),
-			DMaps:   make(map[string]stats.DMap),
+			Backups:  db.backups[partID].loadOwners(),
+			Length:   part.length(),
+			DMaps:    make(map[string]stats.DMap),
+			Rejected: atomic.LoadUint64(&part.rejected),
 		}
 		if !part.backup {
 			p.Owner = part.owner()
@@ -17,6 +17,7 @@ package stats
 
 import (
 	"runtime"
+	"time"
 
 	"github.com/buraksezer/olric/internal/discovery"
 )
@@ -49,6 +50,10 @@ type Partition struct {
 	Backups        []discovery.Member
 	Length         int
 	DMaps          map[string]DMap
+
+	// Number of the writes rejected because a DMap on the partition reached
+	// MaxKeysPerPartition.
+	Rejected uint64
 }
 
 // Runtime exposes memory stats and various metrics from Go runtime.
@@ -61,11 +66,253 @@ type Runtime struct {
 	MemStats     runtime.MemStats
 }
 
+// ConnPool denotes utilization of the connection pool of a member.
+type ConnPool struct {
+	// Number of idle connections in the pool.
+	Idle int
+
+	// Number of connections which are currently used by a request.
+	InUse int
+
+	// Protocol version negotiated with the member. Zero means that the member
+	// runs a version which doesn't support protocol negotiation.
+	ProtocolVersion uint8
+
+	// Compressed is true if the connection streams to the member are compressed.
+	// See config.WireCompression.
+	Compressed bool
+
+	// Multiplexed is true if the requests to the member are multiplexed over
+	// a single connection. See config.Multiplexing.
+	Multiplexed bool
+
+	// MultiplexedRequests is the number of requests in flight on the
+	// multiplexed connection.
+	MultiplexedRequests int
+}
+
+// CircuitBreaker denotes the state of the circuit breaker of a member on
+// the read path.
+type CircuitBreaker struct {
+	// State is one of closed, open or half-open.
+	State string
+
+	// Number of consecutive failures.
+	Failures int
+}
+
+// Scrubber denotes the progress of the background scrubber on a member.
+type Scrubber struct {
+	// Number of completed passes over the partitions.
+	Passes uint64
+
+	// The partition which is scrubbed currently or lastly.
+	PartID uint64
+
+	// Number of scanned keys.
+	Scanned uint64
+
+	// Number of keys with a repaired replica.
+	Repaired uint64
+}
+
+// Rebalancer denotes the state of the rebalancer on a member.
+type Rebalancer struct {
+	// The last time the rebalancer ran, in nanoseconds since the Unix epoch.
+	// Zero means that it has not run yet.
+	LastRun int64
+
+	// Pending is true if the cluster coordinator waits for RebalanceDelay
+	// to update the routing table.
+	Pending bool
+}
+
+// Memory denotes the memory usage of a member and the state of the global
+// eviction. See config.GlobalMaxMemory.
+type Memory struct {
+	// Number of bytes in use by the keys and the values, including the backups.
+	// It's only updated if GlobalMaxMemory is set.
+	Usage int64
+
+	// Number of the global eviction runs.
+	Runs uint64
+
+	// Number of the keys deleted by the global eviction.
+	Evicted uint64
+}
+
+// Reaper denotes the activity of the expiry reaper on a member. See
+// config.ReaperInterval and config.ReaperBatchSize.
+type Reaper struct {
+	// Number of the runs.
+	Runs uint64
+
+	// Number of the scanned entries.
+	Scanned uint64
+
+	// Number of the expired and idle entries deleted.
+	Reaped uint64
+
+	// Mean time between the expiry of the reaped entries and their deletion.
+	// The idle entries are not taken into account.
+	Lag time.Duration
+
+	// The longest time between the expiry of a reaped entry and its deletion.
+	MaxLag time.Duration
+}
+
+// ClockSkew denotes the timestamps which are too far ahead of the local clock.
+// See config.MaxClockSkew.
+type ClockSkew struct {
+	// Number of the writes rejected with ErrClockSkew.
+	Rejected uint64
+
+	// Number of the writes whose timestamps are replaced with the local time.
+	Clamped uint64
+
+	// Number of the versions seen on the reads beyond MaxClockSkew.
+	Warnings uint64
+
+	// The largest skew observed.
+	Max time.Duration
+}
+
+// ReadProfile denotes the mean time spent in the stages of the sampled reads
+// on the partition owners. See config.ReadProfileSampleRate.
+type ReadProfile struct {
+	// Number of the sampled reads.
+	Samples uint64
+
+	LookupOnOwners   time.Duration
+	LookupOnReplicas time.Duration
+	Sort             time.Duration
+	ReadRepair       time.Duration
+}
+
+// ReadVersions denotes the distribution of the number of versions collected
+// per read on the partition owners. See config.MaxReadVersions.
+type ReadVersions struct {
+	// Number of the reads per version count. The reads with more versions are
+	// counted in the last bucket.
+	Distribution map[int]uint64
+
+	// The largest number of versions collected for a read.
+	Max int
+
+	// Number of the reads which stopped collecting versions at MaxReadVersions.
+	Truncated uint64
+}
+
+// ValueSizes denotes the distribution of the sizes of the values written to
+// a DMap through a member. See config.TrackValueSizes.
+type ValueSizes struct {
+	// Number of the values per bucket. A bucket is keyed by its exclusive
+	// upper bound in bytes and its lower bound is the half of it, e.g.
+	// 1024 counts the values in [512, 1024) bytes.
+	Buckets map[uint64]uint64
+
+	// Number of the values.
+	Count uint64
+
+	// Total size of the values in bytes.
+	TotalBytes uint64
+
+	// Mean size of the values in bytes.
+	Average uint64
+
+	// Upper bound of the bucket which holds the median size.
+	Median uint64
+}
+
+// ReadCoalescing denotes the reads redirected to the partition owners by
+// a member. See config.RedirectedReadCacheTTL.
+type ReadCoalescing struct {
+	// Number of the redirected reads.
+	Reads uint64
+
+	// Number of the requests sent to the partition owners.
+	Requests uint64
+
+	// Number of the reads which shared the response of a concurrent request.
+	Coalesced uint64
+
+	// Number of the reads served from the cached responses.
+	CacheHits uint64
+}
+
+// Replication denotes the replica count of the primary partitions owned by
+// a member. The partitions are copied to the new backup owners after a
+// member loss.
+type Replication struct {
+	// Number of the primary partitions with fewer live backups than
+	// ReplicaCount-1, including the ones which are being copied.
+	UnderReplicated int
+
+	// Number of the partitions copied to a new backup owner.
+	Copied uint64
+}
+
+// LazyBackup denotes the replica writes buffered for a backup owner in
+// LazyBackupMode.
+type LazyBackup struct {
+	// Number of the buffered replica writes.
+	Pending int
+
+	// Replication lag, the age of the oldest buffered replica write.
+	Lag time.Duration
+
+	// Number of the replica writes which couldn't be applied on the backup owner.
+	Failed uint64
+}
+
 // Stats includes some metadata information about the cluster. The nodes add everything it knows about the cluster.
 type Stats struct {
-	Cmdline        []string
-	ReleaseVersion string
-	Runtime        Runtime
-	Partitions     map[uint64]Partition
-	Backups        map[uint64]Partition
+	Cmdline         []string
+	ReleaseVersion  string
+	Runtime         Runtime
+	Partitions      map[uint64]Partition
+	Backups         map[uint64]Partition
+	ConnPools       map[string]ConnPool
+	CircuitBreakers map[string]CircuitBreaker
+	Scrubber        Scrubber
+	Rebalancer      Rebalancer
+
+	// Number of in-flight operations on the DMaps with a MaxConcurrentOps.
+	InFlightOps map[string]int
+
+	// Number of retried requests per member. See config.RPCRetryBackoff.
+	RPCRetries map[string]uint64
+
+	// Replica writes buffered per backup owner in LazyBackupMode.
+	LazyBackups map[string]LazyBackup
+
+	// Memory usage and the global eviction activity.
+	Memory Memory
+
+	// Timestamps beyond MaxClockSkew.
+	ClockSkew ClockSkew
+
+	// Activity of the expiry reaper.
+	Reaper Reaper
+
+	// Timing breakdown of the sampled reads.
+	ReadProfile ReadProfile
+
+	// Number of the versions collected per read.
+	ReadVersions ReadVersions
+
+	// Coalesced reads redirected to the partition owners.
+	ReadCoalescing ReadCoalescing
+
+	// Distribution of the written value sizes per DMap.
+	ValueSizes map[string]ValueSizes
+
+	// Under-replicated partitions on this member.
+	Replication Replication
+
+	// True if the writes are paused on the cluster. See Olric.PauseWrites.
+	WritesPaused bool
+
+	// Number of the values decoded by the MigrationSerializer.
+	SerializerFallbacks uint64
 }
@@ -17,6 +17,8 @@ package olric
 import (
 	"context"
 	"testing"
+
+	"github.com/buraksezer/olric/internal/protocol"
 )
 
 func TestStatsStandalone(t *testing.T) {
@@ -125,3 +127,57 @@ func TestStatsCluster(t *testing.T) {
 			"owners in stats is 100. Got: %d", backupTotal)
 	}
 }
+
+func TestStatsConnPools(t *testing.T) {
+	db1, err := newDB(nil)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db1.Shutdown(context.Background())
+		if err != nil {
+			db1.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	db2, err := newDB(nil, db1)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db2.Shutdown(context.Background())
+		if err != nil {
+			db2.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	syncClusterMembers(db1, db2)
+
+	dm, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	s, err := db1.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	cp, ok := s.ConnPools[db2.this.String()]
+	if !ok {
+		t.Fatalf("Expected a connection pool for %s", db2.this)
+	}
+	if cp.Idle <= 0 {
+		t.Fatalf("Expected at least one idle connection. Got: %d", cp.Idle)
+	}
+	if cp.InUse != 0 {
+		t.Fatalf("Expected zero in-use connections. Got: %d", cp.InUse)
+	}
+	if cp.ProtocolVersion != protocol.Version {
+		t.Fatalf("Expected protocol version: %d. Got: %d", protocol.Version, cp.ProtocolVersion)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+
+	"github.com/buraksezer/olric/stats"
+)
+
+// valueSizeBuckets is the number of the power of two buckets in a value size
+// histogram. The values larger than 2GB are counted in the last one.
+const valueSizeBuckets = 32
+
+// valueSizeHistogram counts the values written to a DMap by their sizes. The
+// bucket i counts the values in [2^(i-1), 2^i) bytes, the first one counts
+// the empty values.
+type valueSizeHistogram struct {
+	buckets    [valueSizeBuckets + 1]uint64
+	totalBytes uint64
+}
+
+func (h *valueSizeHistogram) observe(size int) {
+	bucket := bits.Len(uint(size))
+	if bucket > valueSizeBuckets {
+		bucket = valueSizeBuckets
+	}
+	atomic.AddUint64(&h.buckets[bucket], 1)
+	atomic.AddUint64(&h.totalBytes, uint64(size))
+}
+
+func (h *valueSizeHistogram) reset() {
+	for i := range h.buckets {
+		atomic.StoreUint64(&h.buckets[i], 0)
+	}
+	atomic.StoreUint64(&h.totalBytes, 0)
+}
+
+func (h *valueSizeHistogram) stats() stats.ValueSizes {
+	s := stats.ValueSizes{
+		Buckets:    make(map[uint64]uint64),
+		TotalBytes: atomic.LoadUint64(&h.totalBytes),
+	}
+	var counts [valueSizeBuckets + 1]uint64
+	for i := range h.buckets {
+		counts[i] = atomic.LoadUint64(&h.buckets[i])
+		if counts[i] != 0 {
+			s.Buckets[1<<uint(i)] = counts[i]
+		}
+		s.Count += counts[i]
+	}
+	if s.Count == 0 {
+		return s
+	}
+	s.Average = s.TotalBytes / s.Count
+	var seen uint64
+	for i, n := range counts {
+		seen += n
+		if seen*2 >= s.Count {
+			s.Median = 1 << uint(i)
+			break
+		}
+	}
+	return s
+}
+
+// valueSizes keeps a histogram of the value sizes per DMap. See
+// config.TrackValueSizes.
+type valueSizes struct {
+	m sync.Map
+}
+
+// observe records the size of a value written to the DMap.
+func (v *valueSizes) observe(name string, size int) {
+	h, ok := v.m.Load(name)
+	if !ok {
+		h, _ = v.m.LoadOrStore(name, &valueSizeHistogram{})
+	}
+	h.(*valueSizeHistogram).observe(size)
+}
+
+func (v *valueSizes) reset() {
+	v.m.Range(func(_, h interface{}) bool {
+		h.(*valueSizeHistogram).reset()
+		return true
+	})
+}
+
+func (v *valueSizes) stats() map[string]stats.ValueSizes {
+	s := make(map[string]stats.ValueSizes)
+	v.m.Range(func(name, h interface{}) bool {
+		s[name.(string)] = h.(*valueSizeHistogram).stats()
+		return true
+	})
+	return s
+}
+
+// recordValueSize adds the size of a written value to the histogram of the
+// DMap, if config.TrackValueSizes is set.
+func (db *Olric) recordValueSize(name string, value []byte) {
+	if !db.config.TrackValueSizes {
+		return
+	}
+	db.valueSizes.observe(name, len(value))
+}
+
+// ResetValueSizes clears the value size histograms of this member to start
+// a new window. See config.TrackValueSizes.
+func (db *Olric) ResetValueSizes() {
+	db.valueSizes.reset()
+}
@@ -0,0 +1,114 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDMap_TrackValueSizes(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.TrackValueSizes = true
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		err = dm.Put(bkey(i), make([]byte, 100))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm.Put(bkey(3), make([]byte, 5000))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	sizes, ok := s.ValueSizes["mymap"]
+	if !ok {
+		t.Fatalf("Expected value sizes of mymap")
+	}
+	if sizes.Count != 4 {
+		t.Fatalf("Expected Count: 4. Got: %d", sizes.Count)
+	}
+	// The values are encoded by the serializer, so they are slightly larger.
+	if sizes.Buckets[128] != 3 || sizes.Buckets[8192] != 1 {
+		t.Fatalf("Unexpected buckets: %v", sizes.Buckets)
+	}
+	if sizes.TotalBytes < 5300 {
+		t.Fatalf("Expected TotalBytes at least 5300. Got: %d", sizes.TotalBytes)
+	}
+	if sizes.Average != sizes.TotalBytes/4 {
+		t.Fatalf("Expected Average: %d. Got: %d", sizes.TotalBytes/4, sizes.Average)
+	}
+	if sizes.Median != 128 {
+		t.Fatalf("Expected Median: 128. Got: %d", sizes.Median)
+	}
+
+	db.ResetValueSizes()
+	s, err = db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	sizes = s.ValueSizes["mymap"]
+	if sizes.Count != 0 || sizes.TotalBytes != 0 || len(sizes.Buckets) != 0 {
+		t.Fatalf("Expected an empty histogram after reset. Got: %v", sizes)
+	}
+}
+
+func TestDMap_TrackValueSizesDisabled(t *testing.T) {
+	db, err := newDB(testSingleReplicaConfig())
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put(bkey(1), bval(1))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	s, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(s.ValueSizes) != 0 {
+		t.Fatalf("Expected no value sizes. Got: %v", s.ValueSizes)
+	}
+}
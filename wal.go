@@ -0,0 +1,367 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/buraksezer/olric/config"
+	"github.com/buraksezer/olric/internal/storage"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack"
+)
+
+// Operations in the write-ahead log.
+const (
+	walPut uint8 = iota + 1
+	walDelete
+	walExpire
+	walDrop
+)
+
+// walRecord is an entry of the write-ahead log. Every record is prefixed with
+// its length as a big endian uint32.
+type walRecord struct {
+	Op        uint8
+	DMap      string
+	Key       string
+	Value     []byte
+	Timestamp int64
+	TTL       int64
+	Deadline  int64
+}
+
+// partitionLog is the write-ahead log of a partition. Its methods do nothing
+// if it's nil, the write-ahead log is disabled.
+type partitionLog struct {
+	mtx  sync.Mutex
+	file *os.File
+	sync bool
+}
+
+func (l *partitionLog) append(rec *walRecord) error {
+	if l == nil {
+		return nil
+	}
+	data, err := msgpack.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	// A single write call, a crash cannot interleave the records.
+	if _, err = l.file.Write(buf); err != nil {
+		return err
+	}
+	if l.sync {
+		return l.file.Sync()
+	}
+	return nil
+}
+
+func (l *partitionLog) put(name string, vdata *storage.VData) error {
+	return l.append(&walRecord{
+		Op:        walPut,
+		DMap:      name,
+		Key:       vdata.Key,
+		Value:     vdata.Value,
+		Timestamp: vdata.Timestamp,
+		TTL:       vdata.TTL,
+		Deadline:  vdata.Deadline,
+	})
+}
+
+func (l *partitionLog) delete(name, key string) error {
+	return l.append(&walRecord{
+		Op:   walDelete,
+		DMap: name,
+		Key:  key,
+	})
+}
+
+func (l *partitionLog) expire(name, key string, timestamp, ttl int64) error {
+	return l.append(&walRecord{
+		Op:        walExpire,
+		DMap:      name,
+		Key:       key,
+		Timestamp: timestamp,
+		TTL:       ttl,
+	})
+}
+
+func (l *partitionLog) drop(name string) error {
+	return l.append(&walRecord{
+		Op:   walDrop,
+		DMap: name,
+	})
+}
+
+// writeAheadLog keeps the logs of the partitions. See config.WALDir.
+type writeAheadLog struct {
+	mtx  sync.Mutex
+	dir  string
+	sync bool
+	logs map[string]*partitionLog
+}
+
+func newWriteAheadLog(c *config.Config) *writeAheadLog {
+	return &writeAheadLog{
+		dir:  c.WALDir,
+		sync: c.WALSyncMode == config.WALSyncAlways,
+		logs: make(map[string]*partitionLog),
+	}
+}
+
+func (w *writeAheadLog) path(part *partition) string {
+	kind := "primary"
+	if part.backup {
+		kind = "backup"
+	}
+	return filepath.Join(w.dir, fmt.Sprintf("%s-%d.wal", kind, part.id))
+}
+
+// open returns the log of the partition. The file is opened on the first call.
+func (w *writeAheadLog) open(part *partition) (*partitionLog, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	path := w.path(part)
+	if l, ok := w.logs[path]; ok {
+		return l, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &partitionLog{
+		file: f,
+		sync: w.sync,
+	}
+	w.logs[path] = l
+	return l, nil
+}
+
+func (w *writeAheadLog) close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	var result error
+	for path, l := range w.logs {
+		if err := l.file.Close(); err != nil {
+			result = multierror.Append(result, err)
+		}
+		delete(w.logs, path)
+	}
+	return result
+}
+
+// applyWALRecord applies a record to the storage. The target partition of
+// a key is calculated again, the partition count may be changed.
+func (db *Olric) applyWALRecord(part *partition, rec *walRecord) error {
+	if rec.Op == walDrop {
+		part.m.Delete(rec.DMap)
+		return nil
+	}
+
+	hkey := db.getHKey(rec.DMap, rec.Key)
+	if part.backup {
+		part = db.getBackupPartition(hkey)
+	} else {
+		part = db.getPartition(hkey)
+	}
+	tmp, ok := part.m.Load(rec.DMap)
+	if !ok {
+		if rec.Op != walPut {
+			return nil
+		}
+		var err error
+		tmp, err = db.createDMap(part, rec.DMap, nil)
+		if err != nil {
+			return err
+		}
+	}
+	dm := tmp.(*dmap)
+	dm.Lock()
+	defer dm.Unlock()
+
+	var err error
+	switch rec.Op {
+	case walPut:
+		err = dm.storage.Put(hkey, &storage.VData{
+			Key:       rec.Key,
+			Value:     rec.Value,
+			Timestamp: rec.Timestamp,
+			TTL:       rec.TTL,
+			Deadline:  rec.Deadline,
+		})
+		if err == nil && dm.index != nil {
+			dm.index.Insert(db.normalizeKey(rec.Key), hkey)
+		}
+	case walDelete:
+		err = dm.storage.Delete(hkey)
+		if err == nil && dm.index != nil {
+			dm.index.Delete(db.normalizeKey(rec.Key))
+		}
+	case walExpire:
+		err = dm.storage.UpdateTTL(hkey, &storage.VData{
+			Timestamp: rec.Timestamp,
+			TTL:       rec.TTL,
+		})
+		if err == storage.ErrKeyNotFound {
+			err = nil
+		}
+	default:
+		return fmt.Errorf("unknown operation in write-ahead log: %d", rec.Op)
+	}
+	if err == storage.ErrFragmented {
+		db.wg.Add(1)
+		go db.compactTables(dm)
+		err = nil
+	}
+	return err
+}
+
+// replayPartitionLog loads the log of a partition. A torn record at the end,
+// written during a crash, is ignored.
+func (db *Olric) replayPartitionLog(w *writeAheadLog, part *partition) error {
+	f, err := os.Open(w.path(part))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var header [4]byte
+	for {
+		_, err = io.ReadFull(r, header[:])
+		if err == io.EOF {
+			return nil
+		}
+		var data []byte
+		if err == nil {
+			data = make([]byte, binary.BigEndian.Uint32(header[:]))
+			_, err = io.ReadFull(r, data)
+		}
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			db.log.V(2).Printf("[WARN] Torn record at the end of write-ahead log: %s", f.Name())
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rec := &walRecord{}
+		if err = msgpack.Unmarshal(data, rec); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("corrupted write-ahead log: %s", f.Name()))
+		}
+		if err = db.applyWALRecord(part, rec); err != nil {
+			return err
+		}
+	}
+}
+
+// checkpointPartitionLog replaces the log of a partition with the keys in it.
+func (db *Olric) checkpointPartitionLog(w *writeAheadLog, part *partition) error {
+	path := w.path(part)
+	if part.length() == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	l := &partitionLog{file: f}
+
+	part.m.Range(func(name, item interface{}) bool {
+		dm := item.(*dmap)
+		dm.RLock()
+		dm.storage.Range(func(hkey uint64, vdata *storage.VData) bool {
+			if isKeyExpired(vdata.TTL) {
+				return true
+			}
+			err = l.put(name.(string), vdata)
+			return err == nil
+		})
+		dm.RUnlock()
+		return err == nil
+	})
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// openWAL replays the write-ahead logs to reconstruct the partitions, compacts
+// them and attaches them to the DMaps. It's called by New before joining the
+// cluster. The partitions which belong to the other members after joining are
+// moved by the rebalancer.
+func (db *Olric) openWAL() error {
+	w := newWriteAheadLog(db.config)
+	if err := os.MkdirAll(w.dir, 0700); err != nil {
+		return err
+	}
+
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		for _, part := range []*partition{db.partitions[partID], db.backups[partID]} {
+			if err := db.replayPartitionLog(w, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	for partID := uint64(0); partID < db.config.PartitionCount; partID++ {
+		for _, part := range []*partition{db.partitions[partID], db.backups[partID]} {
+			if err := db.checkpointPartitionLog(w, part); err != nil {
+				return err
+			}
+			var err error
+			part.m.Range(func(_, dm interface{}) bool {
+				dm.(*dmap).wal, err = w.open(part)
+				return err == nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// The DMaps created from now on log their writes.
+	db.wal = w
+	return nil
+}
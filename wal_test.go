@@ -0,0 +1,241 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWAL_Replay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olric-wal")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := func() *Olric {
+		c := testSingleReplicaConfig()
+		c.WALDir = dir
+		db, err := newDB(c)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		return db
+	}
+	stop := func(db *Olric) {
+		err := db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}
+
+	db := start()
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		err = dm.Delete(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = dm.Expire(bkey(10), time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	stop(db)
+	<-time.After(5 * time.Millisecond)
+
+	// Restart twice. The second one replays the compacted logs.
+	for n := 0; n < 2; n++ {
+		db = start()
+		dm, err = db.NewDMap("mymap")
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		for i := 0; i < 11; i++ {
+			_, err = dm.Get(bkey(i))
+			if err != ErrKeyNotFound {
+				t.Fatalf("Expected ErrKeyNotFound for %s. Got: %v", bkey(i), err)
+			}
+		}
+		for i := 11; i < 100; i++ {
+			value, err := dm.Get(bkey(i))
+			if err != nil {
+				t.Fatalf("Expected nil. Got: %v", err)
+			}
+			if !bytes.Equal(value.([]byte), bval(i)) {
+				t.Fatalf("Value is different for key: %s", bkey(i))
+			}
+		}
+		stop(db)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("Expected no temporary files. Got: %v", files)
+	}
+}
+
+func TestWAL_TornRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olric-wal")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := testSingleReplicaConfig()
+	c.WALDir = dir
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = dm.Put("mykey", "myvalue")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	err = db.Shutdown(context.Background())
+	if err != nil {
+		db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+	}
+
+	// Simulate a crash in the middle of a write.
+	files, err := filepath.Glob(filepath.Join(dir, "primary-*.wal"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one log file. Got: %v, %v", files, err)
+	}
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	_, err = f.Write([]byte{0, 0, 1, 0, 1, 2})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	c = testSingleReplicaConfig()
+	c.WALDir = dir
+	db, err = newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	dm, err = db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	value, err := dm.Get("mykey")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if value.(string) != "myvalue" {
+		t.Fatalf("Expected myvalue. Got: %v", value)
+	}
+}
+
+func TestWAL_ReplaceAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olric-wal")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := testSingleReplicaConfig()
+	c.WALDir = dir
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	dm, err := db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = dm.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	entries := make(map[string]interface{})
+	for i := 50; i < 150; i++ {
+		entries[bkey(i)] = []byte("new")
+	}
+	if err = dm.ReplaceAll(entries); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if err = db.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	c = testSingleReplicaConfig()
+	c.WALDir = dir
+	db, err = newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+	dm, err = db.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		_, err = dm.Get(bkey(i))
+		if err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound for %s. Got: %v", bkey(i), err)
+		}
+	}
+	for i := 50; i < 150; i++ {
+		value, err := dm.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(value.([]byte), []byte("new")) {
+			t.Fatalf("Expected the new value for %s. Got: %s", bkey(i), string(value.([]byte)))
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/buraksezer/olric/internal/protocol"
+	"github.com/buraksezer/olric/internal/transport"
+)
+
+func TestWireCompression(t *testing.T) {
+	c := testSingleReplicaConfig()
+	c.WireCompression = true
+	db, err := newDB(c)
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	defer func() {
+		err = db.Shutdown(context.Background())
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+		}
+	}()
+
+	value := bytes.Repeat([]byte("olric"), 1000)
+	for i := 0; i < 10; i++ {
+		req := &protocol.Message{
+			DMap:  "mymap",
+			Key:   bkey(i),
+			Value: value,
+			Extra: protocol.PutExtra{Timestamp: time.Now().UnixNano()},
+		}
+		_, err = db.requestTo(db.this.String(), protocol.OpPut, req)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		req := &protocol.Message{
+			DMap: "mymap",
+			Key:  bkey(i),
+		}
+		resp, err := db.requestTo(db.this.String(), protocol.OpGet, req)
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !bytes.Equal(resp.Value, value) {
+			t.Fatalf("Value is different for key: %s", bkey(i))
+		}
+	}
+	if !db.client.Stats()[db.this.String()].Compressed {
+		t.Fatalf("Expected a compressed connection")
+	}
+
+	// A client without WireCompression is served as usual.
+	cc := transport.NewClient(&transport.ClientConfig{MaxConn: 1})
+	defer cc.Close()
+	resp, err := cc.RequestTo(db.this.String(), protocol.OpGet, &protocol.Message{
+		DMap: "mymap",
+		Key:  bkey(0),
+	})
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !bytes.Equal(resp.Value, value) {
+		t.Fatalf("Value is different for key: %s", bkey(0))
+	}
+	if cc.Stats()[db.this.String()].Compressed {
+		t.Fatalf("Expected an uncompressed connection")
+	}
+}
+
+func BenchmarkWireCompression(b *testing.B) {
+	bench := func(b *testing.B, compress bool) {
+		c := testSingleReplicaConfig()
+		c.LogOutput = &bytes.Buffer{}
+		c.WireCompression = compress
+		db, err := newDB(c)
+		if err != nil {
+			b.Fatalf("Expected nil. Got: %v", err)
+		}
+		defer func() {
+			err = db.Shutdown(context.Background())
+			if err != nil {
+				db.log.V(2).Printf("[ERROR] Failed to shutdown Olric: %v", err)
+			}
+		}()
+
+		value := bytes.Repeat([]byte("olric"), 20)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			req := &protocol.Message{
+				DMap:  "mymap",
+				Key:   bkey(i),
+				Value: value,
+				Extra: protocol.PutExtra{Timestamp: time.Now().UnixNano()},
+			}
+			_, err = db.requestTo(db.this.String(), protocol.OpPut, req)
+			if err != nil {
+				b.Fatalf("Expected nil. Got: %v", err)
+			}
+		}
+	}
+	b.Run("uncompressed", func(b *testing.B) { bench(b, false) })
+	b.Run("compressed", func(b *testing.B) { bench(b, true) })
+}
@@ -0,0 +1,70 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/buraksezer/olric/internal/discovery"
+	"github.com/buraksezer/olric/internal/protocol"
+)
+
+// ErrWritesPaused is returned when a write operation is called while the writes
+// are paused on the cluster. See PauseWrites.
+var ErrWritesPaused = errors.New("writes are paused")
+
+func (db *Olric) setWritesPaused(paused bool) error {
+	if err := db.checkOperationStatus(); err != nil {
+		return err
+	}
+	value := []byte{0}
+	if paused {
+		value[0] = 1
+	}
+	return db.fanout(db.discovery.GetMembers(), func(member discovery.Member) error {
+		addr := member.String()
+		req := &protocol.Message{
+			Value: value,
+		}
+		_, err := db.requestTo(addr, protocol.OpSetWritesPaused, req)
+		if err != nil {
+			db.log.V(2).Printf("[ERROR] Failed to set paused state of writes on %s: %v", addr, err)
+		}
+		return err
+	})
+}
+
+// PauseWrites rejects the write operations on all the DMaps with ErrWritesPaused
+// on all the members. Get, Keys and the other read operations are still allowed.
+// It gives a quiescent point to take a backup. The members which join the
+// cluster during the pause get the state from the coordinator. It's thread-safe.
+func (db *Olric) PauseWrites() error {
+	return db.setWritesPaused(true)
+}
+
+// ResumeWrites allows the write operations again. See PauseWrites. It's thread-safe.
+func (db *Olric) ResumeWrites() error {
+	return db.setWritesPaused(false)
+}
+
+func (db *Olric) setWritesPausedOperation(req *protocol.Message) *protocol.Message {
+	var paused int32
+	if len(req.Value) == 1 && req.Value[0] == 1 {
+		paused = 1
+	}
+	atomic.StoreInt32(&db.writesPaused, paused)
+	return req.Success()
+}
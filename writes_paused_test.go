@@ -0,0 +1,101 @@
+// Copyright 2018-2019 Burak Sezer
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package olric
+
+import (
+	"testing"
+)
+
+func TestPauseWrites(t *testing.T) {
+	c := newTestCluster(nil)
+	defer c.teardown()
+
+	db1, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	db2, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	dm1, err := db1.NewDMap("mymap")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm1.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+	err = db1.PauseWrites()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+
+	for _, db := range []*Olric{db1, db2} {
+		s, err := db.Stats()
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+		if !s.WritesPaused {
+			t.Fatalf("Expected WritesPaused to be true on %s", db.this)
+		}
+	}
+
+	dm2, err := db2.NewDMap("other")
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm2.Put(bkey(i), bval(i))
+		if err != ErrWritesPaused {
+			t.Fatalf("Expected ErrWritesPaused. Got: %v", err)
+		}
+		err = dm1.Delete(bkey(i))
+		if err != ErrWritesPaused {
+			t.Fatalf("Expected ErrWritesPaused. Got: %v", err)
+		}
+		_, err = dm1.Get(bkey(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+
+	// A member which joins during the pause gets the state from the coordinator.
+	db3, err := c.newDB()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	s, err := db3.Stats()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	if !s.WritesPaused {
+		t.Fatalf("Expected WritesPaused to be true on the new member")
+	}
+
+	err = db2.ResumeWrites()
+	if err != nil {
+		t.Fatalf("Expected nil. Got: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		err = dm2.Put(bkey(i), bval(i))
+		if err != nil {
+			t.Fatalf("Expected nil. Got: %v", err)
+		}
+	}
+}